@@ -0,0 +1,60 @@
+package saml2aws
+
+import (
+	"context"
+	"sync"
+
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// DefaultAssumeConcurrency the number of roles AssumeRolesWithSAML assumes at once
+const DefaultAssumeConcurrency = 4
+
+// RoleResult the outcome of assuming one of the roles
+type RoleResult struct {
+	Role        *AWSRole
+	Credentials *awsconfig.AWSCredentials
+	Err         error
+}
+
+// AssumeRolesWithSAML exchange the SAML assertion for credentials for each of the roles, assuming up to concurrency
+// of them at once
+//
+// A role which can't be assumed doesn't stop the others. Roles already marked Unavailable aren't sent to STS, their
+// result is ErrRoleUnavailable, and roles STS refuses because their AWS account is suspended or closed are marked
+// Unavailable. The results are in the same order as the roles.
+func AssumeRolesWithSAML(ctx context.Context, account *cfg.IDPAccount, roles []*AWSRole, samlAssertion string, concurrency int) []RoleResult {
+
+	if concurrency <= 0 {
+		concurrency = DefaultAssumeConcurrency
+	}
+
+	results := make([]RoleResult, len(roles))
+
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i, role := range roles {
+		wg.Add(1)
+
+		go func(result *RoleResult, role *AWSRole) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result.Role = role
+			if role.Unavailable {
+				result.Err = ErrRoleUnavailable
+				return
+			}
+			result.Credentials, result.Err = AssumeRoleWithSAML(ctx, account, role, samlAssertion)
+		}(&results[i], role)
+	}
+
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,66 @@
+package saml2aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestAssumeRolesWithSAML(t *testing.T) {
+	_, svc, restore := withMockClients(t)
+	defer restore()
+
+	svc.roleErrors = map[string]error{"arn:aws:iam::456456456456:role/Admin": errors.New("AccessDenied")}
+
+	roles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::123123123123:role/Admin", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/idp"},
+		{RoleARN: "arn:aws:iam::456456456456:role/Admin", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/idp"},
+		{RoleARN: "arn:aws:iam::789789789789:role/ReadOnly", PrincipalARN: "arn:aws:iam::789789789789:saml-provider/idp"},
+		{RoleARN: "arn:aws:iam::789789789789:role/Deploy"},
+	}
+
+	account := cfg.NewIDPAccount()
+
+	results := AssumeRolesWithSAML(context.Background(), account, roles, "assertion", 2)
+	assert.Len(t, results, 4)
+
+	for i, result := range results {
+		assert.Equal(t, roles[i], result.Role)
+	}
+
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, "ASIAEXAMPLE", results[0].Credentials.AWSAccessKey)
+	assert.Error(t, results[1].Err)
+	assert.Nil(t, results[1].Credentials)
+	assert.Nil(t, results[2].Err)
+	assert.EqualError(t, results[3].Err, "unable to determine the principal ARN for role: arn:aws:iam::789789789789:role/Deploy")
+}
+
+func TestAssumeRolesWithSAMLUnavailable(t *testing.T) {
+	_, svc, restore := withMockClients(t)
+	defer restore()
+
+	svc.roleErrors = map[string]error{
+		"arn:aws:iam::456456456456:role/Admin": awserr.New("AccessDenied", "The AWS account 456456456456 is suspended", nil),
+	}
+
+	roles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::123123123123:role/Admin", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/idp", Unavailable: true},
+		{RoleARN: "arn:aws:iam::456456456456:role/Admin", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/idp"},
+		{RoleARN: "arn:aws:iam::789789789789:role/ReadOnly", PrincipalARN: "arn:aws:iam::789789789789:saml-provider/idp"},
+	}
+
+	results := AssumeRolesWithSAML(context.Background(), cfg.NewIDPAccount(), roles, "assertion", 2)
+	assert.Len(t, results, 3)
+
+	// the role already known to be unavailable isn't sent to STS
+	assert.Equal(t, ErrRoleUnavailable, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.True(t, roles[1].Unavailable)
+	assert.Nil(t, results[2].Err)
+	assert.False(t, roles[2].Unavailable)
+}
@@ -0,0 +1,114 @@
+package saml2aws
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// ParseRoles the AWS roles offered by a decoded SAML assertion, this only reads the assertion so nothing is sent to
+// the IdP or AWS
+//
+// Roles repeated in the assertion are returned once. The Name of each role is left empty, it is only known from the
+// AWS signin page.
+func ParseRoles(assertionXML []byte) ([]AWSRole, error) {
+
+	roles, err := ExtractAwsRoles(assertionXML)
+	if err != nil {
+		return nil, err
+	}
+
+	awsRoles, err := ParseAWSRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AWSRole, len(awsRoles))
+	for i, awsRole := range awsRoles {
+		result[i] = *awsRole
+	}
+
+	return result, nil
+}
+
+// ParseSessionDuration the SessionDuration attribute of a decoded SAML assertion in seconds, zero when the IdP
+// doesn't send one
+func ParseSessionDuration(assertionXML []byte) (int, error) {
+
+	duration, err := ExtractSessionDuration(assertionXML)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(duration), nil
+}
+
+// AssertionSummary the parts of a SAML assertion which decide whether AWS accepts it, used to debug the attribute
+// mapping of the IdP
+type AssertionSummary struct {
+	Issuer          string
+	Subject         string
+	Destination     string
+	Audiences       []string
+	NotBefore       string
+	NotOnOrAfter    string
+	SessionDuration int
+	RoleSessionName string
+	Roles           []AWSRole
+}
+
+// SummarizeAssertion summarize a decoded SAML assertion, the values the IdP didn't send are left empty
+func SummarizeAssertion(assertionXML []byte) (*AssertionSummary, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(assertionXML); err != nil {
+		return nil, err
+	}
+
+	assertionElement := doc.FindElement(".//Assertion")
+	if assertionElement == nil {
+		return nil, ErrMissingAssertion
+	}
+
+	summary := &AssertionSummary{}
+
+	if issuer := assertionElement.FindElement("./Issuer"); issuer != nil {
+		summary.Issuer = strings.TrimSpace(issuer.Text())
+	}
+
+	if nameID := assertionElement.FindElement("./Subject/NameID"); nameID != nil {
+		summary.Subject = strings.TrimSpace(nameID.Text())
+	}
+
+	if root := doc.Root(); root != nil && root.Tag == responseTag {
+		summary.Destination = root.SelectAttrValue(destinationAttr, "")
+	}
+
+	if conditions := assertionElement.FindElement("./Conditions"); conditions != nil {
+		summary.NotBefore = conditions.SelectAttrValue("NotBefore", "")
+		summary.NotOnOrAfter = conditions.SelectAttrValue("NotOnOrAfter", "")
+
+		for _, audience := range conditions.FindElements("./AudienceRestriction/Audience") {
+			summary.Audiences = append(summary.Audiences, strings.TrimSpace(audience.Text()))
+		}
+	}
+
+	for _, attribute := range assertionElement.FindElements("./AttributeStatement/Attribute[@Name='https://aws.amazon.com/SAML/Attributes/RoleSessionName']") {
+		if value := attribute.FindElement("./AttributeValue"); value != nil {
+			summary.RoleSessionName = strings.TrimSpace(value.Text())
+		}
+	}
+
+	// an invalid SessionDuration is left for the summary to show as missing, login warns about it
+	duration, err := ExtractSessionDuration(assertionXML)
+	if err == nil {
+		summary.SessionDuration = int(duration)
+	}
+
+	summary.Roles, err = ParseRoles(assertionXML)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,91 @@
+package saml2aws
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRolesMultiAccount(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_multi_account.xml")
+	assert.Nil(t, err)
+
+	roles, err := ParseRoles(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []AWSRole{
+		{RoleARN: "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS"},
+		{RoleARN: "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS"},
+		{RoleARN: "arn:aws:iam::456456456456:role/ReadOnly", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/ExampleADFS"},
+	}, roles)
+
+	duration, err := ParseSessionDuration(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 43200, duration)
+}
+
+func TestParseRolesOtherAttributes(t *testing.T) {
+	// attributes other than the AWS ones are ignored
+	data, err := ioutil.ReadFile("testdata/assertion_pingfed.xml")
+	assert.Nil(t, err)
+
+	roles, err := ParseRoles(data)
+	assert.Nil(t, err)
+	assert.Len(t, roles, 5)
+	assert.Equal(t, AWSRole{RoleARN: "arn:aws:iam::456456456456:role/admin", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp"}, roles[0])
+	assert.Equal(t, AWSRole{RoleARN: "arn:aws:iam::123123123123:role/admin", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/example-idp"}, roles[4])
+
+	duration, err := ParseSessionDuration(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, duration)
+}
+
+func TestParseRolesMalformed(t *testing.T) {
+	tests := map[string]string{
+		"not xml":      "this is not xml",
+		"no assertion": `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"></samlp:Response>`,
+		"no attributes": `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+<Assertion xmlns="urn:oasis:names:tc:SAML:2.0:assertion"></Assertion></samlp:Response>`,
+		"bad role": `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+<Assertion xmlns="urn:oasis:names:tc:SAML:2.0:assertion"><AttributeStatement>
+<Attribute Name="https://aws.amazon.com/SAML/Attributes/Role"><AttributeValue>arn:aws:iam::123123123123:role/NoPrincipal</AttributeValue></Attribute>
+</AttributeStatement></Assertion></samlp:Response>`,
+	}
+
+	for name, assertion := range tests {
+		_, err := ParseRoles([]byte(assertion))
+		assert.Error(t, err, name)
+	}
+
+	_, err := ParseSessionDuration([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+<Assertion xmlns="urn:oasis:names:tc:SAML:2.0:assertion"><AttributeStatement>
+<Attribute Name="https://aws.amazon.com/SAML/Attributes/SessionDuration"><AttributeValue>an hour</AttributeValue></Attribute>
+</AttributeStatement></Assertion></samlp:Response>`))
+	assert.Equal(t, ErrInvalidSessionDuration{Value: "an hour"}, err)
+}
+
+func TestSummarizeAssertion(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_multi_account.xml")
+	assert.Nil(t, err)
+
+	summary, err := SummarizeAssertion(data)
+	assert.Nil(t, err)
+	assert.Equal(t, &AssertionSummary{
+		Issuer:          "http://id.example.com/adfs/services/trust",
+		Subject:         `EXAMPLE\wolfeidau`,
+		Destination:     "https://signin.aws.amazon.com/saml",
+		Audiences:       []string{"urn:amazon:webservices"},
+		NotBefore:       "2016-09-10T02:54:39.371Z",
+		NotOnOrAfter:    "2016-09-10T03:54:39.371Z",
+		SessionDuration: 43200,
+		RoleSessionName: "wolfeidau@example.com",
+		Roles: []AWSRole{
+			{RoleARN: "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS"},
+			{RoleARN: "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS"},
+			{RoleARN: "arn:aws:iam::456456456456:role/ReadOnly", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/ExampleADFS"},
+		},
+	}, summary)
+
+	_, err = SummarizeAssertion([]byte("<Response/>"))
+	assert.Equal(t, ErrMissingAssertion, err)
+}
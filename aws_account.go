@@ -2,17 +2,46 @@ package saml2aws
 
 import (
 	"bytes"
+	"encoding/base64"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"fmt"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
-const awsURL = "https://signin.aws.amazon.com/saml"
+// DefaultSigninEndpoint the AWS SAML signin endpoint used in the standard partition
+const DefaultSigninEndpoint = "https://signin.aws.amazon.com/saml"
+
+// signinEndpoints the AWS SAML signin endpoint for each partition
+var signinEndpoints = map[string]string{
+	endpoints.AwsPartitionID:      DefaultSigninEndpoint,
+	endpoints.AwsCnPartitionID:    "https://signin.amazonaws.cn/saml",
+	endpoints.AwsUsGovPartitionID: "https://signin.amazonaws-us-gov.com/saml",
+}
+
+// SigninEndpoint the AWS SAML signin endpoint for the account, this uses the explicit override if
+// one is configured otherwise it is derived from the partition of the account's region
+func SigninEndpoint(account *cfg.IDPAccount) string {
+	if account.SAMLSigninEndpoint != "" {
+		return account.SAMLSigninEndpoint
+	}
+
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), account.Region); ok {
+		if endpoint, ok := signinEndpoints[p.ID()]; ok {
+			return endpoint
+		}
+	}
+
+	return DefaultSigninEndpoint
+}
 
 // AWSAccount holds the AWS account name and roles
 type AWSAccount struct {
@@ -20,20 +49,99 @@ type AWSAccount struct {
 	Roles []*AWSRole
 }
 
-// ParseAWSAccounts extract the aws accounts from the saml assertion
-func ParseAWSAccounts(samlAssertion string) ([]*AWSAccount, error) {
+// ErrNotRoleSelectionPage returned when the AWS signin response isn't the role selection page
+var ErrNotRoleSelectionPage = errors.New("response is not the AWS role selection page")
+
+// ParseAWSAccounts extract the aws accounts from the saml assertion, posting it to the signin endpoint of the account
+func ParseAWSAccounts(account *cfg.IDPAccount, samlAssertion string) ([]*AWSAccount, error) {
+
+	data, err := fetchSigninPage(account, samlAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	return ExtractAWSAccounts(data)
+}
+
+// ParseAWSRolesFromSigninPage post the saml assertion to the signin endpoint of the account and extract the roles from
+// the role selection page, each role is assigned the SAML provider of its account from the assertion
+func ParseAWSRolesFromSigninPage(account *cfg.IDPAccount, samlAssertion string) ([]*AWSRole, error) {
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	providers, err := ExtractSAMLProviders(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing saml providers")
+	}
+
+	page, err := fetchSigninPage(account, samlAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	awsRoles, err := ExtractAWSRolesFromSigninPage(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return AssignProviderPrincipals(awsRoles, providers), nil
+}
+
+// fetchSigninPage post the saml assertion to the signin endpoint, returning the body of the role selection page
+//
+// The proxy and CA bundle of the account are used, as the signin endpoint is reached the same way as the IdP.
+func fetchSigninPage(account *cfg.IDPAccount, samlAssertion string) ([]byte, error) {
 
-	res, err := http.PostForm(awsURL, url.Values{"SAMLResponse": {samlAssertion}})
+	client := &http.Client{Transport: provider.NewAWSTransport(account)}
+
+	res, err := client.PostForm(SigninEndpoint(account), url.Values{"SAMLResponse": {samlAssertion}})
 	if err != nil {
 		return nil, errors.Wrap(err, "error retrieving AWS login form")
 	}
+	defer res.Body.Close()
 
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "error retrieving AWS login body")
 	}
 
-	return ExtractAWSAccounts(data)
+	return data, nil
+}
+
+// IsRoleSelectionPage check if the document is the AWS signin role selection page
+func IsRoleSelectionPage(doc *goquery.Document) bool {
+	return doc.Find("form#saml_form fieldset div.saml-account").Size() > 0
+}
+
+// ExtractAWSRolesFromSigninPage extract the roles listed on the AWS signin role selection page
+//
+// The page only lists role ARNs, so the returned roles don't have a PrincipalARN assigned, AssignProviderPrincipals
+// assigns them from the assertion.
+func ExtractAWSRolesFromSigninPage(data []byte) ([]*AWSRole, error) {
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build document from response")
+	}
+
+	if !IsRoleSelectionPage(doc) {
+		return nil, ErrNotRoleSelectionPage
+	}
+
+	awsAccounts, err := ExtractAWSAccounts(data)
+	if err != nil {
+		return nil, err
+	}
+
+	awsRoles := []*AWSRole{}
+	for _, awsAccount := range awsAccounts {
+		awsRoles = append(awsRoles, awsAccount.Roles...)
+	}
+
+	return awsRoles, nil
 }
 
 // ExtractAWSAccounts extract the accounts from the AWS html page
@@ -60,22 +168,47 @@ func ExtractAWSAccounts(data []byte) ([]*AWSAccount, error) {
 	return accounts, nil
 }
 
-// AssignPrincipals assign principal from roles
+// AssignPrincipals assign principal from roles, along with whether the role is unavailable
 func AssignPrincipals(awsRoles []*AWSRole, awsAccounts []*AWSAccount) {
 
-	awsPrincipalARNs := make(map[string]string)
+	rolesByARN := make(map[string]*AWSRole)
 	for _, awsRole := range awsRoles {
-		awsPrincipalARNs[awsRole.RoleARN] = awsRole.PrincipalARN
+		rolesByARN[awsRole.RoleARN] = awsRole
 	}
 
 	for _, awsAccount := range awsAccounts {
 		for _, awsRole := range awsAccount.Roles {
-			awsRole.PrincipalARN = awsPrincipalARNs[awsRole.RoleARN]
+			role, ok := rolesByARN[awsRole.RoleARN]
+			if !ok {
+				awsRole.PrincipalARN = ""
+				continue
+			}
+			awsRole.PrincipalARN = role.PrincipalARN
+			awsRole.Unavailable = role.Unavailable
 		}
 	}
 
 }
 
+// AssignProviderPrincipals assign each role the SAML provider of its account, from ExtractSAMLProviders, roles of
+// accounts without a provider can't be assumed so they are left out
+func AssignProviderPrincipals(awsRoles []*AWSRole, providers map[string]string) []*AWSRole {
+
+	assigned := []*AWSRole{}
+
+	for _, awsRole := range awsRoles {
+		principalARN, ok := providers[arnAccountID(awsRole.RoleARN)]
+		if !ok {
+			continue
+		}
+
+		awsRole.PrincipalARN = principalARN
+		assigned = append(assigned, awsRole)
+	}
+
+	return assigned
+}
+
 // LocateRole locate role by name
 func LocateRole(awsRoles []*AWSRole, roleName string) (*AWSRole, error) {
 	for _, awsRole := range awsRoles {
@@ -86,3 +219,69 @@ func LocateRole(awsRoles []*AWSRole, roleName string) (*AWSRole, error) {
 
 	return nil, fmt.Errorf("Supplied RoleArn not found in saml assertion: %s", roleName)
 }
+
+// LocatePreferredRole locate the first role of the account's role_arns, or its role_arn, which is in the roles,
+// roles marked unavailable are passed over
+func LocatePreferredRole(awsRoles []*AWSRole, account *cfg.IDPAccount) (*AWSRole, bool) {
+	var available []string
+	for _, awsRole := range awsRoles {
+		if !awsRole.Unavailable {
+			available = append(available, awsRole.RoleARN)
+		}
+	}
+
+	roleARN, ok := account.PreferredRole(available)
+	if !ok {
+		return nil, false
+	}
+
+	for _, awsRole := range awsRoles {
+		if awsRole.RoleARN == roleARN {
+			return awsRole, true
+		}
+	}
+
+	return nil, false
+}
+
+// FilterAWSAccounts narrow the accounts and their roles to those matching the supplied filters
+//
+// Filters are case insensitive substring matches, the account filter is checked against the account
+// name and the role filter against the role ARN. Empty filters match everything, accounts left
+// without any roles are dropped.
+func FilterAWSAccounts(awsAccounts []*AWSAccount, accountFilter, roleFilter string) []*AWSAccount {
+	accountFilter = strings.ToLower(accountFilter)
+	roleFilter = strings.ToLower(roleFilter)
+
+	filtered := []*AWSAccount{}
+
+	for _, awsAccount := range awsAccounts {
+		if !strings.Contains(strings.ToLower(awsAccount.Name), accountFilter) {
+			continue
+		}
+
+		roles := []*AWSRole{}
+		for _, awsRole := range awsAccount.Roles {
+			if strings.Contains(strings.ToLower(awsRole.RoleARN), roleFilter) {
+				roles = append(roles, awsRole)
+			}
+		}
+
+		if len(roles) == 0 {
+			continue
+		}
+
+		filtered = append(filtered, &AWSAccount{Name: awsAccount.Name, Roles: roles})
+	}
+
+	return filtered
+}
+
+// CountRoles count the roles across all the supplied accounts
+func CountRoles(awsAccounts []*AWSAccount) int {
+	var count int
+	for _, awsAccount := range awsAccounts {
+		count += len(awsAccount.Roles)
+	}
+	return count
+}
@@ -1,10 +1,14 @@
 package saml2aws
 
 import (
+	"encoding/base64"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/cfg"
 )
 
 func TestExtractAWSAccounts(t *testing.T) {
@@ -35,11 +39,35 @@ func TestExtractAWSAccounts(t *testing.T) {
 	assert.Equal(t, role.Name, "Production")
 }
 
+func TestExtractAWSRolesFromSigninPage(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/role_selection.html")
+	assert.Nil(t, err)
+
+	roles, err := ExtractAWSRolesFromSigninPage(data)
+	assert.Nil(t, err)
+	assert.Len(t, roles, 3)
+
+	assert.Equal(t, "arn:aws:iam::111111111111:role/ReadOnly", roles[0].RoleARN)
+	assert.Equal(t, "ReadOnly", roles[0].Name)
+	assert.Equal(t, "arn:aws:iam::222222222222:role/Admin", roles[1].RoleARN)
+	assert.Equal(t, "arn:aws:iam::222222222222:role/Developer", roles[2].RoleARN)
+}
+
+func TestExtractAWSRolesFromSigninPageNotRoleSelection(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	roles, err := ExtractAWSRolesFromSigninPage(data)
+	assert.Equal(t, ErrNotRoleSelectionPage, err)
+	assert.Nil(t, roles)
+}
+
 func TestAssignPrincipals(t *testing.T) {
 	awsRoles := []*AWSRole{
 		{
 			PrincipalARN: "arn:aws:iam::000000000001:saml-provider/test-idp",
 			RoleARN:      "arn:aws:iam::000000000001:role/Development",
+			Unavailable:  true,
 		},
 	}
 
@@ -56,6 +84,7 @@ func TestAssignPrincipals(t *testing.T) {
 	AssignPrincipals(awsRoles, awsAccounts)
 
 	assert.Equal(t, "arn:aws:iam::000000000001:saml-provider/test-idp", awsAccounts[0].Roles[0].PrincipalARN)
+	assert.True(t, awsAccounts[0].Roles[0].Unavailable)
 }
 
 func TestLocateRole(t *testing.T) {
@@ -76,3 +105,163 @@ func TestLocateRole(t *testing.T) {
 
 	assert.Equal(t, "arn:aws:iam::000000000001:role/Development", role.RoleARN)
 }
+
+func TestLocatePreferredRole(t *testing.T) {
+	awsRoles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::000000000001:role/Development"},
+		{RoleARN: "arn:aws:iam::000000000002:role/Development"},
+		{RoleARN: "arn:aws:iam::000000000003:role/Development"},
+	}
+
+	account := cfg.NewIDPAccount()
+	account.RoleARNs = []string{
+		"arn:aws:iam::000000000009:role/Development",
+		"arn:aws:iam::000000000002:role/Development",
+		"arn:aws:iam::000000000001:role/Development",
+	}
+
+	role, ok := LocatePreferredRole(awsRoles, account)
+	assert.True(t, ok)
+	assert.Equal(t, awsRoles[1], role)
+
+	// unavailable roles are passed over for the next preference
+	awsRoles[1].Unavailable = true
+
+	role, ok = LocatePreferredRole(awsRoles, account)
+	assert.True(t, ok)
+	assert.Equal(t, awsRoles[0], role)
+
+	account.RoleARNs = []string{"arn:aws:iam::000000000009:role/Development"}
+
+	_, ok = LocatePreferredRole(awsRoles, account)
+	assert.False(t, ok)
+}
+
+func TestFilterAWSAccounts(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/saml.html")
+	assert.Nil(t, err)
+
+	accounts, err := ExtractAWSAccounts(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, CountRoles(accounts))
+
+	filtered := FilterAWSAccounts(accounts, "", "")
+	assert.Equal(t, 3, CountRoles(filtered))
+
+	filtered = FilterAWSAccounts(accounts, "account-alias", "")
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, 2, CountRoles(filtered))
+
+	filtered = FilterAWSAccounts(accounts, "", "production")
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, 2, CountRoles(filtered))
+
+	filtered = FilterAWSAccounts(accounts, "000000000002", "development")
+	assert.Len(t, filtered, 0)
+}
+
+func TestSigninEndpoint(t *testing.T) {
+
+	tests := []struct {
+		region   string
+		endpoint string
+	}{
+		{"", "https://signin.aws.amazon.com/saml"},
+		{"us-east-1", "https://signin.aws.amazon.com/saml"},
+		{"ap-southeast-2", "https://signin.aws.amazon.com/saml"},
+		{"cn-north-1", "https://signin.amazonaws.cn/saml"},
+		{"cn-northwest-1", "https://signin.amazonaws.cn/saml"},
+		{"us-gov-west-1", "https://signin.amazonaws-us-gov.com/saml"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.endpoint, SigninEndpoint(&cfg.IDPAccount{Region: tt.region}), tt.region)
+	}
+}
+
+func TestSigninEndpointOverride(t *testing.T) {
+
+	account := &cfg.IDPAccount{
+		Region:             "us-gov-west-1",
+		SAMLSigninEndpoint: "https://signin.example.com/saml",
+	}
+
+	assert.Equal(t, "https://signin.example.com/saml", SigninEndpoint(account))
+}
+
+// signinAccount an account whose signin endpoint is the URL
+func signinAccount(signinURL string) *cfg.IDPAccount {
+	account := cfg.NewIDPAccount()
+	account.SAMLSigninEndpoint = signinURL
+	return account
+}
+
+func TestParseAWSAccountsProxy(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/saml.html")
+	assert.Nil(t, err)
+
+	// an http proxy is sent the absolute URL of the signin endpoint
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write(data)
+	}))
+	defer proxy.Close()
+
+	account := signinAccount("http://signin.example.com/saml")
+	account.ProxyURL = proxy.URL
+
+	awsAccounts, err := ParseAWSAccounts(account, "REDACTED")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, awsAccounts)
+	assert.Equal(t, "http://signin.example.com/saml", proxied)
+}
+
+func unparsedRolesAssertion(t *testing.T) string {
+	data, err := ioutil.ReadFile("testdata/assertion_unparsed_roles.xml")
+	assert.Nil(t, err)
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestParseAWSRolesFromSigninPage(t *testing.T) {
+	page, err := ioutil.ReadFile("testdata/role_selection.html")
+	assert.Nil(t, err)
+
+	samlAssertion := unparsedRolesAssertion(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, samlAssertion, r.FormValue("SAMLResponse"))
+		w.Write(page)
+	}))
+	defer ts.Close()
+
+	// the assertion's roles are in a namespace ExtractAwsRoles doesn't look in
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	assert.Nil(t, err)
+	roles, err := ExtractAwsRoles(data)
+	assert.Nil(t, err)
+	assert.Empty(t, roles)
+
+	awsRoles, err := ParseAWSRolesFromSigninPage(signinAccount(ts.URL), samlAssertion)
+	assert.Nil(t, err)
+	assert.Len(t, awsRoles, 3)
+
+	assert.Equal(t, "arn:aws:iam::111111111111:role/ReadOnly", awsRoles[0].RoleARN)
+	assert.Equal(t, "arn:aws:iam::111111111111:saml-provider/Shibboleth", awsRoles[0].PrincipalARN)
+	assert.Equal(t, "arn:aws:iam::222222222222:role/Developer", awsRoles[2].RoleARN)
+	assert.Equal(t, "arn:aws:iam::222222222222:saml-provider/Shibboleth", awsRoles[2].PrincipalARN)
+}
+
+func TestAssignProviderPrincipals(t *testing.T) {
+	awsRoles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::111111111111:role/ReadOnly"},
+		{RoleARN: "arn:aws:iam::333333333333:role/Admin"},
+	}
+
+	assigned := AssignProviderPrincipals(awsRoles, map[string]string{"111111111111": "arn:aws:iam::111111111111:saml-provider/Shibboleth"})
+
+	// a role can't be assumed without the provider of its account
+	assert.Len(t, assigned, 1)
+	assert.Equal(t, "arn:aws:iam::111111111111:saml-provider/Shibboleth", assigned[0].PrincipalARN)
+}
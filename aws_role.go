@@ -10,24 +10,39 @@ type AWSRole struct {
 	RoleARN      string
 	PrincipalARN string
 	Name         string
+	// Unavailable STS refused the role because its AWS account is suspended or closed
+	Unavailable bool
 }
 
 // ParseAWSRoles parses and splits the roles while also validating the contents
+//
+// Some IdPs repeat a role in the assertion, only the first of each role and principal pair is kept so the roles
+// offered for selection are unique.
 func ParseAWSRoles(roles []string) ([]*AWSRole, error) {
-	awsRoles := make([]*AWSRole, len(roles))
+	awsRoles := make([]*AWSRole, 0, len(roles))
+	seen := map[AWSRole]bool{}
 
-	for i, role := range roles {
+	for _, role := range roles {
 		awsRole, err := parseRole(role)
 		if err != nil {
 			return nil, err
 		}
 
-		awsRoles[i] = awsRole
+		if seen[*awsRole] {
+			continue
+		}
+		seen[*awsRole] = true
+
+		awsRoles = append(awsRoles, awsRole)
 	}
 
 	return awsRoles, nil
 }
 
+// parseRole split the role attribute value into the role and principal ARNs
+//
+// AWS expects "roleArn,principalArn" however some IdPs emit the ARNs reversed, so each ARN
+// is identified by its resource type rather than its position.
 func parseRole(role string) (*AWSRole, error) {
 	tokens := strings.Split(role, ",")
 
@@ -38,10 +53,18 @@ func parseRole(role string) (*AWSRole, error) {
 	awsRole := &AWSRole{}
 
 	for _, token := range tokens {
-		if strings.Contains(token, ":saml-provider") {
+		token = strings.TrimSpace(token)
+
+		switch {
+		case strings.Contains(token, ":saml-provider/"):
+			if awsRole.PrincipalARN != "" {
+				return nil, fmt.Errorf("Multiple PrincipalARNs in: %s", role)
+			}
 			awsRole.PrincipalARN = token
-		}
-		if strings.Contains(token, ":role") {
+		case strings.Contains(token, ":role/"):
+			if awsRole.RoleARN != "" {
+				return nil, fmt.Errorf("Multiple RoleARNs in: %s", role)
+			}
 			awsRole.RoleARN = token
 		}
 	}
@@ -1,6 +1,7 @@
 package saml2aws
 
 import (
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,14 +16,28 @@ func TestParseRoles(t *testing.T) {
 
 	awsRoles, err := ParseAWSRoles(roles)
 
+	// the same pair in either order is one role
 	assert.Nil(t, err)
-	assert.Len(t, awsRoles, 2)
+	assert.Len(t, awsRoles, 1)
 
 	for _, awsRole := range awsRoles {
 		assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/example-idp", awsRole.PrincipalARN)
 		assert.Equal(t, "arn:aws:iam::456456456456:role/admin", awsRole.RoleARN)
 	}
 
+	// the ARNs of the GovCloud and China partitions
+	roles = []string{
+		"arn:aws-us-gov:iam::456456456456:role/admin,arn:aws-us-gov:iam::456456456456:saml-provider/example-idp",
+		"arn:aws-cn:iam::456456456456:saml-provider/example-idp,arn:aws-cn:iam::456456456456:role/admin",
+	}
+	awsRoles, err = ParseAWSRoles(roles)
+	assert.Nil(t, err)
+	assert.Len(t, awsRoles, 2)
+	assert.Equal(t, "arn:aws-us-gov:iam::456456456456:role/admin", awsRoles[0].RoleARN)
+	assert.Equal(t, "arn:aws-us-gov:iam::456456456456:saml-provider/example-idp", awsRoles[0].PrincipalARN)
+	assert.Equal(t, "arn:aws-cn:iam::456456456456:role/admin", awsRoles[1].RoleARN)
+	assert.Equal(t, "arn:aws-cn:iam::456456456456:saml-provider/example-idp", awsRoles[1].PrincipalARN)
+
 	roles = []string{""}
 	awsRoles, err = ParseAWSRoles(roles)
 
@@ -30,3 +45,53 @@ func TestParseRoles(t *testing.T) {
 	assert.Nil(t, awsRoles)
 
 }
+
+func TestParseRolesOrdering(t *testing.T) {
+
+	roles := []string{
+		"arn:aws:iam::456456456456:role/admin, arn:aws:iam::456456456456:saml-provider/example-idp",
+		" arn:aws:iam::456456456456:saml-provider/example-idp ,arn:aws:iam::456456456456:role/readonly ",
+		"arn:aws:iam::456456456456:saml-provider/role-idp,arn:aws:iam::456456456456:role/admin",
+	}
+
+	awsRoles, err := ParseAWSRoles(roles)
+
+	assert.Nil(t, err)
+	assert.Len(t, awsRoles, 3)
+
+	assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/example-idp", awsRoles[0].PrincipalARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:role/admin", awsRoles[0].RoleARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/example-idp", awsRoles[1].PrincipalARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:role/readonly", awsRoles[1].RoleARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/role-idp", awsRoles[2].PrincipalARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:role/admin", awsRoles[2].RoleARN)
+}
+
+func TestParseRolesDuplicates(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_duplicate_roles.xml")
+	assert.Nil(t, err)
+
+	roles, err := ExtractAwsRoles(data)
+	assert.Nil(t, err)
+	assert.Len(t, roles, 3)
+
+	awsRoles, err := ParseAWSRoles(roles)
+	assert.Nil(t, err)
+	assert.Equal(t, []*AWSRole{
+		{RoleARN: "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild", PrincipalARN: "arn:aws:iam::123123123123:saml-provider/ExampleADFS"},
+	}, awsRoles)
+}
+
+func TestParseRolesInvalid(t *testing.T) {
+
+	invalid := []string{
+		"arn:aws:iam::456456456456:role/admin,arn:aws:iam::456456456456:role/readonly",
+		"arn:aws:iam::456456456456:saml-provider/a,arn:aws:iam::456456456456:saml-provider/b",
+		"arn:aws:iam::456456456456:role/admin,arn:aws:iam::456456456456:user/bob",
+	}
+
+	for _, role := range invalid {
+		_, err := ParseAWSRoles([]string{role})
+		assert.NotNil(t, err, role)
+	}
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/metrics"
+)
+
+// validateAllRoles check the account can save the credentials of every role, each one needs its own profile
+func validateAllRoles(account *cfg.IDPAccount) error {
+	if account.PrintsCredentials() {
+		return errors.New("--all-roles saves each role to its own profile, it can't be used with --export or --output")
+	}
+
+	if account.TargetRoleARN != "" {
+		return errors.New("--all-roles can't be used with target_role_arn")
+	}
+
+	return nil
+}
+
+// allRoles the roles of the assertion assumed by login --all-roles, role_arns and role_filter narrow them down
+func allRoles(awsRoles []*saml2aws.AWSRole, account *cfg.IDPAccount) []*saml2aws.AWSRole {
+	wanted := map[string]bool{}
+	for _, roleARN := range account.RoleARNs {
+		wanted[roleARN] = true
+	}
+
+	roleFilter := strings.ToLower(account.RoleFilter)
+
+	roles := []*saml2aws.AWSRole{}
+
+	for _, awsRole := range awsRoles {
+		if len(wanted) > 0 && !wanted[awsRole.RoleARN] {
+			continue
+		}
+
+		if !strings.Contains(strings.ToLower(awsRole.RoleARN), roleFilter) {
+			continue
+		}
+
+		roles = append(roles, awsRole)
+	}
+
+	return roles
+}
+
+// loginAllRoles exchange the assertion for credentials for every role and save each to its own profile, the roles
+// are assumed concurrently
+func loginAllRoles(account *cfg.IDPAccount, idpAccount, samlAssertion string, recorder *loginRecorder) error {
+
+	awsRoles, err := parseAwsRoles(samlAssertion, account)
+	if err != nil {
+		recorder.record(metrics.FailureRole)
+		return errors.Wrap(err, "Failed to assume role, please check you are permitted to assume the given role for the AWS service")
+	}
+
+	roles := allRoles(awsRoles, account)
+	if len(roles) == 0 {
+		recorder.record(metrics.FailureRole)
+		return errors.New("no roles in the assertion match role_arns and role_filter")
+	}
+
+	if warning := sessionDurationWarning(samlAssertion, account.SessionDuration); warning != "" {
+		fmt.Println(warning)
+	}
+
+	err = validateTransitiveTagKeys(samlAssertion, account)
+	if err != nil {
+		recorder.record(metrics.FailureConfig)
+		return err
+	}
+
+	err = validateDestination(samlAssertion, account)
+	if err != nil {
+		recorder.record(metrics.FailureIdP)
+		return err
+	}
+
+	fmt.Printf("Requesting AWS credentials for %d roles using SAML assertion\n", len(roles))
+
+	results := saml2aws.AssumeRolesWithSAML(context.Background(), account, roles, samlAssertion, saml2aws.DefaultAssumeConcurrency)
+
+	failed := 0
+	saved := []*saml2aws.RoleResult{}
+
+	for i, result := range results {
+		// roles in suspended or closed accounts can't ever be assumed so they aren't failures
+		if result.Err != nil && result.Role.Unavailable {
+			fmt.Printf("Skipped %s, its AWS account is suspended or closed\n", result.Role.RoleARN)
+			continue
+		}
+
+		if result.Err != nil {
+			fmt.Printf("Failed to assume %s: %v\n", result.Role.RoleARN, result.Err)
+			failed++
+			continue
+		}
+
+		roleAccount := *account
+		roleAccount.Profile = account.ProfileForAccountRole(result.Role.RoleARN)
+
+		sharedCreds := newSharedCredentials(&roleAccount)
+		sharedCreds.IdpAccount = idpAccount
+
+		err = newCredentialsWriter(&roleAccount, sharedCreds, os.Stdout).Write(result.Credentials, &roleAccount)
+		if err != nil {
+			recorder.record(metrics.FailureCredentials)
+			return errors.Wrapf(err, "error saving credentials of %s", result.Role.RoleARN)
+		}
+
+		fmt.Printf("Saved %s to profile %s\n", result.Role.RoleARN, roleAccount.Profile)
+
+		saved = append(saved, &results[i])
+	}
+
+	if failed > 0 {
+		recorder.record(metrics.FailureSTS)
+		return errors.Errorf("%d of %d roles couldn't be assumed", failed, len(results))
+	}
+
+	if len(saved) == 0 {
+		recorder.record(metrics.FailureSTS)
+		return saml2aws.ErrRoleUnavailable
+	}
+
+	fmt.Println("")
+	fmt.Printf("Note that the credentials will expire at %v\n", saved[0].Credentials.Expires)
+
+	recorder.record("")
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestAllRoles(t *testing.T) {
+	awsRoles := []*saml2aws.AWSRole{
+		{RoleARN: "arn:aws:iam::123456789012:role/Admin"},
+		{RoleARN: "arn:aws:iam::123456789012:role/ReadOnly"},
+		{RoleARN: "arn:aws:iam::210987654321:role/Admin"},
+	}
+
+	account := cfg.NewIDPAccount()
+	assert.Equal(t, awsRoles, allRoles(awsRoles, account))
+
+	account.RoleFilter = "admin"
+	assert.Equal(t, []*saml2aws.AWSRole{awsRoles[0], awsRoles[2]}, allRoles(awsRoles, account))
+
+	account.RoleARNs = []string{"arn:aws:iam::210987654321:role/Admin", "arn:aws:iam::123456789012:role/ReadOnly"}
+	assert.Equal(t, []*saml2aws.AWSRole{awsRoles[2]}, allRoles(awsRoles, account))
+
+	account.RoleFilter = "poweruser"
+	assert.Empty(t, allRoles(awsRoles, account))
+}
+
+func TestValidateAllRoles(t *testing.T) {
+	account := cfg.NewIDPAccount()
+	assert.Nil(t, validateAllRoles(account))
+
+	account.CredentialsOutput = cfg.CredentialsOutputExport
+	assert.Error(t, validateAllRoles(account))
+
+	account.CredentialsOutput = ""
+	account.TargetRoleARN = "arn:aws:iam::123456789012:role/Deploy"
+	assert.EqualError(t, validateAllRoles(account), "--all-roles can't be used with target_role_arn")
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+const (
+	// configKeyService the keyring service the configuration encryption key is saved under
+	configKeyService = "saml2aws-config"
+
+	// configKeyAccount the keyring account the configuration encryption key is saved under
+	configKeyAccount = "encryption-key"
+)
+
+func init() {
+	cfg.CurrentKeyStore = keyringKeyStore{}
+}
+
+// keyringKeyStore keeps the configuration encryption key in the current keyring
+type keyringKeyStore struct{}
+
+func (keyringKeyStore) Key() (string, error) {
+	key, err := credentials.CurrentKeyring.GenericPassword(configKeyService, configKeyAccount)
+	switch {
+	case credentials.IsErrCredentialsNotFound(err):
+		return "", cfg.ErrKeyNotFound
+	case err == credentials.ErrKeyringUnsupported:
+		return "", cfg.ErrEncryptionNotSupported
+	}
+
+	return key, err
+}
+
+func (keyringKeyStore) SetKey(key string) error {
+	err := credentials.CurrentKeyring.SetGenericPassword(configKeyService, configKeyAccount, key)
+	if err == credentials.ErrKeyringUnsupported {
+		return cfg.ErrEncryptionNotSupported
+	}
+
+	return err
+}
+
+// ConfigMigrate upgrade the configuration file to the current version, encrypting its sensitive values when
+// encrypt_config is set or encrypt is
+func ConfigMigrate(commonFlags *flags.CommonFlags, encrypt bool) error {
+
+	cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	err = cfgm.Migrate()
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate configuration")
+	}
+
+	if encrypt {
+		err = cfgm.EncryptConfig()
+		if err != nil {
+			return errors.Wrap(err, "failed to encrypt configuration")
+		}
+
+		fmt.Println("Configuration migrated, its sensitive values are encrypted with a key in the keyring")
+		return nil
+	}
+
+	fmt.Println("Configuration migrated")
+
+	return nil
+}
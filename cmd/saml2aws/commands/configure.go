@@ -22,7 +22,7 @@ func Configure(configFlags *flags.CommonFlags) error {
 
 	idpAccountName := configFlags.IdpAccount
 
-	cfgm, err := cfg.NewConfigManager(cfg.DefaultConfigPath)
+	cfgm, err := cfg.NewConfigManager(configFlags.ConfigFile)
 	if err != nil {
 		return errors.Wrap(err, "failed to load configuration")
 	}
@@ -35,17 +35,26 @@ func Configure(configFlags *flags.CommonFlags) error {
 	// update username and hostname if supplied
 	flags.ApplyFlagOverrides(configFlags, account)
 
+	if configFlags.SavePassword && !credentials.SupportsStorage() {
+		return errors.New("saving passwords isn't supported on this platform")
+	}
+
+	if configFlags.SavePassword && configFlags.SkipPrompt && configFlags.Password == "" {
+		return errors.New("--save-password with --skip-prompt needs the password in --password or SAML2AWS_PASSWORD")
+	}
+
 	// do we need to prompt for values now?
 	if !configFlags.SkipPrompt {
 		err = saml2aws.PromptForConfigurationDetails(account)
 		if err != nil {
 			return errors.Wrap(err, "failed to input configuration")
 		}
+	}
 
-		if credentials.SupportsStorage() {
-			if err := storeCredentials(configFlags, account); err != nil {
-				return err
-			}
+	// the password is offered for saving whenever prompting, --save-password saves it without prompting too
+	if (!configFlags.SkipPrompt || configFlags.SavePassword) && credentials.SupportsStorage() {
+		if err := storeCredentials(configFlags, account); err != nil {
+			return err
 		}
 	}
 
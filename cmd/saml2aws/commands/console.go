@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/awsclient"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// openConsole open the console sign-in URL in the browser
+var openConsole = provider.OpenBrowser
+
+// Console open the AWS console in the browser as the federated role using the saved credentials, with linkOnly the
+// sign-in URL is printed instead
+func Console(loginFlags *flags.LoginExecFlags, linkOnly bool) error {
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	sharedCreds := newSharedCredentials(account)
+
+	awsCreds, err := loadCredentials(account, sharedCreds)
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+	if awsCreds == nil {
+		fmt.Println("unable to load credentials, login required to create them")
+		return nil
+	}
+
+	if awsCreds.Expires.Sub(time.Now()) < 0 {
+		return errors.New("error aws credentials have expired")
+	}
+
+	consoleURL, err := awsclient.NewFederation(federationURL(account), provider.NewAWSTransport(account)).ConsoleURL(awsCreds, account.ConsoleDestination, account.ConsoleSessionDuration)
+	if err != nil {
+		return errors.Wrap(err, "error building console sign-in URL")
+	}
+
+	if linkOnly {
+		fmt.Println(consoleURL)
+		return nil
+	}
+
+	err = openConsole(consoleURL)
+	if err != nil {
+		// the link still works when pasted into a browser
+		fmt.Println("Unable to open the browser, open this URL to sign in to the AWS console:")
+		fmt.Println(consoleURL)
+		return nil
+	}
+
+	fmt.Println("Opening the AWS console in your browser, the sign-in link is valid for 15 minutes")
+
+	return nil
+}
+
+// federationURL the federation endpoint sits alongside the SAML signin endpoint for the account's partition
+func federationURL(account *cfg.IDPAccount) string {
+	return strings.TrimSuffix(saml2aws.SigninEndpoint(account), "/saml") + "/federation"
+}
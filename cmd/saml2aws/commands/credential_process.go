@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// credentialProcessRefreshWindow credentials expiring sooner than this are refreshed before they are handed to the
+// aws cli, so a command it is about to run doesn't fail part way through
+const credentialProcessRefreshWindow = 5 * time.Minute
+
+// credentialProcessOutput the document the aws cli and sdks expect from a credential_process
+type credentialProcessOutput struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string `json:",omitempty"`
+}
+
+// CredentialProcess print the credentials of the account as the json a credential_process in ~/.aws/config emits,
+// logging in first when they are missing or about to expire
+//
+// The aws cli reads the credentials from stdout so anything the login prints, prompts included, goes to stderr.
+func CredentialProcess(loginFlags *flags.LoginExecFlags) error {
+	stdout := os.Stdout
+
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	sharedCreds := newSharedCredentials(account)
+
+	awsCreds, err := loadCredentials(account, sharedCreds)
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+
+	if awsCreds == nil || awsCreds.Expires.Sub(time.Now()) < credentialProcessRefreshWindow {
+		loginFlags.Force = true
+
+		os.Stdout = os.Stderr
+		err = Login(loginFlags)
+		os.Stdout = stdout
+		if err != nil {
+			return errors.Wrap(err, "error logging in")
+		}
+
+		awsCreds, err = loadCredentials(account, sharedCreds)
+		if err != nil {
+			return errors.Wrap(err, "error loading credentials")
+		}
+		if awsCreds == nil {
+			return errors.New("no credentials were saved by the login")
+		}
+	}
+
+	return writeCredentialProcess(stdout, awsCreds)
+}
+
+func writeCredentialProcess(w io.Writer, awsCreds *awsconfig.AWSCredentials) error {
+	out := credentialProcessOutput{
+		Version:         1,
+		AccessKeyID:     awsCreds.AWSAccessKey,
+		SecretAccessKey: awsCreds.AWSSecretKey,
+		SessionToken:    awsCreds.AWSSessionToken,
+	}
+
+	if !awsCreds.Expires.IsZero() {
+		out.Expiration = awsCreds.Expires.UTC().Format(time.RFC3339)
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
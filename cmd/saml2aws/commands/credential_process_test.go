@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+func TestWriteCredentialProcess(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := writeCredentialProcess(buf, &awsconfig.AWSCredentials{
+		AWSAccessKey:    "123",
+		AWSSecretKey:    "345",
+		AWSSessionToken: "567",
+		Expires:         time.Date(2018, 6, 1, 12, 30, 0, 0, time.FixedZone("AEST", 10*60*60)),
+	})
+	assert.Nil(t, err)
+
+	assert.JSONEq(t, `{
+		"Version": 1,
+		"AccessKeyId": "123",
+		"SecretAccessKey": "345",
+		"SessionToken": "567",
+		"Expiration": "2018-06-01T02:30:00Z"
+	}`, buf.String())
+}
+
+func TestWriteCredentialProcessNoExpiry(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := writeCredentialProcess(buf, &awsconfig.AWSCredentials{AWSAccessKey: "123", AWSSecretKey: "345"})
+	assert.Nil(t, err)
+
+	assert.JSONEq(t, `{"Version": 1, "AccessKeyId": "123", "SecretAccessKey": "345", "SessionToken": ""}`, buf.String())
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// credentialStore where the aws credentials of the account are kept, the credentials file unless the account uses
+// the keyring
+func credentialStore(account *cfg.IDPAccount, sharedCreds *awsconfig.CredentialsProvider) credentials.CredentialStore {
+	if account.UsesKeyring() {
+		return credentials.KeyringStore{}
+	}
+
+	return credentials.FileStore{Provider: sharedCreds}
+}
+
+// loadCredentials load the saved aws credentials of the account from the keyring or the credentials file, nil is
+// returned when none have been saved yet
+func loadCredentials(account *cfg.IDPAccount, sharedCreds *awsconfig.CredentialsProvider) (*awsconfig.AWSCredentials, error) {
+	awsCreds, err := credentialStore(account, sharedCreds).Load(account.Profile)
+	if credentials.IsErrCredentialsNotFound(err) {
+		return nil, nil
+	}
+
+	return awsCreds, err
+}
+
+// printSavedCredentials tell the user where the login saved the aws credentials and how to use them
+func printSavedCredentials(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) {
+	fmt.Println("Logged in as:", awsCreds.PrincipalARN)
+	fmt.Println("")
+
+	if account.UsesKeyring() {
+		fmt.Println("Your new access key pair has been stored in the keyring")
+		fmt.Printf("Note that it will expire at %v\n", awsCreds.Expires)
+		fmt.Println("To use this credential, run commands with saml2aws exec or load it with saml2aws script.")
+		return
+	}
+
+	fmt.Println("Your new access key pair has been stored in the AWS configuration")
+	fmt.Printf("Note that it will expire at %v\n", awsCreds.Expires)
+	fmt.Println("To use this credential, call the AWS CLI with the --profile option (e.g. aws --profile", account.Profile, "ec2 describe-instances).")
+}
+
+// credentialsWriter writes the aws credentials of a login to the credentials_output of the account
+type credentialsWriter interface {
+	Write(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) error
+}
+
+// storeWriter saves the aws credentials to the profile in the credentials file or keyring
+type storeWriter struct {
+	store       credentials.CredentialStore
+	sharedCreds *awsconfig.CredentialsProvider
+}
+
+func (sw storeWriter) Write(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) error {
+	if !account.UsesKeyring() {
+		if warning := profileCollisionWarning(account, sw.sharedCreds); warning != "" {
+			fmt.Println(warning)
+		}
+	}
+
+	return errors.Wrap(sw.store.Save(account.Profile, awsCreds), "error saving credentials")
+}
+
+// exportWriter prints the aws credentials as export lines, e.g. for eval "$(saml2aws login --export)"
+type exportWriter struct {
+	w io.Writer
+}
+
+func (ew exportWriter) Write(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) error {
+	p := account.EnvPrefix
+
+	vars := [][2]string{
+		{"AWS_ACCESS_KEY_ID", awsCreds.AWSAccessKey},
+		{"AWS_SECRET_ACCESS_KEY", awsCreds.AWSSecretKey},
+		{"AWS_SESSION_TOKEN", awsCreds.AWSSessionToken},
+		{"AWS_SECURITY_TOKEN", awsCreds.AWSSecurityToken},
+	}
+
+	if !awsCreds.Expires.IsZero() {
+		vars = append(vars, [2]string{"AWS_CREDENTIAL_EXPIRATION", awsCreds.Expires.UTC().Format(time.RFC3339)})
+	}
+
+	if account.Region != "" {
+		vars = append(vars, [2]string{"AWS_REGION", account.Region}, [2]string{"AWS_DEFAULT_REGION", account.Region})
+	}
+
+	for _, v := range vars {
+		_, err := fmt.Fprintf(ew.w, "export %s%s=\"%s\"\n", p, v[0], v[1])
+		if err != nil {
+			return errors.Wrap(err, "error printing credentials")
+		}
+	}
+
+	return nil
+}
+
+// jsonWriter prints the aws credentials as the json a credential_process emits
+type jsonWriter struct {
+	w io.Writer
+}
+
+func (jw jsonWriter) Write(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) error {
+	return errors.Wrap(writeCredentialProcess(jw.w, awsCreds), "error printing credentials")
+}
+
+// newCredentialsWriter the writer for the credentials_output of the account, every login, --all-roles and prewarm
+// write the aws credentials through it, printed credentials go to stdout
+func newCredentialsWriter(account *cfg.IDPAccount, sharedCreds *awsconfig.CredentialsProvider, stdout io.Writer) credentialsWriter {
+	switch account.CredentialsOutput {
+	case cfg.CredentialsOutputExport:
+		return exportWriter{w: stdout}
+	case cfg.CredentialsOutputJSON:
+		return jsonWriter{w: stdout}
+	}
+
+	return storeWriter{store: credentialStore(account, sharedCreds), sharedCreds: sharedCreds}
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestLoadCredentialsKeyring(t *testing.T) {
+	defer func(previous credentials.Keyring) { credentials.CurrentKeyring = previous }(credentials.CurrentKeyring)
+	credentials.CurrentKeyring = credentials.NewMemKeyring()
+
+	account := cfg.NewIDPAccount()
+	account.Profile = "prod"
+	account.CredentialsOutput = cfg.CredentialsOutputKeyring
+
+	// the credentials file is never consulted
+	sharedCreds := &awsconfig.CredentialsProvider{Filename: "/nonexistent/credentials", Profile: "prod"}
+
+	// nothing saved yet means a login is needed rather than an error
+	awsCreds, err := loadCredentials(account, sharedCreds)
+	require.Nil(t, err)
+	require.Nil(t, awsCreds)
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	require.Nil(t, newCredentialsWriter(account, sharedCreds, nil).Write(&awsconfig.AWSCredentials{AWSAccessKey: "ASIAEXAMPLE", Expires: expires}, account))
+
+	awsCreds, err = loadCredentials(account, sharedCreds)
+	require.Nil(t, err)
+	require.Equal(t, "ASIAEXAMPLE", awsCreds.AWSAccessKey)
+	require.True(t, expires.Equal(awsCreds.Expires))
+}
+
+func TestNewCredentialsWriter(t *testing.T) {
+	account := cfg.NewIDPAccount()
+	sharedCreds := awsconfig.NewSharedCredentials("saml")
+	stdout := &bytes.Buffer{}
+
+	tests := []struct {
+		output   string
+		expected credentialsWriter
+	}{
+		{output: "", expected: storeWriter{store: credentials.FileStore{Provider: sharedCreds}, sharedCreds: sharedCreds}},
+		{output: cfg.CredentialsOutputFile, expected: storeWriter{store: credentials.FileStore{Provider: sharedCreds}, sharedCreds: sharedCreds}},
+		{output: "file:/run/secrets/aws/credentials", expected: storeWriter{store: credentials.FileStore{Provider: sharedCreds}, sharedCreds: sharedCreds}},
+		{output: cfg.CredentialsOutputKeyring, expected: storeWriter{store: credentials.KeyringStore{}, sharedCreds: sharedCreds}},
+		{output: cfg.CredentialsOutputExport, expected: exportWriter{w: stdout}},
+		{output: cfg.CredentialsOutputJSON, expected: jsonWriter{w: stdout}},
+	}
+
+	for _, tt := range tests {
+		account.CredentialsOutput = tt.output
+		require.Equal(t, tt.expected, newCredentialsWriter(account, sharedCreds, stdout), tt.output)
+	}
+}
+
+func TestExportWriter(t *testing.T) {
+	account := cfg.NewIDPAccount()
+	account.Region = "eu-west-1"
+	account.EnvPrefix = "PROD_"
+
+	awsCreds := &awsconfig.AWSCredentials{
+		AWSAccessKey:     "ASIAEXAMPLE",
+		AWSSecretKey:     "secret",
+		AWSSessionToken:  "token",
+		AWSSecurityToken: "token",
+		Expires:          time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, exportWriter{w: buf}.Write(awsCreds, account))
+	require.Equal(t, `export PROD_AWS_ACCESS_KEY_ID="ASIAEXAMPLE"
+export PROD_AWS_SECRET_ACCESS_KEY="secret"
+export PROD_AWS_SESSION_TOKEN="token"
+export PROD_AWS_SECURITY_TOKEN="token"
+export PROD_AWS_CREDENTIAL_EXPIRATION="2020-01-02T03:04:05Z"
+export PROD_AWS_REGION="eu-west-1"
+export PROD_AWS_DEFAULT_REGION="eu-west-1"
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, jsonWriter{w: buf}.Write(awsCreds, account))
+	require.JSONEq(t, `{"Version":1,"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","SessionToken":"token","Expiration":"2020-01-02T03:04:05Z"}`, buf.String())
+}
+
+func TestCredentialsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	account := cfg.NewIDPAccount()
+	account.Profile = "saml"
+	account.CredentialsOutput = "file:" + filepath.Join(dir, "aws", "credentials")
+
+	awsCreds := &awsconfig.AWSCredentials{AWSAccessKey: "ASIAEXAMPLE", AWSSecretKey: "secret", Expires: time.Now().Add(time.Hour)}
+	require.Nil(t, newCredentialsWriter(account, newSharedCredentials(account), nil).Write(awsCreds, account))
+
+	data, err := ioutil.ReadFile(account.CredentialsFile())
+	require.Nil(t, err)
+	require.Contains(t, string(data), "ASIAEXAMPLE")
+
+	saved, err := loadCredentials(account, newSharedCredentials(account))
+	require.Nil(t, err)
+	require.Equal(t, "ASIAEXAMPLE", saved.AWSAccessKey)
+}
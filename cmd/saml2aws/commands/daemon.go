@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// Daemon keep the credentials of the idp accounts valid, refreshing them shortly before they expire until interrupted
+//
+// Like prewarm each account needs its password saved by an earlier login, a failed refresh is retried.
+func Daemon(commonFlags *flags.CommonFlags, names []string, refreshBefore time.Duration) error {
+
+	if len(names) == 0 {
+		names = []string{commonFlags.IdpAccount}
+	}
+
+	if refreshBefore < 0 {
+		return errors.New("--refresh-before can't be negative")
+	}
+
+	cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	for _, name := range names {
+		account, err := cfgm.LoadVerifyIDPAccount(name)
+		if err != nil {
+			// reported by the refresh of the account
+			continue
+		}
+
+		account.NormalizeURLs()
+
+		err = saml2aws.ValidateRefreshBefore(account, refreshBefore)
+		if err != nil {
+			return errors.Wrapf(err, "invalid --refresh-before for %s", name)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	// a signal also abandons a refresh in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	opts := saml2aws.PrewarmOptions{
+		Cache:         &sharedCredentialsCache{},
+		LoginDetails:  savedLoginDetails(commonFlags),
+		RefreshBefore: refreshBefore,
+	}
+
+	for {
+		results := saml2aws.Prewarm(ctx, cfgm, names, opts)
+		if ctx.Err() != nil {
+			fmt.Println("Stopping")
+			return nil
+		}
+
+		for _, result := range results {
+			switch {
+			case result.Err != nil:
+				fmt.Printf("%s: %v, retrying in %v\n", result.Name, result.Err, saml2aws.DefaultRefreshRetry)
+			case result.Skipped:
+				fmt.Printf("%s: credentials are valid until %v\n", result.Name, result.Credentials.Expires)
+			default:
+				fmt.Printf("%s: refreshed, expires at %v\n", result.Name, result.Credentials.Expires)
+			}
+		}
+
+		wait := saml2aws.NextRefresh(results, time.Now(), refreshBefore, saml2aws.DefaultRefreshRetry)
+
+		fmt.Printf("Next refresh at %v\n", time.Now().Add(wait).Format(time.RFC3339))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			fmt.Println("Stopping")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// DumpAssertion log in to the IdP and write the decoded SAML assertion to the file, or stdout when file is empty
+//
+// STS is never called. Written to stdout the assertion is the only output, everything else goes to stderr.
+func DumpAssertion(loginFlags *flags.LoginExecFlags, file string, pretty, summary bool) error {
+
+	logger := logrus.WithField("command", "dump-assertion")
+
+	stdout := os.Stdout
+	if file == "" {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
+
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	loginDetails, err := resolveLoginDetails(account, loginFlags)
+	if err != nil {
+		return err
+	}
+
+	err = loginDetails.Validate()
+	if err != nil {
+		return errors.Wrap(err, "error validating login details")
+	}
+
+	loginDetails.URL = provider.ResolveIdPURL(account)
+
+	logger.WithField("idpAccount", account).Debug("building provider")
+
+	client, err := saml2aws.NewSAMLClient(account)
+	if err != nil {
+		return errors.Wrap(err, "error building IdP client")
+	}
+
+	samlAssertion, err := client.Authenticate(loginDetails)
+	if err != nil {
+		return errors.Wrap(err, "error authenticating to IdP")
+	}
+
+	if samlAssertion == "" {
+		return errors.New("Response did not contain a valid SAML assertion, please check your username and password is correct")
+	}
+
+	err = credentials.SaveCredentials(account.URL, loginDetails.Username, loginDetails.Password)
+	if err != nil {
+		return errors.Wrap(err, "error storing password in keychain")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	if file == "" {
+		err = writeAssertion(stdout, data, pretty)
+	} else {
+		err = writeAssertionFile(file, data, pretty)
+	}
+	if err != nil {
+		return err
+	}
+
+	if summary {
+		assertionSummary, err := saml2aws.SummarizeAssertion(data)
+		if err != nil {
+			return errors.Wrap(err, "error summarizing saml assertion")
+		}
+
+		printAssertionSummary(os.Stdout, assertionSummary)
+	}
+
+	return nil
+}
+
+// writeAssertionFile write the assertion to the file, only the user can read it as it logs in to AWS until it expires
+func writeAssertionFile(file string, data []byte, pretty bool) error {
+	var buf bytes.Buffer
+
+	err := writeAssertion(&buf, data, pretty)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(file, buf.Bytes(), 0600)
+	if err != nil {
+		return errors.Wrap(err, "error writing saml assertion")
+	}
+
+	fmt.Println("SAML assertion written to", file)
+
+	return nil
+}
+
+// writeAssertion write the decoded assertion, indented when pretty is set
+func writeAssertion(w io.Writer, data []byte, pretty bool) error {
+	if !pretty {
+		_, err := w.Write(data)
+		if err == nil && !strings.HasSuffix(string(data), "\n") {
+			_, err = io.WriteString(w, "\n")
+		}
+		return err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return errors.Wrap(err, "error parsing saml assertion")
+	}
+
+	doc.Indent(2)
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// printAssertionSummary print the attributes AWS checks, the ones the IdP didn't send are shown as missing
+func printAssertionSummary(w io.Writer, summary *saml2aws.AssertionSummary) {
+	value := func(v string) string {
+		if v == "" {
+			return "(missing)"
+		}
+		return v
+	}
+
+	sessionDuration := "(missing)"
+	if summary.SessionDuration > 0 {
+		sessionDuration = fmt.Sprintf("%d seconds", summary.SessionDuration)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, "Issuer:          %s\n", value(summary.Issuer))
+	fmt.Fprintf(w, "Subject:         %s\n", value(summary.Subject))
+	fmt.Fprintf(w, "Destination:     %s\n", value(summary.Destination))
+	fmt.Fprintf(w, "Audience:        %s\n", value(strings.Join(summary.Audiences, ", ")))
+	fmt.Fprintf(w, "NotBefore:       %s\n", value(summary.NotBefore))
+	fmt.Fprintf(w, "NotOnOrAfter:    %s\n", value(summary.NotOnOrAfter))
+	fmt.Fprintf(w, "SessionDuration: %s\n", sessionDuration)
+	fmt.Fprintf(w, "RoleSessionName: %s\n", value(summary.RoleSessionName))
+
+	if len(summary.Roles) == 0 {
+		fmt.Fprintln(w, "Roles:           (missing)")
+		return
+	}
+
+	fmt.Fprintln(w, "Roles:")
+	for _, role := range summary.Roles {
+		fmt.Fprintf(w, "  %s via %s\n", role.RoleARN, role.PrincipalARN)
+	}
+}
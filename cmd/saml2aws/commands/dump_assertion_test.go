@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws"
+)
+
+const compactAssertion = `<Response Destination="https://signin.aws.amazon.com/saml"><Assertion><Issuer>https://id.example.com</Issuer></Assertion></Response>`
+
+func TestWriteAssertion(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := writeAssertion(&buf, []byte(compactAssertion), false)
+	assert.Nil(t, err)
+	assert.Equal(t, compactAssertion+"\n", buf.String())
+
+	buf.Reset()
+
+	err = writeAssertion(&buf, []byte(compactAssertion), true)
+	assert.Nil(t, err)
+	assert.Equal(t, `<Response Destination="https://signin.aws.amazon.com/saml">
+  <Assertion>
+    <Issuer>https://id.example.com</Issuer>
+  </Assertion>
+</Response>
+`, buf.String())
+}
+
+func TestWriteAssertionFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "assertion.xml")
+
+	err = writeAssertionFile(file, []byte(compactAssertion), false)
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, compactAssertion+"\n", string(data))
+
+	info, err := os.Stat(file)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestPrintAssertionSummary(t *testing.T) {
+	var buf bytes.Buffer
+
+	printAssertionSummary(&buf, &saml2aws.AssertionSummary{
+		Issuer:          "https://id.example.com",
+		Audiences:       []string{"urn:amazon:webservices"},
+		NotOnOrAfter:    "2016-09-10T03:54:39.371Z",
+		SessionDuration: 3600,
+		Roles: []saml2aws.AWSRole{
+			{RoleARN: "arn:aws:iam::123456789012:role/admin", PrincipalARN: "arn:aws:iam::123456789012:saml-provider/example-idp"},
+		},
+	})
+
+	assert.Equal(t, `
+Issuer:          https://id.example.com
+Subject:         (missing)
+Destination:     (missing)
+Audience:        urn:amazon:webservices
+NotBefore:       (missing)
+NotOnOrAfter:    2016-09-10T03:54:39.371Z
+SessionDuration: 3600 seconds
+RoleSessionName: (missing)
+Roles:
+  arn:aws:iam::123456789012:role/admin via arn:aws:iam::123456789012:saml-provider/example-idp
+`, buf.String())
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/pkg/errors"
-	"github.com/versent/saml2aws/pkg/awsconfig"
 	"github.com/versent/saml2aws/pkg/flags"
 	"github.com/versent/saml2aws/pkg/shell"
 )
@@ -25,39 +24,39 @@ func Exec(execFlags *flags.LoginExecFlags, cmdline []string) error {
 		return errors.Wrap(err, "error building login details")
 	}
 
-	sharedCreds := awsconfig.NewSharedCredentials(account.Profile)
+	sharedCreds := newSharedCredentials(account)
 
-	// this checks if the credentials file has been created yet
-	// can only really be triggered if saml2aws exec is run on a new
-	// system prior to creating $HOME/.aws
-	exist, err := sharedCreds.CredsExists()
-	if err != nil {
-		return errors.Wrap(err, "error loading credentials")
-	}
-	if !exist {
-		fmt.Println("unable to load credentials, login required to create them")
-		return nil
-	}
-
-	awsCreds, err := sharedCreds.Load()
+	awsCreds, err := loadCredentials(account, sharedCreds)
 	if err != nil {
 		return errors.Wrap(err, "error loading credentials")
 	}
 
-	if awsCreds.Expires.Sub(time.Now()) < 0 {
-		return errors.New("error aws credentials have expired")
-	}
+	// missing or expired credentials are refreshed by logging in, as are ones STS no longer accepts
+	ok := awsCreds != nil && awsCreds.Expires.Sub(time.Now()) > 0
 
-	ok, err := checkToken(account.Profile)
-	if err != nil {
-		return errors.Wrap(err, "error validating token")
+	// the session check reads the profile from the credentials file so keyring credentials only check the expiry
+	if ok && !account.UsesKeyring() {
+		ok, err = checkToken(account.Profile)
+		if err != nil {
+			return errors.Wrap(err, "error validating token")
+		}
 	}
 
 	if !ok {
+		execFlags.Force = true
+
 		err = Login(execFlags)
-	}
-	if err != nil {
-		return errors.Wrap(err, "error logging in")
+		if err != nil {
+			return errors.Wrap(err, "error logging in")
+		}
+
+		awsCreds, err = loadCredentials(account, sharedCreds)
+		if err != nil {
+			return errors.Wrap(err, "error loading credentials")
+		}
+		if awsCreds == nil {
+			return errors.New("no credentials were saved by the login")
+		}
 	}
 
 	return shell.ExecShellCmd(cmdline, shell.BuildEnvVars(awsCreds, account))
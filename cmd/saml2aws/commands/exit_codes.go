@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Exit codes of a failed login, so a script or CI job can tell why it failed, other failures exit with 1
+const (
+	// ExitCodeAuthFailed the IdP rejected the login or didn't return a SAML assertion
+	ExitCodeAuthFailed = 2
+
+	// ExitCodeMFAFailed the MFA needed input which --skip-prompt couldn't prompt for, or mfa_token_file ran out
+	ExitCodeMFAFailed = 3
+
+	// ExitCodeRoleAmbiguous the assertion has several roles and none was chosen up front
+	ExitCodeRoleAmbiguous = 4
+)
+
+// ErrRoleAmbiguous returned when the role can't be chosen without prompting
+var ErrRoleAmbiguous = errors.New("several roles are available, choose one with --role, role_arn or role_arns")
+
+// loginError a login failure with the exit code it is reported with, it has no cause so errors.Cause stops at it
+type loginError struct {
+	code int
+	err  error
+}
+
+func (e *loginError) Error() string {
+	return e.err.Error()
+}
+
+// Format print the wrapped error, with its stack trace for %+v
+func (e *loginError) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprintf(s, "%+v", e.err)
+		return
+	}
+
+	io.WriteString(s, e.Error())
+}
+
+// withExitCode give the error the exit code of the login failure
+func withExitCode(code int, err error) error {
+	return &loginError{code: code, err: err}
+}
+
+// LoginExitCode the exit code of a failed login, false when the error doesn't have one
+func LoginExitCode(err error) (int, bool) {
+	loginErr, ok := errors.Cause(err).(*loginError)
+	if !ok {
+		return 0, false
+	}
+
+	return loginErr.code, true
+}
@@ -0,0 +1,22 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginExitCode(t *testing.T) {
+	err := errors.Wrap(withExitCode(ExitCodeAuthFailed, errors.New("invalid credentials")), "login failed")
+
+	code, ok := LoginExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, ExitCodeAuthFailed, code)
+	assert.Equal(t, "login failed: invalid credentials", err.Error())
+	assert.Equal(t, "invalid credentials", fmt.Sprintf("%v", withExitCode(ExitCodeMFAFailed, errors.New("invalid credentials"))))
+
+	_, ok = LoginExitCode(errors.New("failed to load configuration"))
+	assert.False(t, ok)
+}
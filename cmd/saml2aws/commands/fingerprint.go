@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// Fingerprint print a stable hash of the configuration which can be compared to detect drift
+func Fingerprint(commonFlags *flags.CommonFlags) error {
+
+	cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	fp, err := cfgm.ConfigFingerprint()
+	if err != nil {
+		return errors.Wrap(err, "failed to fingerprint configuration")
+	}
+
+	fmt.Println(fp)
+
+	return nil
+}
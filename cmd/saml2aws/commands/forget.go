@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/provider/onelogin"
+)
+
+// Forget remove the password saved for the IDP account, along with the OneLogin client id and secret
+func Forget(commonFlags *flags.CommonFlags) error {
+	if !credentials.SupportsStorage() {
+		return errors.New("saving passwords isn't supported on this platform")
+	}
+
+	account, err := buildIdpAccount(&flags.LoginExecFlags{CommonFlags: commonFlags})
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	err = credentials.DeleteCredentials(account.URL)
+	if err != nil {
+		return errors.Wrap(err, "error removing password from keychain")
+	}
+
+	if account.Provider == onelogin.ProviderName {
+		err = credentials.DeleteCredentials(path.Join(account.URL, OneLoginOAuthPath))
+		if err != nil {
+			return errors.Wrap(err, "error removing client_id and client_secret from keychain")
+		}
+	}
+
+	fmt.Printf("Saved password removed for %s\n", account.URL)
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// memoryHelper a credentials helper which keeps the saved passwords in memory
+type memoryHelper map[string]credentials.Credentials
+
+func (h memoryHelper) Add(creds *credentials.Credentials) error {
+	h[creds.ServerURL] = *creds
+	return nil
+}
+
+func (h memoryHelper) Delete(serverURL string) error {
+	delete(h, serverURL)
+	return nil
+}
+
+func (h memoryHelper) Get(serverURL string) (string, string, error) {
+	creds, ok := h[serverURL]
+	if !ok {
+		return "", "", credentials.ErrCredentialsNotFound
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func (h memoryHelper) List() (map[string]string, error) {
+	list := map[string]string{}
+	for serverURL, creds := range h {
+		list[serverURL] = creds.Username
+	}
+	return list, nil
+}
+
+func (memoryHelper) SupportsCredentialStorage() bool {
+	return true
+}
+
+func newConfigFile(t *testing.T, dir string) string {
+	configFile := filepath.Join(dir, ".saml2aws")
+
+	cfgm, err := cfg.NewConfigManager(configFile)
+	assert.Nil(t, err)
+
+	account := cfg.NewIDPAccount()
+	account.URL = "https://id.example.com"
+	account.Provider = "KeyCloak"
+	account.MFA = "Auto"
+	account.Username = "user@example.com"
+	assert.Nil(t, cfgm.SaveIDPAccount("default", account))
+
+	return configFile
+}
+
+func TestConfigureSavePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	helper := memoryHelper{}
+	defer func(h credentials.Helper) { credentials.CurrentHelper = h }(credentials.CurrentHelper)
+	credentials.CurrentHelper = helper
+
+	commonFlags := &flags.CommonFlags{IdpAccount: "default", ConfigFile: newConfigFile(t, dir), SkipPrompt: true, SavePassword: true}
+
+	// without a password there is nothing to save
+	err = Configure(commonFlags)
+	assert.Error(t, err)
+	assert.Empty(t, helper)
+
+	commonFlags.Password = "secret"
+
+	err = Configure(commonFlags)
+	assert.Nil(t, err)
+	assert.Equal(t, credentials.Credentials{ServerURL: "https://id.example.com", Username: "user@example.com", Secret: "secret"}, helper["https://id.example.com"])
+}
+
+func TestForget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	helper := memoryHelper{
+		"https://id.example.com":    {ServerURL: "https://id.example.com", Username: "user@example.com", Secret: "secret"},
+		"https://other.example.com": {ServerURL: "https://other.example.com", Username: "user@example.com", Secret: "other"},
+	}
+	defer func(h credentials.Helper) { credentials.CurrentHelper = h }(credentials.CurrentHelper)
+	credentials.CurrentHelper = helper
+
+	err = Forget(&flags.CommonFlags{IdpAccount: "default", ConfigFile: newConfigFile(t, dir)})
+	assert.Nil(t, err)
+
+	_, ok := helper["https://id.example.com"]
+	assert.False(t, ok)
+	_, ok = helper["https://other.example.com"]
+	assert.True(t, ok)
+}
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// ResolveIdpAccount use the default idp account of the configuration when --idp-account wasn't given
+func ResolveIdpAccount(commonFlags *flags.CommonFlags) error {
+	if commonFlags.IdpAccount != "" {
+		return nil
+	}
+
+	cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	name, err := cfgm.DefaultIDPAccountName()
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve the default idp account")
+	}
+
+	commonFlags.IdpAccount = name
+
+	return nil
+}
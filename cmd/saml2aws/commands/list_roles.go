@@ -2,21 +2,48 @@ package commands
 
 import (
 	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws"
 	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/awsclient"
+	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
-// List will list available role ARNs
-func ListRoles(loginFlags *flags.LoginExecFlags) error {
+// listedRole a role in the structured list-roles output
+type listedRole struct {
+	AccountID    string `json:"account_id"`
+	AccountName  string `json:"account_name"`
+	RoleName     string `json:"role_name"`
+	RoleARN      string `json:"role_arn"`
+	PrincipalARN string `json:"principal_arn"`
+}
+
+// ListRoles list the roles in the SAML assertion, output is text, json, table or csv
+//
+// STS is never called, the signin page is only used for the AWS account names.
+func ListRoles(loginFlags *flags.LoginExecFlags, output string) error {
 
 	logger := logrus.WithField("command", "list")
 
+	// only the structured list goes to stdout so it can be parsed, everything else goes to stderr
+	structured := output != "" && output != "text"
+	stdout := os.Stdout
+	if structured {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
+
 	account, err := buildIdpAccount(loginFlags)
 	if err != nil {
 		return errors.Wrap(err, "error building login details")
@@ -33,6 +60,8 @@ func ListRoles(loginFlags *flags.LoginExecFlags) error {
 		return errors.Wrap(err, "error validating login details")
 	}
 
+	loginDetails.URL = provider.ResolveIdPURL(account)
+
 	logger.WithField("idpAccount", account).Debug("building provider")
 
 	provider, err := saml2aws.NewSAMLClient(account)
@@ -52,7 +81,7 @@ func ListRoles(loginFlags *flags.LoginExecFlags) error {
 		os.Exit(1)
 	}
 
-	err = credentials.SaveCredentials(loginDetails.URL, loginDetails.Username, loginDetails.Password)
+	err = credentials.SaveCredentials(account.URL, loginDetails.Username, loginDetails.Password)
 	if err != nil {
 		return errors.Wrap(err, "error storing password in keychain")
 	}
@@ -77,15 +106,84 @@ func ListRoles(loginFlags *flags.LoginExecFlags) error {
 		return errors.Wrap(err, "error parsing aws roles")
 	}
 
-	if err := listRoles(awsRoles, samlAssertion, loginFlags); err != nil {
+	if structured {
+		return writeRoles(stdout, output, listedRoles(awsRoles, samlAssertion, account))
+	}
+
+	if err := listRoles(awsRoles, samlAssertion, account); err != nil {
 		return errors.Wrap(err, "Failed to list roles")
 	}
 
 	return nil
 }
 
-func listRoles(awsRoles []*saml2aws.AWSRole, samlAssertion string, loginFlags *flags.LoginExecFlags) error {
-	awsAccounts, err := saml2aws.ParseAWSAccounts(samlAssertion)
+// listedRoles the roles of the assertion in the order the IdP listed them, with the account names when the signin
+// page can be read
+func listedRoles(awsRoles []*saml2aws.AWSRole, samlAssertion string, account *cfg.IDPAccount) []listedRole {
+	accountNames := map[string]string{}
+
+	awsAccounts, err := roleAccounts(awsRoles, samlAssertion, account)
+	if err != nil {
+		logrus.WithField("command", "list").WithError(err).Debug("unable to read aws account names from the signin page")
+	}
+
+	for _, awsAccount := range awsAccounts {
+		for _, role := range awsAccount.Roles {
+			accountNames[role.RoleARN] = awsAccount.Name
+		}
+	}
+
+	var listed []listedRole
+	for _, role := range awsRoles {
+		accountID := ""
+		if parts := strings.Split(role.RoleARN, ":"); len(parts) > 4 {
+			accountID = parts[4]
+		}
+
+		// the signin page names accounts "Account: name (id)"
+		accountName := strings.TrimPrefix(accountNames[role.RoleARN], "Account: ")
+		accountName = strings.TrimSuffix(accountName, " ("+accountID+")")
+
+		listed = append(listed, listedRole{
+			AccountID:    accountID,
+			AccountName:  accountName,
+			RoleName:     awsclient.RoleNameFromARN(role.RoleARN),
+			RoleARN:      role.RoleARN,
+			PrincipalARN: role.PrincipalARN,
+		})
+	}
+
+	return listed
+}
+
+func writeRoles(w io.Writer, output string, roles []listedRole) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(roles)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"account_id", "account_name", "role_name", "role_arn", "principal_arn"})
+		for _, role := range roles {
+			cw.Write([]string{role.AccountID, role.AccountName, role.RoleName, role.RoleARN, role.PrincipalARN})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACCOUNT ID\tACCOUNT NAME\tROLE NAME\tROLE ARN")
+		for _, role := range roles {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", role.AccountID, role.AccountName, role.RoleName, role.RoleARN)
+		}
+		return tw.Flush()
+	}
+
+	return errors.Errorf("unsupported output %s", output)
+}
+
+func listRoles(awsRoles []*saml2aws.AWSRole, samlAssertion string, idpAccount *cfg.IDPAccount) error {
+	awsAccounts, err := saml2aws.ParseAWSAccounts(idpAccount, samlAssertion)
 	if err != nil {
 		errors.Wrap(err, "error parsing aws role accounts")
 	}
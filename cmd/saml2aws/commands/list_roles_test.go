@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+const namedAccountSigninPage = `<html><body><form id="saml_form"><fieldset>
+<div class="saml-account"><div class="saml-account-name">Account: prod (456456456456)</div>
+<div class="saml-role"><label for="arn:aws:iam::456456456456:role/admin">admin</label></div>
+<div class="saml-role"><label for="arn:aws:iam::456456456456:role/read">read</label></div>
+</div>
+</fieldset></form></body></html>`
+
+func TestListedRoles(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(namedAccountSigninPage))
+	}))
+	defer ts.Close()
+
+	account := cfg.NewIDPAccount()
+	account.SAMLSigninEndpoint = ts.URL
+
+	roles := listedRoles(twoRoles(), "", account)
+	assert.Equal(t, []listedRole{
+		{AccountID: "456456456456", AccountName: "prod", RoleName: "admin", RoleARN: "arn:aws:iam::456456456456:role/admin", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp"},
+		{AccountID: "456456456456", AccountName: "prod", RoleName: "read", RoleARN: "arn:aws:iam::456456456456:role/read", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp"},
+	}, roles)
+}
+
+func TestWriteRoles(t *testing.T) {
+	roles := []listedRole{
+		{AccountID: "456456456456", AccountName: "prod", RoleName: "admin", RoleARN: "arn:aws:iam::456456456456:role/admin", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp"},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, writeRoles(buf, "csv", roles))
+	assert.Equal(t, "account_id,account_name,role_name,role_arn,principal_arn\n456456456456,prod,admin,arn:aws:iam::456456456456:role/admin,arn:aws:iam::456456456456:saml-provider/example-idp\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, writeRoles(buf, "json", roles))
+	assert.JSONEq(t, `[{"account_id": "456456456456", "account_name": "prod", "role_name": "admin", "role_arn": "arn:aws:iam::456456456456:role/admin", "principal_arn": "arn:aws:iam::456456456456:saml-provider/example-idp"}]`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, writeRoles(buf, "table", roles))
+	assert.Equal(t, "ACCOUNT ID    ACCOUNT NAME  ROLE NAME  ROLE ARN\n456456456456  prod          admin      arn:aws:iam::456456456456:role/admin\n", buf.String())
+
+	assert.Error(t, writeRoles(buf, "yaml", roles))
+}
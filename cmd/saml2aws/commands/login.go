@@ -1,21 +1,26 @@
 package commands
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws"
 	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/audit"
 	"github.com/versent/saml2aws/pkg/awsconfig"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
 	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/metrics"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+	"github.com/versent/saml2aws/pkg/shell"
 )
 
 // Login login to ADFS
@@ -23,93 +28,352 @@ func Login(loginFlags *flags.LoginExecFlags) error {
 
 	logger := logrus.WithField("command", "login")
 
-	account, err := buildIdpAccount(loginFlags)
+	account, err := buildLoginIdpAccount(loginFlags)
 	if err != nil {
 		return errors.Wrap(err, "error building login details")
 	}
 
-	sharedCreds := awsconfig.NewSharedCredentials(account.Profile)
+	// any prompt fails the login rather than waiting
+	if loginFlags.CommonFlags.SkipPrompt {
+		previous := prompter.SetPrompter(prompter.NewNonInteractive())
+		defer prompter.SetPrompter(previous)
+	}
 
-	logger.Debug("check if Creds Exist")
+	// only the printed credentials go to stdout so they can be passed to eval or parsed, everything else goes to stderr
+	stdout := os.Stdout
+	if account.PrintsCredentials() {
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
 
-	// this checks if the credentials file has been created yet
-	exist, err := sharedCreds.CredsExists()
-	if err != nil {
-		return errors.Wrap(err, "error loading credentials")
+	if loginFlags.AllRoles {
+		err = validateAllRoles(account)
+		if err != nil {
+			return err
+		}
 	}
-	if !exist {
-		fmt.Println("unable to load credentials, login required to create them")
-		return nil
+
+	for _, warning := range account.ValidateWarnings() {
+		fmt.Println("Warning:", warning)
 	}
 
-	if !sharedCreds.Expired() && !loginFlags.Force {
-		fmt.Println("credentials are not expired skipping")
-		return nil
+	sharedCreds := newSharedCredentials(account)
+	sharedCreds.IdpAccount = loginFlags.CommonFlags.IdpAccount
+
+	logger.Debug("check if Creds Exist")
+
+	switch {
+	case loginFlags.AllRoles:
+		// every role is saved to its own profile so there isn't one profile to check
+	case account.PrintsCredentials():
+		// nothing was saved by an earlier login so there is nothing to reuse
+	case account.UsesKeyring():
+		// the credentials file isn't used at all, this also fails early on platforms without a keychain
+		awsCreds, err := loadCredentials(account, sharedCreds)
+		if err != nil {
+			return errors.Wrap(err, "error loading credentials")
+		}
+
+		if awsCreds != nil && time.Now().Before(awsCreds.Expires) && !loginFlags.Force {
+			return skipLogin()
+		}
+	default:
+		// this checks if the credentials file has been created yet
+		exist, err := sharedCreds.CredsExists()
+		if err != nil {
+			return errors.Wrap(err, "error loading credentials")
+		}
+		if !exist {
+			fmt.Println("unable to load credentials, login required to create them")
+			return nil
+		}
+
+		if !sharedCreds.Expired() && !loginFlags.Force {
+			return skipLogin()
+		}
 	}
 
+	recorder := newLoginRecorder(account, loginFlags.CommonFlags.IdpAccount)
+
 	loginDetails, err := resolveLoginDetails(account, loginFlags)
 	if err != nil {
-		fmt.Printf("%+v\n", err)
-		os.Exit(1)
+		recorder.record(metrics.FailureConfig)
+		return errors.Wrap(err, "error resolving login details")
 	}
 
 	err = loginDetails.Validate()
 	if err != nil {
+		recorder.record(metrics.FailureConfig)
 		return errors.Wrap(err, "error validating login details")
 	}
 
+	samlAssertion, err := authenticate(account, loginDetails, recorder)
+	if err != nil {
+		return err
+	}
+
+	if samlAssertion == "" {
+		recorder.record(metrics.FailureIdP)
+		if promptErr := prompter.PromptErr(); promptErr != nil {
+			return withExitCode(ExitCodeMFAFailed, errors.Wrap(promptErr, "Response did not contain a valid SAML assertion, the MFA couldn't be prompted for"))
+		}
+		return withExitCode(ExitCodeAuthFailed, errors.New("Response did not contain a valid SAML assertion, please check your username and password is correct"))
+	}
+
+	// credentials are always stored against the primary URL so a fallback login doesn't change the lookup
+	err = credentials.SaveCredentials(account.URL, loginDetails.Username, loginDetails.Password)
+	if err != nil {
+		recorder.record(metrics.FailureCredentials)
+		return errors.Wrap(err, "error storing password in keychain")
+	}
+
+	if loginFlags.AllRoles {
+		return loginAllRoles(account, loginFlags.CommonFlags.IdpAccount, samlAssertion, recorder)
+	}
+
+	// roles whose AWS account turned out to be suspended or closed, the picker marks them unavailable
+	unavailable := map[string]bool{}
+
+	role, err := selectAwsRole(samlAssertion, account, unavailable)
+	if err != nil {
+		recorder.record(metrics.FailureRole)
+		return errors.Wrap(err, "Failed to assume role, please check you are permitted to assume the given role for the AWS service")
+	}
+
+	fmt.Println("Selected role:", role.RoleARN)
+
+	recorder.role = role.RoleARN
+
+	if warning := sessionDurationWarning(samlAssertion, account.SessionDuration); warning != "" {
+		fmt.Println(warning)
+	}
+
+	err = validateTransitiveTagKeys(samlAssertion, account)
+	if err != nil {
+		recorder.record(metrics.FailureConfig)
+		return err
+	}
+
+	err = validateDestination(samlAssertion, account)
+	if err != nil {
+		recorder.record(metrics.FailureIdP)
+		return err
+	}
+
+	awsCreds, err := loginToStsUsingRole(account, role, samlAssertion)
+	for err != nil && role.Unavailable && account.RoleARN == "" {
+		// the role was picked so offer the others rather than giving up
+		fmt.Printf("Role %s is unavailable, its AWS account is suspended or closed\n", role.RoleARN)
+		unavailable[role.RoleARN] = true
+
+		role, err = selectAwsRole(samlAssertion, account, unavailable)
+		if err != nil {
+			recorder.record(metrics.FailureRole)
+			return errors.Wrap(err, "Failed to assume role, please check you are permitted to assume the given role for the AWS service")
+		}
+
+		fmt.Println("Selected role:", role.RoleARN)
+
+		recorder.role = role.RoleARN
+
+		awsCreds, err = loginToStsUsingRole(account, role, samlAssertion)
+	}
+	if err != nil {
+		recorder.record(metrics.FailureSTS)
+		return errors.Wrap(err, "error logging into aws role using saml assertion")
+	}
+
+	// the target role is assumed with the credentials of the SAML role, they aren't saved anywhere
+	if account.TargetRoleARN != "" {
+		fmt.Println("Assuming target role:", account.TargetRoleARN)
+
+		awsCreds, err = saml2aws.AssumeTargetRole(context.Background(), account, awsCreds)
+		if err != nil {
+			recorder.record(metrics.FailureSTS)
+			return errors.Wrap(err, "error assuming target role")
+		}
+
+		role = &saml2aws.AWSRole{RoleARN: account.TargetRoleARN}
+	}
+
+	if account.ProfileFromRole && account.RoleARN == "" {
+		account.Profile = account.ProfileForRole(role.RoleARN)
+		sharedCreds.Profile = account.Profile
+	}
+
+	err = newCredentialsWriter(account, sharedCreds, stdout).Write(awsCreds, account)
+	if err != nil {
+		recorder.record(metrics.FailureCredentials)
+		return err
+	}
+
+	if !account.PrintsCredentials() {
+		printSavedCredentials(awsCreds, account)
+	}
+
+	if account.SystemdEnvFile != "" {
+		err = shell.WriteSystemdEnvFile(account.SystemdEnvFile, awsCreds, account)
+		if err != nil {
+			recorder.record(metrics.FailureCredentials)
+			return errors.Wrap(err, "error writing systemd environment file")
+		}
+	}
+
+	err = runPostLoginCmd(account, awsCreds)
+	if err != nil {
+		recorder.record(metrics.FailurePostLogin)
+		return err
+	}
+
+	printRolePermissions(os.Stdout, account, role, awsCreds)
+
+	recorder.record("")
+
+	return nil
+}
+
+// skipLogin the saved credentials haven't expired so no login is needed
+func skipLogin() error {
+	fmt.Println("credentials are not expired skipping")
+
+	return nil
+}
+
+// authenticate run the pre login command then authenticate to the IdP, nothing is sent to the IdP if the command fails
+func authenticate(account *cfg.IDPAccount, loginDetails *creds.LoginDetails, recorder *loginRecorder) (string, error) {
+
+	logger := logrus.WithField("command", "login")
+
+	err := runPreLoginCmd(account)
+	if err != nil {
+		recorder.record(metrics.FailurePreLogin)
+		return "", err
+	}
+
+	loginDetails.URL = provider.ResolveIdPURL(account)
+
 	logger.WithField("idpAccount", account).Debug("building provider")
 
-	provider, err := saml2aws.NewSAMLClient(account)
+	client, err := saml2aws.NewSAMLClient(account)
 	if err != nil {
-		return errors.Wrap(err, "error building IdP client")
+		recorder.record(metrics.FailureConfig)
+		return "", errors.Wrap(err, "error building IdP client")
+	}
+
+	// the token file is only consulted by this login
+	var tokens *prompter.MFATokenFile
+	if account.MFATokenFile != "" {
+		tokens = prompter.NewMFATokenFile(account.MFATokenFile)
+		loginDetails.MFATokens = tokens
 	}
 
 	fmt.Printf("Authenticating as %s ...\n", loginDetails.Username)
 
-	samlAssertion, err := provider.Authenticate(loginDetails)
+	samlAssertion, err := client.Authenticate(loginDetails)
 	if err != nil {
-		return errors.Wrap(err, "error authenticating to IdP")
-
+		recorder.record(metrics.FailureIdP)
+		if tokenErr := tokens.Err(); tokenErr != nil {
+			return "", withExitCode(ExitCodeMFAFailed, errors.Wrap(tokenErr, "error reading MFA code from mfa_token_file"))
+		}
+		if promptErr := prompter.PromptErr(); promptErr != nil {
+			return "", withExitCode(ExitCodeMFAFailed, errors.Wrapf(promptErr, "error authenticating to IdP, the MFA couldn't be prompted for (%v)", err))
+		}
+		return "", withExitCode(ExitCodeAuthFailed, errors.Wrap(err, "error authenticating to IdP"))
 	}
 
-	if samlAssertion == "" {
-		fmt.Println("Response did not contain a valid SAML assertion")
-		fmt.Println("Please check your username and password is correct")
-		os.Exit(1)
+	logger.WithField("bytes", len(samlAssertion)).Debug("received SAML assertion from IdP")
+
+	return samlAssertion, nil
+}
+
+// loginRecorder records the outcome of a login to the metrics pushgateway and audit log when configured
+type loginRecorder struct {
+	account    *cfg.IDPAccount
+	idpAccount string
+	role       string
+	started    time.Time
+	pusher     *metrics.Pusher
+}
+
+func newLoginRecorder(account *cfg.IDPAccount, idpAccount string) *loginRecorder {
+	return &loginRecorder{
+		account:    account,
+		idpAccount: idpAccount,
+		started:    time.Now(),
+		pusher:     metrics.NewPusher(account.MetricsPushgatewayURL),
 	}
+}
 
-	err = credentials.SaveCredentials(loginDetails.URL, loginDetails.Username, loginDetails.Password)
+// record the outcome of this login, failing to record is logged rather than failing the login
+func (r *loginRecorder) record(failureClass string) {
+	duration := time.Since(r.started)
+
+	err := r.pusher.Push(&metrics.Login{
+		Provider:     r.account.Provider,
+		FailureClass: failureClass,
+		Duration:     duration,
+		Finished:     r.started.Add(duration),
+	})
 	if err != nil {
-		return errors.Wrap(err, "error storing password in keychain")
+		logrus.WithError(err).Warn("unable to push login metrics")
+	}
+
+	if r.account.AuditLogFile == "" {
+		return
 	}
 
-	role, err := selectAwsRole(samlAssertion, account)
+	err = audit.Append(r.account.AuditLogFile, &audit.Event{
+		Timestamp:       r.started,
+		IdpAccount:      r.idpAccount,
+		Profile:         r.account.Profile,
+		Provider:        r.account.Provider,
+		Role:            r.role,
+		Success:         failureClass == "",
+		FailureClass:    failureClass,
+		DurationSeconds: duration.Seconds(),
+	})
 	if err != nil {
-		return errors.Wrap(err, "Failed to assume role, please check you are permitted to assume the given role for the AWS service")
+		logrus.WithError(err).Warn("unable to write audit log")
 	}
+}
 
-	fmt.Println("Selected role:", role.RoleARN)
+// runConfigure the configure wizard offered when login can't find the idp account
+var runConfigure = Configure
 
-	awsCreds, err := loginToStsUsingRole(account, role, samlAssertion)
+// roleCachePath the file the AWS accounts of the roles are cached in when cache_roles is set
+var roleCachePath = saml2aws.DefaultRoleCachePath
+
+// buildLoginIdpAccount build the idp account for login, offering to run the configure wizard if it doesn't exist
+func buildLoginIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error) {
+	account, err := buildIdpAccount(loginFlags)
+	if !cfg.IsErrIdpAccountNotFound(err) || loginFlags.NoWizard || loginFlags.CommonFlags.SkipPrompt {
+		return account, err
+	}
+
+	fmt.Printf("No configuration found for IDP account: %s\n", loginFlags.CommonFlags.IdpAccount)
+
+	if prompter.Choose("Would you like to configure it now", []string{"Yes", "No"}) != 0 {
+		return nil, err
+	}
+
+	err = runConfigure(loginFlags.CommonFlags)
 	if err != nil {
-		return errors.Wrap(err, "error logging into aws role using saml assertion")
+		return nil, errors.Wrap(err, "failed to configure idp account")
 	}
 
-	return saveCredentials(awsCreds, sharedCreds)
+	return buildIdpAccount(loginFlags)
 }
 
 func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error) {
-	cfgm, err := cfg.NewConfigManager(cfg.DefaultConfigPath)
+	cfgm, err := cfg.NewConfigManager(loginFlags.CommonFlags.ConfigFile)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load configuration")
 	}
 
-	account, err := cfgm.LoadVerifyIDPAccount(loginFlags.CommonFlags.IdpAccount)
+	account, err := cfgm.LoadIDPAccountWithEnv(loginFlags.CommonFlags.IdpAccount)
 	if err != nil {
 		if cfg.IsErrIdpAccountNotFound(err) {
-			fmt.Printf("%v\n", err)
-			os.Exit(1)
+			return nil, err
 		}
 		return nil, errors.Wrap(err, "failed to load idp account")
 	}
@@ -117,6 +381,11 @@ func buildIdpAccount(loginFlags *flags.LoginExecFlags) (*cfg.IDPAccount, error)
 	// update username and hostname if supplied
 	flags.ApplyFlagOverrides(loginFlags.CommonFlags, account)
 
+	// a role known up front decides the profile now, otherwise login decides it once the role is selected
+	account.Profile = account.ProfileForRole(account.RoleARN)
+
+	account.NormalizeURLs()
+
 	err = account.Validate()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to validate account")
@@ -152,6 +421,30 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 		loginDetails.Password = loginFlags.CommonFlags.Password
 	}
 
+	if loginFlags.CommonFlags.PasswordFd != "" && loginFlags.CommonFlags.PasswordStdin {
+		return nil, errors.New("--password-fd and --password-stdin can't be used together")
+	}
+
+	// a password read from a file descriptor avoids it appearing in the process args or env
+	if loginFlags.CommonFlags.PasswordFd != "" {
+		fd, err := strconv.Atoi(loginFlags.CommonFlags.PasswordFd)
+		if err != nil {
+			return nil, errors.Errorf("invalid password file descriptor: %s", loginFlags.CommonFlags.PasswordFd)
+		}
+
+		loginDetails.Password, err = creds.ReadPasswordFromFd(fd)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading password")
+		}
+	}
+
+	if loginFlags.CommonFlags.PasswordStdin {
+		loginDetails.Password, err = creds.ReadPasswordFromStdin()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading password")
+		}
+	}
+
 	// fmt.Printf("loginDetails %+v\n", loginDetails)
 
 	// if skip prompt was passed just pass back the flag values
@@ -167,7 +460,17 @@ func resolveLoginDetails(account *cfg.IDPAccount, loginFlags *flags.LoginExecFla
 	return loginDetails, nil
 }
 
-func selectAwsRole(samlAssertion string, account *cfg.IDPAccount) (*saml2aws.AWSRole, error) {
+func selectAwsRole(samlAssertion string, account *cfg.IDPAccount, unavailable map[string]bool) (*saml2aws.AWSRole, error) {
+	awsRoles, err := parseAwsRoles(samlAssertion, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveRole(awsRoles, samlAssertion, account, unavailable)
+}
+
+// parseAwsRoles the roles offered by the assertion, or by the AWS signin page when the assertion doesn't list them
+func parseAwsRoles(samlAssertion string, account *cfg.IDPAccount) ([]*saml2aws.AWSRole, error) {
 	data, err := base64.StdEncoding.DecodeString(samlAssertion)
 	if err != nil {
 		return nil, errors.Wrap(err, "error decoding saml assertion")
@@ -178,24 +481,46 @@ func selectAwsRole(samlAssertion string, account *cfg.IDPAccount) (*saml2aws.AWS
 		return nil, errors.Wrap(err, "error parsing aws roles")
 	}
 
+	var awsRoles []*saml2aws.AWSRole
+
 	if len(roles) == 0 {
-		fmt.Println("No roles to assume")
-		fmt.Println("Please check you are permitted to assume roles for the AWS service")
-		os.Exit(1)
+		// fall back to the roles listed on the AWS signin role selection page
+		logrus.WithField("command", "login").Debug("no roles in assertion, checking AWS signin page")
+
+		awsRoles, err = saml2aws.ParseAWSRolesFromSigninPage(account, samlAssertion)
+		if err != nil && err != saml2aws.ErrNotRoleSelectionPage {
+			return nil, errors.Wrap(err, "error parsing aws roles from signin page")
+		}
+	} else {
+		awsRoles, err = saml2aws.ParseAWSRoles(roles)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing aws roles")
+		}
 	}
 
-	awsRoles, err := saml2aws.ParseAWSRoles(roles)
-	if err != nil {
-		return nil, errors.Wrap(err, "error parsing aws roles")
+	if len(awsRoles) == 0 {
+		return nil, errors.New("No roles to assume, please check you are permitted to assume roles for the AWS service")
 	}
 
-	return resolveRole(awsRoles, samlAssertion, account)
+	return awsRoles, nil
 }
 
-func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, account *cfg.IDPAccount) (*saml2aws.AWSRole, error) {
+func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, account *cfg.IDPAccount, unavailable map[string]bool) (*saml2aws.AWSRole, error) {
 	var role = new(saml2aws.AWSRole)
 
-	if len(awsRoles) == 1 {
+	available := 0
+	for _, awsRole := range awsRoles {
+		awsRole.Unavailable = unavailable[awsRole.RoleARN]
+		if !awsRole.Unavailable {
+			available++
+		}
+	}
+
+	if len(awsRoles) > 0 && available == 0 {
+		return nil, saml2aws.ErrRoleUnavailable
+	}
+
+	if len(awsRoles) == 1 && !account.PromptSingleRole {
 		if account.RoleARN != "" {
 			return saml2aws.LocateRole(awsRoles, account.RoleARN)
 		}
@@ -204,15 +529,29 @@ func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, account *cf
 		return nil, errors.New("no roles available")
 	}
 
-	awsAccounts, err := saml2aws.ParseAWSAccounts(samlAssertion)
+	// a configured role is picked from the assertion, the account names are only needed to prompt
+	if role, ok := saml2aws.LocatePreferredRole(awsRoles, account); ok {
+		return role, nil
+	}
+
+	if account.RoleARN != "" {
+		return saml2aws.LocateRole(awsRoles, account.RoleARN)
+	}
+
+	awsAccounts, err := roleAccounts(awsRoles, samlAssertion, account)
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing aws role accounts")
 	}
 
 	saml2aws.AssignPrincipals(awsRoles, awsAccounts)
 
-	if account.RoleARN != "" {
-		return saml2aws.LocateRole(awsRoles, account.RoleARN)
+	awsAccounts, err = filterDisplayRoles(awsAccounts, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if role := autoSelectRole(awsAccounts, account); role != nil {
+		return role, nil
 	}
 
 	for {
@@ -220,56 +559,179 @@ func resolveRole(awsRoles []*saml2aws.AWSRole, samlAssertion string, account *cf
 		if err == nil {
 			break
 		}
+		if errors.Cause(err) == prompter.ErrPromptRequired {
+			return nil, withExitCode(ExitCodeRoleAmbiguous, ErrRoleAmbiguous)
+		}
 		fmt.Println("error selecting role, try again")
 	}
 
 	return role, nil
 }
 
-func loginToStsUsingRole(account *cfg.IDPAccount, role *saml2aws.AWSRole, samlAssertion string) (*awsconfig.AWSCredentials, error) {
+// roleAccounts the AWS accounts the roles belong to, from the role cache when cache_roles is set and the cached
+// accounts list the same roles as the assertion, otherwise from the signin page
+func roleAccounts(awsRoles []*saml2aws.AWSRole, samlAssertion string, account *cfg.IDPAccount) ([]*saml2aws.AWSAccount, error) {
+	if !account.CacheRoles {
+		return saml2aws.ParseAWSAccounts(account, samlAssertion)
+	}
+
+	cache := saml2aws.NewRoleCache(roleCachePath)
+	key := saml2aws.RoleCacheKey(account)
+
+	if !account.RefreshRoles {
+		if awsAccounts, ok := cache.Get(key, awsRoles); ok {
+			logrus.WithField("command", "login").Debug("using cached aws role accounts")
+			return awsAccounts, nil
+		}
+	}
 
-	sess, err := session.NewSession()
+	awsAccounts, err := saml2aws.ParseAWSAccounts(account, samlAssertion)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create session")
+		return nil, err
 	}
 
-	svc := sts.New(sess)
+	err = cache.Put(key, awsAccounts)
+	if err != nil {
+		logrus.WithField("command", "login").WithError(err).Debug("unable to cache aws role accounts")
+	}
 
-	params := &sts.AssumeRoleWithSAMLInput{
-		PrincipalArn:    aws.String(role.PrincipalARN), // Required
-		RoleArn:         aws.String(role.RoleARN),      // Required
-		SAMLAssertion:   aws.String(samlAssertion),     // Required
-		DurationSeconds: aws.Int64(int64(account.SessionDuration)),
+	return awsAccounts, nil
+}
+
+// autoSelectRole return the only role available for selection, unless the account forces the prompt
+func autoSelectRole(awsAccounts []*saml2aws.AWSAccount, account *cfg.IDPAccount) *saml2aws.AWSRole {
+	if account.PromptSingleRole || saml2aws.CountRoles(awsAccounts) != 1 {
+		return nil
 	}
 
-	fmt.Println("Requesting AWS credentials using SAML assertion")
+	for _, awsAccount := range awsAccounts {
+		if len(awsAccount.Roles) == 1 {
+			return awsAccount.Roles[0]
+		}
+	}
+
+	return nil
+}
+
+// filterDisplayRoles apply the configured filters to the accounts and ensure the number of roles
+// left to choose from doesn't exceed the maximum which can be displayed
+func filterDisplayRoles(awsAccounts []*saml2aws.AWSAccount, account *cfg.IDPAccount) ([]*saml2aws.AWSAccount, error) {
+	awsAccounts = saml2aws.FilterAWSAccounts(awsAccounts, account.AccountFilter, account.RoleFilter)
+
+	count := saml2aws.CountRoles(awsAccounts)
+	if count == 0 {
+		return nil, errors.New("no roles available matching the supplied filters")
+	}
+
+	if account.MaxDisplayRoles > 0 && count > account.MaxDisplayRoles {
+		return nil, errors.Errorf("%d roles available which exceeds the maximum of %d, use --role-filter or --account-filter to narrow the list", count, account.MaxDisplayRoles)
+	}
+
+	return awsAccounts, nil
+}
+
+// sessionDurationWarning a warning when the requested session duration exceeds the SessionDuration attribute in the
+// assertion, AWS clamps the credentials to the attribute so an empty string is returned when there is no attribute
+//
+// An attribute which can't be parsed is warned about and the requested session duration is used.
+func sessionDurationWarning(samlAssertion string, requested int) string {
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return ""
+	}
+
+	duration, err := saml2aws.ExtractSessionDuration(data)
+	if invalid, ok := err.(saml2aws.ErrInvalidSessionDuration); ok {
+		return fmt.Sprintf("Warning: ignoring the SessionDuration attribute %q from the IdP, using the requested session duration of %d seconds", invalid.Value, requested)
+	}
+	if err != nil {
+		logrus.WithField("command", "login").WithError(err).Debug("unable to extract session duration")
+		return ""
+	}
+
+	if duration == 0 || int64(requested) <= duration {
+		return ""
+	}
+
+	return fmt.Sprintf("Warning: requested session duration of %d seconds exceeds the %d seconds allowed by the IdP, the credentials will expire sooner", requested, duration)
+}
+
+// validateTransitiveTagKeys verify the session tags which must survive role chaining are transitive in the assertion
+func validateTransitiveTagKeys(samlAssertion string, account *cfg.IDPAccount) error {
+	keys := account.TransitiveTagKeyList()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return errors.Wrap(err, "error decoding saml assertion")
+	}
 
-	resp, err := svc.AssumeRoleWithSAML(params)
+	err = saml2aws.ValidateTransitiveTagKeys(data, keys)
 	if err != nil {
-		return nil, errors.Wrap(err, "error retrieving STS credentials using SAML")
+		return errors.Wrap(err, "transitive session tags are not configured on the IdP")
 	}
 
-	return &awsconfig.AWSCredentials{
-		AWSAccessKey:     aws.StringValue(resp.Credentials.AccessKeyId),
-		AWSSecretKey:     aws.StringValue(resp.Credentials.SecretAccessKey),
-		AWSSessionToken:  aws.StringValue(resp.Credentials.SessionToken),
-		AWSSecurityToken: aws.StringValue(resp.Credentials.SessionToken),
-		PrincipalARN:     aws.StringValue(resp.AssumedRoleUser.Arn),
-		Expires:          resp.Credentials.Expiration.Local(),
-	}, nil
+	return nil
 }
 
-func saveCredentials(awsCreds *awsconfig.AWSCredentials, sharedCreds *awsconfig.CredentialsProvider) error {
-	err := sharedCreds.Save(awsCreds)
+// validateDestination when enabled abort unless the assertion was issued for the signin endpoint it will be posted to
+func validateDestination(samlAssertion string, account *cfg.IDPAccount) error {
+	if !account.VerifyDestination {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
 	if err != nil {
-		return errors.Wrap(err, "error saving credentials")
+		return errors.Wrap(err, "error decoding saml assertion")
 	}
 
-	fmt.Println("Logged in as:", awsCreds.PrincipalARN)
-	fmt.Println("")
-	fmt.Println("Your new access key pair has been stored in the AWS configuration")
-	fmt.Printf("Note that it will expire at %v\n", awsCreds.Expires)
-	fmt.Println("To use this credential, call the AWS CLI with the --profile option (e.g. aws --profile", sharedCreds.Profile, "ec2 describe-instances).")
+	err = saml2aws.ValidateDestination(data, saml2aws.SigninEndpoint(account))
+	if err != nil {
+		return errors.Wrap(err, "SAML assertion may have been misdirected")
+	}
 
 	return nil
 }
+
+func loginToStsUsingRole(account *cfg.IDPAccount, role *saml2aws.AWSRole, samlAssertion string) (*awsconfig.AWSCredentials, error) {
+
+	fmt.Println("Requesting AWS credentials using SAML assertion")
+
+	return saml2aws.AssumeRoleWithSAML(context.Background(), account, role, samlAssertion)
+}
+
+// newSharedCredentials create the credentials provider for the account using any configured key names
+func newSharedCredentials(account *cfg.IDPAccount) *awsconfig.CredentialsProvider {
+	sharedCreds := awsconfig.NewSharedCredentials(account.Profile)
+	sharedCreds.Filename = account.CredentialsFile()
+	sharedCreds.KeyNames = &awsconfig.KeyNames{
+		AccessKey:     account.CredentialsAccessKeyName,
+		SecretKey:     account.CredentialsSecretKeyName,
+		SessionToken:  account.CredentialsSessionTokenName,
+		SecurityToken: account.CredentialsSecurityTokenName,
+	}
+	sharedCreds.ReplaceSymlinks = !account.FollowSymlinks
+
+	return sharedCreds
+}
+
+// profileCollisionWarning when enabled warn if the profile was last written by a different idp account
+func profileCollisionWarning(account *cfg.IDPAccount, sharedCreds *awsconfig.CredentialsProvider) string {
+	if !account.WarnOnProfileCollision || sharedCreds.IdpAccount == "" {
+		return ""
+	}
+
+	last, err := sharedCreds.LastIdpAccount()
+	if err != nil {
+		logrus.WithError(err).Debug("unable to read the idp account which last wrote the profile")
+		return ""
+	}
+
+	if last == "" || last == sharedCreds.IdpAccount {
+		return ""
+	}
+
+	return fmt.Sprintf("Warning: profile %s holds credentials from idp account %s, they will be overwritten by %s", sharedCreds.Profile, last, sharedCreds.IdpAccount)
+}
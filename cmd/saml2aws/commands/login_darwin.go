@@ -7,4 +7,5 @@ import (
 
 func init() {
 	credentials.CurrentHelper = &osxkeychain.Osxkeychain{}
+	credentials.CurrentKeyring = &osxkeychain.Osxkeychain{}
 }
@@ -0,0 +1,15 @@
+package commands
+
+import (
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/helper/secretservice"
+)
+
+func init() {
+	credentials.CurrentKeyring = &secretservice.SecretService{}
+
+	// without a Secret Service the password is prompted for as before rather than failing every lookup
+	if secretservice.Available() {
+		credentials.CurrentHelper = &secretservice.SecretService{}
+	}
+}
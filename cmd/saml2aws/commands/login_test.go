@@ -1,13 +1,29 @@
 package commands
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/awsconfig"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
 	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/vfs"
 )
 
 func TestResolveLoginDetailsWithFlags(t *testing.T) {
@@ -27,6 +43,30 @@ func TestResolveLoginDetailsWithFlags(t *testing.T) {
 	assert.Equal(t, &creds.LoginDetails{Username: "wolfeidau", Password: "testtestlol", URL: "https://id.example.com", MFAToken: "123456"}, loginDetails)
 }
 
+func TestResolveLoginDetailsWithPasswordFd(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+
+	_, err = w.WriteString("frompipe\n")
+	assert.Nil(t, err)
+	w.Close()
+
+	commonFlags := &flags.CommonFlags{URL: "https://id.example.com", Username: "wolfeidau", PasswordFd: strconv.Itoa(int(r.Fd())), SkipPrompt: true}
+	loginFlags := &flags.LoginExecFlags{CommonFlags: commonFlags}
+
+	idpa := &cfg.IDPAccount{
+		URL:      "https://id.example.com",
+		MFA:      "none",
+		Provider: "Ping",
+		Username: "wolfeidau",
+	}
+	loginDetails, err := resolveLoginDetails(idpa, loginFlags)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "frompipe", loginDetails.Password)
+}
+
 func TestResolveRoleSingleEntry(t *testing.T) {
 
 	adminRole := &saml2aws.AWSRole{
@@ -39,7 +79,513 @@ func TestResolveRoleSingleEntry(t *testing.T) {
 		adminRole,
 	}
 
-	got, err := resolveRole(awsRoles, "", cfg.NewIDPAccount())
+	got, err := resolveRole(awsRoles, "", cfg.NewIDPAccount(), nil)
 	assert.Empty(t, err)
 	assert.Equal(t, got, adminRole)
 }
+
+func TestResolveRoleUnavailable(t *testing.T) {
+
+	adminRole := &saml2aws.AWSRole{
+		Name:         "admin",
+		RoleARN:      "arn:aws:iam::456456456456:role/admin",
+		PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp",
+	}
+
+	// the only role is in a closed account so there is nothing left to offer
+	_, err := resolveRole([]*saml2aws.AWSRole{adminRole}, "", cfg.NewIDPAccount(), map[string]bool{adminRole.RoleARN: true})
+	assert.Equal(t, saml2aws.ErrRoleUnavailable, err)
+	assert.True(t, adminRole.Unavailable)
+}
+
+const singleRoleSigninPage = `<html><body><form id="saml_form"><fieldset>
+<div class="saml-account"><div class="saml-account-name">Account: 456456456456</div>
+<div class="saml-role"><label for="arn:aws:iam::456456456456:role/admin">admin</label></div>
+</div>
+</fieldset></form></body></html>`
+
+func TestResolveRoleSingleEntryPrompt(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(singleRoleSigninPage))
+	}))
+	defer ts.Close()
+
+	adminRole := &saml2aws.AWSRole{
+		RoleARN:      "arn:aws:iam::456456456456:role/admin",
+		PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp",
+	}
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("ChooseWithDefault", "Please choose the role", "", []string{"admin / Account: 456456456456"}).Return("admin / Account: 456456456456", nil)
+
+	account := cfg.NewIDPAccount()
+	account.PromptSingleRole = true
+	account.SAMLSigninEndpoint = ts.URL
+
+	got, err := resolveRole([]*saml2aws.AWSRole{adminRole}, "", account, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::456456456456:role/admin", got.RoleARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/example-idp", got.PrincipalARN)
+
+	pr.Mock.AssertNumberOfCalls(t, "ChooseWithDefault", 1)
+}
+
+const twoRoleSigninPage = `<html><body><form id="saml_form"><fieldset>
+<div class="saml-account"><div class="saml-account-name">Account: 456456456456</div>
+<div class="saml-role"><label for="arn:aws:iam::456456456456:role/admin">admin</label></div>
+<div class="saml-role"><label for="arn:aws:iam::456456456456:role/read">read</label></div>
+</div>
+</fieldset></form></body></html>`
+
+func twoRoles() []*saml2aws.AWSRole {
+	return []*saml2aws.AWSRole{
+		{RoleARN: "arn:aws:iam::456456456456:role/admin", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp"},
+		{RoleARN: "arn:aws:iam::456456456456:role/read", PrincipalARN: "arn:aws:iam::456456456456:saml-provider/example-idp"},
+	}
+}
+
+func TestResolveRoleByARNSkipsSigninPage(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the signin page isn't needed when the role is configured")
+	}))
+	defer ts.Close()
+
+	account := cfg.NewIDPAccount()
+	account.SAMLSigninEndpoint = ts.URL
+	account.RoleARN = "arn:aws:iam::456456456456:role/read"
+
+	got, err := resolveRole(twoRoles(), "", account, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::456456456456:role/read", got.RoleARN)
+}
+
+func TestResolveRoleAmbiguousWithoutPrompt(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(twoRoleSigninPage))
+	}))
+	defer ts.Close()
+
+	previous := prompter.SetPrompter(prompter.NewNonInteractive())
+	defer prompter.SetPrompter(previous)
+
+	account := cfg.NewIDPAccount()
+	account.SAMLSigninEndpoint = ts.URL
+
+	_, err := resolveRole(twoRoles(), "", account, nil)
+	assert.EqualError(t, err, ErrRoleAmbiguous.Error())
+
+	code, ok := LoginExitCode(errors.Wrap(err, "Failed to assume role"))
+	assert.True(t, ok)
+	assert.Equal(t, ExitCodeRoleAmbiguous, code)
+}
+
+func TestResolveRolePromptUnavailable(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(twoRoleSigninPage))
+	}))
+	defer ts.Close()
+
+	options := []string{
+		"admin / Account: 456456456456 (unavailable, account suspended or closed)",
+		"read / Account: 456456456456",
+	}
+
+	// picking the unavailable role prompts again
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("ChooseWithDefault", "Please choose the role", "", options).Return(options[0], nil).Once()
+	pr.Mock.On("ChooseWithDefault", "Please choose the role", "", options).Return(options[1], nil).Once()
+
+	account := cfg.NewIDPAccount()
+	account.SAMLSigninEndpoint = ts.URL
+
+	got, err := resolveRole(twoRoles(), "", account, map[string]bool{"arn:aws:iam::456456456456:role/admin": true})
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::456456456456:role/read", got.RoleARN)
+	assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/example-idp", got.PrincipalARN)
+
+	pr.Mock.AssertNumberOfCalls(t, "ChooseWithDefault", 2)
+}
+
+func TestResolveLoginDetailsWithPasswordStdin(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = r
+
+	_, err = w.WriteString("fromstdin\n")
+	assert.Nil(t, err)
+	w.Close()
+
+	commonFlags := &flags.CommonFlags{URL: "https://id.example.com", Username: "wolfeidau", PasswordStdin: true, SkipPrompt: true}
+	loginFlags := &flags.LoginExecFlags{CommonFlags: commonFlags}
+
+	idpa := &cfg.IDPAccount{
+		URL:      "https://id.example.com",
+		MFA:      "none",
+		Provider: "Ping",
+		Username: "wolfeidau",
+	}
+	loginDetails, err := resolveLoginDetails(idpa, loginFlags)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fromstdin", loginDetails.Password)
+
+	// only one source of the password can be used
+	commonFlags.PasswordFd = "3"
+	_, err = resolveLoginDetails(idpa, loginFlags)
+	assert.EqualError(t, err, "--password-fd and --password-stdin can't be used together")
+}
+
+func TestResolveRoleCached(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(path string) { roleCachePath = path }(roleCachePath)
+	roleCachePath = filepath.Join(dir, "roles.json")
+
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte(twoRoleSigninPage))
+	}))
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("ChooseWithDefault", "Please choose the role", "", []string{"admin / Account: 456456456456", "read / Account: 456456456456"}).Return("read / Account: 456456456456", nil)
+
+	account := cfg.NewIDPAccount()
+	account.SAMLSigninEndpoint = ts.URL
+	account.CacheRoles = true
+
+	for i := 0; i < 2; i++ {
+		got, err := resolveRole(twoRoles(), "", account, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "arn:aws:iam::456456456456:role/read", got.RoleARN)
+		assert.Equal(t, "arn:aws:iam::456456456456:saml-provider/example-idp", got.PrincipalARN)
+	}
+	assert.Equal(t, 1, fetches)
+
+	account.RefreshRoles = true
+
+	_, err = resolveRole(twoRoles(), "", account, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestAutoSelectRole(t *testing.T) {
+
+	awsAccounts := []*saml2aws.AWSAccount{
+		{Name: "Account: account-alias (000000000001)"},
+		{
+			Name: "Account: 000000000002",
+			Roles: []*saml2aws.AWSRole{
+				{RoleARN: "arn:aws:iam::000000000002:role/Development"},
+			},
+		},
+	}
+
+	account := cfg.NewIDPAccount()
+
+	role := autoSelectRole(awsAccounts, account)
+	assert.Equal(t, "arn:aws:iam::000000000002:role/Development", role.RoleARN)
+
+	account.PromptSingleRole = true
+	assert.Nil(t, autoSelectRole(awsAccounts, account))
+
+	account.PromptSingleRole = false
+	awsAccounts[0].Roles = []*saml2aws.AWSRole{{RoleARN: "arn:aws:iam::000000000001:role/Production"}}
+	assert.Nil(t, autoSelectRole(awsAccounts, account))
+}
+
+func TestFilterDisplayRolesUnderThreshold(t *testing.T) {
+
+	awsAccounts := []*saml2aws.AWSAccount{
+		{
+			Name: "Account: account-alias (000000000001)",
+			Roles: []*saml2aws.AWSRole{
+				{RoleARN: "arn:aws:iam::000000000001:role/Development"},
+				{RoleARN: "arn:aws:iam::000000000001:role/Production"},
+			},
+		},
+	}
+
+	account := cfg.NewIDPAccount()
+	account.MaxDisplayRoles = 2
+
+	got, err := filterDisplayRoles(awsAccounts, account)
+	assert.Empty(t, err)
+	assert.Equal(t, awsAccounts, got)
+}
+
+func TestFilterDisplayRolesOverThreshold(t *testing.T) {
+
+	awsAccounts := []*saml2aws.AWSAccount{
+		{
+			Name: "Account: account-alias (000000000001)",
+			Roles: []*saml2aws.AWSRole{
+				{RoleARN: "arn:aws:iam::000000000001:role/Development"},
+				{RoleARN: "arn:aws:iam::000000000001:role/Production"},
+			},
+		},
+		{
+			Name: "Account: 000000000002",
+			Roles: []*saml2aws.AWSRole{
+				{RoleARN: "arn:aws:iam::000000000002:role/Production"},
+			},
+		},
+	}
+
+	account := cfg.NewIDPAccount()
+	account.MaxDisplayRoles = 2
+
+	_, err := filterDisplayRoles(awsAccounts, account)
+	assert.Error(t, err)
+
+	account.RoleFilter = "development"
+
+	got, err := filterDisplayRoles(awsAccounts, account)
+	assert.Empty(t, err)
+	assert.Equal(t, 1, saml2aws.CountRoles(got))
+	assert.Equal(t, "arn:aws:iam::000000000001:role/Development", got[0].Roles[0].RoleARN)
+
+	account.RoleFilter = ""
+	account.AccountFilter = "000000000002"
+
+	got, err = filterDisplayRoles(awsAccounts, account)
+	assert.Empty(t, err)
+	assert.Equal(t, 1, saml2aws.CountRoles(got))
+}
+
+func TestLoginRecorderAuditLog(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	account := &cfg.IDPAccount{
+		Provider:     "Okta",
+		Profile:      "saml",
+		AuditLogFile: filepath.Join(dir, "audit.log"),
+	}
+
+	recorder := newLoginRecorder(account, "default")
+	recorder.record("idp")
+	recorder.role = "arn:aws:iam::123456789012:role/Admin"
+	recorder.record("")
+
+	data, err := ioutil.ReadFile(account.AuditLogFile)
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+
+	event := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &event))
+
+	assert.Equal(t, "default", event["idp_account"])
+	assert.Equal(t, "Okta", event["provider"])
+	assert.Equal(t, "arn:aws:iam::123456789012:role/Admin", event["role"])
+	assert.Equal(t, true, event["success"])
+
+	// only these fields may be written, nothing secret is recorded
+	for key := range event {
+		assert.Contains(t, []string{"timestamp", "idp_account", "profile", "provider", "role", "success", "failure_class", "duration_seconds"}, key)
+	}
+}
+
+const attributeAssertion = `<?xml version="1.0" encoding="UTF-8"?>
+<saml2p:Response xmlns:saml2p="urn:oasis:names:tc:SAML:2.0:protocol">
+  <saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion">
+    <saml2:AttributeStatement>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml2:AttributeValue>arn:aws:iam::456456456456:saml-provider/example-idp,arn:aws:iam::456456456456:role/admin</saml2:AttributeValue>
+      </saml2:Attribute>
+      %s
+    </saml2:AttributeStatement>
+  </saml2:Assertion>
+</saml2p:Response>`
+
+const sessionDurationAttribute = `<saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/SessionDuration">
+        <saml2:AttributeValue>3600</saml2:AttributeValue>
+      </saml2:Attribute>`
+
+func TestSessionDurationWarning(t *testing.T) {
+
+	samlAssertion := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(attributeAssertion, sessionDurationAttribute)))
+
+	assert.Equal(t, "Warning: requested session duration of 7200 seconds exceeds the 3600 seconds allowed by the IdP, the credentials will expire sooner", sessionDurationWarning(samlAssertion, 7200))
+	assert.Empty(t, sessionDurationWarning(samlAssertion, 3600))
+	assert.Empty(t, sessionDurationWarning(samlAssertion, 900))
+}
+
+func TestSessionDurationWarningInvalidAttribute(t *testing.T) {
+
+	attribute := strings.Replace(sessionDurationAttribute, "3600", "abc", 1)
+	samlAssertion := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(attributeAssertion, attribute)))
+
+	assert.Equal(t, `Warning: ignoring the SessionDuration attribute "abc" from the IdP, using the requested session duration of 7200 seconds`, sessionDurationWarning(samlAssertion, 7200))
+
+	// whitespace around the value is tolerated
+	attribute = strings.Replace(sessionDurationAttribute, "3600", " 3600.0 ", 1)
+	samlAssertion = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(attributeAssertion, attribute)))
+
+	assert.Equal(t, "Warning: requested session duration of 7200 seconds exceeds the 3600 seconds allowed by the IdP, the credentials will expire sooner", sessionDurationWarning(samlAssertion, 7200))
+}
+
+func TestSessionDurationWarningMissingAttribute(t *testing.T) {
+
+	samlAssertion := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(attributeAssertion, "")))
+
+	assert.Empty(t, sessionDurationWarning(samlAssertion, 43200))
+	assert.Empty(t, sessionDurationWarning("not base64!", 43200))
+}
+
+func TestBuildLoginIdpAccountWizard(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, ".saml2aws")
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("Choose", "Would you like to configure it now", []string{"Yes", "No"}).Return(0)
+
+	var configured bool
+
+	runConfigure = func(commonFlags *flags.CommonFlags) error {
+		configured = true
+
+		cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+		assert.Nil(t, err)
+
+		account := cfg.NewIDPAccount()
+		account.URL = "https://id.example.com"
+		account.Provider = "KeyCloak"
+		account.MFA = "Auto"
+
+		return cfgm.SaveIDPAccount(commonFlags.IdpAccount, account)
+	}
+	defer func() { runConfigure = Configure }()
+
+	loginFlags := &flags.LoginExecFlags{CommonFlags: &flags.CommonFlags{IdpAccount: "default", ConfigFile: configFile}}
+
+	account, err := buildLoginIdpAccount(loginFlags)
+	assert.Nil(t, err)
+	assert.True(t, configured)
+	assert.Equal(t, "https://id.example.com", account.URL)
+	assert.Equal(t, "KeyCloak", account.Provider)
+
+	pr.Mock.AssertNumberOfCalls(t, "Choose", 1)
+}
+
+func TestBuildLoginIdpAccountNoWizard(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+
+	runConfigure = func(commonFlags *flags.CommonFlags) error {
+		t.Fatal("configure wizard should not run")
+		return nil
+	}
+	defer func() { runConfigure = Configure }()
+
+	commonFlags := &flags.CommonFlags{IdpAccount: "default", ConfigFile: filepath.Join(dir, ".saml2aws")}
+
+	_, err = buildLoginIdpAccount(&flags.LoginExecFlags{CommonFlags: commonFlags, NoWizard: true})
+	assert.Equal(t, cfg.ErrIdpAccountNotFound, err)
+
+	commonFlags.SkipPrompt = true
+
+	_, err = buildLoginIdpAccount(&flags.LoginExecFlags{CommonFlags: commonFlags})
+	assert.Equal(t, cfg.ErrIdpAccountNotFound, err)
+
+	pr.Mock.AssertNotCalled(t, "Choose", "Would you like to configure it now", []string{"Yes", "No"})
+}
+
+func TestValidateTransitiveTagKeys(t *testing.T) {
+
+	samlAssertion := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(attributeAssertion, `<saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/PrincipalTag:Project">
+        <saml2:AttributeValue>Automation</saml2:AttributeValue>
+      </saml2:Attribute>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/TransitiveTagKeys">
+        <saml2:AttributeValue>Project</saml2:AttributeValue>
+      </saml2:Attribute>`)))
+
+	account := cfg.NewIDPAccount()
+	assert.Nil(t, validateTransitiveTagKeys(samlAssertion, account))
+
+	account.TransitiveTagKeys = "Project"
+	assert.Nil(t, validateTransitiveTagKeys(samlAssertion, account))
+
+	account.TransitiveTagKeys = "Project, CostCenter"
+	assert.Error(t, validateTransitiveTagKeys(samlAssertion, account))
+}
+
+func TestValidateDestination(t *testing.T) {
+
+	samlAssertion := base64.StdEncoding.EncodeToString([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" Destination="https://signin.aws.amazon.com/saml"></samlp:Response>`))
+
+	account := cfg.NewIDPAccount()
+	account.Region = "us-gov-west-1"
+	assert.Nil(t, validateDestination(samlAssertion, account))
+
+	account.VerifyDestination = true
+	assert.Error(t, validateDestination(samlAssertion, account))
+
+	account.Region = "us-east-1"
+	assert.Nil(t, validateDestination(samlAssertion, account))
+}
+
+func TestFederationURL(t *testing.T) {
+
+	account := cfg.NewIDPAccount()
+	assert.Equal(t, "https://signin.aws.amazon.com/federation", federationURL(account))
+
+	account.Region = "us-gov-west-1"
+	assert.Equal(t, "https://signin.amazonaws-us-gov.com/federation", federationURL(account))
+}
+
+func TestProfileCollisionWarning(t *testing.T) {
+	fsys := vfs.NewMemFS()
+
+	save := func(idpAccount string) *awsconfig.CredentialsProvider {
+		sharedCreds := &awsconfig.CredentialsProvider{Filename: "/home/test/.aws/credentials", Profile: "saml", FS: fsys, IdpAccount: idpAccount}
+
+		_, err := sharedCreds.CredsExists()
+		assert.Nil(t, err)
+
+		return sharedCreds
+	}
+
+	account := cfg.NewIDPAccount()
+
+	sharedCreds := save("prod")
+	assert.Empty(t, profileCollisionWarning(account, sharedCreds))
+	assert.Nil(t, sharedCreds.Save(&awsconfig.AWSCredentials{AWSAccessKey: "prodid", Expires: time.Now().Add(time.Hour)}))
+
+	// the same account writing its own profile again
+	assert.Empty(t, profileCollisionWarning(account, save("prod")))
+
+	assert.Equal(t, "Warning: profile saml holds credentials from idp account prod, they will be overwritten by dev", profileCollisionWarning(account, save("dev")))
+
+	account.WarnOnProfileCollision = false
+	assert.Empty(t, profileCollisionWarning(account, save("dev")))
+}
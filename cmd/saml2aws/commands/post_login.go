@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/shell"
+)
+
+// runPostLoginCmd run the configured post login command with the new credentials in its environment
+//
+// The credentials are only passed to the child process environment and are never logged. A failing
+// command is reported as a warning unless the account is configured to treat it as fatal.
+func runPostLoginCmd(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) error {
+	if account.PostLoginCmd == "" {
+		return nil
+	}
+
+	logrus.WithField("command", "login").WithField("postLoginCmd", account.PostLoginCmd).Debug("running post login command")
+
+	err := shell.ExecShellCmd([]string{account.PostLoginCmd}, shell.BuildEnvVars(awsCreds, account))
+	if err != nil {
+		if account.PostLoginCmdFatal {
+			return errors.Wrap(err, "error running post login command")
+		}
+
+		fmt.Printf("Warning: post login command failed: %v\n", err)
+	}
+
+	return nil
+}
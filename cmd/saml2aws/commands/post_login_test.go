@@ -0,0 +1,52 @@
+// +build !windows
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+var testCreds = &awsconfig.AWSCredentials{
+	AWSAccessKey:     "123",
+	AWSSecretKey:     "345",
+	AWSSessionToken:  "567",
+	AWSSecurityToken: "567",
+}
+
+func TestRunPostLoginCmdEnv(t *testing.T) {
+
+	account := &cfg.IDPAccount{
+		Profile:           "saml",
+		PostLoginCmd:      `test "$AWS_ACCESS_KEY_ID" = "123" && test "$AWS_SECRET_ACCESS_KEY" = "345" && test "$AWS_PROFILE" = "saml"`,
+		PostLoginCmdFatal: true,
+	}
+
+	err := runPostLoginCmd(account, testCreds)
+	assert.Nil(t, err)
+}
+
+func TestRunPostLoginCmdFailure(t *testing.T) {
+
+	account := &cfg.IDPAccount{
+		Profile:      "saml",
+		PostLoginCmd: "exit 3",
+	}
+
+	err := runPostLoginCmd(account, testCreds)
+	assert.Nil(t, err)
+
+	account.PostLoginCmdFatal = true
+
+	err = runPostLoginCmd(account, testCreds)
+	assert.Error(t, err)
+}
+
+func TestRunPostLoginCmdUnset(t *testing.T) {
+
+	err := runPostLoginCmd(&cfg.IDPAccount{PostLoginCmdFatal: true}, testCreds)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/shell"
+)
+
+// runPreLoginCmd run the configured pre login command, such as connecting a VPN or running kinit
+//
+// A failing command aborts the login with the stderr of the command.
+func runPreLoginCmd(account *cfg.IDPAccount) error {
+	if account.PreLoginCmd == "" {
+		return nil
+	}
+
+	logrus.WithField("command", "login").WithField("preLoginCmd", account.PreLoginCmd).Debug("running pre login command")
+
+	stderr := new(bytes.Buffer)
+
+	err := shell.ExecShellCmdWithStderr([]string{account.PreLoginCmd}, nil, stderr)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.Wrapf(err, "error running pre login command: %s", msg)
+		}
+
+		return errors.Wrap(err, "error running pre login command")
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// +build !windows
+
+package commands
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+func newPreLoginAccount(url, preLoginCmd string) *cfg.IDPAccount {
+	account := cfg.NewIDPAccount()
+	account.Provider = "KeyCloak"
+	account.MFA = "Auto"
+	account.URL = url
+	account.PreLoginCmd = preLoginCmd
+
+	return account
+}
+
+func TestAuthenticatePreLoginCmdRunsFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	marker := filepath.Join(dir, "connected")
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, err := os.Stat(marker)
+		assert.Nil(t, err, "IdP reached before the pre login command ran")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	account := newPreLoginAccount(ts.URL, "touch "+marker)
+
+	_, err = authenticate(account, &creds.LoginDetails{Username: "test", Password: "test123", URL: ts.URL}, newLoginRecorder(account, "default"))
+	require.Error(t, err)
+	require.NotZero(t, requests)
+}
+
+func TestAuthenticatePreLoginCmdFailure(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	account := newPreLoginAccount(ts.URL, "echo vpn unreachable >&2; exit 2")
+
+	_, err := authenticate(account, &creds.LoginDetails{Username: "test", Password: "test123", URL: ts.URL}, newLoginRecorder(account, "default"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "vpn unreachable")
+	require.Zero(t, requests)
+}
+
+func TestRunPreLoginCmdUnset(t *testing.T) {
+	require.Nil(t, runPreLoginCmd(&cfg.IDPAccount{}))
+}
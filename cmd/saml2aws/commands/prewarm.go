@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/helper/credentials"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// Prewarm refresh the expired credentials of several idp accounts concurrently, for example on shell startup
+//
+// Credentials expiring within refreshBefore are refreshed too. Nothing is prompted for, so each account needs its
+// password saved by an earlier login.
+func Prewarm(commonFlags *flags.CommonFlags, names []string, concurrency int, refreshBefore time.Duration) error {
+
+	if refreshBefore < 0 {
+		return errors.New("--refresh-before can't be negative")
+	}
+
+	cfgm, err := cfg.NewConfigManager(commonFlags.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	results := saml2aws.Prewarm(context.Background(), cfgm, names, saml2aws.PrewarmOptions{
+		Concurrency:   concurrency,
+		Cache:         &sharedCredentialsCache{},
+		LoginDetails:  savedLoginDetails(commonFlags),
+		RefreshBefore: refreshBefore,
+	})
+
+	failed := 0
+
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("%s: %v\n", result.Name, result.Err)
+		case result.Skipped:
+			fmt.Printf("%s: credentials are valid until %v skipping\n", result.Name, result.Credentials.Expires)
+		default:
+			fmt.Printf("%s: refreshed, expires at %v\n", result.Name, result.Credentials.Expires)
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("failed to refresh %d of %d idp accounts", failed, len(results))
+	}
+
+	return nil
+}
+
+// savedLoginDetails the login details of an account using the password saved in the keychain
+func savedLoginDetails(commonFlags *flags.CommonFlags) func(string, *cfg.IDPAccount) (creds.LoginDetails, error) {
+	return func(name string, account *cfg.IDPAccount) (creds.LoginDetails, error) {
+
+		// credentials are always stored against the primary URL
+		loginDetails := &creds.LoginDetails{URL: account.URL, Username: account.Username, MFAToken: commonFlags.MFAToken}
+
+		err := credentials.LookupCredentials(loginDetails, account.Provider)
+		if err != nil && !credentials.IsErrCredentialsNotFound(err) {
+			return creds.LoginDetails{}, errors.Wrap(err, "error loading saved password")
+		}
+
+		if loginDetails.Password == "" {
+			return creds.LoginDetails{}, errors.Errorf("no saved password, run 'saml2aws login -a %s' first", name)
+		}
+
+		// leave the URL to be resolved so a fallback URL is still used
+		loginDetails.URL = ""
+
+		return *loginDetails, nil
+	}
+}
+
+// sharedCredentialsCache the credentials each account is configured to use, saves are serialised as accounts can
+// share a credentials file
+type sharedCredentialsCache struct {
+	mu sync.Mutex
+}
+
+func (c *sharedCredentialsCache) Load(account *cfg.IDPAccount) (*awsconfig.AWSCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return loadCredentials(account, newSharedCredentials(account))
+}
+
+func (c *sharedCredentialsCache) Save(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return newCredentialsWriter(account, newSharedCredentials(account), os.Stdout).Write(awsCreds, account)
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/awsclient"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// newIAM the IAM client used to summarise the role permissions
+var newIAM = awsclient.NewIAM
+
+// printRolePermissions when enabled print the policies attached to the assumed role
+//
+// This is best effort, when the role can't read its own policies or IAM fails the summary is skipped.
+func printRolePermissions(w io.Writer, account *cfg.IDPAccount, role *saml2aws.AWSRole, awsCreds *awsconfig.AWSCredentials) {
+	if !account.ShowRolePermissions {
+		return
+	}
+
+	logger := logrus.WithField("command", "login").WithField("role", role.RoleARN)
+
+	svc, err := newIAM(account, awsCreds)
+	if err != nil {
+		logger.WithError(err).Warn("unable to create iam client for role permissions")
+		return
+	}
+
+	policies, err := awsclient.ListRolePolicies(svc, awsclient.RoleNameFromARN(role.RoleARN))
+	if err == awsclient.ErrIAMReadDenied {
+		fmt.Fprintln(w, "Skipping role permissions, the role is not permitted to read its IAM policies")
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Warn("unable to list role policies")
+		return
+	}
+
+	fmt.Fprint(w, rolePermissionsSummary(policies))
+}
+
+func rolePermissionsSummary(policies *awsclient.RolePolicies) string {
+	summary := fmt.Sprintf("Policies attached to role %s:\n", policies.RoleName)
+
+	if len(policies.ManagedPolicies) == 0 && len(policies.InlinePolicies) == 0 {
+		return summary + "  none\n"
+	}
+
+	for _, arn := range policies.ManagedPolicies {
+		summary += fmt.Sprintf("  managed: %s\n", arn)
+	}
+
+	for _, name := range policies.InlinePolicies {
+		summary += fmt.Sprintf("  inline:  %s\n", name)
+	}
+
+	return summary
+}
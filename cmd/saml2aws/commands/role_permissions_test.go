@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws"
+	"github.com/versent/saml2aws/pkg/awsclient"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+var roleCreds = &awsconfig.AWSCredentials{AWSAccessKey: "123", AWSSecretKey: "345", AWSSessionToken: "567"}
+
+func withMockIAM(svc iamiface.IAMAPI) func() {
+	orig := newIAM
+	newIAM = func(*cfg.IDPAccount, *awsconfig.AWSCredentials) (iamiface.IAMAPI, error) { return svc, nil }
+
+	return func() { newIAM = orig }
+}
+
+func TestPrintRolePermissions(t *testing.T) {
+	defer withMockIAM(awsclient.NewMemIAM([]string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}, []string{"s3-artifacts"}))()
+
+	account := &cfg.IDPAccount{ShowRolePermissions: true}
+	role := &saml2aws.AWSRole{RoleARN: "arn:aws:iam::123456789012:role/Developer"}
+
+	buf := new(bytes.Buffer)
+	printRolePermissions(buf, account, role, roleCreds)
+
+	assert.Equal(t, `Policies attached to role Developer:
+  managed: arn:aws:iam::aws:policy/ReadOnlyAccess
+  inline:  s3-artifacts
+`, buf.String())
+
+	// nothing is printed unless enabled
+	buf.Reset()
+	printRolePermissions(buf, &cfg.IDPAccount{}, role, roleCreds)
+	assert.Empty(t, buf.String())
+}
+
+func TestPrintRolePermissionsAccessDenied(t *testing.T) {
+	defer withMockIAM(&awsclient.MemIAM{Err: awserr.New("AccessDenied", "User is not authorized to perform: iam:ListAttachedRolePolicies", nil)})()
+
+	buf := new(bytes.Buffer)
+	printRolePermissions(buf, &cfg.IDPAccount{ShowRolePermissions: true}, &saml2aws.AWSRole{RoleARN: "arn:aws:iam::123456789012:role/Developer"}, roleCreds)
+
+	assert.Equal(t, "Skipping role permissions, the role is not permitted to read its IAM policies\n", buf.String())
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"text/template"
 	"time"
@@ -11,25 +12,25 @@ import (
 	"github.com/versent/saml2aws/pkg/flags"
 )
 
-const bashTmpl = `export AWS_ACCESS_KEY_ID="{{ .AWSAccessKey }}"
-export AWS_SECRET_ACCESS_KEY="{{ .AWSSecretKey }}"
-export AWS_SESSION_TOKEN="{{ .AWSSessionToken }}"
-export AWS_SECURITY_TOKEN="{{ .AWSSecurityToken }}"
+const bashTmpl = `export {{ .EnvPrefix }}AWS_ACCESS_KEY_ID="{{ .AWSAccessKey }}"
+export {{ .EnvPrefix }}AWS_SECRET_ACCESS_KEY="{{ .AWSSecretKey }}"
+export {{ .EnvPrefix }}AWS_SESSION_TOKEN="{{ .AWSSessionToken }}"
+export {{ .EnvPrefix }}AWS_SECURITY_TOKEN="{{ .AWSSecurityToken }}"
 export SAML2AWS_PROFILE="{{ .ProfileName }}"
 `
 
-const fishTmpl = `set -gx AWS_ACCESS_KEY_ID {{ .AWSAccessKey }}
-set -gx AWS_SECRET_ACCESS_KEY {{ .AWSSecretKey }}
-set -gx AWS_SESSION_TOKEM {{ .AWSSessionToken }}
-set -gx AWS_SECURITY_TOKEN {{ .AWSSecurityToken }}
+const fishTmpl = `set -gx {{ .EnvPrefix }}AWS_ACCESS_KEY_ID {{ .AWSAccessKey }}
+set -gx {{ .EnvPrefix }}AWS_SECRET_ACCESS_KEY {{ .AWSSecretKey }}
+set -gx {{ .EnvPrefix }}AWS_SESSION_TOKEM {{ .AWSSessionToken }}
+set -gx {{ .EnvPrefix }}AWS_SECURITY_TOKEN {{ .AWSSecurityToken }}
 set -gx SAML2AWS_PROFILE {{ .ProfileName }}
 "
 `
 
-const powershellTmpl = `$env:AWS_ACCESS_KEY_ID={{ .AWSAccessKey }}
-$env:AWS_SECRET_ACCESS_KEY=={{ .AWSSecretKey }}
-$env:AWS_SESSION_TOKEN={{ .AWSSessionToken }}
-$env:AWS_SECURITY_TOKEN={{ .AWSSecurityToken }}
+const powershellTmpl = `$env:{{ .EnvPrefix }}AWS_ACCESS_KEY_ID={{ .AWSAccessKey }}
+$env:{{ .EnvPrefix }}AWS_SECRET_ACCESS_KEY=={{ .AWSSecretKey }}
+$env:{{ .EnvPrefix }}AWS_SESSION_TOKEN={{ .AWSSessionToken }}
+$env:{{ .EnvPrefix }}AWS_SECURITY_TOKEN={{ .AWSSecurityToken }}
 $env:SAML2AWS_PROFILE={{ .ProfileName }}"
 `
 
@@ -40,25 +41,20 @@ func Script(execFlags *flags.LoginExecFlags, shell string) error {
 		return errors.Wrap(err, "error building login details")
 	}
 
-	sharedCreds := awsconfig.NewSharedCredentials(account.Profile)
+	sharedCreds := newSharedCredentials(account)
 
 	// this checks if the credentials file has been created yet
 	// can only really be triggered if saml2aws exec is run on a new
 	// system prior to creating $HOME/.aws
-	exist, err := sharedCreds.CredsExists()
+	awsCreds, err := loadCredentials(account, sharedCreds)
 	if err != nil {
 		return errors.Wrap(err, "error loading credentials")
 	}
-	if !exist {
+	if awsCreds == nil {
 		fmt.Println("unable to load credentials, login required to create them")
 		return nil
 	}
 
-	awsCreds, err := sharedCreds.Load()
-	if err != nil {
-		return errors.Wrap(err, "error loading credentials")
-	}
-
 	if awsCreds.Expires.Sub(time.Now()) < 0 {
 		return errors.New("error aws credentials have expired")
 	}
@@ -66,13 +62,15 @@ func Script(execFlags *flags.LoginExecFlags, shell string) error {
 	// annoymous struct to pass to template
 	data := struct {
 		ProfileName string
+		EnvPrefix   string
 		*awsconfig.AWSCredentials
 	}{
 		account.Profile,
+		account.EnvPrefix,
 		awsCreds,
 	}
 
-	err = buildTmpl(shell, data)
+	err = buildTmpl(os.Stdout, shell, data)
 	if err != nil {
 		return errors.Wrap(err, "error generating template")
 	}
@@ -80,7 +78,7 @@ func Script(execFlags *flags.LoginExecFlags, shell string) error {
 	return nil
 }
 
-func buildTmpl(shell string, data interface{}) error {
+func buildTmpl(w io.Writer, shell string, data interface{}) error {
 	t := template.New("envvar_script")
 
 	var err error
@@ -98,5 +96,5 @@ func buildTmpl(shell string, data interface{}) error {
 		return err
 	}
 
-	return t.Execute(os.Stdout, data)
+	return t.Execute(w, data)
 }
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+func buildScript(t *testing.T, envPrefix string) string {
+	data := struct {
+		ProfileName string
+		EnvPrefix   string
+		*awsconfig.AWSCredentials
+	}{
+		"saml",
+		envPrefix,
+		&awsconfig.AWSCredentials{AWSAccessKey: "123", AWSSecretKey: "345"},
+	}
+
+	buf := new(bytes.Buffer)
+	err := buildTmpl(buf, "bash", data)
+	assert.Nil(t, err)
+
+	return buf.String()
+}
+
+func TestBuildTmplDefault(t *testing.T) {
+	script := buildScript(t, "")
+
+	assert.Contains(t, script, `export AWS_ACCESS_KEY_ID="123"`)
+	assert.Contains(t, script, `export AWS_SECRET_ACCESS_KEY="345"`)
+}
+
+func TestBuildTmplWithPrefix(t *testing.T) {
+	script := buildScript(t, "PROD_")
+
+	assert.Contains(t, script, `export PROD_AWS_ACCESS_KEY_ID="123"`)
+	assert.Contains(t, script, `export PROD_AWS_SECRET_ACCESS_KEY="345"`)
+	assert.NotContains(t, script, `export AWS_ACCESS_KEY_ID`)
+}
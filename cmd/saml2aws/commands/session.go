@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/flags"
+)
+
+// SessionStatus print the role and time to expiry of the saved credentials, returning an error when they are missing
+// or expired so scripts can check for a valid session
+func SessionStatus(loginFlags *flags.LoginExecFlags) error {
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	awsCreds, err := loadCredentials(account, newSharedCredentials(account))
+	if err != nil {
+		return errors.Wrap(err, "error loading credentials")
+	}
+
+	return writeSessionStatus(os.Stdout, account.Profile, awsCreds, time.Now())
+}
+
+func writeSessionStatus(w io.Writer, profile string, awsCreds *awsconfig.AWSCredentials, now time.Time) error {
+	if awsCreds == nil {
+		return errors.Errorf("no credentials saved for profile %s, run saml2aws login", profile)
+	}
+
+	fmt.Fprintln(w, "Profile:", profile)
+	if awsCreds.PrincipalARN != "" {
+		fmt.Fprintln(w, "Role:", awsCreds.PrincipalARN)
+	}
+
+	if awsCreds.Expires.IsZero() {
+		fmt.Fprintln(w, "Expires: unknown")
+		return nil
+	}
+
+	fmt.Fprintln(w, "Expires:", awsCreds.Expires.Local().Format(time.RFC1123))
+
+	remaining := awsCreds.Expires.Sub(now)
+	if remaining <= 0 {
+		return errors.Errorf("credentials for profile %s expired %s ago, run saml2aws login", profile, (-remaining).Truncate(time.Second))
+	}
+
+	fmt.Fprintln(w, "Remaining:", remaining.Truncate(time.Second))
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+func TestWriteSessionStatus(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	awsCreds := &awsconfig.AWSCredentials{
+		PrincipalARN: "arn:aws:sts::123456789012:assumed-role/admin/user@example.com",
+		Expires:      now.Add(42*time.Minute + 10*time.Second + 300*time.Millisecond),
+	}
+
+	buf := new(bytes.Buffer)
+	err := writeSessionStatus(buf, "saml", awsCreds, now)
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "Role: arn:aws:sts::123456789012:assumed-role/admin/user@example.com\n")
+	assert.Contains(t, buf.String(), "Remaining: 42m10s\n")
+
+	err = writeSessionStatus(buf, "saml", awsCreds, now.Add(time.Hour))
+	assert.EqualError(t, err, "credentials for profile saml expired 17m49s ago, run saml2aws login")
+
+	err = writeSessionStatus(buf, "saml", nil, now)
+	assert.EqualError(t, err, "no credentials saved for profile saml, run saml2aws login")
+}
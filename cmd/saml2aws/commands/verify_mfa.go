@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/provider"
+	"github.com/versent/saml2aws/pkg/provider/keycloak"
+)
+
+// VerifyMFA login to the IdP and complete only the MFA challenge, this stops before retrieving
+// the SAML assertion so no roles are extracted and STS isn't called
+//
+// Only the KeyCloak provider can stop after the MFA challenge.
+func VerifyMFA(loginFlags *flags.LoginExecFlags) error {
+
+	logger := logrus.WithField("command", "test-mfa")
+
+	account, err := buildIdpAccount(loginFlags)
+	if err != nil {
+		return errors.Wrap(err, "error building login details")
+	}
+
+	if account.Provider != "KeyCloak" {
+		return errors.Errorf("test-mfa is only supported by the KeyCloak provider, not %s", account.Provider)
+	}
+
+	loginDetails, err := resolveLoginDetails(account, loginFlags)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+		os.Exit(1)
+	}
+
+	err = loginDetails.Validate()
+	if err != nil {
+		return errors.Wrap(err, "error validating login details")
+	}
+
+	loginDetails.URL = provider.ResolveIdPURL(account)
+
+	logger.WithField("idpAccount", account).Debug("building provider")
+
+	client, err := keycloak.New(account)
+	if err != nil {
+		return errors.Wrap(err, "error building IdP client")
+	}
+
+	fmt.Printf("Verifying MFA as %s ...\n", loginDetails.Username)
+
+	err = client.VerifyMFA(loginDetails)
+	if err != nil {
+		return errors.Wrap(err, "MFA verification failed")
+	}
+
+	fmt.Println("MFA verification succeeded")
+
+	return nil
+}
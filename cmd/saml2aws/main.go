@@ -5,9 +5,13 @@ import (
 	"os"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws/cmd/saml2aws/commands"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/dump"
 	"github.com/versent/saml2aws/pkg/flags"
+	"github.com/versent/saml2aws/pkg/shell"
 )
 
 var (
@@ -39,6 +43,36 @@ func buildCmdList(s kingpin.Settings) (target *[]string) {
 	return
 }
 
+// loginCredentialsOutput the credentials_output selected by the login flags, empty when none of them are used
+func loginCredentialsOutput(skipProfile, export bool, output, credentialsFile string) (string, error) {
+	var outputs []string
+
+	if export {
+		outputs = append(outputs, cfg.CredentialsOutputExport)
+	}
+	if output != "" {
+		outputs = append(outputs, output)
+	}
+	if credentialsFile != "" {
+		outputs = append(outputs, cfg.CredentialsOutputFile+":"+credentialsFile)
+	}
+
+	if len(outputs) > 1 {
+		return "", errors.New("only one of --export, --output and --credentials-file can be used")
+	}
+
+	// printed credentials are never saved, --skip-profile only makes that explicit
+	if skipProfile && !export && output == "" {
+		return "", errors.New("--skip-profile needs --export or --output json")
+	}
+
+	if len(outputs) == 0 {
+		return "", nil
+	}
+
+	return outputs[0], nil
+}
+
 func main() {
 
 	app := kingpin.New("saml2aws", "A command line tool to help with SAML access to the AWS token service.")
@@ -46,22 +80,34 @@ func main() {
 
 	// Settings not related to commands
 	verbose := app.Flag("verbose", "Enable verbose logging").Bool()
+	trace := app.Flag("trace", "Enable verbose logging and dump the HTTP requests and responses, with credentials and the SAMLResponse redacted").Bool()
 	provider := app.Flag("provider", "This flag it is obsolete see https://github.com/Versent/saml2aws#adding-idp-accounts.").Short('i').Enum("ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "OneLogin", "KeyCloak")
 
 	// Common (to all commands) settings
 	commonFlags := new(flags.CommonFlags)
-	app.Flag("idp-account", "The name of the configured IDP account").Short('a').Default("default").StringVar(&commonFlags.IdpAccount)
-	app.Flag("idp-provider", "The configured IDP provider").EnumVar(&commonFlags.IdpProvider, "ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "OneLogin", "KeyCloak")
+	app.Flag("config", "Path/filename of saml2aws config file, or ssm://<parameter> to load it from SSM parameter store").Envar("SAML2AWS_CONFIGFILE").StringVar(&commonFlags.ConfigFile)
+	app.Flag("idp-account", "The name of the configured IDP account, defaults to the default_idp_account of the config file or default").Short('a').StringVar(&commonFlags.IdpAccount)
+	app.Flag("idp-provider", "The configured IDP provider").EnumVar(&commonFlags.IdpProvider, "ADFS", "ADFS2", "Ping", "JumpCloud", "Okta", "OneLogin", "KeyCloak", "AzureAD")
 	app.Flag("mfa", "The name of the mfa").StringVar(&commonFlags.MFA)
 	app.Flag("skip-verify", "Skip verification of server certificate.").Short('s').BoolVar(&commonFlags.SkipVerify)
 	app.Flag("url", "The URL of the SAML IDP server used to login.").StringVar(&commonFlags.URL)
+	app.Flag("fallback-url", "The URL used to login when the SAML IDP server is unreachable.").StringVar(&commonFlags.FallbackURL)
 	app.Flag("username", "The username used to login.").Envar("SAML2AWS_USERNAME").StringVar(&commonFlags.Username)
 	app.Flag("password", "The password used to login.").Envar("SAML2AWS_PASSWORD").StringVar(&commonFlags.Password)
+	app.Flag("password-fd", "Read the password from this file descriptor, e.g. 3.").StringVar(&commonFlags.PasswordFd)
+	app.Flag("password-stdin", "Read the password from the first line of stdin.").BoolVar(&commonFlags.PasswordStdin)
 	app.Flag("mfa-token", "The current MFA token (supported in Keycloak, ADFS).").Envar("SAML2AWS_MFA_TOKEN").StringVar(&commonFlags.MFAToken)
+	app.Flag("tenant-id", "The organization or tenant submitted before login (supported in Keycloak).").StringVar(&commonFlags.TenantID)
 	app.Flag("role", "The ARN of the role to assume.").StringVar(&commonFlags.RoleArn)
+	app.Flag("target-role", "The ARN of a role to assume with the credentials of the SAML role.").StringVar(&commonFlags.TargetRoleArn)
 	app.Flag("aws-urn", "The URN used by SAML when you login.").StringVar(&commonFlags.AmazonWebservicesURN)
-	app.Flag("skip-prompt", "Skip prompting for parameters during login.").BoolVar(&commonFlags.SkipPrompt)
+	app.Flag("skip-prompt", "Skip prompting for parameters during login, input the login needs fails it instead.").Envar("SAML2AWS_SKIP_PROMPT").BoolVar(&commonFlags.SkipPrompt)
+	app.Flag("prompt-single", "Prompt for the role even when only one role is available.").BoolVar(&commonFlags.PromptSingleRole)
 	app.Flag("session-duration", "The duration of your AWS Session.").IntVar(&commonFlags.SessionDuration)
+	app.Flag("max-display-roles", "The maximum number of roles to display before a role or account filter is required.").IntVar(&commonFlags.MaxDisplayRoles)
+	app.Flag("role-filter", "Only display roles with an ARN containing this value.").StringVar(&commonFlags.RoleFilter)
+	app.Flag("account-filter", "Only display roles in accounts with a name containing this value.").StringVar(&commonFlags.AccountFilter)
+	app.Flag("metrics-url", "The URL of a prometheus pushgateway to push login metrics to.").Envar("SAML2AWS_METRICS_URL").StringVar(&commonFlags.MetricsURL)
 
 	// `configure` command and settings
 	cmdConfigure := app.Command("configure", "Configure a new IDP account.")
@@ -69,6 +115,7 @@ func main() {
 	cmdConfigure.Flag("client-id", "OneLogin client id, used to generate API access token.").Envar("ONELOGIN_CLIENT_ID").StringVar(&commonFlags.ClientID)
 	cmdConfigure.Flag("client-secret", "OneLogin client secret, used to generate API access token.").Envar("ONELOGIN_CLIENT_SECRET").StringVar(&commonFlags.ClientSecret)
 	cmdConfigure.Flag("subdomain", "OneLogin subdomain of your company account.").Envar("ONELOGIN_SUBDOMAIN").StringVar(&commonFlags.Subdomain)
+	cmdConfigure.Flag("save-password", "Save the password in the keychain, also when --skip-prompt is set.").BoolVar(&commonFlags.SavePassword)
 	configFlags := commonFlags
 
 	// `login` command and settings
@@ -77,29 +124,97 @@ func main() {
 	loginFlags.CommonFlags = commonFlags
 	cmdLogin.Flag("profile", "The AWS profile to save the temporary credentials").Short('p').StringVar(&commonFlags.Profile)
 	cmdLogin.Flag("force", "Refreshes credentials even if not expired").BoolVar(&loginFlags.Force)
+	cmdLogin.Flag("no-wizard", "Don't offer to run configure when the IDP account doesn't exist").BoolVar(&loginFlags.NoWizard)
+	cmdLogin.Flag("refresh-roles", "Fetch the AWS account names again even when the role list is cached").BoolVar(&commonFlags.RefreshRoles)
+	cmdLogin.Flag("all-roles", "Assume every role in the assertion, saving each to a profile named after its account and role").BoolVar(&loginFlags.AllRoles)
+	loginSkipProfile := cmdLogin.Flag("skip-profile", "Don't save the credentials, use with --export or --output json").Bool()
+	loginExport := cmdLogin.Flag("export", "Print the credentials as export lines for eval instead of saving them").Bool()
+	loginOutput := cmdLogin.Flag("output", "Print the credentials in this format instead of saving them: json").Enum("json")
+	loginCredentialsFile := cmdLogin.Flag("credentials-file", "The file the credentials are saved to instead of ~/.aws/credentials").String()
+	cmdLogin.Flag("credentials-format", "The format of the credentials file: ini").EnumVar(&commonFlags.CredentialsFormat, "ini")
 
 	// `exec` command and settings
 	cmdExec := app.Command("exec", "Exec the supplied command with env vars from STS token.")
 	execFlags := new(flags.LoginExecFlags)
 	execFlags.CommonFlags = commonFlags
 	cmdExec.Flag("profile", "The AWS profile to save the temporary credentials").Short('p').StringVar(&commonFlags.Profile)
+	cmdExec.Flag("env-prefix", "Prefix the exported environment variable names, e.g. PROD_").StringVar(&commonFlags.EnvPrefix)
 	cmdLine := buildCmdList(cmdExec.Arg("command", "The command to execute."))
 
 	// `list` command and settings
 	cmdListRoles := app.Command("list-roles", "List available role ARNs.")
 	listRolesFlags := new(flags.LoginExecFlags)
 	listRolesFlags.CommonFlags = commonFlags
+	listRolesOutput := cmdListRoles.Flag("output", "The format of the role list: text, json, table or csv.").Default("text").Enum("text", "json", "table", "csv")
+
+	// `dump-assertion` command and settings
+	cmdDumpAssertion := app.Command("dump-assertion", "Log in to the IdP and write the decoded SAML assertion.")
+	dumpAssertionFlags := new(flags.LoginExecFlags)
+	dumpAssertionFlags.CommonFlags = commonFlags
+	dumpAssertionFile := cmdDumpAssertion.Flag("file", "Write the assertion to this file instead of stdout.").String()
+	dumpAssertionPretty := cmdDumpAssertion.Flag("pretty", "Indent the XML of the assertion.").Bool()
+	dumpAssertionSummary := cmdDumpAssertion.Flag("summary", "Summarize the Audience, SessionDuration, roles and expiry of the assertion.").Bool()
+
+	// `test-mfa` command and settings
+	cmdTestMFA := app.Command("test-mfa", "Login to the IDP and verify the MFA challenge without requesting AWS credentials, KeyCloak only.")
+	testMFAFlags := new(flags.LoginExecFlags)
+	testMFAFlags.CommonFlags = commonFlags
+
+	// `console` command and settings
+	cmdConsole := app.Command("console", "Open the AWS console in the browser using the saved credentials.")
+	consoleFlags := new(flags.LoginExecFlags)
+	consoleFlags.CommonFlags = commonFlags
+	cmdConsole.Flag("profile", "The AWS profile of the saved temporary credentials").Short('p').StringVar(&commonFlags.Profile)
+	cmdConsole.Flag("destination", "The AWS console page to open after signing in.").StringVar(&commonFlags.ConsoleDestination)
+	cmdConsole.Flag("console-duration", "The duration in seconds of the console session.").IntVar(&commonFlags.ConsoleDuration)
+	consoleLinkOnly := cmdConsole.Flag("link-only", "Print the sign-in URL instead of opening it in the browser.").Bool()
+
+	// `forget` command
+	cmdForget := app.Command("forget", "Remove the password saved in the keychain for the IDP account.")
+
+	// `fingerprint` command
+	cmdFingerprint := app.Command("fingerprint", "Print a fingerprint of the configuration for drift detection.")
+
+	// `config migrate` command and settings
+	cmdConfig := app.Command("config", "Manage the configuration file.")
+	cmdConfigMigrate := cmdConfig.Command("migrate", "Upgrade the configuration file to the current version, encrypting the sensitive values when encrypt_config is set.")
+	configMigrateEncrypt := cmdConfigMigrate.Flag("encrypt", "Turn on encrypt_config and encrypt the sensitive values with a key kept in the keyring.").Bool()
+
+	// `prewarm` command and settings
+	cmdPrewarm := app.Command("prewarm", "Refresh the expired credentials of several IDP accounts concurrently.")
+	prewarmAccounts := cmdPrewarm.Arg("accounts", "The names of the IDP accounts to refresh.").Required().Strings()
+	prewarmConcurrency := cmdPrewarm.Flag("concurrency", "The number of IdPs logged in to at once.").Default("4").Int()
+	prewarmRefreshBefore := cmdPrewarm.Flag("refresh-before", "Also refresh the credentials which expire within this long.").Default("5m").Duration()
+
+	// `daemon` command and settings
+	cmdDaemon := app.Command("daemon", "Keep the credentials of the IDP accounts valid, refreshing them before they expire.")
+	daemonAccounts := cmdDaemon.Arg("accounts", "The names of the IDP accounts to keep refreshed, defaults to --idp-account.").Strings()
+	daemonRefreshBefore := cmdDaemon.Flag("refresh-before", "How long before the credentials expire to refresh them.").Default("5m").Duration()
+
+	// `credential-process` command and settings
+	cmdCredentialProcess := app.Command("credential-process", "Print the credentials as the JSON expected by credential_process in ~/.aws/config, logging in when they have expired.")
+	credentialProcessFlags := new(flags.LoginExecFlags)
+	credentialProcessFlags.CommonFlags = commonFlags
+	cmdCredentialProcess.Flag("profile", "The AWS profile to save the temporary credentials").Short('p').StringVar(&commonFlags.Profile)
+
+	// `session status` command and settings
+	cmdSession := app.Command("session", "Inspect the saved AWS session.")
+	cmdSessionStatus := cmdSession.Command("status", "Print the role and time to expiry of the saved credentials, failing when they have expired.")
+	sessionStatusFlags := new(flags.LoginExecFlags)
+	sessionStatusFlags.CommonFlags = commonFlags
+	cmdSessionStatus.Flag("profile", "The AWS profile of the saved temporary credentials").Short('p').StringVar(&commonFlags.Profile)
 
 	// `script` command and settings
 	cmdScript := app.Command("script", "Script will emit a script that will export environment variables")
 	scriptFlags := new(flags.LoginExecFlags)
 	scriptFlags.CommonFlags = commonFlags
 	cmdScript.Flag("profile", "The AWS profile to save the temporary credentials").Short('p').StringVar(&commonFlags.Profile)
-	var shell string
+	cmdScript.Flag("env-prefix", "Prefix the exported environment variable names, e.g. PROD_").StringVar(&commonFlags.EnvPrefix)
+	var scriptShell string
 	cmdScript.
 		Flag("shell", "Type of shell environment, options include: bash, powershell, fish").
 		Default("bash").
-		EnumVar(&shell, "bash", "powershell", "fish")
+		EnumVar(&scriptShell, "bash", "powershell", "fish")
 
 	// Trigger the parsing of the command line inputs via kingpin
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
@@ -110,30 +225,79 @@ func main() {
 		os.Exit(1)
 	}
 
+	// passwords and the SAMLResponse are credentials so keep them out of the debug output
+	logrus.SetFormatter(&dump.RedactFormatter{Formatter: &logrus.TextFormatter{}})
+
 	errtpl := "%v\n"
-	if *verbose {
+	if *verbose || *trace {
 		logrus.SetLevel(logrus.DebugLevel)
 		errtpl = "%+v\n"
 	}
 
+	if *trace {
+		dump.EnableContent()
+	}
+
 	logrus.WithField("command", command).Debug("Running")
 
-	var err error
+	err := commands.ResolveIdpAccount(commonFlags)
+	if err != nil {
+		fmt.Printf(errtpl, err)
+		os.Exit(1)
+	}
+
 	switch command {
 	case cmdScript.FullCommand():
-		err = commands.Script(scriptFlags, shell)
+		err = commands.Script(scriptFlags, scriptShell)
 	case cmdLogin.FullCommand():
+		commonFlags.CredentialsOutput, err = loginCredentialsOutput(*loginSkipProfile, *loginExport, *loginOutput, *loginCredentialsFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		err = commands.Login(loginFlags)
 	case cmdExec.FullCommand():
 		err = commands.Exec(execFlags, *cmdLine)
 	case cmdListRoles.FullCommand():
-		err = commands.ListRoles(listRolesFlags)
+		err = commands.ListRoles(listRolesFlags, *listRolesOutput)
+	case cmdDumpAssertion.FullCommand():
+		err = commands.DumpAssertion(dumpAssertionFlags, *dumpAssertionFile, *dumpAssertionPretty, *dumpAssertionSummary)
+	case cmdTestMFA.FullCommand():
+		err = commands.VerifyMFA(testMFAFlags)
+	case cmdConsole.FullCommand():
+		err = commands.Console(consoleFlags, *consoleLinkOnly)
+	case cmdForget.FullCommand():
+		err = commands.Forget(commonFlags)
+	case cmdConfigMigrate.FullCommand():
+		err = commands.ConfigMigrate(commonFlags, *configMigrateEncrypt)
+	case cmdFingerprint.FullCommand():
+		err = commands.Fingerprint(commonFlags)
+	case cmdCredentialProcess.FullCommand():
+		err = commands.CredentialProcess(credentialProcessFlags)
+	case cmdSessionStatus.FullCommand():
+		err = commands.SessionStatus(sessionStatusFlags)
+	case cmdPrewarm.FullCommand():
+		err = commands.Prewarm(commonFlags, *prewarmAccounts, *prewarmConcurrency, *prewarmRefreshBefore)
+	case cmdDaemon.FullCommand():
+		err = commands.Daemon(commonFlags, *daemonAccounts, *daemonRefreshBefore)
 	case cmdConfigure.FullCommand():
 		err = commands.Configure(configFlags)
 	}
 
+	// exec exits with the exit code of the command it ran
+	if code, ok := shell.ExitCode(err); ok && command == cmdExec.FullCommand() {
+		os.Exit(code)
+	}
+
 	if err != nil {
 		fmt.Printf(errtpl, err)
+		if hint := cfg.ValidationHint(err); hint != "" {
+			fmt.Println("Hint:", hint)
+		}
+		// a failed login exits with a code which tells scripts what went wrong
+		if code, ok := commands.LoginExitCode(err); ok {
+			os.Exit(code)
+		}
 		os.Exit(1)
 	}
 }
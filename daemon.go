@@ -0,0 +1,58 @@
+package saml2aws
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+const (
+	// DefaultRefreshBefore how long before the credentials expire the daemon and prewarm refresh them
+	DefaultRefreshBefore = 5 * time.Minute
+
+	// DefaultRefreshRetry how long the daemon waits to try again after a refresh failed
+	DefaultRefreshRetry = time.Minute
+)
+
+// NextRefresh how long to wait after the results of a refresh before refreshing again, this is when the first of the
+// credentials is due to be refreshed or, when a refresh failed, the retry delay if that is sooner
+//
+// The wait is never shorter than the retry delay, so credentials which are already due aren't refreshed in a loop.
+func NextRefresh(results []PrewarmResult, now time.Time, refreshBefore, retry time.Duration) time.Duration {
+	var next time.Duration
+	found := false
+
+	for _, result := range results {
+		wait := retry
+		if result.Err == nil && result.Credentials != nil {
+			wait = result.Credentials.Expires.Add(-refreshBefore).Sub(now)
+		}
+
+		if !found || wait < next {
+			next = wait
+			found = true
+		}
+	}
+
+	if !found || next < retry {
+		return retry
+	}
+
+	return next
+}
+
+// ValidateRefreshBefore check the credentials of the account live longer than refreshBefore, otherwise they would be
+// due for a refresh as soon as they are issued
+func ValidateRefreshBefore(account *cfg.IDPAccount, refreshBefore time.Duration) error {
+	sessionDuration := time.Duration(account.SessionDuration) * time.Second
+	if account.SessionDuration <= 0 {
+		sessionDuration = cfg.DefaultSessionDuration * time.Second
+	}
+
+	if refreshBefore >= sessionDuration {
+		return errors.Errorf("refresh before %v must be shorter than the aws_session_duration of %v", refreshBefore, sessionDuration)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package saml2aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestNextRefresh(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	results := []PrewarmResult{
+		{Name: "build", Credentials: &awsconfig.AWSCredentials{Expires: now.Add(time.Hour)}},
+		{Name: "prod", Credentials: &awsconfig.AWSCredentials{Expires: now.Add(30 * time.Minute)}, Skipped: true},
+	}
+
+	// the credentials which expire first are refreshed first
+	assert.Equal(t, 25*time.Minute, NextRefresh(results, now, 5*time.Minute, time.Minute))
+
+	// a failed refresh is retried sooner
+	results = append(results, PrewarmResult{Name: "nonprod", Err: errors.New("error authenticating to IdP")})
+	assert.Equal(t, time.Minute, NextRefresh(results, now, 5*time.Minute, time.Minute))
+
+	// credentials already inside the refresh window wait for the retry delay rather than refreshing in a loop
+	results = []PrewarmResult{{Name: "build", Credentials: &awsconfig.AWSCredentials{Expires: now.Add(2 * time.Minute)}}}
+	assert.Equal(t, time.Minute, NextRefresh(results, now, 5*time.Minute, time.Minute))
+
+	assert.Equal(t, time.Minute, NextRefresh(nil, now, 5*time.Minute, time.Minute))
+}
+
+func TestValidateRefreshBefore(t *testing.T) {
+	account := cfg.NewIDPAccount()
+	account.SessionDuration = 900
+
+	assert.Nil(t, ValidateRefreshBefore(account, 5*time.Minute))
+	assert.EqualError(t, ValidateRefreshBefore(account, 15*time.Minute), "refresh before 15m0s must be shorter than the aws_session_duration of 15m0s")
+
+	// the default session duration applies when none is set
+	account.SessionDuration = 0
+	assert.Nil(t, ValidateRefreshBefore(account, 30*time.Minute))
+	assert.Error(t, ValidateRefreshBefore(account, time.Hour))
+}
@@ -0,0 +1,72 @@
+package credentials
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+// keyring accounts the aws credentials are stored under, named after the keys in the credentials file
+const (
+	awsAccessKeyAccount    = "aws_access_key_id"
+	awsSecretKeyAccount    = "aws_secret_access_key"
+	awsSessionTokenAccount = "aws_session_token"
+	awsExpiresAccount      = "x_security_token_expires"
+)
+
+// awsCredentialsService the keyring service holding the aws credentials of the profile
+func awsCredentialsService(profile string) string {
+	return fmt.Sprintf("saml2aws/%s", profile)
+}
+
+// SaveAWSCredentials store the aws credentials for the profile as generic passwords in the current keyring
+func SaveAWSCredentials(profile string, awsCreds *awsconfig.AWSCredentials) error {
+	service := awsCredentialsService(profile)
+
+	values := []struct{ account, secret string }{
+		{awsAccessKeyAccount, awsCreds.AWSAccessKey},
+		{awsSecretKeyAccount, awsCreds.AWSSecretKey},
+		{awsSessionTokenAccount, awsCreds.AWSSessionToken},
+		{awsExpiresAccount, awsCreds.Expires.UTC().Format(time.RFC3339)},
+	}
+
+	for _, v := range values {
+		err := CurrentKeyring.SetGenericPassword(service, v.account, v.secret)
+		if err != nil {
+			return errors.Wrapf(err, "error storing %s in keychain", v.account)
+		}
+	}
+
+	return nil
+}
+
+// LookupAWSCredentials load the aws credentials for the profile from the current keyring, ErrCredentialsNotFound
+// is returned if they haven't been stored yet
+func LookupAWSCredentials(profile string) (*awsconfig.AWSCredentials, error) {
+	service := awsCredentialsService(profile)
+
+	values := map[string]string{}
+
+	for _, account := range []string{awsAccessKeyAccount, awsSecretKeyAccount, awsSessionTokenAccount, awsExpiresAccount} {
+		secret, err := CurrentKeyring.GenericPassword(service, account)
+		if err != nil {
+			return nil, err
+		}
+		values[account] = secret
+	}
+
+	expires, err := time.Parse(time.RFC3339, values[awsExpiresAccount])
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing credentials expiry from keychain")
+	}
+
+	return &awsconfig.AWSCredentials{
+		AWSAccessKey:     values[awsAccessKeyAccount],
+		AWSSecretKey:     values[awsSecretKeyAccount],
+		AWSSessionToken:  values[awsSessionTokenAccount],
+		AWSSecurityToken: values[awsSessionTokenAccount],
+		Expires:          expires,
+	}, nil
+}
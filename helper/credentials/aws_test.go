@@ -0,0 +1,57 @@
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+func TestAWSCredentialsRoundTrip(t *testing.T) {
+	keyring := NewMemKeyring()
+
+	defer func(previous Keyring) { CurrentKeyring = previous }(CurrentKeyring)
+	CurrentKeyring = keyring
+
+	expires := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	err := SaveAWSCredentials("prod", &awsconfig.AWSCredentials{
+		AWSAccessKey:    "ASIAEXAMPLE",
+		AWSSecretKey:    "secret",
+		AWSSessionToken: "token",
+		PrincipalARN:    "arn:aws:sts::123456789012:assumed-role/Admin/me",
+		Expires:         expires,
+	})
+	require.Nil(t, err)
+	secret, err := keyring.GenericPassword("saml2aws/prod", "aws_access_key_id")
+	require.Nil(t, err)
+	require.Equal(t, "ASIAEXAMPLE", secret)
+
+	awsCreds, err := LookupAWSCredentials("prod")
+	require.Nil(t, err)
+	require.Equal(t, &awsconfig.AWSCredentials{
+		AWSAccessKey:     "ASIAEXAMPLE",
+		AWSSecretKey:     "secret",
+		AWSSessionToken:  "token",
+		AWSSecurityToken: "token",
+		Expires:          expires,
+	}, awsCreds)
+
+	// each profile has its own items
+	_, err = LookupAWSCredentials("dev")
+	require.True(t, IsErrCredentialsNotFound(err))
+}
+
+func TestAWSCredentialsUnsupported(t *testing.T) {
+	// the keyring of any build other than macOS
+	defer func(previous Keyring) { CurrentKeyring = previous }(CurrentKeyring)
+	CurrentKeyring = &unsupportedKeyring{}
+
+	err := SaveAWSCredentials("prod", &awsconfig.AWSCredentials{})
+	require.Equal(t, ErrKeyringUnsupported, errors.Cause(err))
+
+	_, err = LookupAWSCredentials("prod")
+	require.Equal(t, ErrKeyringUnsupported, err)
+}
@@ -0,0 +1,32 @@
+package credentials
+
+import (
+	"errors"
+)
+
+var (
+	// CurrentKeyring the keyring used to store aws credentials, macOS, Windows and Linux builds have one
+	CurrentKeyring Keyring = &unsupportedKeyring{}
+
+	// ErrKeyringUnsupported returned when aws credentials are stored in a keyring on a platform without one.
+	ErrKeyringUnsupported = errors.New("storing aws credentials in a keyring isn't supported on this platform")
+)
+
+// Keyring is the interface a store of generic passwords must implement.
+type Keyring interface {
+	// SetGenericPassword adds or replaces the password for the service and account.
+	SetGenericPassword(service, account, secret string) error
+	// GenericPassword retrieves the password for the service and account.
+	// It returns ErrCredentialsNotFound if there isn't one.
+	GenericPassword(service, account string) (string, error)
+}
+
+type unsupportedKeyring struct{}
+
+func (unsupportedKeyring) SetGenericPassword(service, account, secret string) error {
+	return ErrKeyringUnsupported
+}
+
+func (unsupportedKeyring) GenericPassword(service, account string) (string, error) {
+	return "", ErrKeyringUnsupported
+}
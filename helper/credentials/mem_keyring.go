@@ -0,0 +1,37 @@
+package credentials
+
+import "sync"
+
+// MemKeyring an in memory keyring for running without the keyring of the OS
+type MemKeyring struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// NewMemKeyring create an empty in memory keyring
+func NewMemKeyring() *MemKeyring {
+	return &MemKeyring{secrets: map[string]string{}}
+}
+
+// SetGenericPassword adds or replaces the password for the service and account.
+func (k *MemKeyring) SetGenericPassword(service, account, secret string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.secrets[service+"/"+account] = secret
+
+	return nil
+}
+
+// GenericPassword retrieves the password for the service and account.
+func (k *MemKeyring) GenericPassword(service, account string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secret, ok := k.secrets[service+"/"+account]
+	if !ok {
+		return "", ErrCredentialsNotFound
+	}
+
+	return secret, nil
+}
@@ -41,6 +41,11 @@ func SaveCredentials(url, username, password string) error {
 	return CurrentHelper.Add(creds)
 }
 
+// DeleteCredentials remove the saved user credentials.
+func DeleteCredentials(url string) error {
+	return CurrentHelper.Delete(url)
+}
+
 // SupportsStorage will return true or false if storage is supported.
 func SupportsStorage() bool {
 	return CurrentHelper.SupportsCredentialStorage()
@@ -0,0 +1,73 @@
+package credentials
+
+import (
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+// CredentialStore is the interface a store of the aws credentials saved after login must implement.
+type CredentialStore interface {
+	// Save adds or replaces the aws credentials of the profile.
+	Save(profile string, awsCreds *awsconfig.AWSCredentials) error
+	// Load retrieves the aws credentials of the profile.
+	// It returns ErrCredentialsNotFound if none have been saved.
+	Load(profile string) (*awsconfig.AWSCredentials, error)
+}
+
+// KeyringStore keeps the aws credentials in the current keyring.
+type KeyringStore struct{}
+
+// Save stores the aws credentials of the profile in the current keyring.
+func (KeyringStore) Save(profile string, awsCreds *awsconfig.AWSCredentials) error {
+	return SaveAWSCredentials(profile, awsCreds)
+}
+
+// Load retrieves the aws credentials of the profile from the current keyring.
+func (KeyringStore) Load(profile string) (*awsconfig.AWSCredentials, error) {
+	return LookupAWSCredentials(profile)
+}
+
+// FileStore keeps the aws credentials in the shared credentials file, the provider supplies the file and key names
+// and the profile passed in replaces its profile.
+type FileStore struct {
+	Provider *awsconfig.CredentialsProvider
+}
+
+// Save writes the aws credentials of the profile to the credentials file.
+func (s FileStore) Save(profile string, awsCreds *awsconfig.AWSCredentials) error {
+	return s.provider(profile).Save(awsCreds)
+}
+
+// Load reads the aws credentials of the profile from the credentials file.
+func (s FileStore) Load(profile string) (*awsconfig.AWSCredentials, error) {
+	p := s.provider(profile)
+
+	exist, err := p.CredsExists()
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, ErrCredentialsNotFound
+	}
+
+	awsCreds, err := p.Load()
+	if err == awsconfig.ErrCredentialsNotFound {
+		return nil, ErrCredentialsNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the credentials file starts out with an empty section for the profile
+	if awsCreds.AWSAccessKey == "" {
+		return nil, ErrCredentialsNotFound
+	}
+
+	return awsCreds, nil
+}
+
+func (s FileStore) provider(profile string) *awsconfig.CredentialsProvider {
+	p := *s.Provider
+	p.Profile = profile
+
+	return &p
+}
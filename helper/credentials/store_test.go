@@ -0,0 +1,54 @@
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/vfs"
+)
+
+func testStoreRoundTrip(t *testing.T, store CredentialStore) {
+	_, err := store.Load("prod")
+	require.True(t, IsErrCredentialsNotFound(err))
+
+	expires := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	err = store.Save("prod", &awsconfig.AWSCredentials{
+		AWSAccessKey:     "ASIAEXAMPLE",
+		AWSSecretKey:     "secret",
+		AWSSessionToken:  "token",
+		AWSSecurityToken: "token",
+		Expires:          expires,
+	})
+	require.Nil(t, err)
+
+	awsCreds, err := store.Load("prod")
+	require.Nil(t, err)
+	require.Equal(t, "ASIAEXAMPLE", awsCreds.AWSAccessKey)
+	require.Equal(t, "secret", awsCreds.AWSSecretKey)
+	require.Equal(t, "token", awsCreds.AWSSessionToken)
+	require.True(t, expires.Equal(awsCreds.Expires))
+
+	// each profile is kept apart
+	_, err = store.Load("dev")
+	require.True(t, IsErrCredentialsNotFound(err))
+}
+
+func TestKeyringStore(t *testing.T) {
+	defer func(previous Keyring) { CurrentKeyring = previous }(CurrentKeyring)
+	CurrentKeyring = NewMemKeyring()
+
+	testStoreRoundTrip(t, KeyringStore{})
+}
+
+func TestFileStore(t *testing.T) {
+	fsys := vfs.NewMemFS()
+
+	testStoreRoundTrip(t, FileStore{Provider: &awsconfig.CredentialsProvider{Filename: "/home/test/.aws/credentials", FS: fsys}})
+
+	data, err := fsys.ReadFile("/home/test/.aws/credentials")
+	require.Nil(t, err)
+	require.Contains(t, string(data), "[prod]")
+}
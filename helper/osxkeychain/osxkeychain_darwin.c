@@ -248,3 +248,54 @@ void freeListData(char *** data, unsigned int length) {
      }
      free(*data);
 }
+
+char *keychain_generic_set(char *service, char *account, char *secret) {
+  SecKeychainItemRef item = NULL;
+
+  OSStatus status = SecKeychainFindGenericPassword(
+    NULL,
+    strlen(service), service,
+    strlen(account), account,
+    NULL, NULL,
+    &item);
+
+  if (status == errSecSuccess) {
+    status = SecKeychainItemModifyAttributesAndData(item, NULL, strlen(secret), secret);
+    CFRelease(item);
+  } else if (status == errSecItemNotFound) {
+    status = SecKeychainAddGenericPassword(
+      NULL,
+      strlen(service), service,
+      strlen(account), account,
+      strlen(secret), secret,
+      NULL);
+  }
+
+  if (status) {
+    return get_error(status);
+  }
+
+  return NULL;
+}
+
+char *keychain_generic_get(char *service, char *account, unsigned int *secret_l, char **secret) {
+  void *tmp;
+
+  OSStatus status = SecKeychainFindGenericPassword(
+    NULL,
+    strlen(service), service,
+    strlen(account), account,
+    secret_l, &tmp,
+    NULL);
+
+  if (status) {
+    return get_error(status);
+  }
+
+  // the password data isn't nul terminated
+  *secret = malloc(*secret_l);
+  memcpy(*secret, tmp, *secret_l);
+  SecKeychainItemFreeContent(NULL, tmp);
+
+  return NULL;
+}
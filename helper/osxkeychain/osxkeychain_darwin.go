@@ -168,6 +168,51 @@ func (h Osxkeychain) List() (map[string]string, error) {
 	return resp, nil
 }
 
+// SetGenericPassword adds or replaces the generic password for the service and account.
+func (h Osxkeychain) SetGenericPassword(service, account, secret string) error {
+	serviceC := C.CString(service)
+	defer C.free(unsafe.Pointer(serviceC))
+	accountC := C.CString(account)
+	defer C.free(unsafe.Pointer(accountC))
+	secretC := C.CString(secret)
+	defer C.free(unsafe.Pointer(secretC))
+
+	errMsg := C.keychain_generic_set(serviceC, accountC, secretC)
+	if errMsg != nil {
+		defer C.free(unsafe.Pointer(errMsg))
+		return errors.New(C.GoString(errMsg))
+	}
+
+	return nil
+}
+
+// GenericPassword returns the generic password for the service and account.
+func (h Osxkeychain) GenericPassword(service, account string) (string, error) {
+	serviceC := C.CString(service)
+	defer C.free(unsafe.Pointer(serviceC))
+	accountC := C.CString(account)
+	defer C.free(unsafe.Pointer(accountC))
+
+	var secretLen C.uint
+	var secret *C.char
+	// secret is only allocated by keychain_generic_get, so free whatever it holds on return
+	defer func() { C.free(unsafe.Pointer(secret)) }()
+
+	errMsg := C.keychain_generic_get(serviceC, accountC, &secretLen, &secret)
+	if errMsg != nil {
+		defer C.free(unsafe.Pointer(errMsg))
+		goMsg := C.GoString(errMsg)
+
+		if goMsg == errCredentialsNotFound {
+			return "", credentials.ErrCredentialsNotFound
+		}
+
+		return "", errors.New(goMsg)
+	}
+
+	return C.GoStringN(secret, C.int(secretLen)), nil
+}
+
 // SupportsCredentialsStorage returns true since storage is supported
 func (Osxkeychain) SupportsCredentialStorage() bool {
 	return true
@@ -33,4 +33,6 @@ char *keychain_add(struct Server *server, char *label, char *username, char *sec
 char *keychain_get(struct Server *server, unsigned int *username_l, char **username, unsigned int *secret_l, char **secret);
 char *keychain_delete(struct Server *server);
 char *keychain_list(char *credsLabel, char *** data, char *** accts, unsigned int *list_l);
-void freeListData(char *** data, unsigned int length);
\ No newline at end of file
+void freeListData(char *** data, unsigned int length);
+char *keychain_generic_set(char *service, char *account, char *secret);
+char *keychain_generic_get(char *service, char *account, unsigned int *secret_l, char **secret);
\ No newline at end of file
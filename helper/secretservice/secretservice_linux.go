@@ -0,0 +1,183 @@
+package secretservice
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/helper/credentials"
+)
+
+// secretTool the libsecret command line tool used to reach the Secret Service
+var secretTool = "secret-tool"
+
+// SecretService handles IdP passwords and generic passwords using the freedesktop Secret Service, such as GNOME
+// Keyring or KWallet, through secret-tool from libsecret.
+type SecretService struct{}
+
+// SetGenericPassword adds or replaces the generic password for the service and account.
+func (SecretService) SetGenericPassword(service, account, secret string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(secretTool, "store", "--label="+credentials.CredsLabel, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return secretToolError(err, &stderr)
+	}
+
+	return nil
+}
+
+// GenericPassword returns the generic password for the service and account.
+func (SecretService) GenericPassword(service, account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(secretTool, "lookup", "service", service, "account", account)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		// a missing item exits with an error and says nothing
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() == 0 {
+			return "", credentials.ErrCredentialsNotFound
+		}
+		return "", secretToolError(err, &stderr)
+	}
+
+	return stdout.String(), nil
+}
+
+// the attributes an IdP password is stored under, the username is stored alongside it so it can be looked up by
+// the server URL alone
+const (
+	usernameAccount = "saml2aws_username"
+	passwordAccount = "saml2aws_password"
+)
+
+// Add stores the IdP username and password for the server URL.
+func (h SecretService) Add(creds *credentials.Credentials) error {
+	err := h.SetGenericPassword(creds.ServerURL, usernameAccount, creds.Username)
+	if err != nil {
+		return err
+	}
+
+	return h.SetGenericPassword(creds.ServerURL, passwordAccount, creds.Secret)
+}
+
+// Delete removes the IdP username and password for the server URL.
+func (SecretService) Delete(serverURL string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(secretTool, "clear", "service", serverURL)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return secretToolError(err, &stderr)
+	}
+
+	return nil
+}
+
+// Get retrieves the IdP username and password for the server URL.
+func (h SecretService) Get(serverURL string) (string, string, error) {
+	username, err := h.GenericPassword(serverURL, usernameAccount)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err := h.GenericPassword(serverURL, passwordAccount)
+	if err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// List returns the server URLs with a stored IdP username and the username of each.
+func (SecretService) List() (map[string]string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(secretTool, "search", "--all", "account", usernameAccount)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		// no matching items exits with an error and says nothing
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() == 0 {
+			return map[string]string{}, nil
+		}
+		return nil, secretToolError(err, &stderr)
+	}
+
+	return parseSearch(stdout.String()), nil
+}
+
+// SupportsCredentialStorage returns true when the Secret Service can be reached.
+func (SecretService) SupportsCredentialStorage() bool {
+	return Available()
+}
+
+// Available true when secret-tool is installed and there is a session bus to reach the Secret Service on
+func Available() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+
+	_, err := exec.LookPath(secretTool)
+	return err == nil
+}
+
+// parseSearch map the service attribute of each item secret-tool search printed to its secret
+func parseSearch(out string) map[string]string {
+	items := map[string]string{}
+
+	var service, secret string
+	flush := func() {
+		if service != "" {
+			items[service] = secret
+		}
+		service, secret = "", ""
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "[") {
+			flush()
+			continue
+		}
+
+		parts := strings.SplitN(line, " = ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "attribute.service":
+			service = parts[1]
+		case "secret":
+			secret = parts[1]
+		}
+	}
+	flush()
+
+	return items
+}
+
+func secretToolError(err error, stderr *bytes.Buffer) error {
+	if _, ok := err.(*exec.Error); ok || os.IsNotExist(err) {
+		return errors.Wrap(err, "secret-tool from libsecret is needed to use the keyring")
+	}
+
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return errors.Wrap(err, msg)
+	}
+
+	return errors.Wrap(err, "error running secret-tool")
+}
@@ -0,0 +1,111 @@
+package secretservice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/helper/credentials"
+)
+
+// fakeSecretTool a secret-tool which keeps each item in a file named after its attributes
+const fakeSecretTool = `#!/bin/sh
+dir=$(dirname "$0")
+item() {
+	printf '%s-%s' "$1" "$2" | tr '/:' '__'
+}
+case "$1" in
+store)
+	cat > "$dir/$(item "$4" "$6")"
+	;;
+lookup)
+	[ -f "$dir/$(item "$3" "$5")" ] || exit 1
+	cat "$dir/$(item "$3" "$5")"
+	;;
+clear)
+	rm -f "$dir/$(item "$3" "")"*
+	;;
+esac
+`
+
+func TestSecretServiceRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(tool string) { secretTool = tool }(secretTool)
+	secretTool = filepath.Join(dir, "secret-tool")
+	require.Nil(t, ioutil.WriteFile(secretTool, []byte(fakeSecretTool), 0700))
+
+	keyring := SecretService{}
+
+	_, err = keyring.GenericPassword("saml2aws_prod", "aws_access_key_id")
+	require.Equal(t, credentials.ErrCredentialsNotFound, err)
+
+	require.Nil(t, keyring.SetGenericPassword("saml2aws_prod", "aws_access_key_id", "ASIAEXAMPLE"))
+
+	secret, err := keyring.GenericPassword("saml2aws_prod", "aws_access_key_id")
+	require.Nil(t, err)
+	require.Equal(t, "ASIAEXAMPLE", secret)
+}
+
+func TestSecretServiceMissingTool(t *testing.T) {
+	defer func(tool string) { secretTool = tool }(secretTool)
+	secretTool = "/nonexistent/secret-tool"
+
+	err := SecretService{}.SetGenericPassword("saml2aws_prod", "aws_access_key_id", "ASIAEXAMPLE")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "libsecret")
+}
+
+func TestSecretServiceHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(tool string) { secretTool = tool }(secretTool)
+	secretTool = filepath.Join(dir, "secret-tool")
+	require.Nil(t, ioutil.WriteFile(secretTool, []byte(fakeSecretTool), 0700))
+
+	helper := SecretService{}
+
+	_, _, err = helper.Get("https://id.example.com")
+	require.Equal(t, credentials.ErrCredentialsNotFound, err)
+
+	err = helper.Add(&credentials.Credentials{ServerURL: "https://id.example.com", Username: "user@example.com", Secret: "secret"})
+	require.Nil(t, err)
+
+	username, password, err := helper.Get("https://id.example.com")
+	require.Nil(t, err)
+	require.Equal(t, "user@example.com", username)
+	require.Equal(t, "secret", password)
+
+	require.Nil(t, helper.Delete("https://id.example.com"))
+
+	_, _, err = helper.Get("https://id.example.com")
+	require.Equal(t, credentials.ErrCredentialsNotFound, err)
+}
+
+func TestParseSearch(t *testing.T) {
+	out := `[/org/freedesktop/secrets/collection/login/1]
+label = saml2aws Credentials
+secret = user@example.com
+created = 2018-06-01 12:00:00
+modified = 2018-06-01 12:00:00
+schema = org.freedesktop.Secret.Generic
+attribute.account = saml2aws_username
+attribute.service = https://id.example.com
+[/org/freedesktop/secrets/collection/login/2]
+label = saml2aws Credentials
+secret = admin@example.com
+attribute.account = saml2aws_username
+attribute.service = https://other.example.com
+`
+
+	require.Equal(t, map[string]string{
+		"https://id.example.com":    "user@example.com",
+		"https://other.example.com": "admin@example.com",
+	}, parseSearch(out))
+}
@@ -95,6 +95,38 @@ func (h Wincred) List() (map[string]string, error) {
 	return resp, nil
 }
 
+// errElementNotFound the message of the ERROR_NOT_FOUND returned when there is no credential for the target
+const errElementNotFound = "Element not found."
+
+// genericTarget the credential manager target of the generic password for the service and account.
+func genericTarget(service, account string) string {
+	return service + "/" + account
+}
+
+// SetGenericPassword adds or replaces the generic password for the service and account.
+func (h Wincred) SetGenericPassword(service, account, secret string) error {
+	g := winc.NewGenericCredential(genericTarget(service, account))
+	g.UserName = account
+	g.CredentialBlob = []byte(secret)
+	g.Persist = winc.PersistLocalMachine
+	g.Attributes = []winc.CredentialAttribute{{Keyword: "label", Value: []byte(credentials.CredsLabel)}}
+
+	return g.Write()
+}
+
+// GenericPassword returns the generic password for the service and account.
+func (h Wincred) GenericPassword(service, account string) (string, error) {
+	g, err := winc.GetGenericCredential(genericTarget(service, account))
+	if err != nil && err.Error() != errElementNotFound {
+		return "", err
+	}
+	if g == nil {
+		return "", credentials.ErrCredentialsNotFound
+	}
+
+	return string(g.CredentialBlob), nil
+}
+
 // SupportsCredentialsStorage returns true since storage is supported
 func (Wincred) SupportsCredentialStorage() bool {
 	return true
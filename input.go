@@ -88,6 +88,9 @@ func PromptForAWSRoleSelection(accounts []*AWSAccount) (*AWSRole, error) {
 	for _, account := range accounts {
 		for _, role := range account.Roles {
 			name := fmt.Sprintf("%s / %s", role.Name, account.Name)
+			if role.Unavailable {
+				name += " (unavailable, account suspended or closed)"
+			}
 			roles[name] = role
 			roleOptions = append(roleOptions, name)
 		}
@@ -100,5 +103,10 @@ func PromptForAWSRoleSelection(accounts []*AWSAccount) (*AWSRole, error) {
 		return nil, errors.Wrap(err, "Role selection failed")
 	}
 
-	return roles[selectedRole], nil
+	role := roles[selectedRole]
+	if role != nil && role.Unavailable {
+		return nil, ErrRoleUnavailable
+	}
+
+	return role, nil
 }
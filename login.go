@@ -0,0 +1,305 @@
+package saml2aws
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsclient"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// ErrRoleSelectionRequired returned when the assertion offers more than one role and the account doesn't set role_arn
+var ErrRoleSelectionRequired = errors.New("more than one role is available, role_arn must be set on the idp account")
+
+// ErrRoleUnavailable returned when the role can't be assumed because its AWS account is suspended or closed
+var ErrRoleUnavailable = errors.New("role is unavailable, its AWS account is suspended or closed")
+
+// newSAMLClient, newSTS and newTargetSTS build the clients used by Login
+var (
+	newSAMLClient = NewSAMLClient
+	newSTS        = func(account *cfg.IDPAccount) (stsiface.STSAPI, error) {
+		return awsclient.NewSTS(account)
+	}
+	newTargetSTS = func(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) (stsiface.STSAPI, error) {
+		return awsclient.NewSTSWithCredentials(account, awsCreds)
+	}
+)
+
+// defaultTargetSessionName the session name of the target role when neither the SAML session nor the account name one
+const defaultTargetSessionName = "saml2aws"
+
+// maxChainedSessionDuration AWS limits a session assumed with the credentials of another role to an hour
+const maxChainedSessionDuration = 3600
+
+// Login authenticate to the IdP and exchange the SAML assertion for AWS credentials
+//
+// This is the programmatic entry point for embedding saml2aws, it never prompts for a role, writes files or prints.
+// The role is the one named by role_arn, or the only one in the assertion or left by the account and role filters.
+// Any MFA code must be supplied in the login details as providers fall back to prompting for one.
+func Login(ctx context.Context, account *cfg.IDPAccount, loginDetails creds.LoginDetails) (*awsconfig.AWSCredentials, error) {
+
+	samlAssertion, err := authenticate(account, loginDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentialsFromAssertion(ctx, account, samlAssertion)
+}
+
+// authenticate to the IdP of the account returning the SAML assertion
+func authenticate(account *cfg.IDPAccount, loginDetails creds.LoginDetails) (string, error) {
+
+	if loginDetails.URL == "" {
+		loginDetails.URL = provider.ResolveIdPURL(account)
+	}
+
+	err := loginDetails.Validate()
+	if err != nil {
+		return "", errors.Wrap(err, "error validating login details")
+	}
+
+	client, err := newSAMLClient(account)
+	if err != nil {
+		return "", errors.Wrap(err, "error building IdP client")
+	}
+
+	// the token file is only consulted by this login
+	var tokens *prompter.MFATokenFile
+	if account.MFATokenFile != "" {
+		tokens = prompter.NewMFATokenFile(account.MFATokenFile)
+		loginDetails.MFATokens = tokens
+	}
+
+	samlAssertion, err := client.Authenticate(&loginDetails)
+	if err != nil {
+		if tokenErr := tokens.Err(); tokenErr != nil {
+			return "", errors.Wrap(tokenErr, "error reading MFA code from mfa_token_file")
+		}
+		return "", errors.Wrap(err, "error authenticating to IdP")
+	}
+
+	if samlAssertion == "" {
+		return "", errors.New("response did not contain a valid SAML assertion")
+	}
+
+	return samlAssertion, nil
+}
+
+// credentialsFromAssertion check the assertion and exchange it for credentials for the role of the account
+func credentialsFromAssertion(ctx context.Context, account *cfg.IDPAccount, samlAssertion string) (*awsconfig.AWSCredentials, error) {
+
+	data, err := base64.StdEncoding.DecodeString(samlAssertion)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding saml assertion")
+	}
+
+	if account.VerifyDestination {
+		err = ValidateDestination(data, SigninEndpoint(account))
+		if err != nil {
+			return nil, errors.Wrap(err, "SAML assertion may have been misdirected")
+		}
+	}
+
+	err = ValidateTransitiveTagKeys(data, account.TransitiveTagKeyList())
+	if err != nil {
+		return nil, errors.Wrap(err, "transitive session tags are not configured on the IdP")
+	}
+
+	role, err := selectRole(data, samlAssertion, account)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCreds, err := AssumeRoleWithSAML(ctx, account, role, samlAssertion)
+	if err != nil || account.TargetRoleARN == "" {
+		return awsCreds, err
+	}
+
+	return AssumeTargetRole(ctx, account, awsCreds)
+}
+
+// selectRole pick the role to assume without prompting
+func selectRole(data []byte, samlAssertion string, account *cfg.IDPAccount) (*AWSRole, error) {
+
+	roles, err := ExtractAwsRoles(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing aws roles")
+	}
+
+	var awsRoles []*AWSRole
+
+	if len(roles) == 0 {
+		awsRoles, err = ParseAWSRolesFromSigninPage(account, samlAssertion)
+		if err != nil && err != ErrNotRoleSelectionPage {
+			return nil, errors.Wrap(err, "error parsing aws roles from signin page")
+		}
+	} else {
+		awsRoles, err = ParseAWSRoles(roles)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing aws roles")
+		}
+	}
+
+	if len(awsRoles) == 0 {
+		return nil, errors.New("no roles available")
+	}
+
+	if role, ok := LocatePreferredRole(awsRoles, account); ok {
+		return role, nil
+	}
+
+	switch {
+	case account.RoleARN != "":
+		return LocateRole(awsRoles, account.RoleARN)
+	case len(awsRoles) == 1:
+		return awsRoles[0], nil
+	case account.AccountFilter == "" && account.RoleFilter == "":
+		return nil, ErrRoleSelectionRequired
+	}
+
+	return filterRole(awsRoles, samlAssertion, account)
+}
+
+// filterRole the only role left by the account and role filters, as the login command would auto select it
+func filterRole(awsRoles []*AWSRole, samlAssertion string, account *cfg.IDPAccount) (*AWSRole, error) {
+
+	// the account names are only needed to filter by account
+	awsAccounts := []*AWSAccount{{Roles: awsRoles}}
+
+	if account.AccountFilter != "" {
+		var err error
+
+		awsAccounts, err = ParseAWSAccounts(account, samlAssertion)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing aws role accounts")
+		}
+
+		AssignPrincipals(awsRoles, awsAccounts)
+	}
+
+	awsAccounts = FilterAWSAccounts(awsAccounts, account.AccountFilter, account.RoleFilter)
+
+	switch CountRoles(awsAccounts) {
+	case 0:
+		return nil, errors.New("no roles available matching the supplied filters")
+	case 1:
+		for _, awsAccount := range awsAccounts {
+			if len(awsAccount.Roles) == 1 {
+				return awsAccount.Roles[0], nil
+			}
+		}
+	}
+
+	return nil, ErrRoleSelectionRequired
+}
+
+// AssumeRoleWithSAML exchange the SAML assertion for credentials for the role
+func AssumeRoleWithSAML(ctx context.Context, account *cfg.IDPAccount, role *AWSRole, samlAssertion string) (*awsconfig.AWSCredentials, error) {
+
+	if role.PrincipalARN == "" {
+		return nil, errors.Errorf("unable to determine the principal ARN for role: %s", role.RoleARN)
+	}
+
+	svc, err := newSTS(account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create sts client")
+	}
+
+	params := &sts.AssumeRoleWithSAMLInput{
+		PrincipalArn:    aws.String(role.PrincipalARN), // Required
+		RoleArn:         aws.String(role.RoleARN),      // Required
+		SAMLAssertion:   aws.String(samlAssertion),     // Required
+		DurationSeconds: aws.Int64(int64(account.SessionDuration)),
+	}
+
+	resp, err := svc.AssumeRoleWithSAMLWithContext(ctx, params)
+	if err != nil {
+		if awsclient.IsAccountUnavailable(err) {
+			role.Unavailable = true
+			return nil, errors.Wrapf(err, "the AWS account of role %s is suspended or closed", role.RoleARN)
+		}
+
+		msg := "error retrieving STS credentials using SAML"
+		if hint := awsclient.STSErrorHint(err); hint != "" {
+			msg = hint
+		}
+
+		if skew := awsclient.ClockSkewHint(err, account.NTPServer); skew != "" {
+			msg = msg + ", " + skew
+		}
+
+		return nil, errors.Wrap(err, msg)
+	}
+
+	return &awsconfig.AWSCredentials{
+		AWSAccessKey:     aws.StringValue(resp.Credentials.AccessKeyId),
+		AWSSecretKey:     aws.StringValue(resp.Credentials.SecretAccessKey),
+		AWSSessionToken:  aws.StringValue(resp.Credentials.SessionToken),
+		AWSSecurityToken: aws.StringValue(resp.Credentials.SessionToken),
+		PrincipalARN:     aws.StringValue(resp.AssumedRoleUser.Arn),
+		Expires:          resp.Credentials.Expiration.Local(),
+	}, nil
+}
+
+// AssumeTargetRole assume the target_role_arn of the account with the credentials of the SAML role
+//
+// The session name defaults to the one AWS gave the SAML session, so CloudTrail shows the same user in both accounts,
+// then to the username of the account.
+func AssumeTargetRole(ctx context.Context, account *cfg.IDPAccount, samlCreds *awsconfig.AWSCredentials) (*awsconfig.AWSCredentials, error) {
+
+	svc, err := newTargetSTS(account, samlCreds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create sts client")
+	}
+
+	sessionName := account.TargetSessionName
+	if sessionName == "" {
+		sessionName = samlCreds.PrincipalARN[strings.LastIndex(samlCreds.PrincipalARN, "/")+1:]
+	}
+	if sessionName == "" {
+		sessionName = account.Username
+	}
+	if sessionName == "" {
+		sessionName = defaultTargetSessionName
+	}
+
+	params := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(account.TargetRoleARN),
+		RoleSessionName: aws.String(sessionName),
+	}
+
+	if account.TargetExternalID != "" {
+		params.ExternalId = aws.String(account.TargetExternalID)
+	}
+
+	if account.SessionDuration > 0 {
+		duration := account.SessionDuration
+		if duration > maxChainedSessionDuration {
+			duration = maxChainedSessionDuration
+		}
+		params.DurationSeconds = aws.Int64(int64(duration))
+	}
+
+	resp, err := svc.AssumeRoleWithContext(ctx, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error assuming target role %s", account.TargetRoleARN)
+	}
+
+	return &awsconfig.AWSCredentials{
+		AWSAccessKey:     aws.StringValue(resp.Credentials.AccessKeyId),
+		AWSSecretKey:     aws.StringValue(resp.Credentials.SecretAccessKey),
+		AWSSessionToken:  aws.StringValue(resp.Credentials.SessionToken),
+		AWSSecurityToken: aws.StringValue(resp.Credentials.SessionToken),
+		PrincipalARN:     aws.StringValue(resp.AssumedRoleUser.Arn),
+		Expires:          resp.Credentials.Expiration.Local(),
+	}, nil
+}
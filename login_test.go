@@ -0,0 +1,275 @@
+package saml2aws
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+type mockSAMLClient struct {
+	samlAssertion string
+	loginDetails  *creds.LoginDetails
+}
+
+func (m *mockSAMLClient) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	m.loginDetails = loginDetails
+	return m.samlAssertion, nil
+}
+
+type mockSTS struct {
+	stsiface.STSAPI
+	input *sts.AssumeRoleWithSAMLInput
+	// assumeRoleInput the input of the chained AssumeRole
+	assumeRoleInput *sts.AssumeRoleInput
+	// targetCreds the credentials the chained AssumeRole was signed with
+	targetCreds *awsconfig.AWSCredentials
+	// roleErrors returned instead of credentials for the role ARN
+	roleErrors map[string]error
+	// mu guards input as roles may be assumed concurrently
+	mu sync.Mutex
+}
+
+func (m *mockSTS) AssumeRoleWithSAMLWithContext(ctx aws.Context, input *sts.AssumeRoleWithSAMLInput, opts ...request.Option) (*sts.AssumeRoleWithSAMLOutput, error) {
+	m.mu.Lock()
+	m.input = input
+	m.mu.Unlock()
+
+	if err := m.roleErrors[aws.StringValue(input.RoleArn)]; err != nil {
+		return nil, err
+	}
+
+	return &sts.AssumeRoleWithSAMLOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{Arn: aws.String("arn:aws:sts::123123123123:assumed-role/AWS-Admin-CloudOPSBuild/wolfeidau")},
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Date(2018, 6, 1, 10, 30, 0, 0, time.UTC)),
+		},
+	}, nil
+}
+
+func (m *mockSTS) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	m.assumeRoleInput = input
+
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{Arn: aws.String("arn:aws:sts::456456456456:assumed-role/Deploy/wolfeidau")},
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIATARGET"),
+			SecretAccessKey: aws.String("target-secret"),
+			SessionToken:    aws.String("target-token"),
+			Expiration:      aws.Time(time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)),
+		},
+	}, nil
+}
+
+// withMockClients replace the IdP and STS clients used by Login, returning a func which restores them
+func withMockClients(t *testing.T) (*mockSAMLClient, *mockSTS, func()) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	client := &mockSAMLClient{samlAssertion: base64.StdEncoding.EncodeToString(data)}
+	svc := &mockSTS{}
+
+	origSAMLClient, origSTS, origTargetSTS := newSAMLClient, newSTS, newTargetSTS
+
+	newSAMLClient = func(*cfg.IDPAccount) (SAMLClient, error) { return client, nil }
+	newSTS = func(*cfg.IDPAccount) (stsiface.STSAPI, error) { return svc, nil }
+	newTargetSTS = func(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) (stsiface.STSAPI, error) {
+		svc.targetCreds = awsCreds
+		return svc, nil
+	}
+
+	return client, svc, func() { newSAMLClient, newSTS, newTargetSTS = origSAMLClient, origSTS, origTargetSTS }
+}
+
+// captureStdout run fn returning anything it wrote to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+
+	return string(out)
+}
+
+func TestLogin(t *testing.T) {
+	client, svc, restore := withMockClients(t)
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+
+	account := cfg.NewIDPAccount()
+	account.URL = "https://id.example.com"
+	account.RoleARN = "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild"
+	account.VerifyDestination = true
+
+	var awsCreds *awsconfig.AWSCredentials
+
+	out := captureStdout(t, func() {
+		awsCreds, err = Login(context.Background(), account, creds.LoginDetails{Username: "wolfeidau", Password: "test123", MFAToken: "123456"})
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, out)
+
+	assert.Equal(t, "ASIAEXAMPLE", awsCreds.AWSAccessKey)
+	assert.Equal(t, "secret", awsCreds.AWSSecretKey)
+	assert.Equal(t, "token", awsCreds.AWSSessionToken)
+	assert.Equal(t, "arn:aws:sts::123123123123:assumed-role/AWS-Admin-CloudOPSBuild/wolfeidau", awsCreds.PrincipalARN)
+
+	assert.Equal(t, "https://id.example.com", client.loginDetails.URL)
+	assert.Equal(t, "123456", client.loginDetails.MFAToken)
+
+	assert.Equal(t, "arn:aws:iam::123123123123:saml-provider/ExampleADFS", aws.StringValue(svc.input.PrincipalArn))
+	assert.Equal(t, "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild", aws.StringValue(svc.input.RoleArn))
+
+	// nothing is written to the credentials file or anywhere else
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestLoginTargetRole(t *testing.T) {
+	_, svc, restore := withMockClients(t)
+	defer restore()
+
+	account := cfg.NewIDPAccount()
+	account.URL = "https://id.example.com"
+	account.RoleARN = "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild"
+	account.TargetRoleARN = "arn:aws:iam::456456456456:role/Deploy"
+	account.TargetExternalID = "external"
+	account.SessionDuration = 7200
+
+	awsCreds, err := Login(context.Background(), account, creds.LoginDetails{Username: "wolfeidau", Password: "test123"})
+	assert.Nil(t, err)
+
+	// only the target credentials are returned, the SAML credentials signed the AssumeRole
+	assert.Equal(t, "ASIATARGET", awsCreds.AWSAccessKey)
+	assert.Equal(t, "target-token", awsCreds.AWSSessionToken)
+	assert.Equal(t, "arn:aws:sts::456456456456:assumed-role/Deploy/wolfeidau", awsCreds.PrincipalARN)
+	assert.Equal(t, "ASIAEXAMPLE", svc.targetCreds.AWSAccessKey)
+
+	assert.Equal(t, "arn:aws:iam::456456456456:role/Deploy", aws.StringValue(svc.assumeRoleInput.RoleArn))
+	assert.Equal(t, "external", aws.StringValue(svc.assumeRoleInput.ExternalId))
+	assert.Equal(t, "wolfeidau", aws.StringValue(svc.assumeRoleInput.RoleSessionName))
+	assert.Equal(t, int64(3600), aws.Int64Value(svc.assumeRoleInput.DurationSeconds))
+
+	account.TargetSessionName = "deploy"
+	account.TargetExternalID = ""
+
+	_, err = Login(context.Background(), account, creds.LoginDetails{Username: "wolfeidau", Password: "test123"})
+	assert.Nil(t, err)
+	assert.Equal(t, "deploy", aws.StringValue(svc.assumeRoleInput.RoleSessionName))
+	assert.Nil(t, svc.assumeRoleInput.ExternalId)
+}
+
+func TestAssumeTargetRoleSessionName(t *testing.T) {
+	_, svc, restore := withMockClients(t)
+	defer restore()
+
+	account := cfg.NewIDPAccount()
+	account.TargetRoleARN = "arn:aws:iam::456456456456:role/Deploy"
+	account.Username = "wolfeidau"
+
+	// without a SAML session name the username names the session, then a fixed name
+	_, err := AssumeTargetRole(context.Background(), account, &awsconfig.AWSCredentials{AWSAccessKey: "ASIAEXAMPLE"})
+	assert.Nil(t, err)
+	assert.Equal(t, "wolfeidau", aws.StringValue(svc.assumeRoleInput.RoleSessionName))
+
+	account.Username = ""
+
+	_, err = AssumeTargetRole(context.Background(), account, &awsconfig.AWSCredentials{AWSAccessKey: "ASIAEXAMPLE"})
+	assert.Nil(t, err)
+	assert.Equal(t, "saml2aws", aws.StringValue(svc.assumeRoleInput.RoleSessionName))
+}
+
+func TestLoginRoleSelectionRequired(t *testing.T) {
+	_, svc, restore := withMockClients(t)
+	defer restore()
+
+	account := cfg.NewIDPAccount()
+	account.URL = "https://id.example.com"
+
+	_, err := Login(context.Background(), account, creds.LoginDetails{Username: "wolfeidau", Password: "test123"})
+	assert.Equal(t, ErrRoleSelectionRequired, err)
+	assert.Nil(t, svc.input)
+}
+
+func TestLoginRoleFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		roleFilter string
+		wantRole   string
+		wantErr    string
+	}{
+		{name: "one role left", roleFilter: "nonprod", wantRole: "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd"},
+		{name: "no role left", roleFilter: "missing", wantErr: "no roles available matching the supplied filters"},
+		{name: "several roles left", roleFilter: "cloudops", wantErr: ErrRoleSelectionRequired.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, svc, restore := withMockClients(t)
+			defer restore()
+
+			account := cfg.NewIDPAccount()
+			account.URL = "https://id.example.com"
+			account.RoleFilter = tt.roleFilter
+
+			_, err := Login(context.Background(), account, creds.LoginDetails{Username: "wolfeidau", Password: "test123"})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, svc.input)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantRole, aws.StringValue(svc.input.RoleArn))
+		})
+	}
+}
+
+func TestLoginDuplicateRoles(t *testing.T) {
+	client, svc, restore := withMockClients(t)
+	defer restore()
+
+	data, err := ioutil.ReadFile("testdata/assertion_duplicate_roles.xml")
+	assert.Nil(t, err)
+	client.samlAssertion = base64.StdEncoding.EncodeToString(data)
+
+	// the repeated role is the only one so it is selected without role_arn
+	account := cfg.NewIDPAccount()
+	account.URL = "https://id.example.com"
+
+	_, err = Login(context.Background(), account, creds.LoginDetails{Username: "wolfeidau", Password: "test123"})
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild", aws.StringValue(svc.input.RoleArn))
+}
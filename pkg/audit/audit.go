@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// Event a single login recorded in the audit log, this must never contain secrets
+type Event struct {
+	Timestamp       time.Time `json:"timestamp"`
+	IdpAccount      string    `json:"idp_account"`
+	Profile         string    `json:"profile"`
+	Provider        string    `json:"provider"`
+	Role            string    `json:"role,omitempty"`
+	Success         bool      `json:"success"`
+	FailureClass    string    `json:"failure_class,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// Append write the event as a single JSON line to the end of the audit log
+//
+// The line is written with one write to a file opened with O_APPEND so concurrent runs
+// don't interleave their entries.
+func Append(auditLogFile string, event *Event) error {
+
+	path, err := homedir.Expand(auditLogFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to expand audit log path")
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "error encoding audit event")
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "unable to open audit log")
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "error writing audit log")
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readEvents(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	require.Nil(t, err)
+	defer f.Close()
+
+	events := []map[string]interface{}{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := map[string]interface{}{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &event), scanner.Text())
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+
+	err = Append(path, &Event{
+		Timestamp:       time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+		IdpAccount:      "default",
+		Profile:         "saml",
+		Provider:        "Okta",
+		Role:            "arn:aws:iam::123456789012:role/Admin",
+		Success:         true,
+		DurationSeconds: 2.5,
+	})
+	require.Nil(t, err)
+
+	err = Append(path, &Event{IdpAccount: "default", Provider: "Okta", FailureClass: "idp"})
+	require.Nil(t, err)
+
+	events := readEvents(t, path)
+	require.Len(t, events, 2)
+
+	require.Equal(t, "2018-06-01T10:00:00Z", events[0]["timestamp"])
+	require.Equal(t, "arn:aws:iam::123456789012:role/Admin", events[0]["role"])
+	require.Equal(t, true, events[0]["success"])
+	require.Equal(t, 2.5, events[0]["duration_seconds"])
+
+	require.Equal(t, false, events[1]["success"])
+	require.Equal(t, "idp", events[1]["failure_class"])
+	require.NotContains(t, events[1], "role")
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.Nil(t, Append(path, &Event{IdpAccount: "default", Provider: "KeyCloak", Success: true}))
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, readEvents(t, path), 50)
+}
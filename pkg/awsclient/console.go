@@ -0,0 +1,121 @@
+package awsclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+const (
+	// DefaultFederationURL the AWS federation endpoint used to exchange credentials for a console sign-in token
+	DefaultFederationURL = "https://signin.aws.amazon.com/federation"
+
+	// DefaultConsoleDestination the console page opened after signing in
+	DefaultConsoleDestination = "https://console.aws.amazon.com/"
+
+	// DefaultConsoleIssuer identifies saml2aws as the issuer of the sign-in link
+	DefaultConsoleIssuer = "saml2aws"
+
+	// MinConsoleSessionDuration and MaxConsoleSessionDuration the console session durations in seconds accepted by
+	// the federation endpoint
+	MinConsoleSessionDuration = 900
+	MaxConsoleSessionDuration = 43200
+)
+
+// Federation builds AWS console sign-in URLs from temporary credentials
+type Federation struct {
+	URL    string
+	Issuer string
+	Client *http.Client
+}
+
+// NewFederation create a federation client for the supplied endpoint, an empty URL uses the default endpoint and a nil
+// transport the default transport
+func NewFederation(federationURL string, tr http.RoundTripper) *Federation {
+	if federationURL == "" {
+		federationURL = DefaultFederationURL
+	}
+
+	return &Federation{
+		URL:    federationURL,
+		Issuer: DefaultConsoleIssuer,
+		Client: &http.Client{Transport: tr, Timeout: 10 * time.Second},
+	}
+}
+
+// SigninToken exchange the temporary credentials for a sign-in token, a zero session duration uses the AWS default
+func (f *Federation) SigninToken(awsCreds *awsconfig.AWSCredentials, sessionDuration int) (string, error) {
+
+	if sessionDuration != 0 && (sessionDuration < MinConsoleSessionDuration || sessionDuration > MaxConsoleSessionDuration) {
+		return "", errors.Errorf("console session duration must be between %d and %d seconds, got %d", MinConsoleSessionDuration, MaxConsoleSessionDuration, sessionDuration)
+	}
+
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    awsCreds.AWSAccessKey,
+		"sessionKey":   awsCreds.AWSSecretKey,
+		"sessionToken": awsCreds.AWSSessionToken,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding federation session")
+	}
+
+	q := url.Values{}
+	q.Set("Action", "getSigninToken")
+	q.Set("Session", string(session))
+	if sessionDuration > 0 {
+		q.Set("SessionDuration", strconv.Itoa(sessionDuration))
+	}
+
+	logger.WithField("url", f.URL).Debug("requesting signin token")
+
+	res, err := f.Client.Get(f.URL + "?" + q.Encode())
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting signin token")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("requesting signin token failed status: %s", res.Status)
+	}
+
+	var token struct {
+		SigninToken string
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding signin token response")
+	}
+
+	if token.SigninToken == "" {
+		return "", errors.New("federation response did not contain a signin token")
+	}
+
+	return token.SigninToken, nil
+}
+
+// ConsoleURL build a console sign-in URL which opens the destination as the federated role
+func (f *Federation) ConsoleURL(awsCreds *awsconfig.AWSCredentials, destination string, sessionDuration int) (string, error) {
+
+	signinToken, err := f.SigninToken(awsCreds, sessionDuration)
+	if err != nil {
+		return "", err
+	}
+
+	if destination == "" {
+		destination = DefaultConsoleDestination
+	}
+
+	q := url.Values{}
+	q.Set("Action", "login")
+	q.Set("Issuer", f.Issuer)
+	q.Set("Destination", destination)
+	q.Set("SigninToken", signinToken)
+
+	return f.URL + "?" + q.Encode(), nil
+}
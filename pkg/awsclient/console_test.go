@@ -0,0 +1,95 @@
+package awsclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+)
+
+var consoleCreds = &awsconfig.AWSCredentials{
+	AWSAccessKey:    "ASIAEXAMPLE",
+	AWSSecretKey:    "secret",
+	AWSSessionToken: "token",
+}
+
+func newFederationServer(t *testing.T, query *url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*query = r.URL.Query()
+		w.Write([]byte(`{"SigninToken":"VCQgs5qZZt3Q"}`))
+	}))
+}
+
+func TestConsoleURL(t *testing.T) {
+	var query url.Values
+
+	ts := newFederationServer(t, &query)
+	defer ts.Close()
+
+	consoleURL, err := NewFederation(ts.URL, nil).ConsoleURL(consoleCreds, "https://console.aws.amazon.com/ec2/home", 3600)
+	require.Nil(t, err)
+
+	require.Equal(t, "getSigninToken", query.Get("Action"))
+	require.Equal(t, "3600", query.Get("SessionDuration"))
+
+	var session map[string]string
+	require.Nil(t, json.Unmarshal([]byte(query.Get("Session")), &session))
+	require.Equal(t, map[string]string{"sessionId": "ASIAEXAMPLE", "sessionKey": "secret", "sessionToken": "token"}, session)
+
+	u, err := url.Parse(consoleURL)
+	require.Nil(t, err)
+	require.Equal(t, ts.URL, u.Scheme+"://"+u.Host)
+	require.Equal(t, "login", u.Query().Get("Action"))
+	require.Equal(t, "saml2aws", u.Query().Get("Issuer"))
+	require.Equal(t, "https://console.aws.amazon.com/ec2/home", u.Query().Get("Destination"))
+	require.Equal(t, "VCQgs5qZZt3Q", u.Query().Get("SigninToken"))
+}
+
+func TestConsoleURLDefaults(t *testing.T) {
+	var query url.Values
+
+	ts := newFederationServer(t, &query)
+	defer ts.Close()
+
+	consoleURL, err := NewFederation(ts.URL, nil).ConsoleURL(consoleCreds, "", 0)
+	require.Nil(t, err)
+	require.Empty(t, query.Get("SessionDuration"))
+
+	u, err := url.Parse(consoleURL)
+	require.Nil(t, err)
+	require.Equal(t, DefaultConsoleDestination, u.Query().Get("Destination"))
+
+	require.Equal(t, DefaultFederationURL, NewFederation("", nil).URL)
+}
+
+func TestSigninTokenErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	_, err := NewFederation(ts.URL, nil).SigninToken(consoleCreds, 0)
+	require.Error(t, err)
+}
+
+func TestSigninTokenSessionDurationLimits(t *testing.T) {
+	var query url.Values
+
+	ts := newFederationServer(t, &query)
+	defer ts.Close()
+
+	_, err := NewFederation(ts.URL, nil).SigninToken(consoleCreds, 600)
+	require.EqualError(t, err, "console session duration must be between 900 and 43200 seconds, got 600")
+
+	_, err = NewFederation(ts.URL, nil).SigninToken(consoleCreds, 86400)
+	require.Error(t, err)
+	require.Nil(t, query)
+
+	_, err = NewFederation(ts.URL, nil).SigninToken(consoleCreds, 43200)
+	require.Nil(t, err)
+	require.Equal(t, "43200", query.Get("SessionDuration"))
+}
@@ -0,0 +1,86 @@
+package awsclient
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// ErrIAMReadDenied returned when the assumed role isn't permitted to read its own policies
+var ErrIAMReadDenied = errors.New("not permitted to read the role's IAM policies")
+
+// RolePolicies the policies attached to a role
+type RolePolicies struct {
+	RoleName        string
+	ManagedPolicies []string // policy ARNs
+	InlinePolicies  []string // policy names
+}
+
+// NewIAM create an IAM client using the supplied credentials, the account region selects the partition
+func NewIAM(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) (iamiface.IAMAPI, error) {
+
+	config := &aws.Config{
+		Credentials: credentials.NewStaticCredentials(awsCreds.AWSAccessKey, awsCreds.AWSSecretKey, awsCreds.AWSSessionToken),
+	}
+
+	if account.Region != "" {
+		config.Region = aws.String(account.Region)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+
+	return iam.New(sess), nil
+}
+
+// RoleNameFromARN the role name is the last path element of the role ARN
+func RoleNameFromARN(roleARN string) string {
+	return roleARN[strings.LastIndex(roleARN, "/")+1:]
+}
+
+// ListRolePolicies list the managed and inline policies attached to the role, returning ErrIAMReadDenied when
+// the credentials aren't permitted to read them
+func ListRolePolicies(svc iamiface.IAMAPI, roleName string) (*RolePolicies, error) {
+
+	policies := &RolePolicies{RoleName: roleName}
+
+	err := svc.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+			for _, policy := range page.AttachedPolicies {
+				policies.ManagedPolicies = append(policies.ManagedPolicies, aws.StringValue(policy.PolicyArn))
+			}
+			return true
+		})
+	if err != nil {
+		return nil, iamError(err, "error listing attached role policies")
+	}
+
+	err = svc.ListRolePoliciesPages(&iam.ListRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListRolePoliciesOutput, lastPage bool) bool {
+			policies.InlinePolicies = append(policies.InlinePolicies, aws.StringValueSlice(page.PolicyNames)...)
+			return true
+		})
+	if err != nil {
+		return nil, iamError(err, "error listing inline role policies")
+	}
+
+	return policies, nil
+}
+
+func iamError(err error, msg string) error {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDenied" {
+		return ErrIAMReadDenied
+	}
+
+	return errors.Wrap(err, msg)
+}
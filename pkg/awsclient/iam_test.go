@@ -0,0 +1,38 @@
+package awsclient
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRolePolicies(t *testing.T) {
+	svc := NewMemIAM([]string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::123456789012:policy/deploy"}, []string{"s3-artifacts"})
+
+	policies, err := ListRolePolicies(svc, "Developer")
+	require.Nil(t, err)
+	require.Equal(t, &RolePolicies{
+		RoleName:        "Developer",
+		ManagedPolicies: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess", "arn:aws:iam::123456789012:policy/deploy"},
+		InlinePolicies:  []string{"s3-artifacts"},
+	}, policies)
+}
+
+func TestListRolePoliciesAccessDenied(t *testing.T) {
+	svc := &MemIAM{Err: awserr.New("AccessDenied", "User is not authorized to perform: iam:ListAttachedRolePolicies", nil)}
+
+	_, err := ListRolePolicies(svc, "Developer")
+	require.Equal(t, ErrIAMReadDenied, err)
+
+	svc.Err = awserr.New("Throttling", "Rate exceeded", nil)
+
+	_, err = ListRolePolicies(svc, "Developer")
+	require.Error(t, err)
+	require.NotEqual(t, ErrIAMReadDenied, err)
+}
+
+func TestRoleNameFromARN(t *testing.T) {
+	require.Equal(t, "Developer", RoleNameFromARN("arn:aws:iam::123456789012:role/Developer"))
+	require.Equal(t, "Deployer", RoleNameFromARN("arn:aws:iam::123456789012:role/ci/Deployer"))
+}
@@ -0,0 +1,45 @@
+package awsclient
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// MemIAM an in memory IAM client listing the policies of a role, for running without AWS
+//
+// Only the calls made by ListRolePolicies are implemented, any other call panics.
+type MemIAM struct {
+	iamiface.IAMAPI
+	Attached []string // managed policy ARNs, returned one per page
+	Inline   []string // inline policy names
+	Err      error    // returned when listing the attached policies
+}
+
+// NewMemIAM create an in memory IAM client listing the supplied policies
+func NewMemIAM(attached, inline []string) *MemIAM {
+	return &MemIAM{Attached: attached, Inline: inline}
+}
+
+// ListAttachedRolePoliciesPages call fn with a page for each attached policy.
+func (m *MemIAM) ListAttachedRolePoliciesPages(input *iam.ListAttachedRolePoliciesInput, fn func(*iam.ListAttachedRolePoliciesOutput, bool) bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+
+	for i, arn := range m.Attached {
+		page := &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: []*iam.AttachedPolicy{{PolicyArn: aws.String(arn)}}}
+		if !fn(page, i == len(m.Attached)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// ListRolePoliciesPages call fn with a single page of the inline policies.
+func (m *MemIAM) ListRolePoliciesPages(input *iam.ListRolePoliciesInput, fn func(*iam.ListRolePoliciesOutput, bool) bool) error {
+	fn(&iam.ListRolePoliciesOutput{PolicyNames: aws.StringSlice(m.Inline)}, true)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package awsclient
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// ntpTimeout how long to wait for the NTP server to answer
+var ntpTimeout = 5 * time.Second
+
+// ntpEpochOffset seconds between the NTP epoch in 1900 and the unix epoch
+const ntpEpochOffset = 2208988800
+
+// clockSkewErrorCodes the STS error codes returned when the assertion or request signature looks expired, which is
+// what a skewed clock produces
+var clockSkewErrorCodes = map[string]bool{
+	sts.ErrCodeExpiredTokenException: true,
+	"RequestExpired":                 true,
+	"SignatureDoesNotMatch":          true,
+	"InvalidSignatureException":      true,
+}
+
+// ClockSkewHint report the offset of the local clock from the NTP server when the STS error looks like clock skew,
+// empty when no server is configured, the error isn't clock related or the server can't be reached
+//
+// This is only a diagnostic, the clock isn't changed.
+func ClockSkewHint(err error, ntpServer string) string {
+	if ntpServer == "" {
+		return ""
+	}
+
+	awsErr, ok := errors.Cause(err).(awserr.Error)
+	if !ok || !clockSkewErrorCodes[awsErr.Code()] {
+		return ""
+	}
+
+	offset, err := QueryClockOffset(ntpServer)
+	if err != nil {
+		logger.WithError(err).WithField("server", ntpServer).Debug("unable to measure clock offset")
+		return ""
+	}
+
+	return describeClockOffset(offset, ntpServer)
+}
+
+// QueryClockOffset measure how far the NTP server's clock is ahead of the local clock using a single SNTP request,
+// the port defaults to 123
+func QueryClockOffset(server string) (time.Duration, error) {
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, errors.Wrap(err, "error connecting to ntp server")
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(ntpTimeout))
+	if err != nil {
+		return 0, errors.Wrap(err, "error setting ntp deadline")
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x1b // version 3, client mode
+
+	sent := time.Now()
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "error sending ntp request")
+	}
+
+	res := make([]byte, 48)
+
+	n, err := conn.Read(res)
+	if err != nil {
+		return 0, errors.Wrap(err, "error reading ntp response")
+	}
+
+	received := time.Now()
+
+	if n < 48 {
+		return 0, errors.Errorf("short ntp response: %d bytes", n)
+	}
+
+	if mode := res[0] & 0x07; mode != 4 {
+		return 0, errors.Errorf("unexpected ntp response mode: %d", mode)
+	}
+
+	if res[1] == 0 {
+		return 0, errors.New("ntp server refused the request")
+	}
+
+	serverReceived := ntpTime(res[32:40])
+	serverSent := ntpTime(res[40:48])
+
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decode a 64 bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+
+	return time.Unix(secs, (frac*1e9)>>32)
+}
+
+func describeClockOffset(offset time.Duration, ntpServer string) string {
+	offset = offset.Round(time.Second)
+
+	switch {
+	case offset < 0:
+		return fmt.Sprintf("the clock on this machine is %s fast compared to %s", -offset, ntpServer)
+	case offset > 0:
+		return fmt.Sprintf("the clock on this machine is %s slow compared to %s", offset, ntpServer)
+	}
+
+	return fmt.Sprintf("the clock on this machine is in sync with %s", ntpServer)
+}
@@ -0,0 +1,79 @@
+package awsclient
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newNTPServer answer a single SNTP request with timestamps offset from the local clock
+func newNTPServer(t *testing.T, offset time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	go func() {
+		defer conn.Close()
+
+		req := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(req)
+		if err != nil {
+			return
+		}
+
+		res := make([]byte, 48)
+		res[0] = 0x1c // version 3, server mode
+		res[1] = 1    // stratum
+
+		now := time.Now().Add(offset)
+		putNTPTime(res[32:40], now)
+		putNTPTime(res[40:48], now)
+
+		conn.WriteTo(res, addr)
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+func TestQueryClockOffset(t *testing.T) {
+	server := newNTPServer(t, -4*time.Minute)
+
+	offset, err := QueryClockOffset(server)
+	require.Nil(t, err)
+	require.Equal(t, -4*time.Minute, offset.Round(time.Second))
+}
+
+func TestClockSkewHint(t *testing.T) {
+	expired := errors.Wrap(awserr.New(sts.ErrCodeExpiredTokenException, "Token has expired", nil), "error retrieving STS credentials")
+
+	server := newNTPServer(t, -4*time.Minute)
+	require.Equal(t, "the clock on this machine is 4m0s fast compared to "+server, ClockSkewHint(expired, server))
+
+	server = newNTPServer(t, 90*time.Second)
+	require.Equal(t, "the clock on this machine is 1m30s slow compared to "+server, ClockSkewHint(expired, server))
+
+	server = newNTPServer(t, 0)
+	require.Equal(t, "the clock on this machine is in sync with "+server, ClockSkewHint(expired, server))
+}
+
+func TestClockSkewHintSkipped(t *testing.T) {
+	expired := awserr.New(sts.ErrCodeExpiredTokenException, "Token has expired", nil)
+
+	// no server is configured
+	require.Empty(t, ClockSkewHint(expired, ""))
+
+	// the error isn't clock related so the server isn't queried
+	server := newNTPServer(t, -4*time.Minute)
+	require.Empty(t, ClockSkewHint(awserr.New("AccessDenied", "Not authorized", nil), server))
+	require.Empty(t, ClockSkewHint(errors.New("connection reset"), server))
+}
@@ -0,0 +1,147 @@
+package awsclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+var logger = logrus.WithField("pkg", "awsclient")
+
+// stsErrorHints actionable messages for the STS error codes which point somewhere other than the role
+var stsErrorHints = map[string]string{
+	sts.ErrCodeIDPRejectedClaimException:     "AWS rejected the claims in the SAML assertion, check the role and principal ARNs match the IAM SAML provider and the role trust policy",
+	sts.ErrCodeExpiredTokenException:         "the SAML assertion has expired, check the clock on this machine is in sync and login again",
+	sts.ErrCodeInvalidIdentityTokenException: "AWS could not validate the SAML assertion, check the IAM SAML provider exists in this account and its metadata matches the IdP",
+}
+
+// STSErrorHint return an actionable message for an STS error, empty when there is nothing more specific to say
+func STSErrorHint(err error) string {
+	awsErr, ok := errors.Cause(err).(awserr.Error)
+	if !ok {
+		return ""
+	}
+
+	return stsErrorHints[awsErr.Code()]
+}
+
+// accountUnavailableCodes the STS error codes which, along with a message about the account being suspended or
+// closed, mean the role can't be assumed until the account is reinstated
+var accountUnavailableCodes = map[string]bool{
+	"AccessDenied":         true,
+	"InvalidClientTokenId": true,
+	"OptInRequired":        true,
+	"AccountSuspended":     true,
+}
+
+// IsAccountUnavailable true when STS refused the role because its AWS account is suspended or closed
+func IsAccountUnavailable(err error) bool {
+	awsErr, ok := errors.Cause(err).(awserr.Error)
+	if !ok || !accountUnavailableCodes[awsErr.Code()] {
+		return false
+	}
+
+	if awsErr.Code() == "AccountSuspended" {
+		return true
+	}
+
+	msg := strings.ToLower(awsErr.Message())
+
+	return strings.Contains(msg, "suspended") || strings.Contains(msg, "closed")
+}
+
+// STSEndpointResolver resolves the STS service to an explicitly configured endpoint
+//
+// This is used in isolated regions where the SDK doesn't know the partition, all other
+// services fall through to the default resolver.
+func STSEndpointResolver(endpoint, signingRegion string) endpoints.Resolver {
+	return endpoints.ResolverFunc(func(service, region string, optFns ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if service == endpoints.StsServiceID {
+			return endpoints.ResolvedEndpoint{
+				URL:           endpoint,
+				SigningRegion: signingRegion,
+				SigningName:   endpoints.StsServiceID,
+				SigningMethod: "v4",
+			}, nil
+		}
+
+		return endpoints.DefaultResolver().EndpointFor(service, region, optFns...)
+	})
+}
+
+// NewSTS create an STS client, using the endpoint resolver override when the account configures one, otherwise the
+// regional STS endpoint of the configured region
+func NewSTS(account *cfg.IDPAccount) (*sts.STS, error) {
+	return NewSTSWithCredentials(account, nil)
+}
+
+// NewSTSWithCredentials create an STS client like NewSTS which signs its requests with the credentials, nil uses the
+// default credential chain
+func NewSTSWithCredentials(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) (*sts.STS, error) {
+
+	opts := session.Options{}
+
+	switch {
+	case account.STSEndpoint != "":
+		// an endpoint in a known region, such as a VPC endpoint, is signed for the account's region
+		signingRegion := account.STSSigningRegion
+		if signingRegion == "" {
+			signingRegion = account.Region
+		}
+
+		if signingRegion == "" {
+			return nil, errors.New("aws_sts_signing_region or region is required when aws_sts_endpoint is set")
+		}
+
+		logger.WithField("endpoint", account.STSEndpoint).WithField("signingRegion", signingRegion).Debug("using sts endpoint override")
+
+		opts.Config = aws.Config{
+			Region:           aws.String(signingRegion),
+			EndpointResolver: STSEndpointResolver(account.STSEndpoint, signingRegion),
+		}
+	case account.Region != "":
+		logger.WithField("region", account.Region).Debug("using regional sts endpoint")
+
+		opts.Config = aws.Config{
+			Region: aws.String(account.Region),
+		}
+	}
+
+	// STS is reached through the same proxy as the IdP and trusts ca_bundle unless it has its own bundle
+	if account.ProxyURL != "" || account.CABundle != "" {
+		opts.Config.HTTPClient = &http.Client{Transport: provider.NewAWSTransport(account)}
+	}
+
+	if account.STSCABundle != "" {
+		data, err := ioutil.ReadFile(account.STSCABundle)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read sts ca bundle")
+		}
+
+		opts.CustomCABundle = bytes.NewReader(data)
+	}
+
+	if awsCreds != nil {
+		opts.Config.Credentials = credentials.NewStaticCredentials(awsCreds.AWSAccessKey, awsCreds.AWSSecretKey, awsCreds.AWSSessionToken)
+	}
+
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+
+	return sts.New(sess), nil
+}
@@ -0,0 +1,134 @@
+package awsclient
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestSTSEndpointResolver(t *testing.T) {
+	resolver := STSEndpointResolver("https://sts.isolated.example.ic.gov", "us-iso-east-1")
+
+	ep, err := resolver.EndpointFor(endpoints.StsServiceID, "us-iso-east-1")
+	require.Nil(t, err)
+	require.Equal(t, "https://sts.isolated.example.ic.gov", ep.URL)
+	require.Equal(t, "us-iso-east-1", ep.SigningRegion)
+	require.Equal(t, "sts", ep.SigningName)
+
+	ep, err = resolver.EndpointFor("s3", "us-east-1")
+	require.Nil(t, err)
+	require.Equal(t, "https://s3.amazonaws.com", ep.URL)
+}
+
+func TestNewSTSIsolatedRegion(t *testing.T) {
+	account := &cfg.IDPAccount{
+		STSEndpoint:      "https://sts.isolated.example.ic.gov",
+		STSSigningRegion: "us-iso-east-1",
+	}
+
+	svc, err := NewSTS(account)
+	require.Nil(t, err)
+	require.Equal(t, "https://sts.isolated.example.ic.gov", svc.Endpoint)
+	require.Equal(t, "us-iso-east-1", svc.SigningRegion)
+}
+
+func TestNewSTSRegion(t *testing.T) {
+	tests := []struct {
+		region   string
+		endpoint string
+	}{
+		{region: "us-gov-west-1", endpoint: "https://sts.us-gov-west-1.amazonaws.com"},
+		{region: "cn-north-1", endpoint: "https://sts.cn-north-1.amazonaws.com.cn"},
+	}
+
+	for _, tt := range tests {
+		svc, err := NewSTS(&cfg.IDPAccount{Region: tt.region})
+		require.Nil(t, err)
+		require.Equal(t, tt.endpoint, svc.Endpoint, tt.region)
+		require.Equal(t, tt.region, svc.SigningRegion, tt.region)
+	}
+}
+
+func TestNewSTSEndpointInRegion(t *testing.T) {
+	account := &cfg.IDPAccount{
+		STSEndpoint: "https://vpce-0123456789abcdef0.sts.us-gov-west-1.vpce.amazonaws.com",
+		Region:      "us-gov-west-1",
+	}
+
+	svc, err := NewSTS(account)
+	require.Nil(t, err)
+	require.Equal(t, "https://vpce-0123456789abcdef0.sts.us-gov-west-1.vpce.amazonaws.com", svc.Endpoint)
+	require.Equal(t, "us-gov-west-1", svc.SigningRegion)
+}
+
+func TestNewSTSMissingSigningRegion(t *testing.T) {
+	_, err := NewSTS(&cfg.IDPAccount{STSEndpoint: "https://sts.isolated.example.ic.gov"})
+	require.Error(t, err)
+}
+
+func TestNewSTSMissingCABundle(t *testing.T) {
+	account := &cfg.IDPAccount{
+		STSEndpoint:      "https://sts.isolated.example.ic.gov",
+		STSSigningRegion: "us-iso-east-1",
+		STSCABundle:      "example/missing.pem",
+	}
+
+	_, err := NewSTS(account)
+	require.Error(t, err)
+
+	// the bundle is used with the regional endpoint too
+	_, err = NewSTS(&cfg.IDPAccount{Region: "us-east-1", STSCABundle: "example/missing.pem"})
+	require.Error(t, err)
+}
+
+func TestNewSTSProxy(t *testing.T) {
+	svc, err := NewSTS(&cfg.IDPAccount{Region: "us-east-1", ProxyURL: "http://proxy.example.com:3128"})
+	require.Nil(t, err)
+
+	// STS requests go through the proxy of the account
+	tr, ok := svc.Client.Config.HTTPClient.Transport.(*http.Transport)
+	require.True(t, ok)
+
+	proxyURL, err := tr.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "sts.us-east-1.amazonaws.com"}})
+	require.Nil(t, err)
+	require.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+}
+
+func TestSTSErrorHint(t *testing.T) {
+	tests := []struct {
+		code string
+		hint string
+	}{
+		{code: "IDPRejectedClaim", hint: "check the role and principal ARNs"},
+		{code: "ExpiredTokenException", hint: "check the clock on this machine is in sync and login again"},
+		{code: "InvalidIdentityToken", hint: "check the IAM SAML provider exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			err := awserr.New(tt.code, "Error from STS", nil)
+			require.Contains(t, STSErrorHint(err), tt.hint)
+
+			// the code is still found once the error has been wrapped
+			require.Contains(t, STSErrorHint(errors.Wrap(err, "error retrieving STS credentials")), tt.hint)
+		})
+	}
+
+	require.Empty(t, STSErrorHint(awserr.New("AccessDenied", "Not authorized to perform sts:AssumeRoleWithSAML", nil)))
+	require.Empty(t, STSErrorHint(errors.New("connection reset")))
+}
+
+func TestIsAccountUnavailable(t *testing.T) {
+	require.True(t, IsAccountUnavailable(awserr.New("AccessDenied", "The AWS account 123456789012 is suspended", nil)))
+	require.True(t, IsAccountUnavailable(errors.Wrap(awserr.New("InvalidClientTokenId", "The account has been closed", nil), "error retrieving STS credentials")))
+	require.True(t, IsAccountUnavailable(awserr.New("AccountSuspended", "", nil)))
+
+	require.False(t, IsAccountUnavailable(awserr.New("AccessDenied", "Not authorized to perform sts:AssumeRoleWithSAML", nil)))
+	require.False(t, IsAccountUnavailable(awserr.New("ExpiredTokenException", "Token has been closed", nil)))
+	require.False(t, IsAccountUnavailable(errors.New("account suspended")))
+}
@@ -1,15 +1,18 @@
 package awsconfig
 
 import (
-	"io/ioutil"
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
 
 	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/vfs"
 
 	ini "gopkg.in/ini.v1"
 )
@@ -22,8 +25,22 @@ var (
 	ErrCredentialsNotFound = errors.New("aws credentials not found")
 
 	logger = logrus.WithField("pkg", "awsconfig")
+
+	// idpAccountKey annotates a profile with the saml2aws idp account that last wrote it
+	idpAccountKey = "x_saml2aws_idp_account"
+
+	// lastSaved the credentials most recently written to each profile by this process, keyed by filename and profile
+	lastSaved   = map[string]savedCredentials{}
+	lastSavedMu sync.Mutex
 )
 
+// savedCredentials identifies a set of credentials written to a profile
+type savedCredentials struct {
+	PrincipalARN string
+	AccessKey    string
+	Expires      time.Time
+}
+
 // AWSCredentials represents the set of attributes used to authenticate to AWS with a short lived session
 type AWSCredentials struct {
 	AWSAccessKey     string    `ini:"aws_access_key_id"`
@@ -34,10 +51,37 @@ type AWSCredentials struct {
 	Expires          time.Time `ini:"x_security_token_expires"`
 }
 
+// KeyNames the key names used for the credentials written to a profile
+type KeyNames struct {
+	AccessKey     string
+	SecretKey     string
+	SessionToken  string
+	SecurityToken string
+}
+
+// DefaultKeyNames the key names used by the AWS CLI and SDKs
+func DefaultKeyNames() *KeyNames {
+	return &KeyNames{
+		AccessKey:     "aws_access_key_id",
+		SecretKey:     "aws_secret_access_key",
+		SessionToken:  "aws_session_token",
+		SecurityToken: "aws_security_token",
+	}
+}
+
 // CredentialsProvider loads aws credentials file
 type CredentialsProvider struct {
 	Filename string
 	Profile  string
+	KeyNames *KeyNames // nil uses DefaultKeyNames
+	FS       vfs.FS    // nil uses the OS filesystem
+
+	// IdpAccount the saml2aws idp account recorded in the profile when saving
+	IdpAccount string
+
+	// ReplaceSymlinks write a regular file in place of a symlinked credentials file, by default the symlink is kept
+	// and its target is written
+	ReplaceSymlinks bool
 }
 
 // NewSharedCredentials helper to create the credentials provider
@@ -66,21 +110,79 @@ func (p *CredentialsProvider) CredsExists() (bool, error) {
 }
 
 // Save persist the credentials
+//
+// Writing the same role credentials with the same expiry to a profile again within this process, for example when
+// a login is retried after a transient error, is skipped.
 func (p *CredentialsProvider) Save(awsCreds *AWSCredentials) error {
 	filename, err := p.resolveFilename()
 	if err != nil {
 		return err
 	}
 
-	err = p.ensureConfigExists()
+	key := filename + "|" + p.Profile
+	saved := savedCredentials{
+		PrincipalARN: awsCreds.PrincipalARN,
+		AccessKey:    awsCreds.AWSAccessKey,
+		Expires:      awsCreds.Expires,
+	}
+
+	lastSavedMu.Lock()
+	defer lastSavedMu.Unlock()
+
+	if last, ok := lastSaved[key]; ok && last.PrincipalARN == saved.PrincipalARN && last.AccessKey == saved.AccessKey && last.Expires.Equal(saved.Expires) {
+		logger.WithField("profile", p.Profile).WithField("principalARN", saved.PrincipalARN).Debug("credentials already saved, skipping")
+		return nil
+	}
+
+	err = p.save(filename, awsCreds)
+	if err != nil {
+		return err
+	}
+
+	lastSaved[key] = saved
+
+	return nil
+}
+
+func (p *CredentialsProvider) save(filename string, awsCreds *AWSCredentials) error {
+	err := p.ensureConfigExists()
 	if err != nil {
 		if os.IsNotExist(err) {
-			return createAndSaveProfile(filename, p.Profile, awsCreds)
+			return createAndSaveProfile(p.fs(), filename, p.Profile, awsCreds, p.keyNames(), p.IdpAccount, p.ReplaceSymlinks)
 		}
 		return errors.Wrap(err, "unable to load file")
 	}
 
-	return saveProfile(filename, p.Profile, awsCreds)
+	return saveProfile(p.fs(), filename, p.Profile, awsCreds, p.keyNames(), p.IdpAccount, p.ReplaceSymlinks)
+}
+
+// LastIdpAccount the saml2aws idp account which last saved credentials to the profile, this is empty when the
+// profile doesn't exist or wasn't annotated
+func (p *CredentialsProvider) LastIdpAccount() (string, error) {
+	filename, err := p.resolveFilename()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := p.fs().ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	config, err := ini.Load(data)
+	if err != nil {
+		return "", err
+	}
+
+	iniProfile, err := config.GetSection(p.Profile)
+	if err != nil {
+		return "", nil
+	}
+
+	return iniProfile.Key(idpAccountKey).String(), nil
 }
 
 // Load load the aws credentials file
@@ -90,7 +192,12 @@ func (p *CredentialsProvider) Load() (*AWSCredentials, error) {
 		return nil, err
 	}
 
-	config, err := ini.Load(filename)
+	data, err := p.fs().ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := ini.Load(data)
 	if err != nil {
 		return nil, err
 	}
@@ -107,6 +214,13 @@ func (p *CredentialsProvider) Load() (*AWSCredentials, error) {
 		return nil, ErrCredentialsNotFound
 	}
 
+	keyNames := p.keyNames()
+
+	awsCreds.AWSAccessKey = iniProfile.Key(keyNames.AccessKey).String()
+	awsCreds.AWSSecretKey = iniProfile.Key(keyNames.SecretKey).String()
+	awsCreds.AWSSessionToken = iniProfile.Key(keyNames.SessionToken).String()
+	awsCreds.AWSSecurityToken = iniProfile.Key(keyNames.SecurityToken).String()
+
 	return awsCreds, nil
 }
 
@@ -128,12 +242,12 @@ func (p *CredentialsProvider) ensureConfigExists() error {
 	}
 	logger.WithField("filename", filename).Debug("ensureConfigExists")
 
-	if _, err := os.Stat(filename); err != nil {
+	if _, err := p.fs().Stat(filename); err != nil {
 		if os.IsNotExist(err) {
 
 			dir := filepath.Dir(filename)
 
-			err = os.MkdirAll(dir, os.ModePerm)
+			err = p.fs().MkdirAll(dir, os.ModePerm)
 			if err != nil {
 				return err
 			}
@@ -141,7 +255,7 @@ func (p *CredentialsProvider) ensureConfigExists() error {
 			logger.WithField("dir", dir).Debug("Dir created")
 
 			// create an base config file
-			err = ioutil.WriteFile(filename, []byte("["+p.Profile+"]"), 0600)
+			err = p.fs().WriteFile(filename, []byte("["+p.Profile+"]"), 0600)
 			if err != nil {
 				return err
 			}
@@ -155,6 +269,37 @@ func (p *CredentialsProvider) ensureConfigExists() error {
 	return nil
 }
 
+func (p *CredentialsProvider) fs() vfs.FS {
+	if p.FS == nil {
+		return vfs.OS
+	}
+
+	return p.FS
+}
+
+// keyNames the configured key names with any unset names falling back to the defaults
+func (p *CredentialsProvider) keyNames() *KeyNames {
+	keyNames := DefaultKeyNames()
+	if p.KeyNames == nil {
+		return keyNames
+	}
+
+	if p.KeyNames.AccessKey != "" {
+		keyNames.AccessKey = p.KeyNames.AccessKey
+	}
+	if p.KeyNames.SecretKey != "" {
+		keyNames.SecretKey = p.KeyNames.SecretKey
+	}
+	if p.KeyNames.SessionToken != "" {
+		keyNames.SessionToken = p.KeyNames.SessionToken
+	}
+	if p.KeyNames.SecurityToken != "" {
+		keyNames.SecurityToken = p.KeyNames.SecurityToken
+	}
+
+	return keyNames
+}
+
 func (p *CredentialsProvider) resolveFilename() (string, error) {
 	if p.Filename == "" {
 		filename, err := locateConfigFile()
@@ -165,6 +310,14 @@ func (p *CredentialsProvider) resolveFilename() (string, error) {
 		p.Filename = filename
 	}
 
+	// a filename from the idp account config may start with ~
+	filename, err := homedir.Expand(p.Filename)
+	if err != nil {
+		return "", ErrCredentialsHomeNotFound
+	}
+
+	p.Filename = filename
+
 	return p.Filename, nil
 }
 
@@ -183,19 +336,12 @@ func locateConfigFile() (string, error) {
 
 	logger.WithField("name", name).Debug("Expand")
 
-	// is the filename a symlink?
-	name, err = resolveSymlink(name)
-	if err != nil {
-		return "", errors.Wrap(err, "unable to resolve symlink")
-	}
-
-	logger.WithField("name", name).Debug("resolveSymlink")
-
+	// a symlink is resolved when the file is written
 	return name, nil
 }
 
-func resolveSymlink(filename string) (string, error) {
-	sympath, err := filepath.EvalSymlinks(filename)
+func resolveSymlink(fsys vfs.FS, filename string) (string, error) {
+	sympath, err := fsys.EvalSymlinks(filename)
 
 	// return the un modified filename
 	if os.IsNotExist(err) {
@@ -208,25 +354,30 @@ func resolveSymlink(filename string) (string, error) {
 	return sympath, nil
 }
 
-func createAndSaveProfile(filename, profile string, awsCreds *AWSCredentials) error {
+func createAndSaveProfile(fsys vfs.FS, filename, profile string, awsCreds *AWSCredentials, keyNames *KeyNames, idpAccount string, replaceSymlinks bool) error {
 
 	dirPath := filepath.Dir(filename)
 
-	err := os.Mkdir(dirPath, 0700)
+	err := fsys.MkdirAll(dirPath, 0700)
 	if err != nil {
 		return errors.Wrapf(err, "unable to create %s directory", dirPath)
 	}
 
-	_, err = os.Create(filename)
+	err = fsys.WriteFile(filename, nil, 0666)
 	if err != nil {
 		return errors.Wrapf(err, "unable to create configuration")
 	}
 
-	return saveProfile(filename, profile, awsCreds)
+	return saveProfile(fsys, filename, profile, awsCreds, keyNames, idpAccount, replaceSymlinks)
 }
 
-func saveProfile(filename, profile string, awsCreds *AWSCredentials) error {
-	config, err := ini.Load(filename)
+func saveProfile(fsys vfs.FS, filename, profile string, awsCreds *AWSCredentials, keyNames *KeyNames, idpAccount string, replaceSymlinks bool) error {
+	data, err := fsys.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	config, err := ini.Load(data)
 	if err != nil {
 		return err
 	}
@@ -240,5 +391,75 @@ func saveProfile(filename, profile string, awsCreds *AWSCredentials) error {
 		return err
 	}
 
-	return config.SaveTo(filename)
+	// swap the default key names written by ReflectFrom for the configured names
+	defaults := DefaultKeyNames()
+
+	renameKey(iniProfile, defaults.AccessKey, keyNames.AccessKey, awsCreds.AWSAccessKey)
+	renameKey(iniProfile, defaults.SecretKey, keyNames.SecretKey, awsCreds.AWSSecretKey)
+	renameKey(iniProfile, defaults.SessionToken, keyNames.SessionToken, awsCreds.AWSSessionToken)
+	renameKey(iniProfile, defaults.SecurityToken, keyNames.SecurityToken, awsCreds.AWSSecurityToken)
+
+	// an annotation from an earlier save by another account would be stale
+	iniProfile.DeleteKey(idpAccountKey)
+	if idpAccount != "" {
+		iniProfile.Key(idpAccountKey).SetValue(idpAccount)
+	}
+
+	buf := new(bytes.Buffer)
+
+	_, err = config.WriteTo(buf)
+	if err != nil {
+		return err
+	}
+
+	return writeCredentialsFile(fsys, filename, buf.Bytes(), replaceSymlinks)
+}
+
+// writeCredentialsFile write the credentials to a temporary file and rename it over the credentials file, so an
+// interrupted write never leaves it truncated, the mode of the existing file is kept
+//
+// Renaming over a symlink would replace it, so unless replaceSymlinks is set the symlink is resolved and its target
+// is replaced instead.
+func writeCredentialsFile(fsys vfs.FS, filename string, data []byte, replaceSymlinks bool) error {
+	target := filename
+
+	if !replaceSymlinks {
+		var err error
+
+		target, err = resolveSymlink(fsys, filename)
+		if err != nil {
+			return errors.Wrap(err, "unable to resolve symlink")
+		}
+	}
+
+	perm := os.FileMode(0600)
+	if fi, err := fsys.Stat(target); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d.tmp", target, os.Getpid())
+
+	// the temporary file is only left behind when it couldn't be renamed into place
+	defer fsys.Remove(tmpPath)
+
+	err := fsys.WriteFile(tmpPath, data, perm)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.Chmod(tmpPath, perm)
+	if err != nil {
+		return err
+	}
+
+	return fsys.Rename(tmpPath, target)
+}
+
+func renameKey(iniProfile *ini.Section, from, to, value string) {
+	if from == to {
+		return
+	}
+
+	iniProfile.DeleteKey(from)
+	iniProfile.Key(to).SetValue(value)
 }
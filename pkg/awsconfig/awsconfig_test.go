@@ -1,12 +1,16 @@
 package awsconfig
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/vfs"
 )
 
 func TestUpdateSamlConfig(t *testing.T) {
@@ -14,7 +18,7 @@ func TestUpdateSamlConfig(t *testing.T) {
 
 	logrus.SetLevel(logrus.DebugLevel)
 
-	sharedCreds := &CredentialsProvider{".credentials", "saml"}
+	sharedCreds := &CredentialsProvider{Filename: ".credentials", Profile: "saml"}
 
 	exist, err := sharedCreds.CredsExists()
 	assert.Nil(t, err)
@@ -38,3 +42,193 @@ func TestUpdateSamlConfig(t *testing.T) {
 
 	os.Remove(".credentials")
 }
+
+func TestSaveCustomKeyNames(t *testing.T) {
+	os.Remove(".credentials")
+
+	sharedCreds := &CredentialsProvider{
+		Filename: ".credentials",
+		Profile:  "legacy",
+		KeyNames: &KeyNames{
+			AccessKey:    "access_key",
+			SecretKey:    "secret_key",
+			SessionToken: "token",
+		},
+	}
+
+	_, err := sharedCreds.CredsExists()
+	assert.Nil(t, err)
+
+	err = sharedCreds.Save(&AWSCredentials{
+		AWSAccessKey:     "testid",
+		AWSSecretKey:     "testsecret",
+		AWSSessionToken:  "testtoken",
+		AWSSecurityToken: "testtoken",
+	})
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(".credentials")
+	assert.Nil(t, err)
+
+	content := string(data)
+	assert.Contains(t, content, "access_key")
+	assert.Contains(t, content, "secret_key")
+	assert.Contains(t, content, "token ")
+	assert.Contains(t, content, "aws_security_token")
+	assert.NotContains(t, content, "aws_access_key_id")
+	assert.NotContains(t, content, "aws_secret_access_key")
+	assert.NotContains(t, content, "aws_session_token")
+
+	awsCreds, err := sharedCreds.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", awsCreds.AWSAccessKey)
+	assert.Equal(t, "testsecret", awsCreds.AWSSecretKey)
+	assert.Equal(t, "testtoken", awsCreds.AWSSessionToken)
+	assert.Equal(t, "testtoken", awsCreds.AWSSecurityToken)
+
+	os.Remove(".credentials")
+}
+
+func TestKeyNamesDefaults(t *testing.T) {
+	sharedCreds := &CredentialsProvider{KeyNames: &KeyNames{AccessKey: "access_key"}}
+
+	keyNames := sharedCreds.keyNames()
+	assert.Equal(t, "access_key", keyNames.AccessKey)
+	assert.Equal(t, "aws_secret_access_key", keyNames.SecretKey)
+	assert.Equal(t, "aws_session_token", keyNames.SessionToken)
+	assert.Equal(t, "aws_security_token", keyNames.SecurityToken)
+
+	assert.Equal(t, DefaultKeyNames(), NewSharedCredentials("saml").keyNames())
+}
+
+func TestSaveSkipsIdenticalCredentials(t *testing.T) {
+	os.Remove(".credentials")
+	defer os.Remove(".credentials")
+
+	sharedCreds := &CredentialsProvider{Filename: ".credentials", Profile: "retry"}
+
+	_, err := sharedCreds.CredsExists()
+	assert.Nil(t, err)
+
+	awsCreds := &AWSCredentials{
+		AWSAccessKey:    "testid",
+		AWSSecretKey:    "testsecret",
+		AWSSessionToken: "testtoken",
+		PrincipalARN:    "arn:aws:sts::123123123123:assumed-role/admin/wolfeidau",
+		Expires:         time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+
+	err = sharedCreds.Save(awsCreds)
+	assert.Nil(t, err)
+
+	// a retry with the same role and expiry must not rewrite the profile
+	assert.Nil(t, os.Remove(".credentials"))
+
+	err = sharedCreds.Save(awsCreds)
+	assert.Nil(t, err)
+
+	_, err = os.Stat(".credentials")
+	assert.True(t, os.IsNotExist(err))
+
+	// new credentials for the same role are written
+	_, err = sharedCreds.CredsExists()
+	assert.Nil(t, err)
+
+	err = sharedCreds.Save(&AWSCredentials{
+		AWSAccessKey:    "testid2",
+		AWSSecretKey:    "testsecret2",
+		AWSSessionToken: "testtoken2",
+		PrincipalARN:    awsCreds.PrincipalARN,
+		Expires:         awsCreds.Expires.Add(time.Hour),
+	})
+	assert.Nil(t, err)
+
+	loaded, err := sharedCreds.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "testid2", loaded.AWSAccessKey)
+}
+
+func TestSaveMemFS(t *testing.T) {
+	fsys := vfs.NewMemFS()
+
+	sharedCreds := &CredentialsProvider{Filename: "/home/test/.aws/credentials", Profile: "saml", FS: fsys}
+
+	exist, err := sharedCreds.CredsExists()
+	assert.Nil(t, err)
+	assert.True(t, exist)
+
+	err = sharedCreds.Save(&AWSCredentials{
+		AWSAccessKey:    "memid",
+		AWSSecretKey:    "memsecret",
+		AWSSessionToken: "memtoken",
+		Expires:         time.Now().Add(time.Hour),
+	})
+	assert.Nil(t, err)
+
+	_, err = os.Stat("/home/test/.aws/credentials")
+	assert.True(t, os.IsNotExist(err))
+
+	data, err := fsys.ReadFile("/home/test/.aws/credentials")
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "memid")
+
+	awsCreds, err := sharedCreds.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "memid", awsCreds.AWSAccessKey)
+	assert.Equal(t, "memsecret", awsCreds.AWSSecretKey)
+	assert.Equal(t, "memtoken", awsCreds.AWSSessionToken)
+	assert.False(t, sharedCreds.Expired())
+}
+
+func TestSaveRecordsIdpAccount(t *testing.T) {
+	fsys := vfs.NewMemFS()
+
+	sharedCreds := &CredentialsProvider{Filename: "/home/test/.aws/credentials", Profile: "saml", FS: fsys}
+
+	idpAccount, err := sharedCreds.LastIdpAccount()
+	assert.Nil(t, err)
+	assert.Empty(t, idpAccount)
+
+	_, err = sharedCreds.CredsExists()
+	assert.Nil(t, err)
+
+	sharedCreds.IdpAccount = "prod"
+
+	err = sharedCreds.Save(&AWSCredentials{AWSAccessKey: "prodid", Expires: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+
+	idpAccount, err = sharedCreds.LastIdpAccount()
+	assert.Nil(t, err)
+	assert.Equal(t, "prod", idpAccount)
+
+	// a save without an account drops the annotation rather than leaving it stale
+	sharedCreds.IdpAccount = ""
+
+	err = sharedCreds.Save(&AWSCredentials{AWSAccessKey: "otherid", Expires: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+
+	idpAccount, err = sharedCreds.LastIdpAccount()
+	assert.Nil(t, err)
+	assert.Empty(t, idpAccount)
+}
+
+// failingRenameFS an in memory filesystem which can't rename files
+type failingRenameFS struct {
+	*vfs.MemFS
+}
+
+func (failingRenameFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+}
+
+func TestSaveRemovesTempFile(t *testing.T) {
+	fsys := vfs.NewMemFS()
+
+	sharedCreds := &CredentialsProvider{Filename: "/home/test/.aws/credentials", Profile: "saml", FS: failingRenameFS{fsys}}
+
+	err := sharedCreds.Save(&AWSCredentials{AWSAccessKey: "memid", AWSSecretKey: "memsecret"})
+	assert.Error(t, err)
+
+	_, err = fsys.Stat(fmt.Sprintf("/home/test/.aws/credentials.%d.tmp", os.Getpid()))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,65 @@
+// +build !windows
+
+package awsconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSymlinkedCredentials(t *testing.T) (dir, link, target string) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+
+	target = filepath.Join(dir, "dotfiles-credentials")
+	assert.Nil(t, ioutil.WriteFile(target, []byte("[saml]\n"), 0640))
+
+	link = filepath.Join(dir, "credentials")
+	assert.Nil(t, os.Symlink(target, link))
+
+	return dir, link, target
+}
+
+func TestSaveFollowsSymlink(t *testing.T) {
+	dir, link, target := newSymlinkedCredentials(t)
+	defer os.RemoveAll(dir)
+
+	sharedCreds := &CredentialsProvider{Filename: link, Profile: "saml"}
+
+	err := sharedCreds.Save(&AWSCredentials{AWSAccessKey: "testid", AWSSecretKey: "testsecret"})
+	assert.Nil(t, err)
+
+	fi, err := os.Lstat(link)
+	assert.Nil(t, err)
+	assert.True(t, fi.Mode()&os.ModeSymlink != 0)
+
+	fi, err = os.Stat(target)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	awsCreds, err := (&CredentialsProvider{Filename: target, Profile: "saml"}).Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", awsCreds.AWSAccessKey)
+}
+
+func TestSaveReplacesSymlink(t *testing.T) {
+	dir, link, target := newSymlinkedCredentials(t)
+	defer os.RemoveAll(dir)
+
+	sharedCreds := &CredentialsProvider{Filename: link, Profile: "saml", ReplaceSymlinks: true}
+
+	err := sharedCreds.Save(&AWSCredentials{AWSAccessKey: "testid", AWSSecretKey: "testsecret"})
+	assert.Nil(t, err)
+
+	fi, err := os.Lstat(link)
+	assert.Nil(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+
+	data, err := ioutil.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "[saml]\n", string(data))
+}
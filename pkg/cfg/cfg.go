@@ -1,15 +1,35 @@
 package cfg
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/vfs"
 	ini "gopkg.in/ini.v1"
 )
 
+// DefaultIDPAccount the idp account used when no other account has been made the default
+const DefaultIDPAccount = "default"
+
+// defaultIDPAccountKey the key in the ini DEFAULT section which names the default idp account
+const defaultIDPAccountKey = "default_idp_account"
+
+// configFileMu serializes the changes to the configuration file, each one loads the file, changes it and saves it
+var configFileMu sync.Mutex
+
 // ErrIdpAccountNotFound returned if the idp account is not found in the configuration file
 var ErrIdpAccountNotFound = errors.New("IDP account not found, run configure to set it up")
 
@@ -21,28 +41,149 @@ const (
 	// NOTE: This only needs to be changed to log into GovCloud
 	DefaultAmazonWebservicesURN = "urn:amazon:webservices"
 
+	// GovCloudAmazonWebservicesURN URN used when authenticating to aws GovCloud (US) using SAML
+	GovCloudAmazonWebservicesURN = "urn:amazon:webservices:govcloud"
+
+	// ChinaAmazonWebservicesURN URN used when authenticating to aws China using SAML
+	ChinaAmazonWebservicesURN = "urn:amazon:webservices:cn-north-1"
+
 	// DefaultSessionDuration this is the default session duration which can be overridden in the AWS console
 	// see https://aws.amazon.com/blogs/security/enable-federated-api-access-to-your-aws-resources-for-up-to-12-hours-using-iam-roles/
 	DefaultSessionDuration = 3600
 
+	// MinSessionDuration the shortest session duration STS accepts
+	MinSessionDuration = 900
+
+	// MaxSessionDuration the longest session duration STS accepts, the role's MaxSessionDuration must be raised to
+	// allow anything over an hour
+	MaxSessionDuration = 43200
+
+	// MaxLoginRetries the most login_retries allowed, so a broken IdP can't keep a login going
+	MaxLoginRetries = 10
+
 	// DefaultProfile this is the default profile name used to save the credentials in the aws cli
 	DefaultProfile = "saml"
+
+	// DefaultMaxDisplayRoles the number of roles presented for selection before a role or account filter is required
+	DefaultMaxDisplayRoles = 30
+
+	// DefaultMinTLSVersion the minimum TLS version used when connecting to the IdP
+	DefaultMinTLSVersion = "1.2"
+
+	// DefaultMaxRedirects the number of redirects followed during the IdP flow before giving up
+	DefaultMaxRedirects = 10
+
+	// DefaultMaxRetries the number of times a successful response without a SAML assertion is fetched again
+	DefaultMaxRetries = 2
+
+	// DefaultMFACodeLength the number of digits in a TOTP code
+	DefaultMFACodeLength = 6
+
+	// CredentialsOutputFile save the aws credentials to the shared credentials file, this is the default, file:<path>
+	// saves them to another file
+	CredentialsOutputFile = "file"
+
+	// CredentialsOutputKeyring save the aws credentials to the keyring of the OS instead of the credentials file
+	CredentialsOutputKeyring = "keyring"
+
+	// CredentialsOutputExport print the aws credentials as export lines for eval after login, they aren't saved
+	CredentialsOutputExport = "export"
+
+	// CredentialsOutputJSON print the aws credentials as json after login, they aren't saved
+	CredentialsOutputJSON = "json"
+
+	// CredentialsFormatINI the shared credentials file format, the only format of the credentials file
+	CredentialsFormatINI = "ini"
 )
 
+// credentialsFilePrefix the prefix of a credentials_output naming the credentials file to save to
+const credentialsFilePrefix = CredentialsOutputFile + ":"
+
+// tlsVersions supported values for min_tls_version, 1.3 is added when built with Go 1.12 or later
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+}
+
+// proxySchemes supported schemes for proxy_url, socks5h resolves host names on the proxy
+var proxySchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"socks5":  true,
+	"socks5h": true,
+}
+
 // IDPAccount saml IDP account
 type IDPAccount struct {
-	AppID                string `ini:"app_id"` // used by OneLogin
-	URL                  string `ini:"url"`
-	Username             string `ini:"username"`
-	Provider             string `ini:"provider"`
-	MFA                  string `ini:"mfa"`
-	SkipVerify           bool   `ini:"skip_verify"`
-	Timeout              int    `ini:"timeout"`
-	AmazonWebservicesURN string `ini:"aws_urn"`
-	SessionDuration      int    `ini:"aws_session_duration"`
-	Profile              string `ini:"aws_profile"`
-	Subdomain            string `ini:"subdomain"` // used by OneLogin
-	RoleARN              string `ini:"role_arn"`
+	AppID                        string   `ini:"app_id"` // used by OneLogin
+	URL                          string   `ini:"url"`
+	AllowInsecureURL             bool     `ini:"allow_insecure_url"` // permit http IdP URLs, otherwise they must be https
+	Username                     string   `ini:"username"`
+	Provider                     string   `ini:"provider"`
+	MFA                          string   `ini:"mfa"`
+	AutoMFAPreference            string   `ini:"auto_mfa_preference"` // comma separated factor types preferred when mfa is Auto
+	SkipVerify                   bool     `ini:"skip_verify"`
+	TOTPAutoRetry                bool     `ini:"totp_auto_retry"`   // prompt for the next code when one is rejected at a window boundary
+	MFAInitialDelay              int      `ini:"mfa_initial_delay"` // milliseconds to wait before the first push MFA poll
+	MFATimeout                   int      `ini:"mfa_timeout"`       // seconds to wait for a push MFA to be approved, 0 leaves it to the IdP
+	Timeout                      int      `ini:"timeout"`
+	MaxRedirects                 int      `ini:"max_redirects"`   // redirects followed during the IdP flow, defaults to 10
+	MaxRetries                   int      `ini:"max_retries"`     // okta only, refetches of a successful response missing the SAML assertion, defaults to 2
+	LoginRetries                 int      `ini:"login_retries"`   // IdP requests sent again after a transient network error, at most 10
+	RetryBackoffSeconds          int      `ini:"retry_backoff"`   // seconds to wait before each request retry
+	MFACodeLength                int      `ini:"mfa_code_length"` // digits expected in a TOTP code, checked before it is submitted, 0 disables the check
+	MFATokenFile                 string   `ini:"mfa_token_file"`  // one MFA code per line, each MFA prompt takes the first code and removes it from the file
+	AmazonWebservicesURN         string   `ini:"aws_urn"`
+	SPEntityID                   string   `ini:"sp_entity_id"` // issuer of SP-initiated AuthnRequests, defaults to aws_urn
+	SessionDuration              int      `ini:"aws_session_duration"`
+	Profile                      string   `ini:"aws_profile"`
+	WarnOnProfileCollision       bool     `ini:"warn_on_profile_collision"` // warn before overwriting a profile saved by another account
+	FollowSymlinks               bool     `ini:"follow_symlinks"`           // write through a symlinked credentials file to its target, defaults to true
+	Subdomain                    string   `ini:"subdomain"`                 // used by OneLogin
+	RoleARN                      string   `ini:"role_arn"`
+	RoleARNs                     []string `ini:"role_arns" delim:","`   // roles to assume in order of preference, the first one in the assertion is used
+	TargetRoleARN                string   `ini:"target_role_arn"`       // assumed with the credentials of the SAML role, only its credentials are saved
+	TargetExternalID             string   `ini:"target_external_id"`    // external id required by the trust policy of the target role
+	TargetSessionName            string   `ini:"target_session_name"`   // defaults to the session name of the SAML role, then the username
+	ProfileFromRole              bool     `ini:"profile_from_role"`     // append the name of the assumed role to the profile, e.g. saml-admin
+	ShowRolePermissions          bool     `ini:"show_role_permissions"` // print the policies attached to the role after login
+	PromptSingleRole             bool     `ini:"prompt_single_role"`    // prompt even when only one role is available
+	TenantID                     string   `ini:"tenant_id"`             // used by KeyCloak when an organization is requested before login
+	AssertionJSONPath            string   `ini:"assertion_json_path"`   // okta only, used when the IdP returns the assertion in a JSON envelope
+	MetricsPushgatewayURL        string   `ini:"metrics_pushgateway_url"`
+	MaxDisplayRoles              int      `ini:"max_display_roles"`
+	RoleFilter                   string   `ini:"role_filter"`
+	AccountFilter                string   `ini:"account_filter"`
+	PreLoginCmd                  string   `ini:"pre_login_cmd"` // run before login, a failure aborts the login
+	PostLoginCmd                 string   `ini:"post_login_cmd"`
+	PostLoginCmdFatal            bool     `ini:"post_login_cmd_fatal"`
+	EnvPrefix                    string   `ini:"env_prefix"`           // prefixes the variable names emitted by exec and script
+	Region                       string   `ini:"region"`               // selects the AWS partition used to derive the signin endpoint
+	SAMLSigninEndpoint           string   `ini:"saml_signin_endpoint"` // overrides the signin endpoint derived from the region
+	STSEndpoint                  string   `ini:"aws_sts_endpoint"`     // used in isolated regions, requires aws_sts_signing_region
+	STSSigningRegion             string   `ini:"aws_sts_signing_region"`
+	STSCABundle                  string   `ini:"aws_sts_ca_bundle"`
+	NTPServer                    string   `ini:"ntp_server"` // queried for the clock offset when STS rejects an assertion which looks expired
+	MinTLSVersion                string   `ini:"min_tls_version"`
+	ProxyURL                     string   `ini:"proxy_url"`      // http, https, socks5 or socks5h proxy used for IdP and AWS connections
+	SourceAddress                string   `ini:"source_address"` // local IP address IdP connections are made from
+	CABundle                     string   `ini:"ca_bundle"`      // PEM file of extra CA certificates trusted for IdP and AWS connections
+	CacheEndpoints               bool     `ini:"cache_endpoints"`
+	CacheEndpointsTTL            int      `ini:"cache_endpoints_ttl"`         // seconds
+	CacheRoles                   bool     `ini:"cache_roles"`                 // the AWS accounts found on the signin page are reused by later logins
+	RefreshRoles                 bool     `ini:"-"`                           // set by --refresh-roles to fetch the signin page even when the roles are cached
+	AuditLogFile                 string   `ini:"audit_log_file"`              // append-only JSON lines log of each login
+	SystemdEnvFile               string   `ini:"systemd_env_file"`            // systemd EnvironmentFile written with the credentials after login
+	CredentialsOutput            string   `ini:"credentials_output"`          // file, file:<path>, keyring, export or json, where the aws credentials go
+	CredentialsAccessKeyName     string   `ini:"credentials_access_key_name"` // overrides aws_access_key_id in the credentials file
+	CredentialsSecretKeyName     string   `ini:"credentials_secret_key_name"`
+	CredentialsSessionTokenName  string   `ini:"credentials_session_token_name"`
+	CredentialsSecurityTokenName string   `ini:"credentials_security_token_name"`
+	CredentialsFormat            string   `ini:"credentials_format"`       // format of the credentials file, only ini is supported
+	FallbackURL                  string   `ini:"fallback_url"`             // used when the primary URL is unreachable
+	ConsoleDestination           string   `ini:"console_destination"`      // console page opened by the console command
+	ConsoleSessionDuration       int      `ini:"console_session_duration"` // seconds, zero uses the AWS default
+	VerifyDestination            bool     `ini:"verify_destination"`       // abort unless the SAML response destination is the signin endpoint
+	TransitiveTagKeys            string   `ini:"transitive_tag_keys"`      // comma separated session tag keys which must be transitive
 }
 
 func (ia IDPAccount) String() string {
@@ -70,78 +211,484 @@ func (ia IDPAccount) String() string {
 func (ia *IDPAccount) Validate() error {
 	if ia.Provider == "OneLogin" {
 		if ia.AppID == "" {
-			return errors.New("app ID empty in idp account")
+			return newValidationError("run 'saml2aws configure' and set the OneLogin app ID with --app-id", "app ID empty in idp account")
 		}
 		if ia.Subdomain == "" {
-			return errors.New("subdomain empty in idp account")
+			return newValidationError("run 'saml2aws configure' and set the OneLogin subdomain with --subdomain", "subdomain empty in idp account")
 		}
 	}
 
 	if ia.URL == "" {
-		return errors.New("URL empty in idp account")
+		return newValidationError("run 'saml2aws configure' and set the URL of your IdP with --url", "URL empty in idp account")
 	}
 
-	_, err := url.Parse(ia.URL)
+	u, err := url.Parse(ia.URL)
 	if err != nil {
-		return errors.New("URL parse failed")
+		return newValidationError("set url to the full address of your IdP, e.g. https://id.example.com", "URL parse failed")
+	}
+
+	if err := ia.validateURL("url", u); err != nil {
+		return err
+	}
+
+	if ia.FallbackURL != "" {
+		u, err := url.Parse(ia.FallbackURL)
+		if err != nil {
+			return newValidationError("set fallback_url to a full address, e.g. https://id-dr.example.com, or remove it", "fallback URL parse failed")
+		}
+
+		if err := ia.validateURL("fallback_url", u); err != nil {
+			return err
+		}
+	}
+
+	if ia.Region != "" && regionURN(ia.Region) == "" {
+		return newValidationError("set region to an AWS region such as us-east-1, us-gov-west-1 or cn-north-1", "Unknown AWS partition for region in idp account: %s", ia.Region)
 	}
 
 	if ia.Provider == "" {
-		return errors.New("Provider empty in idp account")
+		return newValidationError("run 'saml2aws configure' and choose a provider, or set it with --idp-provider", "Provider empty in idp account")
 	}
 
 	if ia.MFA == "" {
-		return errors.New("MFA empty in idp account")
+		return newValidationError("run 'saml2aws configure' and choose an MFA method, use Auto if unsure", "MFA empty in idp account")
+	}
+
+	if ia.SessionDuration != 0 && (ia.SessionDuration < MinSessionDuration || ia.SessionDuration > MaxSessionDuration) {
+		return newValidationError(fmt.Sprintf("set aws_session_duration to between %d and %d seconds", MinSessionDuration, MaxSessionDuration), "Session duration in idp account is outside the range AWS allows: %d", ia.SessionDuration)
+	}
+
+	if ia.LoginRetries < 0 || ia.LoginRetries > MaxLoginRetries {
+		return newValidationError(fmt.Sprintf("set login_retries to between 0 and %d", MaxLoginRetries), "Login retries in idp account must be between 0 and %d: %d", MaxLoginRetries, ia.LoginRetries)
+	}
+
+	if ia.RetryBackoffSeconds < 0 {
+		return newValidationError("set retry_backoff to a number of seconds, or 0 to retry straight away", "Retry backoff in idp account can't be negative: %d", ia.RetryBackoffSeconds)
 	}
 
 	if ia.Profile == "" {
-		return errors.New("Profile empty in idp account")
+		return newValidationError("run 'saml2aws configure' and set the AWS profile the credentials are saved to", "Profile empty in idp account")
+	}
+
+	if _, ok := tlsVersions[ia.MinTLSVersion]; ia.MinTLSVersion == "1.3" && !ok {
+		return newValidationError("set min_tls_version to 1.2, or use a saml2aws built with Go 1.12 or later", "TLS 1.3 isn't supported by this build of saml2aws")
+	}
+
+	if _, ok := tlsVersions[ia.MinTLSVersion]; ia.MinTLSVersion != "" && !ok {
+		return newValidationError("set min_tls_version to 1.2 or 1.3", "Unsupported min TLS version in idp account: %s", ia.MinTLSVersion)
+	}
+
+	if ia.ProxyURL != "" {
+		u, err := url.Parse(ia.ProxyURL)
+		if err != nil {
+			return newValidationError("set proxy_url to a full address, e.g. http://proxy.example.com:3128", "proxy URL parse failed")
+		}
+
+		if !proxySchemes[u.Scheme] {
+			return newValidationError("use an http, https, socks5 or socks5h proxy_url", "Unsupported proxy URL scheme in idp account: %s", u.Scheme)
+		}
+	}
+
+	if ia.SourceAddress != "" && net.ParseIP(ia.SourceAddress) == nil {
+		return newValidationError("set source_address to an IP address of this machine, e.g. 10.0.0.5", "Invalid source address in idp account: %s", ia.SourceAddress)
+	}
+
+	switch ia.CredentialsOutput {
+	case "", CredentialsOutputFile, CredentialsOutputKeyring, CredentialsOutputExport, CredentialsOutputJSON:
+	default:
+		if ia.CredentialsFile() == "" {
+			return newValidationError("set credentials_output to file, file:<path>, keyring, export or json", "Unsupported credentials output in idp account: %s", ia.CredentialsOutput)
+		}
+	}
+
+	if ia.CredentialsFormat != "" && ia.CredentialsFormat != CredentialsFormatINI {
+		return newValidationError("set credentials_format to ini, or remove it", "Unsupported credentials format in idp account: %s", ia.CredentialsFormat)
+	}
+
+	return nil
+}
+
+// ValidateWarnings settings which are valid but likely to fail at login, these shouldn't stop the login
+func (ia *IDPAccount) ValidateWarnings() []string {
+	var warnings []string
+
+	if ia.SessionDuration > DefaultSessionDuration && ia.SessionDuration <= MaxSessionDuration {
+		warnings = append(warnings, fmt.Sprintf("aws_session_duration of %d seconds is over an hour, the MaxSessionDuration of the role must be raised to allow it", ia.SessionDuration))
+	}
+
+	if ia.TargetRoleARN != "" && ia.SessionDuration > DefaultSessionDuration {
+		warnings = append(warnings, "the target_role_arn session is limited to an hour by AWS, aws_session_duration only applies to the SAML role")
+	}
+
+	return warnings
+}
+
+// validateURL IdP URLs must be absolute https URLs, http is permitted by allow_insecure_url or skip_verify
+func (ia *IDPAccount) validateURL(key string, u *url.URL) error {
+	switch {
+	case u.Scheme == "":
+		return newValidationError(fmt.Sprintf("set %s to the full address including https://", key), "Missing scheme in %s in idp account: %s", key, u.String())
+	case u.Scheme == "https":
+	case u.Scheme == "http" && (ia.AllowInsecureURL || ia.SkipVerify):
+	case u.Scheme == "http":
+		return newValidationError(fmt.Sprintf("use an https %s, or set allow_insecure_url = true if the IdP only supports http", key), "The %s in idp account must be https: %s", key, u.String())
+	default:
+		return newValidationError(fmt.Sprintf("set %s to the full address including https://", key), "Unsupported %s scheme in idp account: %s", key, u.Scheme)
+	}
+
+	if u.Host == "" {
+		return newValidationError(fmt.Sprintf("set %s to the full address including the host name, e.g. https://id.example.com", key), "Missing host in %s in idp account: %s", key, u.String())
 	}
 
 	return nil
 }
 
+// NormalizeURLs add https:// to IdP URLs without a scheme and remove trailing slashes from their path, so requests
+// are built the same way however the URLs were entered
+func (ia *IDPAccount) NormalizeURLs() {
+	ia.URL = NormalizeURL(ia.URL)
+	ia.FallbackURL = NormalizeURL(ia.FallbackURL)
+}
+
+// NormalizeURL add https:// to a URL without a scheme and remove trailing slashes from its path
+func NormalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	// only the path is trimmed, a query or fragment may legitimately end with a slash
+	end := len(rawURL)
+	if i := strings.IndexAny(rawURL, "?#"); i != -1 {
+		end = i
+	}
+
+	path := strings.TrimRight(rawURL[:end], "/")
+	if strings.HasSuffix(path, ":") {
+		// nothing but the scheme is left
+		return rawURL
+	}
+
+	return path + rawURL[end:]
+}
+
 // NewIDPAccount Create an idp account and fill in any default fields with sane values
 func NewIDPAccount() *IDPAccount {
 	return &IDPAccount{
-		AmazonWebservicesURN: DefaultAmazonWebservicesURN,
-		SessionDuration:      DefaultSessionDuration,
-		Profile:              DefaultProfile,
+		AmazonWebservicesURN:   DefaultAmazonWebservicesURN,
+		SessionDuration:        DefaultSessionDuration,
+		Profile:                DefaultProfile,
+		MaxDisplayRoles:        DefaultMaxDisplayRoles,
+		MinTLSVersion:          DefaultMinTLSVersion,
+		MaxRedirects:           DefaultMaxRedirects,
+		MaxRetries:             DefaultMaxRetries,
+		MFACodeLength:          DefaultMFACodeLength,
+		WarnOnProfileCollision: true,
+		FollowSymlinks:         true,
+	}
+}
+
+// TLSMinVersion the tls package constant for the configured minimum TLS version, defaults to TLS 1.2
+func (ia *IDPAccount) TLSMinVersion() uint16 {
+	if v, ok := tlsVersions[ia.MinTLSVersion]; ok {
+		return v
+	}
+
+	return tlsVersions[DefaultMinTLSVersion]
+}
+
+// ProfileForRole the profile the credentials of the role are saved to, with profile_from_role the role name, the last
+// element of the role ARN, is appended to the profile
+func (ia *IDPAccount) ProfileForRole(roleARN string) string {
+	if !ia.ProfileFromRole || roleARN == "" {
+		return ia.Profile
+	}
+
+	return ia.Profile + "-" + roleARN[strings.LastIndex(roleARN, "/")+1:]
+}
+
+// ProfileForAccountRole the profile the credentials of a role assumed by login --all-roles are saved to, the account id
+// and name of the role are appended to the profile, e.g. saml-123456789012-admin
+func (ia *IDPAccount) ProfileForAccountRole(roleARN string) string {
+	name := roleARN[strings.LastIndex(roleARN, "/")+1:]
+
+	parts := strings.Split(roleARN, ":")
+	if len(parts) < 6 {
+		return ia.Profile + "-" + name
 	}
+
+	return ia.Profile + "-" + parts[4] + "-" + name
+}
+
+// ServiceProviderEntityID the entity ID used as the issuer of SP-initiated AuthnRequests, this defaults to the
+// AWS URN which is the entity ID AWS registers as a service provider
+func (ia *IDPAccount) ServiceProviderEntityID() string {
+	if ia.SPEntityID != "" {
+		return ia.SPEntityID
+	}
+
+	if ia.AmazonWebservicesURN != "" {
+		return ia.AmazonWebservicesURN
+	}
+
+	return ia.DefaultURN()
+}
+
+// regionPartitions the region prefixes of each AWS partition and the SAML URN used to authenticate to it, the more
+// specific prefixes come first
+var regionPartitions = []struct {
+	prefixes []string
+	urn      string
+}{
+	{prefixes: []string{"us-gov-"}, urn: GovCloudAmazonWebservicesURN},
+	{prefixes: []string{"cn-"}, urn: ChinaAmazonWebservicesURN},
+	{prefixes: []string{"us-", "eu-", "ap-", "sa-", "ca-", "me-", "af-", "il-", "mx-"}, urn: DefaultAmazonWebservicesURN},
+}
+
+// regionURN the SAML URN of the partition the region belongs to, empty if the region isn't in a known partition
+func regionURN(region string) string {
+	for _, partition := range regionPartitions {
+		for _, prefix := range partition.prefixes {
+			if strings.HasPrefix(region, prefix) {
+				return partition.urn
+			}
+		}
+	}
+
+	return ""
+}
+
+// DefaultURN the SAML URN of the partition the configured region belongs to, this is the standard AWS URN when no
+// region is configured
+func (ia *IDPAccount) DefaultURN() string {
+	if urn := regionURN(ia.Region); urn != "" {
+		return urn
+	}
+
+	return DefaultAmazonWebservicesURN
+}
+
+// derivedURN check if aws_urn is the one derived from the region, so it doesn't need saving
+func (ia *IDPAccount) derivedURN() bool {
+	switch ia.AmazonWebservicesURN {
+	case "", DefaultAmazonWebservicesURN, ia.DefaultURN():
+		return true
+	}
+
+	return false
+}
+
+// applyRegionURN derive the URN from the region unless aws_urn has been changed from the default, this is only done
+// when the account is loaded
+func (ia *IDPAccount) applyRegionURN() {
+	if ia.derivedURN() {
+		ia.AmazonWebservicesURN = ia.DefaultURN()
+	}
+}
+
+// RetryPolicy the number of times an IdP request is attempted and the wait between attempts, a single attempt unless
+// login_retries is set
+func (ia *IDPAccount) RetryPolicy() (attempts int, backoff time.Duration) {
+	attempts = 1
+	if ia.LoginRetries > 0 {
+		attempts += ia.LoginRetries
+	}
+
+	if ia.RetryBackoffSeconds > 0 {
+		backoff = time.Duration(ia.RetryBackoffSeconds) * time.Second
+	}
+
+	return attempts, backoff
+}
+
+// UsesKeyring check if the aws credentials are kept in the keyring of the OS rather than the credentials file
+func (ia *IDPAccount) UsesKeyring() bool {
+	return ia.CredentialsOutput == CredentialsOutputKeyring
+}
+
+// PrintsCredentials check if the aws credentials are printed to stdout after login instead of being saved
+func (ia *IDPAccount) PrintsCredentials() bool {
+	return ia.CredentialsOutput == CredentialsOutputExport || ia.CredentialsOutput == CredentialsOutputJSON
+}
+
+// CredentialsFile the file named by credentials_output = file:<path>, empty for the shared credentials file
+func (ia *IDPAccount) CredentialsFile() string {
+	if !strings.HasPrefix(ia.CredentialsOutput, credentialsFilePrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(ia.CredentialsOutput, credentialsFilePrefix)
+}
+
+// PreferredRole the first of the configured role ARNs which is available, role_arns is used in order and falls back
+// to role_arn, false when none of them are available so the role can be chosen interactively
+func (ia *IDPAccount) PreferredRole(available []string) (string, bool) {
+	preferred := ia.RoleARNs
+	if len(preferred) == 0 && ia.RoleARN != "" {
+		preferred = []string{ia.RoleARN}
+	}
+
+	for _, roleARN := range preferred {
+		for _, a := range available {
+			if a == roleARN {
+				return roleARN, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// TransitiveTagKeyList the configured transitive session tag keys
+func (ia *IDPAccount) TransitiveTagKeyList() []string {
+	return splitList(ia.TransitiveTagKeys)
+}
+
+// AutoMFAPreferenceList the configured MFA factor types in the order they are preferred when MFA is Auto
+func (ia *IDPAccount) AutoMFAPreferenceList() []string {
+	return splitList(ia.AutoMFAPreference)
+}
+
+// splitList split a comma separated setting dropping any empty values
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
 }
 
 // ConfigManager manage the various IDP account settings
 type ConfigManager struct {
 	configPath string
+	fs         vfs.FS
+
+	ssmParameter string
+	ssmClient    ssmiface.SSMAPI
 }
 
 // NewConfigManager build a new config manager and optionally override the config path
+//
+// A config path prefixed with ssm:// is loaded from the named SSM parameter.
 func NewConfigManager(configFile string) (*ConfigManager, error) {
+	return NewConfigManagerWithHome(configFile, "")
+}
+
+// NewConfigManagerWithHome build a new config manager which expands ~ in the config path against the supplied
+// home directory rather than the process HOME, an empty home falls back to the process HOME
+func NewConfigManagerWithHome(configFile, home string) (*ConfigManager, error) {
+	return NewConfigManagerWithFS(configFile, home, vfs.OS)
+}
+
+// NewConfigManagerWithFS build a new config manager which reads and writes the config file through the supplied
+// filesystem, this allows saml2aws to run where there is no real filesystem
+func NewConfigManagerWithFS(configFile, home string, fsys vfs.FS) (*ConfigManager, error) {
 
 	if configFile == "" {
 		configFile = DefaultConfigPath
 	}
 
-	configPath, err := homedir.Expand(configFile)
+	if isSSMConfigSource(configFile) {
+		return &ConfigManager{ssmParameter: strings.TrimPrefix(configFile, SSMConfigPrefix)}, nil
+	}
+
+	configPath, err := ExpandHome(configFile, home)
 	if err != nil {
 		return nil, err
 	}
 
-	return &ConfigManager{configPath}, nil
+	return &ConfigManager{configPath: configPath, fs: fsys}, nil
+}
+
+// ExpandHome expand a leading ~ against the supplied home directory in the same way as homedir.Expand, an empty
+// home falls back to the process HOME
+func ExpandHome(path, home string) (string, error) {
+	if home == "" {
+		return homedir.Expand(path)
+	}
+
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+
+	if len(path) > 1 && path[1] != '/' && path[1] != '\\' {
+		return "", errors.New("cannot expand user-specific home dir")
+	}
+
+	return filepath.Join(home, path[1:]), nil
+}
+
+func (cm *ConfigManager) loadConfig() (*ini.File, error) {
+
+	if cm.ssmParameter != "" {
+		data, err := loadSSMParameter(cm.ssmClient, cm.ssmParameter)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return cfg, decryptValues(cfg)
+	}
+
+	cfg, err := cm.loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, decryptValues(cfg)
+}
+
+// loadConfigFile load the config file, a missing file is treated as empty
+func (cm *ConfigManager) loadConfigFile() (*ini.File, error) {
+	data, err := cm.fs.ReadFile(cm.configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ini.Empty(), nil
+		}
+		return nil, err
+	}
+
+	return ini.LoadSources(ini.LoadOptions{Loose: true}, data)
 }
 
 // SaveIDPAccount save idp account
 func (cm *ConfigManager) SaveIDPAccount(idpAccountName string, account *IDPAccount) error {
 
+	account.NormalizeURLs()
+
 	if err := account.Validate(); err != nil {
 		return errors.Wrap(err, "Account validation failed")
 	}
 
-	cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, cm.configPath)
+	if cm.ssmParameter != "" {
+		return ErrSSMSaveNotSupported
+	}
+
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	cfg, err := cm.loadConfigFile()
 	if err != nil {
 		return errors.Wrap(err, "Unable to load configuration file")
 	}
 
+	// the version stamp is only valid once the rest of the file has been brought up to date
+	err = migrateConfig(cfg)
+	if err != nil {
+		return err
+	}
+
 	newSec, err := cfg.NewSection(idpAccountName)
 	if err != nil {
 		return errors.Wrap(err, "Unable to build a new section in configuration file")
@@ -152,17 +699,143 @@ func (cm *ConfigManager) SaveIDPAccount(idpAccountName string, account *IDPAccou
 		return errors.Wrap(err, "Unable to save account to configuration file")
 	}
 
-	err = cfg.SaveTo(cm.configPath)
+	// the URN derived from the region is worked out again when loading, unless DEFAULT sets one to inherit
+	if account.derivedURN() && !cfg.Section(ini.DEFAULT_SECTION).HasKey("aws_urn") {
+		newSec.DeleteKey("aws_urn")
+	}
+
+	_, err = migrateEncryption(cfg)
+	if err != nil {
+		return err
+	}
+
+	return cm.saveConfigFile(cfg)
+}
+
+// DeleteIDPAccount remove the idp account from the configuration file, ErrIdpAccountNotFound is returned if it
+// doesn't exist
+func (cm *ConfigManager) DeleteIDPAccount(idpAccountName string) error {
+
+	if cm.ssmParameter != "" {
+		return ErrSSMSaveNotSupported
+	}
+
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	cfg, err := cm.loadConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	if _, err := cfg.GetSection(idpAccountName); err != nil || idpAccountName == ini.DEFAULT_SECTION {
+		return ErrIdpAccountNotFound
+	}
+
+	cfg.DeleteSection(idpAccountName)
+
+	defaults := cfg.Section(ini.DEFAULT_SECTION)
+	if key, err := defaults.GetKey(defaultIDPAccountKey); err == nil && key.String() == idpAccountName {
+		defaults.DeleteKey(defaultIDPAccountKey)
+	}
+
+	return cm.saveConfigFile(cfg)
+}
+
+// RenameIDPAccount move the idp account to a new name keeping all of its settings, ErrIdpAccountNotFound is returned
+// if it doesn't exist and an error if the new name is already taken
+func (cm *ConfigManager) RenameIDPAccount(oldName, newName string) error {
+
+	if cm.ssmParameter != "" {
+		return ErrSSMSaveNotSupported
+	}
+
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	cfg, err := cm.loadConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	oldSec, err := cfg.GetSection(oldName)
+	if err != nil || oldName == ini.DEFAULT_SECTION {
+		return ErrIdpAccountNotFound
+	}
+
+	if _, err := cfg.GetSection(newName); err == nil || newName == ini.DEFAULT_SECTION {
+		return errors.Errorf("IDP account already exists: %s", newName)
+	}
+
+	newSec, err := cfg.NewSection(newName)
+	if err != nil {
+		return errors.Wrap(err, "Unable to build a new section in configuration file")
+	}
+	newSec.Comment = oldSec.Comment
+
+	for _, key := range oldSec.Keys() {
+		newKey, err := newSec.NewKey(key.Name(), key.Value())
+		if err != nil {
+			return errors.Wrapf(err, "Unable to copy %s to the renamed account", key.Name())
+		}
+		newKey.Comment = key.Comment
+	}
+
+	cfg.DeleteSection(oldName)
+
+	if key, err := cfg.Section(ini.DEFAULT_SECTION).GetKey(defaultIDPAccountKey); err == nil && key.String() == oldName {
+		key.SetValue(newName)
+	}
+
+	return cm.saveConfigFile(cfg)
+}
+
+// saveConfigFile write the configuration to a temporary file in the same directory and rename it over the config
+// file, so an interrupted save never leaves a truncated file behind
+//
+// A new file is only readable by the user as it holds usernames and role ARNs, the mode of an existing file is kept.
+func (cm *ConfigManager) saveConfigFile(cfg *ini.File) error {
+
+	buf := new(bytes.Buffer)
+
+	_, err := cfg.WriteTo(buf)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode configuration file")
+	}
+
+	perm := os.FileMode(0600)
+	if fi, err := cm.fs.Stat(cm.configPath); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d.tmp", cm.configPath, os.Getpid())
+
+	// the temporary file is only left behind when it couldn't be renamed into place
+	defer cm.fs.Remove(tmpPath)
+
+	err = cm.fs.WriteFile(tmpPath, buf.Bytes(), perm)
 	if err != nil {
 		return errors.Wrap(err, "Failed to save configuration file")
 	}
+
+	// the umask applies when the file is created
+	err = cm.fs.Chmod(tmpPath, perm)
+	if err != nil {
+		return errors.Wrap(err, "Failed to set configuration file permissions")
+	}
+
+	err = cm.fs.Rename(tmpPath, cm.configPath)
+	if err != nil {
+		return errors.Wrap(err, "Failed to replace configuration file")
+	}
+
 	return nil
 }
 
 // LoadIDPAccount load the idp account and default to an empty one if it doesn't exist
 func (cm *ConfigManager) LoadIDPAccount(idpAccountName string) (*IDPAccount, error) {
 
-	cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, cm.configPath)
+	cfg, err := cm.loadConfig()
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to load configuration file")
 	}
@@ -173,11 +846,16 @@ func (cm *ConfigManager) LoadIDPAccount(idpAccountName string) (*IDPAccount, err
 // LoadVerifyIDPAccount load the idp account and verify it isn't empty
 func (cm *ConfigManager) LoadVerifyIDPAccount(idpAccountName string) (*IDPAccount, error) {
 
-	cfg, err := ini.LoadSources(ini.LoadOptions{Loose: true}, cm.configPath)
+	cfg, err := cm.loadConfig()
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to load configuration file")
 	}
 
+	// inherited DEFAULT values mean a missing account doesn't read back empty
+	if _, err := cfg.GetSection(idpAccountName); err != nil {
+		return nil, ErrIdpAccountNotFound
+	}
+
 	account, err := readAccount(idpAccountName, cfg)
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to read idp account")
@@ -190,15 +868,86 @@ func (cm *ConfigManager) LoadVerifyIDPAccount(idpAccountName string) (*IDPAccoun
 	return account, nil
 }
 
+// ListIDPAccounts list the names of the idp accounts in the configuration, sorted, a missing configuration file has none
+func (cm *ConfigManager) ListIDPAccounts() ([]string, error) {
+
+	cfg, err := cm.loadConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	names := []string{}
+	for _, name := range cfg.SectionStrings() {
+		if name == ini.DEFAULT_SECTION {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// SetDefaultIDPAccount make the named idp account the one used when no account is given, ErrIdpAccountNotFound is
+// returned if it doesn't exist
+func (cm *ConfigManager) SetDefaultIDPAccount(name string) error {
+
+	if cm.ssmParameter != "" {
+		return ErrSSMSaveNotSupported
+	}
+
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	cfg, err := cm.loadConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	if _, err := cfg.GetSection(name); err != nil || name == ini.DEFAULT_SECTION {
+		return ErrIdpAccountNotFound
+	}
+
+	cfg.Section(ini.DEFAULT_SECTION).Key(defaultIDPAccountKey).SetValue(name)
+
+	return cm.saveConfigFile(cfg)
+}
+
+// DefaultIDPAccountName the name of the idp account used when no account is given, this is "default" until another
+// account is made the default
+func (cm *ConfigManager) DefaultIDPAccountName() (string, error) {
+
+	cfg, err := cm.loadConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	if key, err := cfg.Section(ini.DEFAULT_SECTION).GetKey(defaultIDPAccountKey); err == nil && key.String() != "" {
+		return key.String(), nil
+	}
+
+	return DefaultIDPAccount, nil
+}
+
 // IsErrIdpAccountNotFound check if the error is a ErrIdpAccountNotFound
 func IsErrIdpAccountNotFound(err error) bool {
 	return err == ErrIdpAccountNotFound
 }
 
+// readAccount map the named section over the values in the DEFAULT section, so values set in DEFAULT are
+// inherited by every account which doesn't set them itself
 func readAccount(idpAccountName string, cfg *ini.File) (*IDPAccount, error) {
 
 	account := NewIDPAccount()
 
+	if idpAccountName != ini.DEFAULT_SECTION {
+		err := cfg.Section(ini.DEFAULT_SECTION).MapTo(account)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to map default account values")
+		}
+	}
+
 	sec := cfg.Section(idpAccountName)
 
 	err := sec.MapTo(account)
@@ -206,5 +955,10 @@ func readAccount(idpAccountName string, cfg *ini.File) (*IDPAccount, error) {
 		return nil, errors.Wrap(err, "Unable to map account")
 	}
 
+	account.applyRegionURN()
+
+	// an empty role_arns key maps to an empty slice, keep it the same as an account which never set it
+	account.RoleARNs = splitList(strings.Join(account.RoleARNs, ","))
+
 	return account, nil
 }
@@ -0,0 +1,197 @@
+package cfg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	ini "gopkg.in/ini.v1"
+)
+
+// encryptConfigKey the key in the ini DEFAULT section which turns on the encryption of the sensitive values
+const encryptConfigKey = "encrypt_config"
+
+// encryptedValuePrefix marks a value encrypted with the key from the KeyStore, the rest is the base64 of the nonce
+// followed by the AES-GCM sealed value
+const encryptedValuePrefix = "enc:"
+
+// sensitiveKeys the account settings encrypted when encrypt_config is set
+var sensitiveKeys = map[string]bool{
+	"username":           true,
+	"target_external_id": true,
+}
+
+// KeyStore keeps the key the sensitive values of the configuration file are encrypted with, saml2aws keeps it in
+// the keyring of the OS
+type KeyStore interface {
+	// Key retrieves the base64 encoded key.
+	// It returns ErrKeyNotFound if there isn't one.
+	Key() (string, error)
+	// SetKey saves the base64 encoded key.
+	SetKey(key string) error
+}
+
+// CurrentKeyStore the store of the encryption key, nil where the OS has no keyring
+var CurrentKeyStore KeyStore
+
+var (
+	// ErrKeyNotFound returned by a KeyStore which hasn't saved a key yet
+	ErrKeyNotFound = errors.New("configuration encryption key not found")
+
+	// ErrEncryptionNotSupported returned when encrypt_config is set on a platform without a keyring
+	ErrEncryptionNotSupported = errors.New("encrypt_config needs a keyring, which isn't supported on this platform")
+)
+
+// EncryptConfig turn on encrypt_config and encrypt the sensitive values already in the configuration file, the key
+// is created the first time
+func (cm *ConfigManager) EncryptConfig() error {
+
+	if cm.ssmParameter != "" {
+		return ErrSSMSaveNotSupported
+	}
+
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	cfg, err := cm.loadConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	cfg.Section(ini.DEFAULT_SECTION).Key(encryptConfigKey).SetValue("true")
+
+	_, err = encryptSensitiveValues(cfg)
+	if err != nil {
+		return err
+	}
+
+	return cm.saveConfigFile(cfg)
+}
+
+// migrateEncryption encrypt the sensitive values left in plaintext when encrypt_config is set, true is returned
+// when the file changed
+func migrateEncryption(cfg *ini.File) (bool, error) {
+	if !encryptConfig(cfg) {
+		return false, nil
+	}
+
+	return encryptSensitiveValues(cfg)
+}
+
+// encryptConfig check if encrypt_config is set in the DEFAULT section
+func encryptConfig(cfg *ini.File) bool {
+	key, err := cfg.Section(ini.DEFAULT_SECTION).GetKey(encryptConfigKey)
+	if err != nil {
+		return false
+	}
+
+	return key.MustBool(false)
+}
+
+// encryptSensitiveValues encrypt the sensitive values which are still in plaintext, true is returned when any were
+func encryptSensitiveValues(cfg *ini.File) (bool, error) {
+	var gcm cipher.AEAD
+	changed := false
+
+	for _, sec := range cfg.Sections() {
+		for _, key := range sec.Keys() {
+			if !sensitiveKeys[key.Name()] || key.Value() == "" || strings.HasPrefix(key.Value(), encryptedValuePrefix) {
+				continue
+			}
+
+			if gcm == nil {
+				var err error
+				gcm, err = configCipher(true)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			nonce := make([]byte, gcm.NonceSize())
+			if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+				return false, errors.Wrap(err, "Unable to generate nonce")
+			}
+
+			sealed := gcm.Seal(nonce, nonce, []byte(key.Value()), nil)
+			key.SetValue(encryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed))
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// decryptValues decrypt every encrypted value in the configuration, the key is only fetched when there is one
+func decryptValues(cfg *ini.File) error {
+	var gcm cipher.AEAD
+
+	for _, sec := range cfg.Sections() {
+		for _, key := range sec.Keys() {
+			if !strings.HasPrefix(key.Value(), encryptedValuePrefix) {
+				continue
+			}
+
+			if gcm == nil {
+				var err error
+				gcm, err = configCipher(false)
+				if err != nil {
+					return err
+				}
+			}
+
+			sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(key.Value(), encryptedValuePrefix))
+			if err != nil || len(sealed) < gcm.NonceSize() {
+				return errors.Errorf("Unable to decode %s in idp account %s", key.Name(), sec.Name())
+			}
+
+			value, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+			if err != nil {
+				return errors.Errorf("Unable to decrypt %s in idp account %s, it was encrypted with another key", key.Name(), sec.Name())
+			}
+
+			key.SetValue(string(value))
+		}
+	}
+
+	return nil
+}
+
+// configCipher the AES-GCM cipher of the key in the KeyStore, a missing key is created when create is set
+func configCipher(create bool) (cipher.AEAD, error) {
+	if CurrentKeyStore == nil {
+		return nil, ErrEncryptionNotSupported
+	}
+
+	encoded, err := CurrentKeyStore.Key()
+	if err == ErrKeyNotFound && create {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, errors.Wrap(err, "Unable to generate encryption key")
+		}
+
+		encoded = base64.StdEncoding.EncodeToString(key)
+
+		err = CurrentKeyStore.SetKey(encoded)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to save encryption key")
+		}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Unable to load encryption key")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("Invalid encryption key in the keyring")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid encryption key in the keyring")
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,105 @@
+package cfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// memKeyStore a KeyStore which keeps the key in memory
+type memKeyStore struct {
+	key string
+}
+
+func (ks *memKeyStore) Key() (string, error) {
+	if ks.key == "" {
+		return "", ErrKeyNotFound
+	}
+	return ks.key, nil
+}
+
+func (ks *memKeyStore) SetKey(key string) error {
+	ks.key = key
+	return nil
+}
+
+func TestEncryptConfig(t *testing.T) {
+	defer func(ks KeyStore) { CurrentKeyStore = ks }(CurrentKeyStore)
+	keyStore := &memKeyStore{}
+	CurrentKeyStore = keyStore
+
+	cfgm, fsys := newConfigManager(t, "example/saml2aws_v0_migrated.ini")
+
+	before, err := cfgm.LoadVerifyIDPAccount("custom")
+	require.Nil(t, err)
+	require.NotEmpty(t, before.Username)
+
+	require.Nil(t, cfgm.EncryptConfig())
+	require.NotEmpty(t, keyStore.key)
+
+	data, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Contains(t, string(data), "encrypt_config")
+	require.NotContains(t, string(data), before.Username)
+
+	// the values are decrypted transparently
+	account, err := cfgm.LoadVerifyIDPAccount("custom")
+	require.Nil(t, err)
+	require.Equal(t, before, account)
+
+	// accounts saved later are encrypted as well
+	account.Username = "new-user@example.com"
+	require.Nil(t, cfgm.SaveIDPAccount("other", account))
+
+	data, err = fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "new-user@example.com")
+
+	account, err = cfgm.LoadVerifyIDPAccount("other")
+	require.Nil(t, err)
+	require.Equal(t, "new-user@example.com", account.Username)
+
+	// without the key the values can't be read
+	keyStore.key = ""
+	_, err = cfgm.LoadVerifyIDPAccount("custom")
+	require.True(t, strings.HasPrefix(err.Error(), "Unable to load configuration file: Unable to load encryption key"), err.Error())
+}
+
+func TestMigrateEncryption(t *testing.T) {
+	defer func(ks KeyStore) { CurrentKeyStore = ks }(CurrentKeyStore)
+	CurrentKeyStore = &memKeyStore{}
+
+	cfgm, fsys := newConfigManager(t, "example/saml2aws_v0.ini")
+	require.Nil(t, cfgm.Migrate())
+
+	plain, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.NotContains(t, string(plain), encryptedValuePrefix)
+
+	// turning on encrypt_config by hand is picked up by the next migrate
+	edited := "encrypt_config = true\n" + string(plain)
+	require.Nil(t, fsys.WriteFile("/home/test/.saml2aws", []byte(edited), 0600))
+	require.Nil(t, cfgm.Migrate())
+
+	data, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Contains(t, string(data), "username = "+encryptedValuePrefix)
+
+	// the second run has nothing to do
+	require.Nil(t, cfgm.Migrate())
+
+	again, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, string(data), string(again))
+}
+
+func TestEncryptConfigUnsupported(t *testing.T) {
+	defer func(ks KeyStore) { CurrentKeyStore = ks }(CurrentKeyStore)
+	CurrentKeyStore = nil
+
+	cfgm, _ := newConfigManager(t, "example/saml2aws_v0_migrated.ini")
+
+	require.Equal(t, ErrEncryptionNotSupported, errors.Cause(cfgm.EncryptConfig()))
+}
@@ -0,0 +1,65 @@
+package cfg
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// LoadIDPAccountWithEnv load the idp account then override its settings with any set SAML2AWS_* environment variables
+//
+// The environment takes precedence over the configuration file, so SAML2AWS_ROLE_ARN=... switches roles without
+// editing the file. Only variables which are set override the file and an invalid number or bool is an error. As
+// with LoadVerifyIDPAccount the account must exist in the configuration file.
+func (cm *ConfigManager) LoadIDPAccountWithEnv(idpAccountName string) (*IDPAccount, error) {
+
+	account, err := cm.LoadVerifyIDPAccount(idpAccountName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = account.applyEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to apply environment overrides")
+	}
+
+	return account, nil
+}
+
+// applyEnv override the settings which have an environment variable set
+func (ia *IDPAccount) applyEnv() error {
+
+	stringVars := map[string]*string{
+		"SAML2AWS_URL":         &ia.URL,
+		"SAML2AWS_USERNAME":    &ia.Username,
+		"SAML2AWS_PROVIDER":    &ia.Provider,
+		"SAML2AWS_MFA":         &ia.MFA,
+		"SAML2AWS_ROLE_ARN":    &ia.RoleARN,
+		"SAML2AWS_AWS_PROFILE": &ia.Profile,
+	}
+
+	for name, field := range stringVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := os.LookupEnv("SAML2AWS_SKIP_VERIFY"); ok {
+		skipVerify, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.Errorf("SAML2AWS_SKIP_VERIFY must be true or false: %q", value)
+		}
+		ia.SkipVerify = skipVerify
+	}
+
+	if value, ok := os.LookupEnv("SAML2AWS_SESSION_DURATION"); ok {
+		duration, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Errorf("SAML2AWS_SESSION_DURATION must be a number of seconds: %q", value)
+		}
+		ia.SessionDuration = duration
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package cfg
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setenv set the environment variables for the test, returning a func which unsets them
+func setenv(t *testing.T, vars map[string]string) func() {
+	for name, value := range vars {
+		require.Nil(t, os.Setenv(name, value))
+	}
+
+	return func() {
+		for name := range vars {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoadIDPAccountWithEnv(t *testing.T) {
+
+	defer setenv(t, map[string]string{
+		"SAML2AWS_URL":              "https://id.example.com",
+		"SAML2AWS_USERNAME":         "ci@example.com",
+		"SAML2AWS_PROVIDER":         "Okta",
+		"SAML2AWS_MFA":              "Auto",
+		"SAML2AWS_SKIP_VERIFY":      "true",
+		"SAML2AWS_SESSION_DURATION": "7200",
+		"SAML2AWS_ROLE_ARN":         "arn:aws:iam::123456789012:role/ci",
+		"SAML2AWS_AWS_PROFILE":      "ci",
+	})()
+
+	cfgm, err := NewConfigManager("example/saml2aws.ini")
+	require.Nil(t, err)
+
+	account, err := cfgm.LoadIDPAccountWithEnv("test123")
+	require.Nil(t, err)
+	require.Equal(t, "https://id.example.com", account.URL)
+	require.Equal(t, "ci@example.com", account.Username)
+	require.Equal(t, "Okta", account.Provider)
+	require.Equal(t, "Auto", account.MFA)
+	require.True(t, account.SkipVerify)
+	require.Equal(t, 7200, account.SessionDuration)
+	require.Equal(t, "arn:aws:iam::123456789012:role/ci", account.RoleARN)
+	require.Equal(t, "ci", account.Profile)
+}
+
+func TestLoadIDPAccountWithEnvUnset(t *testing.T) {
+
+	// a variable set to an empty value still overrides the file
+	defer setenv(t, map[string]string{"SAML2AWS_USERNAME": ""})()
+
+	cfgm, err := NewConfigManager("example/saml2aws.ini")
+	require.Nil(t, err)
+
+	account, err := cfgm.LoadIDPAccountWithEnv("test123")
+	require.Nil(t, err)
+	require.Equal(t, "", account.Username)
+	require.Equal(t, "https://id.whatever.com", account.URL)
+	require.Equal(t, "keycloak", account.Provider)
+	require.False(t, account.SkipVerify)
+	require.Equal(t, DefaultSessionDuration, account.SessionDuration)
+
+	_, err = cfgm.LoadIDPAccountWithEnv("missing")
+	require.Equal(t, ErrIdpAccountNotFound, err)
+}
+
+func TestLoadIDPAccountWithEnvInvalid(t *testing.T) {
+
+	cfgm, err := NewConfigManager("example/saml2aws.ini")
+	require.Nil(t, err)
+
+	restore := setenv(t, map[string]string{"SAML2AWS_SESSION_DURATION": "1h"})
+	_, err = cfgm.LoadIDPAccountWithEnv("test123")
+	restore()
+	require.EqualError(t, err, `Unable to apply environment overrides: SAML2AWS_SESSION_DURATION must be a number of seconds: "1h"`)
+
+	restore = setenv(t, map[string]string{"SAML2AWS_SKIP_VERIFY": "yes"})
+	_, err = cfgm.LoadIDPAccountWithEnv("test123")
+	restore()
+	require.EqualError(t, err, `Unable to apply environment overrides: SAML2AWS_SKIP_VERIFY must be true or false: "yes"`)
+}
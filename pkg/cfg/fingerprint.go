@@ -0,0 +1,71 @@
+package cfg
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	ini "gopkg.in/ini.v1"
+)
+
+// ConfigFingerprint a stable hash of the settings of every idp account in the configuration
+//
+// Every setting is hashed, the accounts hold no secrets as passwords are kept in the keyring. Sections and keys are
+// sorted before hashing so the fingerprint doesn't depend on their order in the file.
+func (cm *ConfigManager) ConfigFingerprint() (string, error) {
+
+	cfg, err := cm.loadConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	names := []string{}
+	for _, sec := range cfg.Sections() {
+		if sec.Name() == ini.DEFAULT_SECTION && !hasAccountKeys(sec) {
+			continue
+		}
+		names = append(names, sec.Name())
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+
+	for _, name := range names {
+		account, err := readAccount(name, cfg)
+		if err != nil {
+			return "", errors.Wrapf(err, "Unable to read idp account: %s", name)
+		}
+
+		sec := ini.Empty().Section(name)
+
+		err = sec.ReflectFrom(account)
+		if err != nil {
+			return "", errors.Wrapf(err, "Unable to reflect idp account: %s", name)
+		}
+
+		fmt.Fprintf(h, "[%s]\n", name)
+
+		keys := sec.KeyStrings()
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(h, "%s=%s\n", key, sec.Key(key).Value())
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hasAccountKeys check if the section sets any account settings, the DEFAULT section also holds keys which describe
+// the file itself
+func hasAccountKeys(sec *ini.Section) bool {
+	for _, key := range sec.KeyStrings() {
+		if key != configVersionKey && key != defaultIDPAccountKey && key != encryptConfigKey {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,82 @@
+package cfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const fingerprintConfig = `[wolfeidau]
+username = mark@wolfe.id.au
+provider = keycloak
+mfa      = totp
+
+[test123]
+username = abc@whatever.com
+provider = keycloak
+mfa      = sms
+url      = https://id.whatever.com
+`
+
+const fingerprintConfigReordered = `[test123]
+url      = https://id.whatever.com
+mfa      = sms
+provider = keycloak
+username = abc@whatever.com
+
+[wolfeidau]
+mfa      = totp
+provider = keycloak
+username = mark@wolfe.id.au
+`
+
+func fingerprint(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "saml2aws")
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	cfgm, err := NewConfigManager(path)
+	require.Nil(t, err)
+
+	fp, err := cfgm.ConfigFingerprint()
+	require.Nil(t, err)
+
+	return fp
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := fingerprint(t, dir, fingerprintConfig)
+	require.Len(t, fp, 64)
+
+	require.Equal(t, fp, fingerprint(t, dir, fingerprintConfig))
+	require.Equal(t, fp, fingerprint(t, dir, fingerprintConfigReordered))
+}
+
+func TestConfigFingerprintChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := fingerprint(t, dir, fingerprintConfig)
+
+	changed := fingerprint(t, dir, fingerprintConfig+"timeout  = 30\n")
+	require.NotEqual(t, fp, changed)
+}
+
+func TestConfigFingerprintCredentialsKeyNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := fingerprint(t, dir, fingerprintConfig)
+
+	// the names of the credentials file keys aren't secrets, so drift in them changes the fingerprint
+	changed := fingerprint(t, dir, fingerprintConfig+"credentials_secret_key_name = secret_key\n")
+	require.NotEqual(t, fp, changed)
+}
@@ -0,0 +1,108 @@
+package cfg
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	ini "gopkg.in/ini.v1"
+)
+
+// CurrentConfigVersion the schema version of the configuration files written by this version of saml2aws
+const CurrentConfigVersion = 1
+
+// configVersionKey the key in the ini DEFAULT section which records the schema version of the file, files written
+// before it was added are version 0
+const configVersionKey = "config_version"
+
+// configMigrations upgrade the configuration file one version at a time, the migration at index i takes a version i
+// file to version i+1, a migration only fills in keys which are missing so values set by the user are kept
+var configMigrations = []func(cfg *ini.File){
+	// the aws_urn of a version 0 file is derived from its region when loaded, so it only needs the version stamp
+	func(cfg *ini.File) {},
+}
+
+// Migrate upgrade the configuration file to the current schema version and rewrite it, the sensitive values are
+// also encrypted when encrypt_config is set, a file which is already up to date is left untouched
+func (cm *ConfigManager) Migrate() error {
+
+	if cm.ssmParameter != "" {
+		return ErrSSMSaveNotSupported
+	}
+
+	// there is nothing to migrate until the file has been written
+	if _, err := cm.fs.Stat(cm.configPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	cfg, err := cm.loadConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "Unable to load configuration file")
+	}
+
+	version, err := configVersion(cfg)
+	if err != nil {
+		return err
+	}
+
+	if version > CurrentConfigVersion {
+		return errors.Errorf("Configuration file version %d is newer than this saml2aws supports", version)
+	}
+
+	err = migrateConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := migrateEncryption(cfg)
+	if err != nil {
+		return err
+	}
+
+	if version == CurrentConfigVersion && !encrypted {
+		return nil
+	}
+
+	return cm.saveConfigFile(cfg)
+}
+
+// configVersion the schema version recorded in the configuration file
+func configVersion(cfg *ini.File) (int, error) {
+
+	key, err := cfg.Section(ini.DEFAULT_SECTION).GetKey(configVersionKey)
+	if err != nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(key.String())
+	if err != nil || version < 0 {
+		return 0, errors.Errorf("Invalid %s in configuration file: %s", configVersionKey, key.String())
+	}
+
+	return version, nil
+}
+
+// migrateConfig apply the migrations for every version after the one recorded in the file and stamp the current
+// version, a file from a newer saml2aws is left as it is
+func migrateConfig(cfg *ini.File) error {
+
+	version, err := configVersion(cfg)
+	if err != nil {
+		return err
+	}
+
+	if version >= CurrentConfigVersion {
+		return nil
+	}
+
+	for _, migrate := range configMigrations[version:] {
+		migrate(cfg)
+	}
+
+	cfg.Section(ini.DEFAULT_SECTION).Key(configVersionKey).SetValue(strconv.Itoa(CurrentConfigVersion))
+
+	return nil
+}
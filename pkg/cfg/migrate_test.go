@@ -0,0 +1,77 @@
+package cfg
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+
+	cfgm, fsys := newConfigManager(t, "example/saml2aws_v0.ini")
+
+	require.Nil(t, cfgm.Migrate())
+
+	expected, err := ioutil.ReadFile("example/saml2aws_v0_migrated.ini")
+	require.Nil(t, err)
+
+	data, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, string(expected), string(data))
+
+	fi, err := fsys.Stat("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, "-rw-------", fi.Mode().String())
+
+	// the second run has nothing to do
+	require.Nil(t, cfgm.Migrate())
+
+	again, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, string(data), string(again))
+
+	account, err := cfgm.LoadVerifyIDPAccount("custom")
+	require.Nil(t, err)
+	require.Equal(t, "urn:amazon:webservices:custom", account.AmazonWebservicesURN)
+
+	account, err = cfgm.LoadVerifyIDPAccount("govcloud")
+	require.Nil(t, err)
+	require.Equal(t, GovCloudAmazonWebservicesURN, account.AmazonWebservicesURN)
+}
+
+func TestMigrateInheritedURN(t *testing.T) {
+
+	cfgm, _ := newConfigManager(t, "")
+	require.Nil(t, cfgm.fs.WriteFile("/home/test/.saml2aws", []byte("aws_urn = urn:amazon:webservices:custom\n\n[prod]\nurl = https://id.example.com\n"), 0600))
+
+	require.Nil(t, cfgm.Migrate())
+
+	data, err := cfgm.fs.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Contains(t, string(data), "config_version = 1")
+
+	// aws_urn is inherited from DEFAULT so it isn't copied into the account
+	require.Equal(t, 1, strings.Count(string(data), "aws_urn"))
+}
+
+func TestMigrateVersion(t *testing.T) {
+
+	cfgm, _ := newConfigManager(t, "", "first")
+
+	data, err := cfgm.fs.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Contains(t, string(data), "config_version = 1")
+
+	require.Nil(t, cfgm.fs.WriteFile("/home/test/.saml2aws", []byte("config_version = 2\n"), 0600))
+	require.Error(t, cfgm.Migrate())
+
+	require.Nil(t, cfgm.fs.WriteFile("/home/test/.saml2aws", []byte("config_version = one\n"), 0600))
+	require.Error(t, cfgm.Migrate())
+
+	// a missing file isn't created
+	missing, err := NewConfigManagerWithFS("~/.saml2aws", "/home/other", cfgm.fs)
+	require.Nil(t, err)
+	require.Nil(t, missing.Migrate())
+}
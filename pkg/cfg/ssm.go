@@ -0,0 +1,45 @@
+package cfg
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+)
+
+// SSMConfigPrefix config sources with this prefix are loaded from the named SSM parameter
+const SSMConfigPrefix = "ssm://"
+
+// ErrSSMSaveNotSupported returned when attempting to save configuration to an SSM config source
+var ErrSSMSaveNotSupported = errors.New("saving configuration to SSM parameter store is not supported")
+
+func isSSMConfigSource(configFile string) bool {
+	return strings.HasPrefix(configFile, SSMConfigPrefix)
+}
+
+// loadSSMParameter read the ini content stored in the named SSM parameter, the client is
+// created with the ambient AWS credentials if one isn't supplied
+func loadSSMParameter(client ssmiface.SSMAPI, name string) ([]byte, error) {
+
+	if client == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create session")
+		}
+
+		client = ssm.New(sess)
+	}
+
+	res, err := client.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read SSM parameter: %s", name)
+	}
+
+	return []byte(aws.StringValue(res.Parameter.Value)), nil
+}
@@ -0,0 +1,91 @@
+package cfg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/stretchr/testify/require"
+)
+
+const ssmConfig = `[default]
+url           = https://id.whatever.com
+username      = abc@whatever.com
+provider      = keycloak
+mfa           = sms
+aws_urn       = urn:amazon:webservices
+aws_profile   = saml
+`
+
+type mockSSM struct {
+	ssmiface.SSMAPI
+	name  string
+	value string
+	err   error
+}
+
+func (m *mockSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	m.name = aws.StringValue(input.Name)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(m.value)}}, nil
+}
+
+func TestNewConfigManagerSSMLoad(t *testing.T) {
+
+	cfgm, err := NewConfigManager("ssm:///saml2aws/config")
+	require.Nil(t, err)
+
+	client := &mockSSM{value: ssmConfig}
+	cfgm.ssmClient = client
+
+	idpAccount, err := cfgm.LoadVerifyIDPAccount("default")
+	require.Nil(t, err)
+	require.Equal(t, "/saml2aws/config", client.name)
+	require.Equal(t, &IDPAccount{
+		URL:                    "https://id.whatever.com",
+		Username:               "abc@whatever.com",
+		Provider:               "keycloak",
+		MFA:                    "sms",
+		AmazonWebservicesURN:   DefaultAmazonWebservicesURN,
+		SessionDuration:        DefaultSessionDuration,
+		Profile:                "saml",
+		MaxDisplayRoles:        DefaultMaxDisplayRoles,
+		MinTLSVersion:          DefaultMinTLSVersion,
+		MaxRedirects:           DefaultMaxRedirects,
+		MaxRetries:             DefaultMaxRetries,
+		MFACodeLength:          DefaultMFACodeLength,
+		WarnOnProfileCollision: true,
+		FollowSymlinks:         true,
+	}, idpAccount)
+}
+
+func TestNewConfigManagerSSMLoadError(t *testing.T) {
+
+	cfgm, err := NewConfigManager("ssm:///saml2aws/config")
+	require.Nil(t, err)
+
+	cfgm.ssmClient = &mockSSM{err: errors.New("ParameterNotFound")}
+
+	_, err = cfgm.LoadIDPAccount("default")
+	require.Error(t, err)
+}
+
+func TestNewConfigManagerSSMSave(t *testing.T) {
+
+	cfgm, err := NewConfigManager("ssm:///saml2aws/config")
+	require.Nil(t, err)
+
+	err = cfgm.SaveIDPAccount("default", &IDPAccount{
+		URL:      "https://id.whatever.com",
+		Username: "abc@whatever.com",
+		Provider: "keycloak",
+		MFA:      "sms",
+		Profile:  "saml",
+	})
+	require.Equal(t, ErrSSMSaveNotSupported, err)
+}
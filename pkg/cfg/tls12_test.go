@@ -0,0 +1,22 @@
+// +build !go1.12
+
+package cfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMinTLSVersion13Unsupported(t *testing.T) {
+
+	account := &IDPAccount{
+		URL:           "https://id.whatever.com",
+		Provider:      "keycloak",
+		MFA:           "sms",
+		Profile:       "saml",
+		MinTLSVersion: "1.3",
+	}
+
+	require.EqualError(t, account.Validate(), "TLS 1.3 isn't supported by this build of saml2aws")
+}
@@ -0,0 +1,9 @@
+// +build go1.12
+
+package cfg
+
+import "crypto/tls"
+
+func init() {
+	tlsVersions["1.3"] = tls.VersionTLS13
+}
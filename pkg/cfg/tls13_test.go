@@ -0,0 +1,24 @@
+// +build go1.12
+
+package cfg
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMinTLSVersion13(t *testing.T) {
+
+	account := &IDPAccount{
+		URL:           "https://id.whatever.com",
+		Provider:      "keycloak",
+		MFA:           "sms",
+		Profile:       "saml",
+		MinTLSVersion: "1.3",
+	}
+
+	require.Nil(t, account.Validate())
+	require.Equal(t, uint16(tls.VersionTLS13), account.TLSMinVersion())
+}
@@ -0,0 +1,36 @@
+package cfg
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ValidationError an idp account validation failure along with a hint on how to fix it
+type ValidationError struct {
+	message string
+	hint    string
+}
+
+func newValidationError(hint string, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{message: fmt.Sprintf(format, args...), hint: hint}
+}
+
+// Error the validation failure, this doesn't include the hint
+func (e *ValidationError) Error() string {
+	return e.message
+}
+
+// Hint what to change in the idp account to fix the validation failure
+func (e *ValidationError) Hint() string {
+	return e.hint
+}
+
+// ValidationHint return the hint of a validation error, empty if the cause of the error isn't one
+func ValidationHint(err error) string {
+	if verr, ok := errors.Cause(err).(*ValidationError); ok {
+		return verr.Hint()
+	}
+
+	return ""
+}
@@ -0,0 +1,60 @@
+package cfg
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHints(t *testing.T) {
+
+	valid := func() *IDPAccount {
+		return &IDPAccount{
+			URL:      "https://id.whatever.com",
+			Provider: "keycloak",
+			MFA:      "sms",
+			Profile:  "saml",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(ia *IDPAccount)
+		message string
+		hint    string
+	}{
+		{"app id", func(ia *IDPAccount) { ia.Provider = "OneLogin" }, "app ID empty in idp account", "run 'saml2aws configure' and set the OneLogin app ID with --app-id"},
+		{"subdomain", func(ia *IDPAccount) { ia.Provider = "OneLogin"; ia.AppID = "123" }, "subdomain empty in idp account", "run 'saml2aws configure' and set the OneLogin subdomain with --subdomain"},
+		{"url", func(ia *IDPAccount) { ia.URL = "" }, "URL empty in idp account", "run 'saml2aws configure' and set the URL of your IdP with --url"},
+		{"url parse", func(ia *IDPAccount) { ia.URL = "https://id.whatever.com/%zz" }, "URL parse failed", "set url to the full address of your IdP, e.g. https://id.example.com"},
+		{"fallback url parse", func(ia *IDPAccount) { ia.FallbackURL = "https://id-dr.whatever.com/%zz" }, "fallback URL parse failed", "set fallback_url to a full address, e.g. https://id-dr.example.com, or remove it"},
+		{"provider", func(ia *IDPAccount) { ia.Provider = "" }, "Provider empty in idp account", "run 'saml2aws configure' and choose a provider, or set it with --idp-provider"},
+		{"mfa", func(ia *IDPAccount) { ia.MFA = "" }, "MFA empty in idp account", "run 'saml2aws configure' and choose an MFA method, use Auto if unsure"},
+		{"profile", func(ia *IDPAccount) { ia.Profile = "" }, "Profile empty in idp account", "run 'saml2aws configure' and set the AWS profile the credentials are saved to"},
+		{"min tls version", func(ia *IDPAccount) { ia.MinTLSVersion = "1.1" }, "Unsupported min TLS version in idp account: 1.1", "set min_tls_version to 1.2 or 1.3"},
+		{"proxy url parse", func(ia *IDPAccount) { ia.ProxyURL = "http://proxy/%zz" }, "proxy URL parse failed", "set proxy_url to a full address, e.g. http://proxy.example.com:3128"},
+		{"proxy scheme", func(ia *IDPAccount) { ia.ProxyURL = "socks4://proxy:1080" }, "Unsupported proxy URL scheme in idp account: socks4", "use an http, https, socks5 or socks5h proxy_url"},
+		{"credentials output", func(ia *IDPAccount) { ia.CredentialsOutput = "vault" }, "Unsupported credentials output in idp account: vault", "set credentials_output to file, file:<path>, keyring, export or json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := valid()
+			tt.modify(account)
+
+			err := account.Validate()
+			require.Error(t, err)
+			require.Equal(t, tt.message, err.Error())
+			require.Equal(t, tt.hint, ValidationHint(err))
+		})
+	}
+}
+
+func TestValidationHintWrapped(t *testing.T) {
+	err := errors.Wrap((&IDPAccount{}).Validate(), "failed to validate account")
+	require.Equal(t, "failed to validate account: URL empty in idp account", err.Error())
+	require.Equal(t, "run 'saml2aws configure' and set the URL of your IdP with --url", ValidationHint(err))
+
+	require.Empty(t, ValidationHint(errors.New("not a validation failure")))
+}
@@ -9,9 +9,15 @@ type LoginDetails struct {
 	Username     string
 	Password     string
 	MFAToken     string
+	MFATokens    MFATokenSource // answers the MFA prompts of this login, nil to prompt
 	URL          string
 }
 
+// MFATokenSource supplies the MFA codes of a login in place of prompting for them
+type MFATokenSource interface {
+	Next() (string, error)
+}
+
 // Validate validate the login details
 func (ld *LoginDetails) Validate() error {
 	if ld.URL == "" {
@@ -0,0 +1,62 @@
+package creds
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadPasswordFromFd read a single line containing the password from the file descriptor
+//
+// The descriptor is read a byte at a time so nothing past the first line is consumed, and it
+// is closed once the password has been read.
+func ReadPasswordFromFd(fd int) (string, error) {
+
+	if fd < 0 {
+		return "", fmt.Errorf("invalid password file descriptor: %d", fd)
+	}
+
+	f := os.NewFile(uintptr(fd), "password-fd")
+	if f == nil {
+		return "", fmt.Errorf("invalid password file descriptor: %d", fd)
+	}
+	defer f.Close()
+
+	return readPasswordLine(f, fmt.Sprintf("file descriptor %d", fd))
+}
+
+// ReadPasswordFromStdin read a single line containing the password from stdin, which is left open
+func ReadPasswordFromStdin() (string, error) {
+	return readPasswordLine(os.Stdin, "stdin")
+}
+
+// readPasswordLine read the first line a byte at a time so nothing past it is consumed
+func readPasswordLine(r io.Reader, source string) (string, error) {
+
+	var line []byte
+
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading password from %s: %v", source, err)
+		}
+	}
+
+	password := strings.TrimSuffix(string(line), "\r")
+	if password == "" {
+		return "", fmt.Errorf("no password read from %s", source)
+	}
+
+	return password, nil
+}
@@ -0,0 +1,79 @@
+package creds
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPasswordFromFd(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+
+	_, err = w.WriteString("test123\nsecond line\n")
+	require.Nil(t, err)
+	w.Close()
+
+	password, err := ReadPasswordFromFd(int(r.Fd()))
+	require.Nil(t, err)
+	require.Equal(t, "test123", password)
+
+	// the descriptor is closed after reading
+	_, err = r.Read(make([]byte, 1))
+	require.Error(t, err)
+}
+
+func TestReadPasswordFromFdNoNewline(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+
+	_, err = w.WriteString("test123\r")
+	require.Nil(t, err)
+	w.Close()
+
+	password, err := ReadPasswordFromFd(int(r.Fd()))
+	require.Nil(t, err)
+	require.Equal(t, "test123", password)
+}
+
+func TestReadPasswordFromFdEOF(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+	w.Close()
+
+	_, err = ReadPasswordFromFd(int(r.Fd()))
+	require.Error(t, err)
+}
+
+func TestReadPasswordFromFdInvalid(t *testing.T) {
+
+	_, err := ReadPasswordFromFd(-1)
+	require.Error(t, err)
+}
+
+func TestReadPasswordFromStdin(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = r
+
+	_, err = w.WriteString("test123\nsecond line\n")
+	require.Nil(t, err)
+	w.Close()
+
+	password, err := ReadPasswordFromStdin()
+	require.Nil(t, err)
+	require.Equal(t, "test123", password)
+
+	// stdin is left open with the rest of the input unread
+	rest, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "second line\n", string(rest))
+}
@@ -14,7 +14,7 @@ func RequestString(req *http.Request) string {
 		return ""
 	}
 
-	return string(data)
+	return Redact(string(data))
 }
 
 // ResponseString helper method to dump the http response
@@ -25,10 +25,18 @@ func ResponseString(res *http.Response) string {
 		return ""
 	}
 
-	return string(data)
+	return Redact(string(data))
+}
+
+// contentEnabled set by EnableContent when --trace is given
+var contentEnabled bool
+
+// EnableContent dump request / response content, as DUMP_CONTENT=true does
+func EnableContent() {
+	contentEnabled = true
 }
 
 // ContentEnable enable dumping of request / response content
 func ContentEnable() bool {
-	return os.Getenv("DUMP_CONTENT") == "true"
+	return contentEnabled || os.Getenv("DUMP_CONTENT") == "true"
 }
@@ -0,0 +1,118 @@
+package dump
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// samlResponsePatterns match the value of a SAMLResponse parameter as it appears in a form or query string, an html
+// form input and a json document, the value is the last submatch
+var samlResponsePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(SAMLResponse=)([^&\s"'<>]+)`),
+	regexp.MustCompile(`(?i)(<input[^>]*name=["']SAMLResponse["'][^>]*value=["'])([^"']*)`),
+	regexp.MustCompile(`(?i)(<input[^>]*value=["'])([^"']*)(["'][^>]*name=["']SAMLResponse["'])`),
+	regexp.MustCompile(`("SAMLResponse"\s*:\s*")([^"]*)`),
+}
+
+// credentialPatterns match the value of passwords, secrets, Okta session and state tokens and session headers in form
+// and query strings, json documents and http headers, the value is the second submatch
+var credentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)([\w.%$-]*(?:password|passwd|secret|sessiontoken|statetoken)[\w.%$-]*=)([^&\s"'<>]+)`),
+	regexp.MustCompile(`(?i)("[\w.-]*(?:password|passwd|secret|sessiontoken|statetoken)[\w.-]*"\s*:\s*")([^"]*)`),
+	// the Okta session token passed to sessionCookieRedirect
+	regexp.MustCompile(`([?&]token=)([^&\s"'<>]+)`),
+	regexp.MustCompile(`(?im)^((?:Authorization|Cookie|Set-Cookie):[ \t]*)([^\r\n]+)`),
+}
+
+// credentialFields the log fields which hold a password, secret or token on their own
+var credentialFields = map[string]bool{
+	"password":     true,
+	"secret":       true,
+	"clientsecret": true,
+	"sessiontoken": true,
+	"statetoken":   true,
+}
+
+// credentialPlaceholder replaces the passwords and secrets, unlike the SAMLResponse they are never logged
+const credentialPlaceholder = "[redacted]"
+
+// samlAssertionFields the log fields which hold a SAMLResponse on their own
+var samlAssertionFields = map[string]bool{
+	"samlresponse":  true,
+	"samlassertion": true,
+}
+
+// SAMLResponseRedactEnable redact the SAMLResponse in dumped requests / responses and debug logs, set
+// DUMP_SAML_RESPONSE=true to log it as it is
+func SAMLResponseRedactEnable() bool {
+	return os.Getenv("DUMP_SAML_RESPONSE") != "true"
+}
+
+// RedactSAMLResponse replace the value of every SAMLResponse parameter in the text with a placeholder recording its
+// length, the rest of the text is kept
+func RedactSAMLResponse(s string) string {
+	if !SAMLResponseRedactEnable() || !strings.Contains(s, "SAMLResponse") {
+		return s
+	}
+
+	for _, pattern := range samlResponsePatterns {
+		s = pattern.ReplaceAllStringFunc(s, func(match string) string {
+			groups := pattern.FindStringSubmatch(match)
+			groups[2] = samlResponsePlaceholder(groups[2])
+			return strings.Join(groups[1:], "")
+		})
+	}
+
+	return s
+}
+
+// RedactCredentials replace passwords, secrets, cookies and authorization headers in the text with a placeholder
+func RedactCredentials(s string) string {
+	for _, pattern := range credentialPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+credentialPlaceholder)
+	}
+
+	return s
+}
+
+// Redact remove the credentials and the SAMLResponse from the text
+func Redact(s string) string {
+	return RedactCredentials(RedactSAMLResponse(s))
+}
+
+func samlResponsePlaceholder(value string) string {
+	return fmt.Sprintf("[redacted SAMLResponse, %d bytes]", len(value))
+}
+
+// RedactFormatter logrus formatter which redacts the credentials and SAMLResponse in the message and fields of every
+// log entry before handing it to the wrapped formatter
+type RedactFormatter struct {
+	Formatter logrus.Formatter
+}
+
+// Format redact a copy of the entry and format it
+func (f *RedactFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = Redact(entry.Message)
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+
+	for key, value := range entry.Data {
+		s, ok := value.(string)
+		switch {
+		case !ok:
+			redacted.Data[key] = value
+		case credentialFields[strings.ToLower(key)]:
+			redacted.Data[key] = credentialPlaceholder
+		case samlAssertionFields[strings.ToLower(key)] && SAMLResponseRedactEnable():
+			redacted.Data[key] = samlResponsePlaceholder(s)
+		default:
+			redacted.Data[key] = Redact(s)
+		}
+	}
+
+	return f.Formatter.Format(&redacted)
+}
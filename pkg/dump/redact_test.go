@@ -0,0 +1,151 @@
+package dump
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const testSAMLResponse = "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+"
+
+func TestRequestStringRedactsSAMLResponse(t *testing.T) {
+	defer os.Unsetenv("DUMP_CONTENT")
+	os.Setenv("DUMP_CONTENT", "true")
+
+	form := url.Values{"SAMLResponse": {testSAMLResponse}, "RelayState": {"https://signin.aws.amazon.com"}}
+	req, err := http.NewRequest("POST", "https://signin.aws.amazon.com/saml", strings.NewReader(form.Encode()))
+	require.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	out := RequestString(req)
+	require.NotContains(t, out, testSAMLResponse)
+	require.Contains(t, out, "SAMLResponse=[redacted SAMLResponse, 46 bytes]")
+	require.Contains(t, out, "RelayState=https%3A%2F%2Fsignin.aws.amazon.com")
+	require.Contains(t, out, "POST /saml HTTP/1.1")
+}
+
+func TestRedactSAMLResponse(t *testing.T) {
+	placeholder := "[redacted SAMLResponse, 44 bytes]"
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "https://sp.example.com/acs?SAMLResponse=" + testSAMLResponse + "&RelayState=abc",
+			want: "https://sp.example.com/acs?SAMLResponse=" + placeholder + "&RelayState=abc",
+		},
+		{
+			in:   `<input type="hidden" name="SAMLResponse" value="` + testSAMLResponse + `"/><input name="RelayState" value="abc"/>`,
+			want: `<input type="hidden" name="SAMLResponse" value="` + placeholder + `"/><input name="RelayState" value="abc"/>`,
+		},
+		{
+			in:   `<input value="` + testSAMLResponse + `" name="SAMLResponse"/>`,
+			want: `<input value="` + placeholder + `" name="SAMLResponse"/>`,
+		},
+		{
+			in:   `{"SAMLResponse": "` + testSAMLResponse + `", "status": "ok"}`,
+			want: `{"SAMLResponse": "` + placeholder + `", "status": "ok"}`,
+		},
+		{
+			in:   "no assertion here",
+			want: "no assertion here",
+		},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, RedactSAMLResponse(tt.in))
+	}
+
+	// redaction can be turned off to debug the assertion
+	defer os.Unsetenv("DUMP_SAML_RESPONSE")
+	os.Setenv("DUMP_SAML_RESPONSE", "true")
+	require.Equal(t, tests[0].in, RedactSAMLResponse(tests[0].in))
+}
+
+func TestRedactFormatter(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = &RedactFormatter{Formatter: &logrus.TextFormatter{}}
+
+	logger.WithField("samlAssertion", testSAMLResponse).
+		WithField("url", "https://sp.example.com/acs?SAMLResponse="+testSAMLResponse).
+		WithField("status", 200).
+		WithField("password", "hunter2").
+		Debug("SAMLResponse=" + testSAMLResponse)
+
+	out := buf.String()
+	require.NotContains(t, out, testSAMLResponse)
+	require.Contains(t, out, "[redacted SAMLResponse, 44 bytes]")
+	require.Contains(t, out, "https://sp.example.com/acs?SAMLResponse=")
+	require.Contains(t, out, "status=200")
+	require.NotContains(t, out, "hunter2")
+}
+
+func TestRedactCredentials(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "UserName=user%40example.com&Password=hunter2&AuthMethod=FormsAuthentication",
+			want: "UserName=user%40example.com&Password=[redacted]&AuthMethod=FormsAuthentication",
+		},
+		{
+			in:   "ctl00%24ContentPlaceHolder1%24PasswordTextBox=hunter2&ctl00%24ContentPlaceHolder1%24SubmitButton=Sign+In",
+			want: "ctl00%24ContentPlaceHolder1%24PasswordTextBox=[redacted]&ctl00%24ContentPlaceHolder1%24SubmitButton=Sign+In",
+		},
+		{
+			in:   `{"username": "user", "password": "hunter2", "client_secret": "abc"}`,
+			want: `{"username": "user", "password": "[redacted]", "client_secret": "[redacted]"}`,
+		},
+		{
+			in:   `{"stateToken": "00abc", "status": "SUCCESS", "sessionToken": "20111abc"}`,
+			want: `{"stateToken": "[redacted]", "status": "SUCCESS", "sessionToken": "[redacted]"}`,
+		},
+		{
+			in:   "stateToken=00abc&factorId=abc",
+			want: "stateToken=[redacted]&factorId=abc",
+		},
+		{
+			in:   "GET /login/sessionCookieRedirect?checkAccountSetupComplete=true&token=20111abc&redirectUrl=https%3A%2F%2Fexample.okta.com HTTP/1.1",
+			want: "GET /login/sessionCookieRedirect?checkAccountSetupComplete=true&token=[redacted]&redirectUrl=https%3A%2F%2Fexample.okta.com HTTP/1.1",
+		},
+		{
+			in:   "GET / HTTP/1.1\r\nAuthorization: Bearer abc\r\nCookie: MSISAuth=abc\r\nAccept: */*\r\n",
+			want: "GET / HTTP/1.1\r\nAuthorization: [redacted]\r\nCookie: [redacted]\r\nAccept: */*\r\n",
+		},
+		{
+			in:   `<input id="passwordInput" name="Password" type="password" value=""/>`,
+			want: `<input id="passwordInput" name="Password" type="password" value=""/>`,
+		},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, RedactCredentials(tt.in))
+	}
+}
+
+func TestRequestStringRedactsPassword(t *testing.T) {
+	defer func() { contentEnabled = false }()
+	EnableContent()
+
+	form := url.Values{"UserName": {"user@example.com"}, "Password": {"hunter2"}}
+	req, err := http.NewRequest("POST", "https://adfs.example.com/adfs/ls/", strings.NewReader(form.Encode()))
+	require.Nil(t, err)
+	req.Header.Set("Cookie", "MSISSamlRequest=abc")
+
+	out := RequestString(req)
+	require.NotContains(t, out, "hunter2")
+	require.NotContains(t, out, "MSISSamlRequest")
+	require.Contains(t, out, "UserName=user%40example.com")
+}
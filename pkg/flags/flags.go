@@ -7,6 +7,7 @@ import (
 // CommonFlags flags common to all of the `saml2aws` commands (except `help`)
 type CommonFlags struct {
 	AppID                string
+	ConfigFile           string
 	ClientID             string
 	ClientSecret         string
 	IdpAccount           string
@@ -14,21 +15,40 @@ type CommonFlags struct {
 	MFA                  string
 	MFAToken             string
 	URL                  string
+	FallbackURL          string
 	Username             string
 	Password             string
+	PasswordFd           string
+	PasswordStdin        bool
 	RoleArn              string
+	TargetRoleArn        string
 	AmazonWebservicesURN string
 	SessionDuration      int
 	SkipPrompt           bool
+	PromptSingleRole     bool
 	SkipVerify           bool
 	Profile              string
 	Subdomain            string
+	TenantID             string
+	MetricsURL           string
+	MaxDisplayRoles      int
+	RoleFilter           string
+	AccountFilter        string
+	EnvPrefix            string
+	ConsoleDestination   string
+	ConsoleDuration      int
+	RefreshRoles         bool
+	SavePassword         bool
+	CredentialsOutput    string
+	CredentialsFormat    string
 }
 
 // LoginExecFlags flags for the Login / Exec commands
 type LoginExecFlags struct {
 	CommonFlags *CommonFlags
 	Force       bool
+	NoWizard    bool
+	AllRoles    bool
 }
 
 // ApplyFlagOverrides overrides IDPAccount with command line settings
@@ -41,6 +61,10 @@ func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) {
 		account.URL = commonFlags.URL
 	}
 
+	if commonFlags.FallbackURL != "" {
+		account.FallbackURL = commonFlags.FallbackURL
+	}
+
 	if commonFlags.Username != "" {
 		account.Username = commonFlags.Username
 	}
@@ -73,7 +97,59 @@ func ApplyFlagOverrides(commonFlags *CommonFlags, account *cfg.IDPAccount) {
 		account.Subdomain = commonFlags.Subdomain
 	}
 
+	if commonFlags.TenantID != "" {
+		account.TenantID = commonFlags.TenantID
+	}
+
+	if commonFlags.PromptSingleRole {
+		account.PromptSingleRole = commonFlags.PromptSingleRole
+	}
+
 	if commonFlags.RoleArn != "" {
 		account.RoleARN = commonFlags.RoleArn
 	}
+
+	if commonFlags.TargetRoleArn != "" {
+		account.TargetRoleARN = commonFlags.TargetRoleArn
+	}
+
+	if commonFlags.MetricsURL != "" {
+		account.MetricsPushgatewayURL = commonFlags.MetricsURL
+	}
+
+	if commonFlags.MaxDisplayRoles != 0 {
+		account.MaxDisplayRoles = commonFlags.MaxDisplayRoles
+	}
+
+	if commonFlags.RoleFilter != "" {
+		account.RoleFilter = commonFlags.RoleFilter
+	}
+
+	if commonFlags.AccountFilter != "" {
+		account.AccountFilter = commonFlags.AccountFilter
+	}
+
+	if commonFlags.EnvPrefix != "" {
+		account.EnvPrefix = commonFlags.EnvPrefix
+	}
+
+	if commonFlags.ConsoleDestination != "" {
+		account.ConsoleDestination = commonFlags.ConsoleDestination
+	}
+
+	if commonFlags.ConsoleDuration != 0 {
+		account.ConsoleSessionDuration = commonFlags.ConsoleDuration
+	}
+
+	if commonFlags.RefreshRoles {
+		account.RefreshRoles = commonFlags.RefreshRoles
+	}
+
+	if commonFlags.CredentialsOutput != "" {
+		account.CredentialsOutput = commonFlags.CredentialsOutput
+	}
+
+	if commonFlags.CredentialsFormat != "" {
+		account.CredentialsFormat = commonFlags.CredentialsFormat
+	}
 }
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Failure classes used as the class label of the login_last_failure_timestamp_seconds gauge
+const (
+	FailurePreLogin    = "pre_login_cmd"
+	FailureConfig      = "config"
+	FailureIdP         = "idp"
+	FailureRole        = "role"
+	FailureSTS         = "sts"
+	FailureCredentials = "credentials"
+	FailurePostLogin   = "post_login_cmd"
+)
+
+// DefaultJob the pushgateway job name metrics are grouped under
+const DefaultJob = "saml2aws"
+
+var logger = logrus.WithField("pkg", "metrics")
+
+// Login the outcome of a single login run
+type Login struct {
+	Provider     string
+	FailureClass string // empty when the login succeeded
+	Duration     time.Duration
+	Finished     time.Time // when the login finished, the zero time is now
+}
+
+// Pusher pushes login metrics to a prometheus pushgateway
+type Pusher struct {
+	URL    string
+	Job    string
+	Client *http.Client
+}
+
+// NewPusher create a pusher for the supplied pushgateway URL, an empty URL disables pushing
+func NewPusher(pushgatewayURL string) *Pusher {
+	return &Pusher{
+		URL:    strings.TrimSuffix(pushgatewayURL, "/"),
+		Job:    DefaultJob,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled returns true if a pushgateway has been configured
+func (p *Pusher) Enabled() bool {
+	return p != nil && p.URL != ""
+}
+
+// Push send the metrics for the supplied login to the pushgateway, this is a no-op when unconfigured
+//
+// The metrics are POSTed so they only replace the metrics of the same name, a failed login leaves the time of the
+// last success in place.
+func (p *Pusher) Push(login *Login) error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	pushURL := fmt.Sprintf("%s/metrics/job/%s", p.URL, p.Job)
+
+	logger.WithField("url", pushURL).Debug("pushing metrics")
+
+	req, err := http.NewRequest("POST", pushURL, bytes.NewBufferString(Encode(login)))
+	if err != nil {
+		return errors.Wrap(err, "error building metrics request")
+	}
+
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error pushing metrics")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("pushing metrics to %s failed status: %s", pushURL, res.Status)
+	}
+
+	return nil
+}
+
+// Encode render the login metrics in the prometheus text exposition format
+//
+// The pushgateway keeps the last value pushed rather than adding them up, so each metric is a gauge describing the
+// last login, or the last successful or failed one.
+func Encode(login *Login) string {
+	buf := new(bytes.Buffer)
+
+	finished := login.Finished
+	if finished.IsZero() {
+		finished = time.Now()
+	}
+
+	providerLabel := fmt.Sprintf(`provider="%s"`, escapeLabel(login.Provider))
+
+	fmt.Fprintln(buf, "# HELP login_last_duration_seconds Duration of the last saml2aws login.")
+	fmt.Fprintln(buf, "# TYPE login_last_duration_seconds gauge")
+	fmt.Fprintf(buf, "login_last_duration_seconds{%s} %g\n", providerLabel, login.Duration.Seconds())
+
+	if login.FailureClass == "" {
+		fmt.Fprintln(buf, "# HELP login_last_success_timestamp_seconds Time of the last successful saml2aws login.")
+		fmt.Fprintln(buf, "# TYPE login_last_success_timestamp_seconds gauge")
+		fmt.Fprintf(buf, "login_last_success_timestamp_seconds{%s} %d\n", providerLabel, finished.Unix())
+	} else {
+		fmt.Fprintln(buf, "# HELP login_last_failure_timestamp_seconds Time of the last failed saml2aws login.")
+		fmt.Fprintln(buf, "# TYPE login_last_failure_timestamp_seconds gauge")
+		fmt.Fprintf(buf, "login_last_failure_timestamp_seconds{%s,class=\"%s\"} %d\n", providerLabel, escapeLabel(login.FailureClass), finished.Unix())
+	}
+
+	return buf.String()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushSuccess(t *testing.T) {
+	var path, method, body string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		path, method, body = r.URL.Path, r.Method, string(data)
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	finished := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	err := NewPusher(ts.URL).Push(&Login{Provider: "Okta", Duration: 3 * time.Second, Finished: finished})
+	require.Nil(t, err)
+	require.Equal(t, "/metrics/job/saml2aws", path)
+	require.Equal(t, "POST", method)
+	require.Contains(t, body, "# TYPE login_last_duration_seconds gauge\n")
+	require.Contains(t, body, `login_last_duration_seconds{provider="Okta"} 3`)
+	require.Contains(t, body, `login_last_success_timestamp_seconds{provider="Okta"} 1791979200`)
+	require.NotContains(t, body, `login_last_failure_timestamp_seconds`)
+}
+
+func TestPushFailure(t *testing.T) {
+	var body string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(202)
+	}))
+	defer ts.Close()
+
+	err := NewPusher(ts.URL + "/").Push(&Login{Provider: "KeyCloak", FailureClass: FailureSTS, Duration: time.Second})
+	require.Nil(t, err)
+
+	// the time of the last success isn't pushed so the pushgateway keeps it
+	require.Contains(t, body, `login_last_failure_timestamp_seconds{provider="KeyCloak",class="sts"} `)
+	require.NotContains(t, body, `login_last_success_timestamp_seconds`)
+}
+
+func TestPushErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer ts.Close()
+
+	err := NewPusher(ts.URL).Push(&Login{Provider: "Okta"})
+	require.Error(t, err)
+}
+
+func TestPushUnconfigured(t *testing.T) {
+	p := NewPusher("")
+	require.False(t, p.Enabled())
+	require.Nil(t, p.Push(&Login{Provider: "Okta"}))
+}
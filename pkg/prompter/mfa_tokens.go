@@ -0,0 +1,112 @@
+package prompter
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+// ErrMFATokensExhausted returned once every code in the MFA token file has been used
+var ErrMFATokensExhausted = errors.New("no MFA codes left in the MFA token file")
+
+// mfaTokenFilesMu serialise taking codes, concurrent logins may share a token file
+var mfaTokenFilesMu sync.Mutex
+
+// MFATokenFile answers the MFA prompts of a login with codes generated ahead of time, one per line, each code is
+// removed from the file once it is used so the next login takes the next code
+type MFATokenFile struct {
+	path string
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewMFATokenFile create an MFA token file reading the codes from path
+func NewMFATokenFile(path string) *MFATokenFile {
+	return &MFATokenFile{path: path}
+}
+
+// Next take the first code from the file
+func (f *MFATokenFile) Next() (string, error) {
+	mfaTokenFilesMu.Lock()
+	code, err := f.next()
+	mfaTokenFilesMu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+
+	return code, err
+}
+
+// Err the error from the last call to Next, nil when f is nil
+func (f *MFATokenFile) Err() error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+func (f *MFATokenFile) next() (string, error) {
+	path, err := homedir.Expand(f.path)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to expand MFA token file path")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to read MFA token file")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to read MFA token file")
+	}
+
+	var codes []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			codes = append(codes, line)
+		}
+	}
+
+	if len(codes) == 0 {
+		return "", errors.Wrap(ErrMFATokensExhausted, path)
+	}
+
+	rest := ""
+	if len(codes) > 1 {
+		rest = strings.Join(codes[1:], "\n") + "\n"
+	}
+
+	err = ioutil.WriteFile(path, []byte(rest), info.Mode().Perm())
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to update MFA token file")
+	}
+
+	return codes[0], nil
+}
+
+// MFACode answer an MFA prompt with the next code from the login's token source, ask prompts for the code when there
+// is no source, an empty code is handed back once the source runs out and the error is left with the source
+func MFACode(tokens creds.MFATokenSource, ask func() string) string {
+	if tokens == nil {
+		return ask()
+	}
+
+	logger.Debug("using MFA code from mfa_token_file")
+
+	code, _ := tokens.Next()
+
+	return code
+}
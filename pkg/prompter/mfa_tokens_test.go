@@ -0,0 +1,84 @@
+package prompter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+)
+
+func TestMFATokenFileInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "codes")
+	require.Nil(t, ioutil.WriteFile(path, []byte("111111\n\n 222222\n33333333\n"), 0640))
+
+	// the user is never prompted while the file has codes
+	pr := &mocks.Prompter{}
+	defer func(p Prompter) { defaultPrompter = p }(defaultPrompter)
+	SetPrompter(pr)
+
+	tokens := NewMFATokenFile(path)
+
+	require.Equal(t, "111111", MFACode(tokens, func() string { return RequestSecurityCode("000000") }))
+	require.Equal(t, "222222", MFACode(tokens, func() string { return RequestMFACode("Enter verification code", 6) }))
+
+	// the remaining code is left for the next login, and the file keeps its mode
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "33333333\n", string(data))
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	require.Equal(t, "33333333", MFACode(tokens, func() string { return RequestSecurityCodeLength(8) }))
+	require.Nil(t, tokens.Err())
+
+	pr.Mock.AssertNotCalled(t, "RequestSecurityCode", "000000")
+	pr.Mock.AssertNotCalled(t, "StringRequired", "Enter verification code")
+}
+
+func TestMFATokenFileExhausted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "codes")
+	require.Nil(t, ioutil.WriteFile(path, []byte("111111\n"), 0600))
+
+	tokens := NewMFATokenFile(path)
+	prompt := func() string { return RequestSecurityCodeLength(6) }
+
+	require.Equal(t, "111111", MFACode(tokens, prompt))
+	require.Equal(t, "", MFACode(tokens, prompt))
+
+	err = tokens.Err()
+	require.Error(t, err)
+	require.Equal(t, ErrMFATokensExhausted, errors.Cause(err))
+
+	// a missing file is reported rather than prompting
+	tokens = NewMFATokenFile(filepath.Join(dir, "missing"))
+	require.Equal(t, "", MFACode(tokens, prompt))
+	require.Error(t, tokens.Err())
+}
+
+func TestMFACodeWithoutTokens(t *testing.T) {
+	pr := &mocks.Prompter{}
+	defer func(p Prompter) { defaultPrompter = p }(defaultPrompter)
+	SetPrompter(pr)
+
+	pr.Mock.On("StringRequired", "Enter passcode").Return("123456")
+
+	// a login without a token file prompts, and no error is left behind
+	require.Equal(t, "123456", MFACode(nil, func() string { return StringRequired("Enter passcode") }))
+
+	var tokens *MFATokenFile
+	require.Nil(t, tokens.Err())
+}
@@ -0,0 +1,88 @@
+package prompter
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPromptRequired returned when input is needed but prompting has been turned off with --skip-prompt
+var ErrPromptRequired = errors.New("input required but prompting is disabled")
+
+// NonInteractive a prompter for unattended logins which never waits for input, every prompt records
+// ErrPromptRequired and answers with nothing so the login fails instead of hanging
+type NonInteractive struct {
+	mu  sync.Mutex
+	err error
+}
+
+// NewNonInteractive create a prompter which refuses to prompt
+func NewNonInteractive() *NonInteractive {
+	return &NonInteractive{}
+}
+
+// Err the error from the first prompt which was refused, nil when there wasn't one
+func (ni *NonInteractive) Err() error {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+
+	return ni.err
+}
+
+func (ni *NonInteractive) refuse(pr string) error {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+
+	logger.WithField("prompt", pr).Debug("refusing to prompt")
+
+	err := errors.Wrapf(ErrPromptRequired, "%s", pr)
+	if ni.err == nil {
+		ni.err = err
+	}
+
+	return err
+}
+
+// RequestSecurityCode refuse to prompt for the security code
+func (ni *NonInteractive) RequestSecurityCode(pattern string) string {
+	_ = ni.refuse("security code")
+	return ""
+}
+
+// ChooseWithDefault refuse to prompt for the choice
+func (ni *NonInteractive) ChooseWithDefault(pr string, defaultValue string, options []string) (string, error) {
+	return "", ni.refuse(pr)
+}
+
+// Choose refuse to prompt for the choice, -1 is returned so no option is picked
+func (ni *NonInteractive) Choose(pr string, options []string) int {
+	_ = ni.refuse(pr)
+	return -1
+}
+
+// StringRequired refuse to prompt for the string
+func (ni *NonInteractive) StringRequired(pr string) string {
+	_ = ni.refuse(pr)
+	return ""
+}
+
+// String refuse to prompt for the string, the default is returned
+func (ni *NonInteractive) String(pr string, defaultValue string) string {
+	_ = ni.refuse(pr)
+	return defaultValue
+}
+
+// Password refuse to prompt for the password
+func (ni *NonInteractive) Password(pr string) string {
+	_ = ni.refuse(pr)
+	return ""
+}
+
+// PromptErr the error from the first prompt refused by the non interactive prompter, nil when prompting is allowed
+func PromptErr() error {
+	if ni, ok := defaultPrompter.(*NonInteractive); ok {
+		return ni.Err()
+	}
+
+	return nil
+}
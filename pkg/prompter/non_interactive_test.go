@@ -0,0 +1,31 @@
+package prompter
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonInteractive(t *testing.T) {
+	defer SetPrompter(defaultPrompter)
+
+	require.Nil(t, PromptErr())
+
+	ni := NewNonInteractive()
+	SetPrompter(ni)
+
+	require.Nil(t, PromptErr())
+
+	// malformed codes aren't prompted for again
+	require.Equal(t, "", RequestSecurityCodeLength(6))
+	require.Equal(t, "default", String("Enter value", "default"))
+
+	require.Equal(t, -1, Choose("Select which MFA option to use", []string{"a", "b"}))
+
+	_, err := ChooseWithDefault("Please choose the role", "", []string{"a", "b"})
+	require.Equal(t, ErrPromptRequired, errors.Cause(err))
+
+	// the first refused prompt is kept
+	require.EqualError(t, PromptErr(), "security code: input required but prompting is disabled")
+}
@@ -1,5 +1,17 @@
 package prompter
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("pkg", "prompter")
+
+// maxMFACodeAttempts the number of malformed MFA codes accepted before the last one is submitted anyway
+const maxMFACodeAttempts = 3
+
 var defaultPrompter Prompter = NewCli()
 
 // Prompter handles prompting user for input
@@ -12,13 +24,19 @@ type Prompter interface {
 	Password(string) string
 }
 
-// SetPrompter configure an aternate prompter to the default one
-func SetPrompter(prmpt Prompter) {
+// SetPrompter configure an aternate prompter to the default one, the prompter it replaces is returned so it can be
+// restored
+func SetPrompter(prmpt Prompter) Prompter {
+	previous := defaultPrompter
 	defaultPrompter = prmpt
+
+	return previous
 }
 
 // RequestSecurityCode request a security code to be entered by the user
 func RequestSecurityCode(pattern string) string {
+	logger.Debug("prompting for MFA code")
+
 	return defaultPrompter.RequestSecurityCode(pattern)
 }
 
@@ -27,7 +45,7 @@ func ChooseWithDefault(pr string, defaultValue string, options []string) (string
 	return defaultPrompter.ChooseWithDefault(pr, defaultValue, options)
 }
 
-// Choose given the choice return the option selected
+// Choose given the choice return the option selected, this is negative when no option was chosen
 func Choose(pr string, options []string) int {
 	return defaultPrompter.Choose(pr, options)
 }
@@ -46,3 +64,57 @@ func String(pr string, defaultValue string) string {
 func Password(pr string) string {
 	return defaultPrompter.Password(pr)
 }
+
+// RequestSecurityCodeLength request a security code, prompting again until it is length digits
+func RequestSecurityCodeLength(length int) string {
+	logger.Debug("prompting for MFA code")
+
+	pattern := "000000"
+	if length > 0 {
+		pattern = strings.Repeat("0", length)
+	}
+
+	return requestMFACode(func() string { return defaultPrompter.RequestSecurityCode(pattern) }, length)
+}
+
+// RequestMFACode prompt for a numeric MFA code, prompting again until it is length digits
+func RequestMFACode(pr string, length int) string {
+	logger.Debug("prompting for MFA code")
+
+	return requestMFACode(func() string { return defaultPrompter.StringRequired(pr) }, length)
+}
+
+// ValidMFACode true when the code is length digits, any code is valid when length isn't positive
+func ValidMFACode(code string, length int) bool {
+	if length <= 0 {
+		return true
+	}
+
+	if len(code) != length {
+		return false
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func requestMFACode(ask func() string, length int) string {
+	var code string
+
+	for attempt := 1; attempt <= maxMFACodeAttempts; attempt++ {
+		code = strings.TrimSpace(ask())
+		if ValidMFACode(code, length) || PromptErr() != nil {
+			return code
+		}
+
+		fmt.Printf("MFA code must be %d digits\n", length)
+	}
+
+	// leave the IdP to reject it rather than prompting forever
+	return code
+}
@@ -0,0 +1,48 @@
+package prompter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+)
+
+func TestRequestMFACodeReprompt(t *testing.T) {
+	pr := &mocks.Prompter{}
+	SetPrompter(pr)
+
+	pr.Mock.On("StringRequired", "Enter verification code").Return("12345").Once()
+	pr.Mock.On("StringRequired", "Enter verification code").Return("12a456").Once()
+	pr.Mock.On("StringRequired", "Enter verification code").Return("123456").Once()
+
+	require.Equal(t, "123456", RequestMFACode("Enter verification code", 6))
+	pr.Mock.AssertNumberOfCalls(t, "StringRequired", 3)
+}
+
+func TestRequestMFACodeValid(t *testing.T) {
+	pr := &mocks.Prompter{}
+	SetPrompter(pr)
+
+	pr.Mock.On("RequestSecurityCode", "00000000").Return(" 12345678 ").Once()
+
+	require.Equal(t, "12345678", RequestSecurityCodeLength(8))
+	pr.Mock.AssertNumberOfCalls(t, "RequestSecurityCode", 1)
+}
+
+func TestRequestMFACodeGivesUp(t *testing.T) {
+	pr := &mocks.Prompter{}
+	SetPrompter(pr)
+
+	pr.Mock.On("StringRequired", "Enter passcode").Return("123")
+
+	// the last entry is handed back for the IdP to reject
+	require.Equal(t, "123", RequestMFACode("Enter passcode", 6))
+	pr.Mock.AssertNumberOfCalls(t, "StringRequired", maxMFACodeAttempts)
+}
+
+func TestValidMFACode(t *testing.T) {
+	require.True(t, ValidMFACode("123456", 6))
+	require.False(t, ValidMFACode("12345", 6))
+	require.False(t, ValidMFACode("12345a", 6))
+	require.True(t, ValidMFACode("push", 0))
+}
@@ -0,0 +1,502 @@
+package aad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+var logger = logrus.WithField("provider", "aad")
+
+const (
+	// MFAPush approve the sign in with a notification to the Microsoft Authenticator app
+	MFAPush = "PUSH"
+	// MFATotp enter a code from the Microsoft Authenticator app, or another authenticator app
+	MFATotp = "TOTP"
+	// MFASms enter a code sent by text message
+	MFASms = "SMS"
+)
+
+// authMethodIDs the Azure AD authentication method of each MFA option
+var authMethodIDs = map[string]string{
+	MFAPush: "PhoneAppNotification",
+	MFATotp: "PhoneAppOTP",
+	MFASms:  "OneWaySMS",
+}
+
+const (
+	// maxLoginSteps the maximum number of pages followed before giving up on the login
+	maxLoginSteps = 20
+
+	// maxMFAPolls the maximum number of times an unanswered push notification is checked
+	maxMFAPolls = 60
+
+	pageSignIn      = "ConvergedSignIn"
+	pageMFA         = "ConvergedTFA"
+	pageKMSI        = "KmsiInterrupt"
+	pageProofUp     = "ConvergedProofUpRedirect"
+	authPending     = "AuthenticationPending"
+	processAuthType = "22"
+)
+
+// mfaPollInterval how long to wait between checks of an unanswered push notification
+var mfaPollInterval = time.Second
+
+// configPattern the $Config object the login.microsoftonline.com pages are driven by
+var configPattern = regexp.MustCompile(`\$Config=(\{.*\});`)
+
+// Client wrapper around Azure AD enabling authentication and retrieval of assertions
+type Client struct {
+	client        *provider.HTTPClient
+	mfa           string
+	mfaCodeLength int
+	mfaTimeout    time.Duration
+	mfaTokens     creds.MFATokenSource
+}
+
+// loginConfig the parts of the $Config object used to drive the login
+type loginConfig struct {
+	PageID                 string      `json:"pgid"`
+	URLPost                string      `json:"urlPost"`
+	URLBeginAuth           string      `json:"urlBeginAuth"`
+	URLEndAuth             string      `json:"urlEndAuth"`
+	URLSkipMfaRegistration string      `json:"urlSkipMfaRegistration"`
+	FlowToken              string      `json:"sFT"`
+	Ctx                    string      `json:"sCtx"`
+	Canary                 string      `json:"canary"`
+	ErrorCode              string      `json:"sErrorCode"`
+	ErrorText              string      `json:"sErrTxt"`
+	UserProofs             []userProof `json:"arrUserProofs"`
+}
+
+// userProof an MFA method the user has registered
+type userProof struct {
+	AuthMethodID string `json:"authMethodId"`
+	Display      string `json:"display"`
+	IsDefault    bool   `json:"isDefault"`
+}
+
+// mfaRequest the body of the BeginAuth and EndAuth requests
+type mfaRequest struct {
+	AuthMethodID       string `json:"AuthMethodId"`
+	Method             string `json:"Method"`
+	Ctx                string `json:"Ctx"`
+	FlowToken          string `json:"FlowToken"`
+	SessionID          string `json:"SessionId,omitempty"`
+	AdditionalAuthData string `json:"AdditionalAuthData,omitempty"`
+	PollCount          int    `json:"PollCount,omitempty"`
+}
+
+// mfaResponse the result of the BeginAuth and EndAuth requests
+type mfaResponse struct {
+	Success     bool   `json:"Success"`
+	ResultValue string `json:"ResultValue"`
+	Message     string `json:"Message"`
+	Ctx         string `json:"Ctx"`
+	FlowToken   string `json:"FlowToken"`
+	SessionID   string `json:"SessionId"`
+	Entropy     int    `json:"Entropy"`
+}
+
+// New create a new Azure AD client
+func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+
+	tr := provider.NewTransport(idpAccount)
+
+	client, err := provider.NewHTTPClient(tr, idpAccount)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building http client")
+	}
+
+	return &Client{
+		client:        client,
+		mfa:           idpAccount.MFA,
+		mfaCodeLength: idpAccount.MFACodeLength,
+		mfaTimeout:    time.Duration(idpAccount.MFATimeout) * time.Second,
+	}, nil
+}
+
+// Authenticate logs into Azure AD and returns a SAML response
+//
+// The login starts at the user access URL of the AWS application and follows the sign in, MFA and stay signed in
+// pages, along with the forms conditional access and federation redirects submit, until the assertion is posted.
+func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+
+	ac.mfaTokens = loginDetails.MFATokens
+
+	res, err := ac.client.Get(loginDetails.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving login page")
+	}
+
+	signedIn := false
+
+	for step := 0; step < maxLoginSteps; step++ {
+		pageURL := res.Request.URL
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return "", errors.Wrap(err, "error reading login page")
+		}
+
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return "", errors.Wrap(err, "error parsing login page")
+		}
+
+		if samlAssertion, ok := doc.Find(`input[name="SAMLResponse"]`).Attr("value"); ok {
+			return samlAssertion, nil
+		}
+
+		config, ok, err := parseConfig(body)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			// conditional access and federation redirects are forms which the browser submits automatically
+			res, err = ac.submitForm(pageURL, doc)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if config.ErrorCode != "" {
+			return "", errors.Errorf("login failed, Azure AD error %s: %s", config.ErrorCode, config.ErrorText)
+		}
+
+		logger.WithField("page", config.PageID).Debug("login page")
+
+		switch config.PageID {
+		case pageSignIn:
+			if signedIn {
+				return "", errors.New("login failed, Azure AD asked for the username and password again")
+			}
+			signedIn = true
+			res, err = ac.postCredentials(pageURL, config, loginDetails)
+		case pageMFA:
+			res, err = ac.verifyMFA(pageURL, config, loginDetails)
+		case pageKMSI:
+			res, err = ac.postKMSI(pageURL, config)
+		case pageProofUp:
+			if config.URLSkipMfaRegistration == "" {
+				return "", errors.New("Azure AD requires MFA to be registered, sign in with a browser to register it")
+			}
+			res, err = ac.client.Get(resolveURL(pageURL, config.URLSkipMfaRegistration))
+		default:
+			return "", errors.Errorf("unsupported Azure AD page: %s", config.PageID)
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", errors.New("too many pages followed without receiving a SAML response")
+}
+
+func (ac *Client) postCredentials(pageURL *url.URL, config *loginConfig, loginDetails *creds.LoginDetails) (*http.Response, error) {
+	form := url.Values{
+		"login":     {loginDetails.Username},
+		"loginfmt":  {loginDetails.Username},
+		"passwd":    {loginDetails.Password},
+		"ctx":       {config.Ctx},
+		"flowToken": {config.FlowToken},
+		"canary":    {config.Canary},
+	}
+
+	res, err := ac.client.PostForm(resolveURL(pageURL, config.URLPost), form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error submitting login form")
+	}
+
+	return res, nil
+}
+
+// postKMSI decline to stay signed in, the session cookies aren't kept between logins
+func (ac *Client) postKMSI(pageURL *url.URL, config *loginConfig) (*http.Response, error) {
+	form := url.Values{
+		"LoginOptions": {"0"},
+		"ctx":          {config.Ctx},
+		"flowToken":    {config.FlowToken},
+		"canary":       {config.Canary},
+	}
+
+	res, err := ac.client.PostForm(resolveURL(pageURL, config.URLPost), form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error submitting stay signed in form")
+	}
+
+	return res, nil
+}
+
+// verifyMFA complete the MFA challenge with the method selected by the account, approving a push notification or
+// submitting a code
+func (ac *Client) verifyMFA(pageURL *url.URL, config *loginConfig, loginDetails *creds.LoginDetails) (*http.Response, error) {
+
+	proof, err := ac.selectProof(config.UserProofs)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithField("method", proof.AuthMethodID).Debug("mfa")
+
+	begin, err := ac.postMFA(resolveURL(pageURL, config.URLBeginAuth), &mfaRequest{
+		AuthMethodID: proof.AuthMethodID,
+		Method:       "BeginAuth",
+		Ctx:          config.Ctx,
+		FlowToken:    config.FlowToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !begin.Success {
+		return nil, errors.Errorf("error starting mfa: %s", begin.Message)
+	}
+
+	end := &mfaRequest{
+		AuthMethodID: proof.AuthMethodID,
+		Method:       "EndAuth",
+		Ctx:          begin.Ctx,
+		FlowToken:    begin.FlowToken,
+		SessionID:    begin.SessionID,
+	}
+
+	var result *mfaResponse
+
+	if proof.AuthMethodID == authMethodIDs[MFAPush] {
+		result, err = ac.waitForPush(resolveURL(pageURL, config.URLEndAuth), end, begin.Entropy)
+	} else {
+		result, err = ac.submitCode(resolveURL(pageURL, config.URLEndAuth), end, loginDetails.MFAToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"type":          {processAuthType},
+		"request":       {result.Ctx},
+		"flowToken":     {result.FlowToken},
+		"mfaAuthMethod": {proof.AuthMethodID},
+		"canary":        {config.Canary},
+		"login":         {loginDetails.Username},
+	}
+
+	if end.AdditionalAuthData != "" {
+		form.Set("otc", end.AdditionalAuthData)
+	}
+
+	res, err := ac.client.PostForm(resolveURL(pageURL, config.URLPost), form)
+	if err != nil {
+		return nil, errors.Wrap(err, "error submitting mfa result")
+	}
+
+	return res, nil
+}
+
+// selectProof the registered MFA method matching the account's mfa setting, Auto uses the user's default method
+func (ac *Client) selectProof(proofs []userProof) (*userProof, error) {
+	if len(proofs) == 0 {
+		return nil, errors.New("no MFA methods are registered for the user")
+	}
+
+	if ac.mfa == "" || ac.mfa == "Auto" {
+		for i := range proofs {
+			if proofs[i].IsDefault {
+				return &proofs[i], nil
+			}
+		}
+
+		return &proofs[0], nil
+	}
+
+	authMethodID := authMethodIDs[ac.mfa]
+	for i := range proofs {
+		if proofs[i].AuthMethodID == authMethodID {
+			return &proofs[i], nil
+		}
+	}
+
+	return nil, errors.Errorf("MFA %s isn't registered for the user", ac.mfa)
+}
+
+// waitForPush poll until the push notification is approved or rejected, giving up after maxMFAPolls or mfa_timeout
+func (ac *Client) waitForPush(endAuthURL string, end *mfaRequest, entropy int) (*mfaResponse, error) {
+	if entropy != 0 {
+		fmt.Printf("Enter %d in the Microsoft Authenticator app to approve the sign in\n", entropy)
+	} else {
+		fmt.Println("Waiting for approval, please check the Microsoft Authenticator app ...")
+	}
+
+	started := time.Now()
+
+	for poll := 1; poll <= maxMFAPolls; poll++ {
+		if ac.mfaTimeout > 0 && time.Since(started) > ac.mfaTimeout {
+			break
+		}
+
+		end.PollCount = poll
+
+		result, err := ac.postMFA(endAuthURL, end)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Success {
+			return result, nil
+		}
+
+		if result.ResultValue != authPending {
+			return nil, errors.Errorf("mfa rejected: %s", mfaMessage(result))
+		}
+
+		time.Sleep(mfaPollInterval)
+	}
+
+	return nil, errors.New("timed out waiting for the mfa push notification to be approved")
+}
+
+// submitCode submit the code from the authenticator app or text message
+func (ac *Client) submitCode(endAuthURL string, end *mfaRequest, mfaToken string) (*mfaResponse, error) {
+	if mfaToken == "" {
+		mfaToken = prompter.MFACode(ac.mfaTokens, func() string { return prompter.RequestMFACode("Enter verification code", ac.mfaCodeLength) })
+	}
+
+	end.AdditionalAuthData = mfaToken
+
+	result, err := ac.postMFA(endAuthURL, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Success {
+		return nil, errors.Errorf("mfa code rejected: %s", mfaMessage(result))
+	}
+
+	return result, nil
+}
+
+func (ac *Client) postMFA(mfaURL string, mfaReq *mfaRequest) (*mfaResponse, error) {
+	data, err := json.Marshal(mfaReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building mfa request")
+	}
+
+	req, err := http.NewRequest("POST", mfaURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building mfa request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending mfa request")
+	}
+	defer res.Body.Close()
+
+	result := new(mfaResponse)
+
+	err = json.NewDecoder(res.Body).Decode(result)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding mfa response")
+	}
+
+	return result, nil
+}
+
+// submitForm submit the first form on the page the way the browser's auto-submit would
+func (ac *Client) submitForm(pageURL *url.URL, doc *goquery.Document) (*http.Response, error) {
+	form := doc.Find("form").First()
+	if form.Length() == 0 {
+		return nil, errors.New("unexpected page, no form or Azure AD config found")
+	}
+
+	action, _ := form.Attr("action")
+
+	values := url.Values{}
+	form.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		value, _ := s.Attr("value")
+		values.Add(name, value)
+	})
+
+	formURL := resolveURL(pageURL, action)
+
+	logger.WithField("url", formURL).Debug("submitting form")
+
+	if method, _ := form.Attr("method"); strings.EqualFold(method, "GET") {
+		u, err := url.Parse(formURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing form action")
+		}
+		u.RawQuery = values.Encode()
+
+		res, err := ac.client.Get(u.String())
+		if err != nil {
+			return nil, errors.Wrap(err, "error submitting form")
+		}
+		return res, nil
+	}
+
+	res, err := ac.client.PostForm(formURL, values)
+	if err != nil {
+		return nil, errors.Wrap(err, "error submitting form")
+	}
+
+	return res, nil
+}
+
+// parseConfig extract the $Config object from the page, false if the page doesn't have one
+func parseConfig(body []byte) (*loginConfig, bool, error) {
+	match := configPattern.FindSubmatch(body)
+	if match == nil {
+		return nil, false, nil
+	}
+
+	config := new(loginConfig)
+
+	err := json.Unmarshal(match[1], config)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error parsing Azure AD config")
+	}
+
+	return config, true, nil
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return base.ResolveReference(u).String()
+}
+
+func mfaMessage(result *mfaResponse) string {
+	if result.Message != "" {
+		return result.Message
+	}
+
+	return result.ResultValue
+}
@@ -0,0 +1,284 @@
+package aad
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const testSAMLResponse = "PHNhbWxwOlJlc3BvbnNlLz4="
+
+// configPage a login.microsoftonline.com page driven by the config
+func configPage(config map[string]interface{}) string {
+	data, _ := json.Marshal(config)
+	return fmt.Sprintf("<html><head><script type=\"text/javascript\">//<![CDATA[\n$Config=%s;\n//]]></script></head><body></body></html>", data)
+}
+
+// beginAuth the BeginAuth response of a push notification without number matching
+var beginAuth = mfaResponse{Success: true, SessionID: "session", Ctx: "ctx3", FlowToken: "ft3"}
+
+// newAzureAD a fake Azure AD which signs the user in, asks for MFA and to stay signed in, and then redirects through
+// a conditional access form before posting the assertion
+func newAzureAD(t *testing.T, proofs []map[string]interface{}, endAuth func(req mfaRequest) mfaResponse) (*httptest.Server, *[]string) {
+	return newAzureADWithBeginAuth(t, proofs, beginAuth, endAuth)
+}
+
+// newAzureADWithBeginAuth a fake Azure AD answering BeginAuth with begin, for example a number matching challenge
+func newAzureADWithBeginAuth(t *testing.T, proofs []map[string]interface{}, begin mfaResponse, endAuth func(req mfaRequest) mfaResponse) (*httptest.Server, *[]string) {
+	var steps []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "start")
+		http.Redirect(w, r, "/common/oauth2/authorize", http.StatusFound)
+	})
+	mux.HandleFunc("/common/oauth2/authorize", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(configPage(map[string]interface{}{
+			"pgid": "ConvergedSignIn", "urlPost": "/common/login", "sFT": "ft1", "sCtx": "ctx1", "canary": "canary1",
+		})))
+	})
+	mux.HandleFunc("/common/login", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "login")
+		require.Equal(t, "user@example.com", r.PostFormValue("loginfmt"))
+		require.Equal(t, "ft1", r.PostFormValue("flowToken"))
+
+		if r.PostFormValue("passwd") != "secret" {
+			w.Write([]byte(configPage(map[string]interface{}{
+				"pgid": "ConvergedSignIn", "urlPost": "/common/login", "sErrorCode": "50126", "sErrTxt": "Your account or password is incorrect.",
+			})))
+			return
+		}
+
+		w.Write([]byte(configPage(map[string]interface{}{
+			"pgid": "ConvergedTFA", "urlPost": "/common/SAS/ProcessAuth", "urlBeginAuth": "/common/SAS/BeginAuth",
+			"urlEndAuth": "/common/SAS/EndAuth", "sFT": "ft2", "sCtx": "ctx2", "canary": "canary2", "arrUserProofs": proofs,
+		})))
+	})
+	mux.HandleFunc("/common/SAS/BeginAuth", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "begin")
+		var req mfaRequest
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "ft2", req.FlowToken)
+
+		json.NewEncoder(w).Encode(begin)
+	})
+	mux.HandleFunc("/common/SAS/EndAuth", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "end")
+		var req mfaRequest
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "session", req.SessionID)
+
+		json.NewEncoder(w).Encode(endAuth(req))
+	})
+	mux.HandleFunc("/common/SAS/ProcessAuth", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "process")
+		require.Equal(t, "ft4", r.PostFormValue("flowToken"))
+
+		w.Write([]byte(configPage(map[string]interface{}{
+			"pgid": "KmsiInterrupt", "urlPost": "/kmsi", "sFT": "ft5", "sCtx": "ctx5",
+		})))
+	})
+	mux.HandleFunc("/kmsi", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "kmsi")
+		require.Equal(t, "0", r.PostFormValue("LoginOptions"))
+
+		w.Write([]byte(`<html><body onload="document.forms[0].submit()"><form method="POST" name="hiddenform" action="/conditional-access">
+<input type="hidden" name="code" value="abc"/></form></body></html>`))
+	})
+	mux.HandleFunc("/conditional-access", func(w http.ResponseWriter, r *http.Request) {
+		steps = append(steps, "conditional-access")
+		require.Equal(t, "abc", r.PostFormValue("code"))
+
+		w.Write([]byte(`<html><body><form method="POST" action="https://signin.aws.amazon.com/saml">
+<input type="hidden" name="SAMLResponse" value="` + testSAMLResponse + `"/></form></body></html>`))
+	})
+
+	return httptest.NewServer(mux), &steps
+}
+
+// captureStdout run fn returning anything it wrote to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.Nil(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+
+	return string(out)
+}
+
+func newTestClient(t *testing.T, mfa string) *Client {
+	client, err := provider.NewHTTPClient(http.DefaultTransport, cfg.NewIDPAccount())
+	require.Nil(t, err)
+
+	return &Client{client: client, mfa: mfa}
+}
+
+func TestAuthenticatePush(t *testing.T) {
+	defer func(interval time.Duration) { mfaPollInterval = interval }(mfaPollInterval)
+	mfaPollInterval = time.Millisecond
+
+	polls := 0
+	proofs := []map[string]interface{}{
+		{"authMethodId": "PhoneAppOTP"},
+		{"authMethodId": "PhoneAppNotification", "isDefault": true},
+	}
+
+	ts, steps := newAzureAD(t, proofs, func(req mfaRequest) mfaResponse {
+		require.Equal(t, "PhoneAppNotification", req.AuthMethodID)
+
+		polls++
+		if polls < 3 {
+			return mfaResponse{ResultValue: authPending}
+		}
+		return mfaResponse{Success: true, Ctx: "ctx4", FlowToken: "ft4"}
+	})
+	defer ts.Close()
+
+	ac := newTestClient(t, "Auto")
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret"}
+
+	samlAssertion, err := ac.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, testSAMLResponse, samlAssertion)
+	require.Equal(t, 3, polls)
+	require.Equal(t, []string{"start", "login", "begin", "end", "end", "end", "process", "kmsi", "conditional-access"}, *steps)
+}
+
+func TestAuthenticatePushNumberMatching(t *testing.T) {
+	defer func(interval time.Duration) { mfaPollInterval = interval }(mfaPollInterval)
+	mfaPollInterval = time.Millisecond
+
+	data, err := ioutil.ReadFile("example/beginauth_number_matching.json")
+	require.Nil(t, err)
+
+	var begin mfaResponse
+	require.Nil(t, json.Unmarshal(data, &begin))
+
+	polls := 0
+	proofs := []map[string]interface{}{{"authMethodId": "PhoneAppNotification", "isDefault": true}}
+
+	ts, steps := newAzureADWithBeginAuth(t, proofs, begin, func(req mfaRequest) mfaResponse {
+		polls++
+		if polls < 2 {
+			return mfaResponse{ResultValue: authPending}
+		}
+		return mfaResponse{Success: true, Ctx: "ctx4", FlowToken: "ft4"}
+	})
+	defer ts.Close()
+
+	ac := newTestClient(t, MFAPush)
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret"}
+
+	var samlAssertion string
+
+	out := captureStdout(t, func() {
+		samlAssertion, err = ac.Authenticate(loginDetails)
+	})
+
+	// the number to enter is shown and polling carries on until the sign in is approved
+	require.Contains(t, out, "Enter 42 in the Microsoft Authenticator app")
+	require.Nil(t, err)
+	require.Equal(t, testSAMLResponse, samlAssertion)
+	require.Equal(t, []string{"start", "login", "begin", "end", "end", "process", "kmsi", "conditional-access"}, *steps)
+}
+
+func TestAuthenticatePushTimeout(t *testing.T) {
+	defer func(interval time.Duration) { mfaPollInterval = interval }(mfaPollInterval)
+	mfaPollInterval = 10 * time.Millisecond
+
+	proofs := []map[string]interface{}{{"authMethodId": "PhoneAppNotification", "isDefault": true}}
+
+	ts, _ := newAzureAD(t, proofs, func(req mfaRequest) mfaResponse {
+		return mfaResponse{ResultValue: authPending}
+	})
+	defer ts.Close()
+
+	ac := newTestClient(t, MFAPush)
+	ac.mfaTimeout = 50 * time.Millisecond
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret"}
+
+	_, err := ac.Authenticate(loginDetails)
+	require.EqualError(t, err, "timed out waiting for the mfa push notification to be approved")
+}
+
+func TestAuthenticateTOTP(t *testing.T) {
+	proofs := []map[string]interface{}{
+		{"authMethodId": "PhoneAppNotification", "isDefault": true},
+		{"authMethodId": "PhoneAppOTP"},
+	}
+
+	ts, _ := newAzureAD(t, proofs, func(req mfaRequest) mfaResponse {
+		require.Equal(t, "PhoneAppOTP", req.AuthMethodID)
+		require.Equal(t, "123456", req.AdditionalAuthData)
+
+		return mfaResponse{Success: true, Ctx: "ctx4", FlowToken: "ft4"}
+	})
+	defer ts.Close()
+
+	ac := newTestClient(t, MFATotp)
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret", MFAToken: "123456"}
+
+	samlAssertion, err := ac.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, testSAMLResponse, samlAssertion)
+}
+
+func TestAuthenticateMFARejected(t *testing.T) {
+	proofs := []map[string]interface{}{{"authMethodId": "PhoneAppNotification", "isDefault": true}}
+
+	ts, _ := newAzureAD(t, proofs, func(req mfaRequest) mfaResponse {
+		return mfaResponse{ResultValue: "PhoneAppDenied", Message: "The sign in was denied."}
+	})
+	defer ts.Close()
+
+	ac := newTestClient(t, MFAPush)
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "secret"}
+
+	_, err := ac.Authenticate(loginDetails)
+	require.EqualError(t, err, "mfa rejected: The sign in was denied.")
+}
+
+func TestAuthenticateBadPassword(t *testing.T) {
+	ts, _ := newAzureAD(t, nil, nil)
+	defer ts.Close()
+
+	ac := newTestClient(t, "Auto")
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "user@example.com", Password: "wrong"}
+
+	_, err := ac.Authenticate(loginDetails)
+	require.EqualError(t, err, "login failed, Azure AD error 50126: Your account or password is incorrect.")
+}
+
+func TestSelectProof(t *testing.T) {
+	proofs := []userProof{{AuthMethodID: "OneWaySMS"}, {AuthMethodID: "PhoneAppOTP", IsDefault: true}}
+
+	proof, err := (&Client{mfa: "Auto"}).selectProof(proofs)
+	require.Nil(t, err)
+	require.Equal(t, "PhoneAppOTP", proof.AuthMethodID)
+
+	proof, err = (&Client{mfa: MFASms}).selectProof(proofs)
+	require.Nil(t, err)
+	require.Equal(t, "OneWaySMS", proof.AuthMethodID)
+
+	_, err = (&Client{mfa: MFAPush}).selectProof(proofs)
+	require.EqualError(t, err, "MFA PUSH isn't registered for the user")
+}
@@ -1,12 +1,16 @@
 package adfs
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
@@ -23,51 +27,127 @@ var logger = logrus.WithField("provider", "adfs")
 type Client struct {
 	client     *provider.HTTPClient
 	idpAccount *cfg.IDPAccount
+	cache      *provider.EndpointCache // nil unless cache_endpoints is enabled
+	mfaTokens  creds.MFATokenSource
 }
 
 // New create a new ADFS client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := &http.Transport{
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
-	}
+	tr := provider.NewTransport(idpAccount)
+	tr.TLSClientConfig.Renegotiation = tls.RenegotiateFreelyAsClient
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
 
+	var cache *provider.EndpointCache
+	if idpAccount.CacheEndpoints {
+		cache = provider.NewEndpointCache(provider.DefaultEndpointCachePath, time.Duration(idpAccount.CacheEndpointsTTL)*time.Second)
+	}
+
 	return &Client{
 		client:     client,
 		idpAccount: idpAccount,
+		cache:      cache,
 	}, nil
 }
 
 // Authenticate authenticate to ADFS and return the data from the body of the SAML assertion.
 func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
 
-	var authSubmitURL string
+	ac.mfaTokens = loginDetails.MFATokens
+
 	var samlAssertion string
 
 	adfsURL := fmt.Sprintf("%s/adfs/ls/IdpInitiatedSignOn.aspx?loginToRp=%s", loginDetails.URL, ac.idpAccount.AmazonWebservicesURN)
 
+	authSubmitURL, res, err := ac.submitLoginForm(adfsURL, loginDetails)
+	if err != nil {
+		return samlAssertion, err
+	}
+
+	logger.WithField("authSubmitURL", authSubmitURL).Debug("submitted login form")
+
+	// just parse the response whether res is from the login form or MFA form
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return samlAssertion, errors.Wrap(err, "error retrieving login response body")
+	}
+
+	doc, err = ac.adapterMFA(authSubmitURL, loginDetails.MFAToken, doc)
+	if err != nil {
+		return samlAssertion, errors.Wrap(err, "error retrieving mfa form results")
+	}
+
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		if name == "SAMLResponse" {
+			val, ok := s.Attr("value")
+			if !ok {
+				log.Fatalf("unable to locate saml assertion value")
+			}
+			samlAssertion = val
+		}
+	})
+
+	if samlAssertion == "" {
+		logger.Debug("login response did not contain a SAML assertion")
+	} else {
+		logger.WithField("bytes", len(samlAssertion)).Debug("extracted SAML assertion")
+	}
+
+	return samlAssertion, nil
+}
+
+// submitLoginForm post the login form, when endpoint caching is enabled the cached form is posted
+// directly and the login page is only fetched if there is no cached form or posting it fails
+func (ac *Client) submitLoginForm(adfsURL string, loginDetails *creds.LoginDetails) (string, *http.Response, error) {
+
+	if ac.cache != nil {
+		if endpoint, ok := ac.cache.Get(adfsURL); ok {
+			res, err := ac.postLoginForm(endpoint.Action, fillCachedForm(endpoint.Fields, loginDetails))
+			if err == nil && res.StatusCode < 400 && !containsLoginForm(res, endpoint.Fields) {
+				return endpoint.Action, res, nil
+			}
+
+			// the form is fetched again so this response isn't used
+			if err == nil {
+				res.Body.Close()
+			}
+
+			logger.WithError(err).Debug("cached login endpoint failed, rediscovering")
+
+			_ = ac.cache.Delete(adfsURL)
+		}
+	}
+
+	logger.WithField("url", adfsURL).Debug("fetching login form")
+
 	res, err := ac.client.Get(adfsURL)
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retieving form")
+		return "", nil, errors.Wrap(err, "error retieving form")
 	}
 
 	doc, err := goquery.NewDocumentFromResponse(res)
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "failed to build document from response")
+		return "", nil, errors.Wrap(err, "failed to build document from response")
 	}
 
 	authForm := url.Values{}
+	cachedForm := url.Values{}
 
 	doc.Find("input").Each(func(i int, s *goquery.Selection) {
 		updateFormData(authForm, s, loginDetails)
+		updateFormData(cachedForm, s, &creds.LoginDetails{})
 	})
 
+	var authSubmitURL string
+
 	doc.Find("form").Each(func(i int, s *goquery.Selection) {
 		action, ok := s.Attr("action")
 		if !ok {
@@ -77,104 +157,286 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	})
 
 	if authSubmitURL == "" {
-		return samlAssertion, fmt.Errorf("unable to locate IDP authentication form submit URL")
+		return "", nil, fmt.Errorf("unable to locate IDP authentication form submit URL")
 	}
 
-	//log.Printf("id authentication url: %s", authSubmitURL)
+	if ac.cache != nil {
+		err = ac.cache.Put(adfsURL, &provider.CachedEndpoint{Action: authSubmitURL, Fields: cachedForm})
+		if err != nil {
+			logger.WithError(err).Debug("unable to cache login endpoint")
+		}
+	}
+
+	res, err = ac.postLoginForm(authSubmitURL, authForm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return authSubmitURL, res, nil
+}
+
+func (ac *Client) postLoginForm(authSubmitURL string, authForm url.Values) (*http.Response, error) {
 
 	req, err := http.NewRequest("POST", authSubmitURL, strings.NewReader(authForm.Encode()))
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error building authentication request")
+		return nil, errors.Wrap(err, "error building authentication request")
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	res, err = ac.client.Do(req)
+	res, err := ac.client.Do(req)
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving login form results")
+		return nil, errors.Wrap(err, "error retrieving login form results")
 	}
 
-	switch ac.idpAccount.MFA {
-	case "VIP":
-		res, err = ac.vipMFA(authSubmitURL, loginDetails.MFAToken, res)
-		if err != nil {
-			return samlAssertion, errors.Wrap(err, "error retrieving mfa form results")
-		}
+	return res, nil
+}
+
+// containsLoginForm check if the response is the login page again by looking for the password
+// field of the cached form, the response body is buffered so it can still be read by the caller
+func containsLoginForm(res *http.Response, cachedForm url.Values) bool {
+
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return false
 	}
 
-	// just parse the response whether res is from the login form or MFA form
-	doc, err = goquery.NewDocumentFromResponse(res)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error retrieving login response body")
+		return false
 	}
 
-	doc.Find("input").Each(func(i int, s *goquery.Selection) {
-		name, ok := s.Attr("name")
-		if !ok {
-			log.Fatalf("unable to locate IDP authentication form submit URL")
+	for name := range cachedForm {
+		if strings.Contains(strings.ToLower(name), "pass") && doc.Find(fmt.Sprintf("input[name='%s']", name)).Size() > 0 {
+			return true
 		}
-		if name == "SAMLResponse" {
-			val, ok := s.Attr("value")
-			if !ok {
-				log.Fatalf("unable to locate saml assertion value")
-			}
-			samlAssertion = val
+	}
+
+	return false
+}
+
+// fillCachedForm populate the credentials in a cached login form
+func fillCachedForm(cachedForm url.Values, loginDetails *creds.LoginDetails) url.Values {
+
+	authForm := url.Values{}
+
+	for name, values := range cachedForm {
+		lname := strings.ToLower(name)
+		if strings.Contains(lname, "user") {
+			authForm.Add(name, loginDetails.Username)
+		} else if strings.Contains(lname, "email") {
+			authForm.Add(name, loginDetails.Username)
+		} else if strings.Contains(lname, "pass") {
+			authForm.Add(name, loginDetails.Password)
+		} else {
+			authForm[name] = values
 		}
-	})
+	}
 
-	return samlAssertion, nil
+	return authForm
 }
 
-// vipMFA when supplied with the the form response document attempt to extract the VIP mfa related field
-// then use that to trigger a submit of the MFA security token
-func (ac *Client) vipMFA(authSubmitURL string, mfaToken string, res *http.Response) (*http.Response, error) {
+// mfaAdapter an ADFS additional authentication provider whose page follows the forms login
+type mfaAdapter struct {
+	// mfa the value of the mfa setting which selects the adapter
+	mfa string
+	// authMethods the AuthMethod values the pages of the adapter post
+	authMethods []string
+	// codeField part of the lowercase name of the input the code is entered in
+	codeField string
+	// name of the code in prompts and errors
+	name string
+}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
-	if err != nil {
-		return nil, errors.Wrap(err, "error retrieving saml response body")
+// mfaAdapters the adapters driven after the forms login, mfa Auto drives whichever one ADFS presents
+var mfaAdapters = []mfaAdapter{
+	{mfa: "VIP", authMethods: []string{"VIPAuthenticationProviderWindowsAccountName"}, codeField: "security_code", name: "VIP security code"},
+	{mfa: "Azure", authMethods: []string{"AzureMfaAuthentication", "AzureMfaServerAuthentication"}, codeField: "verificationcode", name: "Azure MFA verification code"},
+	{mfa: "RSA", authMethods: []string{"SecurIDAuthentication", "SecurIDv2Authentication"}, codeField: "passcode", name: "RSA SecurID passcode"},
+}
+
+// selectOptionRe finds the adapters offered on the page ADFS shows when the user can use more than one
+var selectOptionRe = regexp.MustCompile(`selectOption\('([^']+)'\)`)
+
+// adapterMFA drive the MFA adapter page which follows the forms login, choosing the adapter first when ADFS offers
+// more than one, the document is returned as it is when there is no adapter page
+func (ac *Client) adapterMFA(authSubmitURL string, mfaToken string, doc *goquery.Document) (*goquery.Document, error) {
+
+	if authMethod, ok := ac.chooseAdapter(doc); ok {
+		logger.WithField("authMethod", authMethod).Debug("choosing MFA adapter")
+
+		form := hiddenFields(doc)
+		form.Set("AuthMethod", authMethod)
+
+		var err error
+		doc, err = ac.postForm(formAction(doc, authSubmitURL), form)
+		if err != nil {
+			return nil, errors.Wrap(err, "error choosing MFA adapter")
+		}
 	}
 
-	otpForm := url.Values{}
+	adapter, ok := ac.detectAdapter(doc)
+	if !ok {
+		return doc, nil // if we didn't find the MFA flag then just continue
+	}
+
+	logger.WithField("mfa", adapter.mfa).Debug("verifying adapter MFA")
+
+	doc, err := ac.submitAdapterCode(adapter, adapter.codeField, mfaToken, authSubmitURL, doc)
+	if err != nil {
+		return nil, err
+	}
 
-	vipIndex := doc.Find("input#authMethod[value=VIPAuthenticationProviderWindowsAccountName]").Index()
+	// RSA asks for the next tokencode when the token may be out of step
+	if adapter.mfa == "RSA" && doc.Find("input[name=NextCode]").Size() > 0 {
+		fmt.Println("Wait for the tokencode to change")
+		doc, err = ac.submitAdapterCode(adapter, "nextcode", prompter.MFACode(ac.mfaTokens, func() string { return prompter.Password("Enter the next tokencode") }), authSubmitURL, doc)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if vipIndex == -1 {
-		return res, nil // if we didn't find the MFA flag then just continue
+	// a rejected code shows the adapter page again
+	if _, again := ac.detectAdapter(doc); again {
+		return nil, errors.Errorf("the %s wasn't accepted", adapter.name)
 	}
 
-	if mfaToken == "" {
-		mfaToken = prompter.RequestSecurityCode("000000")
+	return doc, nil
+}
+
+// submitAdapterCode post the adapter form with the code entered in the field, prompting for it when there isn't one
+func (ac *Client) submitAdapterCode(adapter *mfaAdapter, codeField, code, authSubmitURL string, doc *goquery.Document) (*goquery.Document, error) {
+
+	if code == "" {
+		if adapter.mfa == "RSA" {
+			code = prompter.MFACode(ac.mfaTokens, func() string { return prompter.Password("Enter passcode") })
+		} else {
+			code = prompter.MFACode(ac.mfaTokens, func() string { return prompter.RequestSecurityCode("000000") })
+		}
 	}
 
+	otpForm := url.Values{}
+
 	doc.Find("input").Each(func(i int, s *goquery.Selection) {
-		updateOTPFormData(otpForm, s, mfaToken)
+		updateOTPFormData(otpForm, s, codeField, code)
 	})
 
-	doc.Find("form").Each(func(i int, s *goquery.Selection) {
-		action, ok := s.Attr("action")
-		if !ok {
-			return
+	return ac.postForm(formAction(doc, authSubmitURL), otpForm)
+}
+
+// detectAdapter the adapter whose page this is, only the adapter selected by mfa is driven unless it is Auto
+func (ac *Client) detectAdapter(doc *goquery.Document) (*mfaAdapter, bool) {
+	for i := range mfaAdapters {
+		adapter := &mfaAdapters[i]
+
+		if !ac.usesAdapter(adapter) {
+			continue
+		}
+
+		for _, authMethod := range adapter.authMethods {
+			if doc.Find(fmt.Sprintf("input#authMethod[value=%s]", authMethod)).Size() > 0 {
+				return adapter, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// chooseAdapter the AuthMethod to pick on the page ADFS shows when the user can use more than one adapter
+func (ac *Client) chooseAdapter(doc *goquery.Document) (string, bool) {
+	if doc.Find("form#options").Size() == 0 {
+		return "", false
+	}
+
+	offered := map[string]bool{}
+
+	doc.Find("[onclick]").Each(func(i int, s *goquery.Selection) {
+		onclick, _ := s.Attr("onclick")
+		if match := selectOptionRe.FindStringSubmatch(onclick); match != nil {
+			offered[match[1]] = true
 		}
-		authSubmitURL = action
 	})
 
-	if authSubmitURL == "" {
-		return nil, fmt.Errorf("unable to locate IDP MFA form submit URL")
+	for i := range mfaAdapters {
+		if !ac.usesAdapter(&mfaAdapters[i]) {
+			continue
+		}
+
+		for _, authMethod := range mfaAdapters[i].authMethods {
+			if offered[authMethod] {
+				return authMethod, true
+			}
+		}
 	}
 
-	req, err := http.NewRequest("POST", authSubmitURL, strings.NewReader(otpForm.Encode()))
+	return "", false
+}
+
+// usesAdapter check if the mfa setting selects the adapter
+func (ac *Client) usesAdapter(adapter *mfaAdapter) bool {
+	return ac.idpAccount.MFA == "Auto" || ac.idpAccount.MFA == "" || ac.idpAccount.MFA == adapter.mfa
+}
+
+// postForm post the form and parse the page returned
+func (ac *Client) postForm(actionURL string, form url.Values) (*goquery.Document, error) {
+
+	req, err := http.NewRequest("POST", actionURL, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, errors.Wrap(err, "error building MFA request")
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	res, err = ac.client.Do(req)
+	res, err := ac.client.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "error retrieving content")
 	}
 
-	return res, nil
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving MFA response body")
+	}
+
+	return doc, nil
+}
+
+// formAction the URL the form on the page posts to, resolved against the URL the login form was posted to
+func formAction(doc *goquery.Document, authSubmitURL string) string {
+	action, ok := doc.Find("form").Last().Attr("action")
+	if !ok || action == "" {
+		return authSubmitURL
+	}
+
+	base, err := url.Parse(authSubmitURL)
+	if err != nil {
+		return action
+	}
+
+	ref, err := url.Parse(action)
+	if err != nil {
+		return action
+	}
+
+	return base.ResolveReference(ref).String()
+}
+
+// hiddenFields the hidden inputs of the page, passed through when choosing an adapter
+func hiddenFields(doc *goquery.Document) url.Values {
+	form := url.Values{}
+
+	doc.Find("input[type=hidden]").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			return
+		}
+		val, _ := s.Attr("value")
+		form.Add(name, val)
+	})
+
+	return form
 }
 
 func updateFormData(authForm url.Values, s *goquery.Selection, user *creds.LoginDetails) {
@@ -200,14 +462,14 @@ func updateFormData(authForm url.Values, s *goquery.Selection, user *creds.Login
 	}
 }
 
-func updateOTPFormData(otpForm url.Values, s *goquery.Selection, token string) {
+func updateOTPFormData(otpForm url.Values, s *goquery.Selection, codeField, token string) {
 	name, ok := s.Attr("name")
 	//	log.Printf("name = %s ok = %v", name, ok)
 	if !ok {
 		return
 	}
 	lname := strings.ToLower(name)
-	if strings.Contains(lname, "security_code") {
+	if strings.Contains(lname, codeField) {
 		otpForm.Add(name, token)
 	} else {
 		// pass through any hidden fields
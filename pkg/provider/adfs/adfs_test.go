@@ -0,0 +1,252 @@
+package adfs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+const exampleAssertion = "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+"
+
+type testIdP struct {
+	*httptest.Server
+	loginPageFetches int
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	loginPage, err := ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+
+	assertion, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	idp := &testIdP{}
+	idp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/adfs/ls/IdpInitiatedSignOn.aspx":
+			idp.loginPageFetches++
+			w.Write([]byte(strings.Replace(string(loginPage), "https://id.example.com", idp.URL, -1)))
+		case r.Method == "POST" && r.URL.Path == "/adfs/ls/":
+			r.ParseForm()
+			if r.Form.Get("UserName") != "test@example.com" || r.Form.Get("Password") != "test123" || r.Form.Get("AuthMethod") != "FormsAuthentication" {
+				w.Write(loginPage)
+				return
+			}
+			w.Write(assertion)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return idp
+}
+
+func newTestClient(t *testing.T, dir string) *Client {
+	return &Client{
+		client:     &provider.HTTPClient{Client: http.Client{}},
+		idpAccount: &cfg.IDPAccount{AmazonWebservicesURN: cfg.DefaultAmazonWebservicesURN, CacheEndpoints: true},
+		cache:      provider.NewEndpointCache(filepath.Join(dir, "endpoints.json"), time.Hour),
+	}
+}
+
+func TestAuthenticateCachesEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	idp := newTestIdP(t)
+	defer idp.Close()
+
+	ac := newTestClient(t, dir)
+	loginDetails := &creds.LoginDetails{URL: idp.URL, Username: "test@example.com", Password: "test123"}
+
+	samlAssertion, err := ac.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, 1, idp.loginPageFetches)
+
+	// the second login posts the cached form without fetching the login page
+	samlAssertion, err = ac.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, 1, idp.loginPageFetches)
+
+	// the password is never written to the cache
+	data, err := ioutil.ReadFile(filepath.Join(dir, "endpoints.json"))
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "test123")
+}
+
+func TestAuthenticateCachedEndpointFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	idp := newTestIdP(t)
+	defer idp.Close()
+
+	ac := newTestClient(t, dir)
+	loginDetails := &creds.LoginDetails{URL: idp.URL, Username: "test@example.com", Password: "test123"}
+
+	adfsURL := idp.URL + "/adfs/ls/IdpInitiatedSignOn.aspx?loginToRp=" + cfg.DefaultAmazonWebservicesURN
+
+	err = ac.cache.Put(adfsURL, &provider.CachedEndpoint{
+		Action: idp.URL + "/adfs/ls/stale",
+		Fields: url.Values{"UserName": {""}, "Password": {""}, "AuthMethod": {"FormsAuthentication"}},
+	})
+	require.Nil(t, err)
+
+	samlAssertion, err := ac.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, 1, idp.loginPageFetches)
+
+	endpoint, ok := ac.cache.Get(adfsURL)
+	require.True(t, ok)
+	require.Equal(t, idp.URL+"/adfs/ls/?loginToRp=urn:amazon:webservices&client-request-id=7b5fbd2b-c1f6-4c3d-8d08-0080020000d5", endpoint.Action)
+}
+
+func TestFillCachedForm(t *testing.T) {
+	authForm := fillCachedForm(url.Values{
+		"UserName":   {""},
+		"Password":   {""},
+		"AuthMethod": {"FormsAuthentication"},
+	}, &creds.LoginDetails{Username: "test@example.com", Password: "test123"})
+
+	require.Equal(t, url.Values{
+		"UserName":   {"test@example.com"},
+		"Password":   {"test123"},
+		"AuthMethod": {"FormsAuthentication"},
+	}, authForm)
+}
+
+// newMFATestIdP an IdP which shows the pages after the forms login in turn, the assertion is returned once they have
+// all been posted, check is called with each form posted after the login form
+func newMFATestIdP(t *testing.T, pages []string, check func(form url.Values) bool) *httptest.Server {
+	loginPage, err := ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+
+	assertion, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	var srv *httptest.Server
+	next := 0
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/adfs/ls/IdpInitiatedSignOn.aspx":
+			w.Write([]byte(strings.Replace(string(loginPage), "https://id.example.com", srv.URL, -1)))
+		case r.Method == "POST" && r.URL.Path == "/adfs/ls/":
+			r.ParseForm()
+			if r.Form.Get("AuthMethod") != "FormsAuthentication" && !check(r.Form) {
+				next--
+			}
+			if next == len(pages) {
+				w.Write(assertion)
+				return
+			}
+			page, err := ioutil.ReadFile(pages[next])
+			require.Nil(t, err)
+			next++
+			w.Write(page)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return srv
+}
+
+func TestAuthenticateAzureMFA(t *testing.T) {
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456")
+
+	srv := newMFATestIdP(t, []string{"example/azuremfa.html"}, func(form url.Values) bool {
+		return form.Get("VerificationCode") == "123456" && form.Get("AuthMethod") == "AzureMfaServerAuthentication"
+	})
+	defer srv.Close()
+
+	ac := &Client{
+		client:     &provider.HTTPClient{Client: http.Client{}},
+		idpAccount: &cfg.IDPAccount{AmazonWebservicesURN: cfg.DefaultAmazonWebservicesURN, MFA: "Auto"},
+	}
+
+	samlAssertion, err := ac.Authenticate(&creds.LoginDetails{URL: srv.URL, Username: "test@example.com", Password: "test123"})
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	pr.AssertExpectations(t)
+}
+
+func TestAuthenticateRSANextCode(t *testing.T) {
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("Password", "Enter the next tokencode").Return("654321")
+
+	codes := []string{}
+
+	srv := newMFATestIdP(t, []string{"example/rsa.html", "example/rsa-nextcode.html"}, func(form url.Values) bool {
+		codes = append(codes, form.Get("Passcode")+form.Get("NextCode"))
+		return form.Get("AuthMethod") == "SecurIDAuthentication"
+	})
+	defer srv.Close()
+
+	ac := &Client{
+		client:     &provider.HTTPClient{Client: http.Client{}},
+		idpAccount: &cfg.IDPAccount{AmazonWebservicesURN: cfg.DefaultAmazonWebservicesURN, MFA: "RSA"},
+	}
+
+	samlAssertion, err := ac.Authenticate(&creds.LoginDetails{URL: srv.URL, Username: "test@example.com", Password: "test123", MFAToken: "1234123456"})
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, []string{"1234123456", "654321"}, codes)
+}
+
+func TestAuthenticateChoosesAdapter(t *testing.T) {
+	authMethods := []string{}
+
+	srv := newMFATestIdP(t, []string{"example/options.html", "example/rsa.html"}, func(form url.Values) bool {
+		authMethods = append(authMethods, form.Get("AuthMethod"))
+		return true
+	})
+	defer srv.Close()
+
+	ac := &Client{
+		client:     &provider.HTTPClient{Client: http.Client{}},
+		idpAccount: &cfg.IDPAccount{AmazonWebservicesURN: cfg.DefaultAmazonWebservicesURN, MFA: "RSA"},
+	}
+
+	samlAssertion, err := ac.Authenticate(&creds.LoginDetails{URL: srv.URL, Username: "test@example.com", Password: "test123", MFAToken: "1234123456"})
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, []string{"SecurIDAuthentication", "SecurIDAuthentication"}, authMethods)
+}
+
+func TestAuthenticateRejectedCode(t *testing.T) {
+	srv := newMFATestIdP(t, []string{"example/azuremfa.html"}, func(form url.Values) bool {
+		return false
+	})
+	defer srv.Close()
+
+	ac := &Client{
+		client:     &provider.HTTPClient{Client: http.Client{}},
+		idpAccount: &cfg.IDPAccount{AmazonWebservicesURN: cfg.DefaultAmazonWebservicesURN, MFA: "Azure"},
+	}
+
+	_, err := ac.Authenticate(&creds.LoginDetails{URL: srv.URL, Username: "test@example.com", Password: "test123", MFAToken: "000000"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the Azure MFA verification code wasn't accepted")
+}
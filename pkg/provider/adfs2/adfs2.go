@@ -13,6 +13,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
 var logger = logrus.WithField("provider", "adfs2")
@@ -25,11 +26,11 @@ type Client struct {
 
 // New new adfs2 client with ntlmssp configured
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
+	tr := provider.NewTransport(idpAccount)
+	tr.TLSClientConfig.Renegotiation = tls.RenegotiateFreelyAsClient
+
 	transport := &ntlmssp.Negotiator{
-		RoundTripper: &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
-		},
+		RoundTripper: tr,
 	}
 
 	jar, err := cookiejar.New(&cookiejar.Options{
@@ -9,13 +9,14 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
 func (ac *Client) authenticateNTLM(loginDetails *creds.LoginDetails) (string, error) {
 
 	ac.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		req.SetBasicAuth(loginDetails.Username, loginDetails.Password)
-		return nil
+		return provider.CheckRedirectLimit(ac.idpAccount.MaxRedirects, via)
 	}
 
 	url := fmt.Sprintf("%s/adfs/ls/IdpInitiatedSignOn.aspx?loginToRp=%s", loginDetails.URL, ac.idpAccount.AmazonWebservicesURN)
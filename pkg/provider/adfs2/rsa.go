@@ -33,7 +33,7 @@ func (ac *Client) authenticateRsa(loginDetails *creds.LoginDetails) (string, err
 		return "", errors.Wrap(err, "error extracting mfa form data")
 	}
 
-	token := prompter.Password("Enter passcode")
+	token := prompter.MFACode(loginDetails.MFATokens, func() string { return prompter.Password("Enter passcode") })
 
 	passcodeForm.Set("Passcode", token)
 	passcodeForm.Del("submit")
@@ -48,7 +48,7 @@ func (ac *Client) authenticateRsa(loginDetails *creds.LoginDetails) (string, err
 		return "", errors.Wrap(err, "error extracting rsa form data")
 	}
 
-	nextCode := prompter.Password("Enter nextCode")
+	nextCode := prompter.MFACode(loginDetails.MFATokens, func() string { return prompter.Password("Enter nextCode") })
 
 	rsaForm.Set("NextCode", nextCode)
 	rsaForm.Del("submit")
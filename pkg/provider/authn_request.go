@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+const (
+	samlProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlPostBinding        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// AuthnRequest a SAML 2.0 AuthnRequest used to start an SP-initiated login
+type AuthnRequest struct {
+	XMLName                     xml.Name `xml:"samlp:AuthnRequest"`
+	ProtocolNamespace           string   `xml:"xmlns:samlp,attr"`
+	AssertionNamespace          string   `xml:"xmlns:saml,attr"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      string   `xml:"saml:Issuer"`
+}
+
+// NewAuthnRequest build an AuthnRequest for the IdP destination which asks for the assertion to be posted to the
+// supplied assertion consumer service, the issuer is the SP entity ID configured on the account
+func NewAuthnRequest(idpAccount *cfg.IDPAccount, destination, acsURL string) (*AuthnRequest, error) {
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errors.Wrap(err, "error generating request id")
+	}
+
+	return &AuthnRequest{
+		ProtocolNamespace:           samlProtocolNamespace,
+		AssertionNamespace:          samlAssertionNamespace,
+		ID:                          "_" + hex.EncodeToString(id),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 destination,
+		AssertionConsumerServiceURL: acsURL,
+		ProtocolBinding:             samlPostBinding,
+		Issuer:                      idpAccount.ServiceProviderEntityID(),
+	}, nil
+}
+
+// Encode the request as the base64 SAMLRequest value used by the HTTP-POST binding
+func (r *AuthnRequest) Encode() (string, error) {
+	data, err := xml.Marshal(r)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding AuthnRequest")
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func decodeAuthnRequest(t *testing.T, req *AuthnRequest) *etree.Element {
+	samlRequest, err := req.Encode()
+	require.Nil(t, err)
+
+	data, err := base64.StdEncoding.DecodeString(samlRequest)
+	require.Nil(t, err)
+
+	doc := etree.NewDocument()
+	require.Nil(t, doc.ReadFromBytes(data))
+
+	return doc.Root()
+}
+
+func TestNewAuthnRequestSPEntityID(t *testing.T) {
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.SPEntityID = "https://sp.example.com/saml/metadata"
+
+	req, err := NewAuthnRequest(idpAccount, "https://id.example.com/sso", "https://signin.aws.amazon.com/saml")
+	require.Nil(t, err)
+
+	root := decodeAuthnRequest(t, req)
+	require.Equal(t, "AuthnRequest", root.Tag)
+	require.Equal(t, "samlp", root.Space)
+	require.Equal(t, "urn:oasis:names:tc:SAML:2.0:protocol", root.SelectAttrValue("xmlns:samlp", ""))
+	require.Equal(t, "https://id.example.com/sso", root.SelectAttrValue("Destination", ""))
+	require.Equal(t, "https://signin.aws.amazon.com/saml", root.SelectAttrValue("AssertionConsumerServiceURL", ""))
+	require.True(t, strings.HasPrefix(root.SelectAttrValue("ID", ""), "_"))
+
+	issuer := root.FindElement("./saml:Issuer")
+	require.NotNil(t, issuer)
+	require.Equal(t, "https://sp.example.com/saml/metadata", issuer.Text())
+}
+
+func TestNewAuthnRequestDefaultIssuer(t *testing.T) {
+	req, err := NewAuthnRequest(cfg.NewIDPAccount(), "https://id.example.com/sso", "https://signin.aws.amazon.com/saml")
+	require.Nil(t, err)
+	require.Equal(t, cfg.DefaultAmazonWebservicesURN, req.Issuer)
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.AmazonWebservicesURN = "urn:amazon:webservices:govcloud"
+
+	req, err = NewAuthnRequest(idpAccount, "https://id.example.com/sso", "https://signin.amazonaws-us-gov.com/saml")
+	require.Nil(t, err)
+	require.Equal(t, "urn:amazon:webservices:govcloud", decodeAuthnRequest(t, req).FindElement("./saml:Issuer").Text())
+}
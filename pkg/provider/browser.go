@@ -0,0 +1,27 @@
+package provider
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// BrowserLauncher open the URL in the user's web browser
+type BrowserLauncher func(url string) error
+
+// OpenBrowser open the URL with the platform's URL handler
+var OpenBrowser BrowserLauncher = openBrowser
+
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigureCABundle trust the CA certificates in the PEM file for the connections made by the transport, along with
+// the system roots, so a TLS intercepting proxy can be used without skip_verify
+//
+// A bundle which can't be read or has no certificates fails every connection rather than silently using the system
+// roots alone.
+func ConfigureCABundle(tr *http.Transport, caBundle string) {
+	if caBundle == "" {
+		return
+	}
+
+	pool, err := loadCABundle(caBundle)
+	if err != nil {
+		tr.DialContext = func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		}
+		return
+	}
+
+	tr.TLSClientConfig.RootCAs = pool
+}
+
+// loadCABundle the system roots with the certificates of the PEM file added
+func loadCABundle(caBundle string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caBundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read ca bundle")
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no certificates found in ca bundle: %s", caBundle)
+	}
+
+	return pool, nil
+}
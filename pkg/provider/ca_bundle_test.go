@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestNewTransportCABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	caBundle := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	require.Nil(t, err)
+
+	// the test server's certificate isn't trusted without the bundle
+	_, err = (&http.Client{Transport: NewTransport(&cfg.IDPAccount{})}).Get(ts.URL)
+	require.Error(t, err)
+
+	res, err := (&http.Client{Transport: NewTransport(&cfg.IDPAccount{CABundle: caBundle})}).Get(ts.URL)
+	require.Nil(t, err)
+	res.Body.Close()
+}
+
+func TestNewTransportInvalidCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	caBundle := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caBundle, []byte("not a certificate"), 0600)
+	require.Nil(t, err)
+
+	_, err = (&http.Client{Transport: NewTransport(&cfg.IDPAccount{CABundle: caBundle})}).Get("https://id.example.com")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no certificates found in ca bundle: "+caBundle)
+
+	_, err = (&http.Client{Transport: NewTransport(&cfg.IDPAccount{CABundle: filepath.Join(dir, "missing.pem")})}).Get("https://id.example.com")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to read ca bundle")
+}
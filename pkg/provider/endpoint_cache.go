@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultEndpointCachePath the file discovered login endpoints are cached in
+	DefaultEndpointCachePath = "~/.saml2aws-endpoints.json"
+
+	// DefaultEndpointCacheTTL how long a discovered login endpoint is reused before rediscovery
+	DefaultEndpointCacheTTL = 24 * time.Hour
+)
+
+// CachedEndpoint a login form discovered on the IdP, the fields never include the user's credentials
+type CachedEndpoint struct {
+	Action     string     `json:"action"`
+	Fields     url.Values `json:"fields"`
+	Discovered time.Time  `json:"discovered"`
+}
+
+// EndpointCache caches discovered login endpoints so repeated logins can skip fetching the login page
+type EndpointCache struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// NewEndpointCache build a cache stored in the supplied file, empty values use the defaults
+func NewEndpointCache(path string, ttl time.Duration) *EndpointCache {
+	if path == "" {
+		path = DefaultEndpointCachePath
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultEndpointCacheTTL
+	}
+
+	return &EndpointCache{path: path, ttl: ttl, now: time.Now}
+}
+
+// Get return the cached endpoint for the key if it exists and hasn't exceeded the TTL
+func (ec *EndpointCache) Get(key string) (*CachedEndpoint, bool) {
+	endpoints, err := ec.load()
+	if err != nil {
+		logrus.WithField("cache", "endpoints").WithError(err).Debug("unable to load endpoint cache")
+		return nil, false
+	}
+
+	endpoint, ok := endpoints[key]
+	if !ok || ec.now().Sub(endpoint.Discovered) > ec.ttl {
+		return nil, false
+	}
+
+	return endpoint, true
+}
+
+// Put store the endpoint for the key
+func (ec *EndpointCache) Put(key string, endpoint *CachedEndpoint) error {
+	endpoints, err := ec.load()
+	if err != nil {
+		endpoints = map[string]*CachedEndpoint{}
+	}
+
+	endpoint.Discovered = ec.now()
+	endpoints[key] = endpoint
+
+	return ec.save(endpoints)
+}
+
+// Delete remove the endpoint for the key
+func (ec *EndpointCache) Delete(key string) error {
+	endpoints, err := ec.load()
+	if err != nil {
+		return nil
+	}
+
+	delete(endpoints, key)
+
+	return ec.save(endpoints)
+}
+
+func (ec *EndpointCache) load() (map[string]*CachedEndpoint, error) {
+	path, err := homedir.Expand(ec.path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := map[string]*CachedEndpoint{}
+
+	err = json.Unmarshal(data, &endpoints)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid endpoint cache")
+	}
+
+	return endpoints, nil
+}
+
+func (ec *EndpointCache) save(endpoints map[string]*CachedEndpoint) error {
+	path, err := homedir.Expand(ec.path)
+	if err != nil {
+		return errors.Wrap(err, "unable to expand endpoint cache path")
+	}
+
+	data, err := json.Marshal(endpoints)
+	if err != nil {
+		return errors.Wrap(err, "error encoding endpoint cache")
+	}
+
+	err = ioutil.WriteFile(path, data, os.FileMode(0600))
+	if err != nil {
+		return errors.Wrap(err, "error writing endpoint cache")
+	}
+
+	return nil
+}
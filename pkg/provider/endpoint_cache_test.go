@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ec := NewEndpointCache(filepath.Join(dir, "endpoints.json"), time.Hour)
+
+	_, ok := ec.Get("https://id.example.com")
+	require.False(t, ok)
+
+	err = ec.Put("https://id.example.com", &CachedEndpoint{
+		Action: "https://id.example.com/login",
+		Fields: url.Values{"UserName": {""}, "Password": {""}, "AuthMethod": {"FormsAuthentication"}},
+	})
+	require.Nil(t, err)
+
+	endpoint, ok := ec.Get("https://id.example.com")
+	require.True(t, ok)
+	require.Equal(t, "https://id.example.com/login", endpoint.Action)
+	require.Equal(t, "FormsAuthentication", endpoint.Fields.Get("AuthMethod"))
+
+	require.Nil(t, ec.Delete("https://id.example.com"))
+
+	_, ok = ec.Get("https://id.example.com")
+	require.False(t, ok)
+}
+
+func TestEndpointCacheExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ec := NewEndpointCache(filepath.Join(dir, "endpoints.json"), time.Hour)
+
+	err = ec.Put("https://id.example.com", &CachedEndpoint{Action: "https://id.example.com/login"})
+	require.Nil(t, err)
+
+	ec.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	_, ok := ec.Get("https://id.example.com")
+	require.False(t, ok)
+}
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// fallbackProbeTimeout how long to wait for the primary IdP before trying the fallback URL
+var fallbackProbeTimeout = 10 * time.Second
+
+// ResolveIdPURL returns the URL to authenticate against, this is the fallback URL when one is configured and
+// the primary URL is unreachable or returns a server error
+//
+// Only connection level failures trigger the fallback, any other response including an authentication failure
+// is left for the provider to handle against the primary URL.
+func ResolveIdPURL(idpAccount *cfg.IDPAccount) string {
+	if idpAccount.FallbackURL == "" {
+		return idpAccount.URL
+	}
+
+	logger := logrus.WithField("fallback", idpAccount.FallbackURL)
+
+	client := &http.Client{
+		Transport: NewTransport(idpAccount),
+		Timeout:   fallbackProbeTimeout,
+	}
+
+	res, err := client.Get(idpAccount.URL)
+	if err != nil {
+		logger.WithError(err).Warn("primary IdP unreachable, using fallback URL")
+		return idpAccount.FallbackURL
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 500 {
+		logger.WithField("status", res.Status).Warn("primary IdP unavailable, using fallback URL")
+		return idpAccount.FallbackURL
+	}
+
+	return idpAccount.URL
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func newFallbackAccount(primaryURL, fallbackURL string) *cfg.IDPAccount {
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.URL = primaryURL
+	idpAccount.FallbackURL = fallbackURL
+
+	return idpAccount
+}
+
+func TestResolveIdPURLPrimaryUnreachable(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	primaryURL := primary.URL
+	primary.Close() // connection refused
+
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fallback.Close()
+
+	require.Equal(t, fallback.URL, ResolveIdPURL(newFallbackAccount(primaryURL, fallback.URL)))
+}
+
+func TestResolveIdPURLPrimaryServerError(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	require.Equal(t, "https://dr.id.example.com", ResolveIdPURL(newFallbackAccount(primary.URL, "https://dr.id.example.com")))
+}
+
+func TestResolveIdPURLPrimaryTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { fallbackProbeTimeout = timeout }(fallbackProbeTimeout)
+	fallbackProbeTimeout = 50 * time.Millisecond
+
+	done := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer primary.Close()
+	defer close(done)
+
+	require.Equal(t, "https://dr.id.example.com", ResolveIdPURL(newFallbackAccount(primary.URL, "https://dr.id.example.com")))
+}
+
+func TestResolveIdPURLPrimaryAuthError(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer primary.Close()
+
+	// an authentication failure is reported by the provider against the primary
+	require.Equal(t, primary.URL, ResolveIdPURL(newFallbackAccount(primary.URL, "https://dr.id.example.com")))
+}
+
+func TestResolveIdPURLNoFallback(t *testing.T) {
+	require.Equal(t, "https://id.example.com", ResolveIdPURL(newFallbackAccount("https://id.example.com", "")))
+}
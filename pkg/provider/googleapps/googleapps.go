@@ -19,17 +19,26 @@ import (
 
 var logger = logrus.WithField("provider", "googleapps")
 
+// googleAPIsURL where the sign in prompt on the phone is waited for
+const googleAPIsURL = "https://content.googleapis.com"
+
+// errCaptcha returned when google won't continue the sign in until a captcha is solved
+var errCaptcha = errors.New("google asked for a captcha, sign in to Google with a browser to solve it and try again")
+
 // Client wrapper around Google Apps.
 type Client struct {
-	client *provider.HTTPClient
+	client    *provider.HTTPClient
+	mfaToken  string
+	mfaTokens creds.MFATokenSource
+	apisBase  string
 }
 
 // New create a new Google Apps Client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewTransport(idpAccount)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -48,6 +57,9 @@ func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return "", errors.Wrap(err, "error loading first page")
 	}
 
+	kc.mfaToken = loginDetails.MFAToken
+	kc.mfaTokens = loginDetails.MFATokens
+
 	authForm.Set("Email", loginDetails.Username)
 
 	passwordURL, _, err := kc.loadLoginPage(authURL, loginDetails.URL, authForm)
@@ -143,6 +155,10 @@ func (kc *Client) loadLoginPage(submitURL string, referer string, authForm url.V
 		return "", nil, errors.Wrap(err, "error parsing login page html document")
 	}
 
+	if containsCaptcha(doc) {
+		return "", nil, errCaptcha
+	}
+
 	loginForm, loginURL, err := extractInputsByFormID(doc, "gaia_loginform")
 	if err != nil {
 		return "", nil, errors.Wrap(err, "failed to build login form data")
@@ -171,77 +187,103 @@ func (kc *Client) loadChallengePage(submitURL string, referer string, authForm u
 		return nil, errors.Wrap(err, "error parsing login page html document")
 	}
 
+	if containsCaptcha(doc) {
+		return nil, errCaptcha
+	}
+
 	errMsg := mustFindErrorMsg(doc)
 
 	if errMsg != "" {
 		return nil, errors.New("Invalid username or password")
 	}
 
-	secondFactorHeader := "This extra step shows it’s really you trying to sign in"
-	secondFactorHeader2 := "This extra step shows that it’s really you trying to sign in"
-	secondFactorHeaderJp := "2 段階認証プロセス"
-
 	// have we been asked for 2-Step Verification
-	if extractNodeText(doc, "h2", secondFactorHeader) != "" ||
-	   extractNodeText(doc, "h2", secondFactorHeader2) != "" ||
-	   extractNodeText(doc, "h1", secondFactorHeaderJp) != "" {
-
-		responseForm, secondActionURL, err := extractInputsByFormID(doc, "challenge")
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to extract challenge form")
-		}
-
-		logger.Debugf("secondActionURL: %s", secondActionURL)
+	if !containsChallenge(doc) {
+		return doc, nil
+	}
 
-		u, _ := url.Parse(submitURL)
-		u.Path = secondActionURL // we are just updating the path with the action as it is a relative path
+	responseForm, secondActionURL, err := extractInputsByFormID(doc, "challenge")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to extract challenge form")
+	}
 
-		switch {
-		case strings.Contains(secondActionURL, "challenge/totp/"): // handle TOTP challenge
+	logger.Debugf("secondActionURL: %s", secondActionURL)
 
-			var token = prompter.RequestSecurityCode("000000")
+	u, _ := url.Parse(submitURL)
+	u.Path = secondActionURL // we are just updating the path with the action as it is a relative path
 
-			responseForm.Set("Pin", token)
-			responseForm.Set("TrustDevice", "on") // Don't ask again on this computer
+	var challenge string
 
-			return kc.loadResponsePage(u.String(), submitURL, responseForm)
-		case strings.Contains(secondActionURL, "challenge/ipp/"): // handle SMS challenge
+	switch {
+	case strings.Contains(secondActionURL, "challenge/totp/"): // handle TOTP challenge
+		challenge = "authenticator code"
 
-			var token = prompter.StringRequired("Enter SMS token: G-")
+		token := kc.mfaToken
+		if token == "" {
+			token = prompter.MFACode(kc.mfaTokens, func() string { return prompter.RequestSecurityCode("000000") })
+		}
 
-			responseForm.Set("Pin", token)
-			responseForm.Set("TrustDevice", "on") // Don't ask again on this computer
+		responseForm.Set("Pin", token)
+	case strings.Contains(secondActionURL, "challenge/ipp/"): // handle SMS challenge
+		challenge = "SMS code"
 
-			return kc.loadResponsePage(u.String(), submitURL, responseForm)
+		var token = prompter.MFACode(kc.mfaTokens, func() string { return prompter.StringRequired("Enter SMS token: G-") })
 
-		case strings.Contains(secondActionURL, "challenge/az/"): // handle phone challenge
+		responseForm.Set("Pin", token)
+	case strings.Contains(secondActionURL, "challenge/bc/"): // handle backup code challenge
+		challenge = "backup code"
 
-			dataAttrs := extractDataAttributes(doc, "div[data-context]", []string{"data-context", "data-gapi-url", "data-tx-id", "data-api-key", "data-tx-lifetime"})
+		var token = prompter.MFACode(kc.mfaTokens, func() string { return prompter.StringRequired("Enter one of your 8 digit backup codes") })
 
-			logger.Debugf("prompt with data values: %+v", dataAttrs)
+		responseForm.Set("Pin", strings.Replace(token, " ", "", -1))
+	case strings.Contains(secondActionURL, "challenge/az/"): // handle phone challenge
+		challenge = "sign in prompt"
 
-			waitValues := map[string]string{
-				"txId": dataAttrs["data-tx-id"],
-			}
+		dataAttrs := extractDataAttributes(doc, "div[data-context]", []string{"data-context", "data-gapi-url", "data-tx-id", "data-api-key", "data-tx-lifetime"})
 
-			fmt.Println("Open the Google App, and tap 'Yes' on the prompt to sign in")
+		logger.Debugf("prompt with data values: %+v", dataAttrs)
 
-			_, err := kc.postJSON(fmt.Sprintf("https://content.googleapis.com/cryptauth/v1/authzen/awaittx?alt=json&key=%s", dataAttrs["data-api-key"]), waitValues, submitURL)
-			if err != nil {
-				return nil, errors.Wrap(err, "unable to extract post wait tx form")
-			}
+		waitValues := map[string]string{
+			"txId": dataAttrs["data-tx-id"],
+		}
 
-			// responseForm.Set("Pin", token)
-			responseForm.Set("TrustDevice", "on") // Don't ask again on this computer
+		fmt.Println("Open the Google App, and tap 'Yes' on the prompt to sign in")
 
-			return kc.loadResponsePage(u.String(), submitURL, responseForm)
+		res, err := kc.postJSON(fmt.Sprintf("%s/cryptauth/v1/authzen/awaittx?alt=json&key=%s", kc.apisURL(), dataAttrs["data-api-key"]), waitValues, submitURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to extract post wait tx form")
 		}
+		res.Body.Close()
 
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("the sign in prompt wasn't approved, google returned %s", res.Status)
+		}
+	default:
 		return nil, errors.Errorf("unsupported second factor: %s", secondActionURL)
 	}
 
-	return doc, nil
+	responseForm.Set("TrustDevice", "on") // Don't ask again on this computer
+
+	responseDoc, err := kc.loadResponsePage(u.String(), submitURL, responseForm)
+	if err != nil {
+		return nil, err
+	}
+
+	// a rejected code shows the same challenge again
+	if containsChallenge(responseDoc) {
+		return nil, errors.Errorf("the %s wasn't accepted", challenge)
+	}
+
+	return responseDoc, nil
+}
 
+// apisURL the google apis the sign in prompt is waited for through, replaced in tests
+func (kc *Client) apisURL() string {
+	if kc.apisBase != "" {
+		return kc.apisBase
+	}
+
+	return googleAPIsURL
 }
 
 func (kc *Client) postJSON(submitURL string, values map[string]string, referer string) (*http.Response, error) {
@@ -296,7 +338,7 @@ func mustFindInputByName(doc *goquery.Document, name string) string {
 	doc.Find(q).Each(func(i int, s *goquery.Selection) {
 		val, ok := s.Attr("value")
 		if !ok {
-			logger.Fatal("unable to locate field value")
+			return
 		}
 		fieldValue = val
 	})
@@ -347,6 +389,29 @@ func extractInputsByFormID(doc *goquery.Document, formID string) (url.Values, st
 	return formData, actionURL, nil
 }
 
+// containsChallenge the page asks for the second step of 2-Step Verification
+func containsChallenge(doc *goquery.Document) bool {
+	secondFactorHeader := "This extra step shows it’s really you trying to sign in"
+	secondFactorHeader2 := "This extra step shows that it’s really you trying to sign in"
+	secondFactorHeaderJp := "2 段階認証プロセス"
+
+	if extractNodeText(doc, "h2", secondFactorHeader) != "" ||
+		extractNodeText(doc, "h2", secondFactorHeader2) != "" ||
+		extractNodeText(doc, "h1", secondFactorHeaderJp) != "" {
+		return true
+	}
+
+	// the headings are translated so also look for the challenge form itself
+	action, _ := doc.Find("form#challenge").Attr("action")
+
+	return strings.Contains(action, "challenge/")
+}
+
+// containsCaptcha google asks for a captcha when it doesn't trust the sign in, it can't be solved here
+func containsCaptcha(doc *goquery.Document) bool {
+	return doc.Find("input[name=logincaptcha], img#captcha-img").Length() > 0
+}
+
 func extractNodeText(doc *goquery.Document, tag, txt string) string {
 
 	var res string
@@ -11,6 +11,8 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/mocks"
+	"github.com/versent/saml2aws/pkg/prompter"
 	"github.com/versent/saml2aws/pkg/provider"
 )
 
@@ -65,23 +67,124 @@ func TestContentContainsMessage2(t *testing.T) {
 	require.Equal(t, "This extra step shows that it’s really you trying to sign in", txt)
 }
 
-func TestChallengePage(t *testing.T) {
+// newChallengeServer serves the challenge page for the password and the SAML response for the code, the pins
+// submitted to the challenge are recorded
+func newChallengeServer(t *testing.T, challengePage, challengePath string) (*httptest.Server, *[]string) {
+	data, err := ioutil.ReadFile(challengePage)
+	require.Nil(t, err)
 
-	data, err := ioutil.ReadFile("example/challenge-totp.html")
+	samlResponse, err := ioutil.ReadFile("example/saml-response.html")
 	require.Nil(t, err)
 
+	var pins []string
+
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write(data)
+		if r.URL.Path != challengePath {
+			w.Write(data)
+			return
+		}
+
+		require.Nil(t, r.ParseForm())
+		pins = append(pins, r.PostForm.Get("Pin"))
+		require.Equal(t, "on", r.PostForm.Get("TrustDevice"))
+
+		if r.PostForm.Get("Pin") == "000000" {
+			w.Write(data)
+			return
+		}
+		w.Write(samlResponse)
 	}))
+
+	return ts, &pins
+}
+
+func TestChallengePage(t *testing.T) {
+	ts, pins := newChallengeServer(t, "example/challenge-totp.html", "/signin/challenge/totp/2")
 	defer ts.Close()
 
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456")
+
 	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
-	// loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
 	authForm := url.Values{}
 
 	challengeDoc, err := kc.loadChallengePage(ts.URL, "https://accounts.google.com/signin/challenge/sl/password", authForm)
 	require.Nil(t, err)
 	require.NotNil(t, challengeDoc)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", mustFindInputByName(challengeDoc, "SAMLResponse"))
+	require.Equal(t, []string{"123456"}, *pins)
+
+	// the code from --mfa-token is used without prompting
+	kc.mfaToken = "654321"
+	_, err = kc.loadChallengePage(ts.URL, "https://accounts.google.com/signin/challenge/sl/password", authForm)
+	require.Nil(t, err)
+	require.Equal(t, []string{"123456", "654321"}, *pins)
+	pr.Mock.AssertNumberOfCalls(t, "RequestSecurityCode", 1)
+
+	// a rejected code shows the challenge again
+	kc.mfaToken = "000000"
+	_, err = kc.loadChallengePage(ts.URL, "https://accounts.google.com/signin/challenge/sl/password", authForm)
+	require.EqualError(t, err, "the authenticator code wasn't accepted")
+}
+
+func TestChallengePageBackupCode(t *testing.T) {
+	ts, pins := newChallengeServer(t, "example/challenge-backup.html", "/signin/challenge/bc/3")
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("StringRequired", "Enter one of your 8 digit backup codes").Return("1234 5678")
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+
+	challengeDoc, err := kc.loadChallengePage(ts.URL, "https://accounts.google.com/signin/challenge/sl/password", url.Values{})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", mustFindInputByName(challengeDoc, "SAMLResponse"))
+	require.Equal(t, []string{"12345678"}, *pins)
+}
+
+func TestChallengePagePrompt(t *testing.T) {
+	ts, _ := newChallengeServer(t, "example/challenge-prompt.html", "/signin/challenge/az/5")
+	defer ts.Close()
+
+	approved := true
+	apis := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/cryptauth/v1/authzen/awaittx", r.URL.Path)
+		if !approved {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer apis.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}, apisBase: apis.URL}
+
+	challengeDoc, err := kc.loadChallengePage(ts.URL, "https://accounts.google.com/signin/challenge/sl/password", url.Values{})
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", mustFindInputByName(challengeDoc, "SAMLResponse"))
+
+	approved = false
+	_, err = kc.loadChallengePage(ts.URL, "https://accounts.google.com/signin/challenge/sl/password", url.Values{})
+	require.EqualError(t, err, "the sign in prompt wasn't approved, google returned 403 Forbidden")
+}
+
+func TestChallengePageCaptcha(t *testing.T) {
+	data, err := ioutil.ReadFile("example/captcha.html")
+	require.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+
+	_, _, err = kc.loadLoginPage(ts.URL, ts.URL, url.Values{})
+	require.Equal(t, errCaptcha, err)
+
+	_, err = kc.loadChallengePage(ts.URL, ts.URL, url.Values{})
+	require.Equal(t, errCaptcha, err)
 }
 
 func TestExtractDataAttributes(t *testing.T) {
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"runtime"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/cookiejar"
 	"github.com/versent/saml2aws/pkg/dump"
 
@@ -17,10 +19,16 @@ import (
 	"golang.org/x/net/publicsuffix"
 )
 
+// retrySleep waits between attempts of a request, replaced in tests
+var retrySleep = time.Sleep
+
 // HTTPClient saml2aws http client which extends the existing client
 type HTTPClient struct {
 	http.Client
 	CheckResponseStatus func(*http.Request, *http.Response) error
+	MaxRedirects        int           // zero uses cfg.DefaultMaxRedirects
+	Attempts            int           // tries of a request failing with a transient network error, zero tries once
+	RetryBackoff        time.Duration // wait before each retry
 }
 
 // NewDefaultTransport configure a transport with the TLS skip verify option
@@ -40,8 +48,33 @@ func NewDefaultTransport(skipVerify bool) *http.Transport {
 	}
 }
 
-// NewHTTPClient configure the default http client used by the providers
-func NewHTTPClient(tr http.RoundTripper) (*HTTPClient, error) {
+// NewTransport configure the default transport using the TLS settings from the idp account
+func NewTransport(idpAccount *cfg.IDPAccount) *http.Transport {
+	tr := NewDefaultTransport(idpAccount.SkipVerify)
+	tr.TLSClientConfig.MinVersion = idpAccount.TLSMinVersion()
+
+	ConfigureSourceAddress(tr, idpAccount.SourceAddress)
+	ConfigureProxy(tr, idpAccount.ProxyURL)
+	ConfigureCABundle(tr, idpAccount.CABundle)
+
+	return tr
+}
+
+// NewAWSTransport configure the default transport for connections to AWS, such as the signin page and STS, with the
+// proxy and CA bundle of the idp account, skip_verify only applies to the IdP
+func NewAWSTransport(idpAccount *cfg.IDPAccount) *http.Transport {
+	tr := NewDefaultTransport(false)
+	tr.TLSClientConfig.MinVersion = idpAccount.TLSMinVersion()
+
+	ConfigureProxy(tr, idpAccount.ProxyURL)
+	ConfigureCABundle(tr, idpAccount.CABundle)
+
+	return tr
+}
+
+// NewHTTPClient configure the default http client used by the providers, following redirects up to the
+// max_redirects of the idp account and retrying requests with its retry policy
+func NewHTTPClient(tr http.RoundTripper, idpAccount *cfg.IDPAccount) (*HTTPClient, error) {
 
 	options := &cookiejar.Options{
 		PublicSuffixList: publicsuffix.List,
@@ -52,9 +85,28 @@ func NewHTTPClient(tr http.RoundTripper) (*HTTPClient, error) {
 		return nil, err
 	}
 
-	client := http.Client{Transport: tr, Jar: jar}
+	hc := &HTTPClient{Client: http.Client{Transport: tr, Jar: jar}, MaxRedirects: idpAccount.MaxRedirects}
+	hc.Attempts, hc.RetryBackoff = idpAccount.RetryPolicy()
+	hc.EnableFollowRedirect()
 
-	return &HTTPClient{client, nil}, nil
+	return hc, nil
+}
+
+// CheckRedirectLimit return an error once a request has been redirected more than max times, zero uses
+// cfg.DefaultMaxRedirects
+//
+// This is intended to be called from a CheckRedirect func so a redirect loop caused by a misconfigured
+// IdP fails with a clear error.
+func CheckRedirectLimit(max int, via []*http.Request) error {
+	if max <= 0 {
+		max = cfg.DefaultMaxRedirects
+	}
+
+	if len(via) > max {
+		return errors.Errorf("too many redirects (more than %d), possible misconfiguration of the IdP or url", max)
+	}
+
+	return nil
 }
 
 // Do do the request
@@ -79,7 +131,7 @@ func (hc *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 
 	hc.logHTTPRequest(req)
 
-	resp, err := hc.Client.Do(req)
+	resp, err := hc.doWithRetries(req)
 	if err != nil {
 		return resp, err
 	}
@@ -97,6 +149,35 @@ func (hc *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
+// doWithRetries send the request again after a transient network error, up to the configured attempts
+//
+// Only the failed request is sent again, so a dropped connection doesn't start the login or its MFA over. A request
+// whose body can't be replayed is sent once.
+func (hc *HTTPClient) doWithRetries(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := hc.Client.Do(req)
+		if attempt >= hc.Attempts || !IsTransientNetworkError(err) {
+			return resp, err
+		}
+
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, err
+			}
+
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req.Body = body
+		}
+
+		logrus.WithError(err).WithField("attempt", attempt).Warn("request failed with a network error, retrying")
+
+		retrySleep(hc.RetryBackoff)
+	}
+}
+
 // DisableFollowRedirect disable redirects
 func (hc *HTTPClient) DisableFollowRedirect() {
 	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -104,9 +185,11 @@ func (hc *HTTPClient) DisableFollowRedirect() {
 	}
 }
 
-// EnableFollowRedirect enable redirects
+// EnableFollowRedirect enable redirects, up to the configured maximum
 func (hc *HTTPClient) EnableFollowRedirect() {
-	hc.CheckRedirect = nil
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return CheckRedirectLimit(hc.MaxRedirects, via)
+	}
 }
 
 // SuccessOrRedirectResponseValidator this validates the response code is within range of 200 - 399
@@ -120,8 +203,9 @@ func SuccessOrRedirectResponseValidator(req *http.Request, resp *http.Response)
 
 func (hc *HTTPClient) logHTTPRequest(req *http.Request) {
 
+	// dumps go to stderr so they don't mix with output such as the credential-process json
 	if dump.ContentEnable() {
-		fmt.Println(dump.RequestString(req))
+		fmt.Fprintln(os.Stderr, dump.RequestString(req))
 		return
 	}
 
@@ -134,7 +218,7 @@ func (hc *HTTPClient) logHTTPRequest(req *http.Request) {
 func (hc *HTTPClient) logHTTPResponse(resp *http.Response) {
 
 	if dump.ContentEnable() {
-		fmt.Println(dump.ResponseString(resp))
+		fmt.Fprintln(os.Stderr, dump.ResponseString(resp))
 		return
 	}
 
@@ -1,11 +1,16 @@
 package provider
 
 import (
+	"crypto/tls"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
 )
 
 func TestClientDoGetOK(t *testing.T) {
@@ -16,7 +21,7 @@ func TestClientDoGetOK(t *testing.T) {
 
 	rt := NewDefaultTransport(false)
 
-	hc, err := NewHTTPClient(rt)
+	hc, err := NewHTTPClient(rt, cfg.NewIDPAccount())
 	require.Nil(t, err)
 
 	// hc := &HTTPClient{Client: http.Client{}}
@@ -39,7 +44,7 @@ func TestClientDisableRedirect(t *testing.T) {
 
 	rt := NewDefaultTransport(false)
 
-	hc, err := NewHTTPClient(rt)
+	hc, err := NewHTTPClient(rt, cfg.NewIDPAccount())
 	require.Nil(t, err)
 
 	hc.DisableFollowRedirect()
@@ -70,3 +75,111 @@ func TestClientDoResponseCheck(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, 400, res.StatusCode)
 }
+
+func TestNewTransportMinTLSVersion(t *testing.T) {
+
+	tr := NewTransport(&cfg.IDPAccount{MinTLSVersion: "1.2"})
+	require.Equal(t, uint16(tls.VersionTLS12), tr.TLSClientConfig.MinVersion)
+
+	// unset defaults to TLS 1.2
+	tr = NewTransport(&cfg.IDPAccount{})
+	require.Equal(t, uint16(tls.VersionTLS12), tr.TLSClientConfig.MinVersion)
+}
+
+func TestClientMaxRedirects(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, ts.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	account := cfg.NewIDPAccount()
+	account.MaxRedirects = 3
+
+	hc, err := NewHTTPClient(NewDefaultTransport(false), account)
+	require.Nil(t, err)
+
+	req, err := http.NewRequest("GET", ts.URL+"/", nil)
+	require.Nil(t, err)
+
+	_, err = hc.Do(req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "too many redirects (more than 3), possible misconfiguration")
+	require.Contains(t, err.Error(), "/xxxx")
+}
+
+func TestCheckRedirectLimit(t *testing.T) {
+	via := make([]*http.Request, cfg.DefaultMaxRedirects)
+
+	require.Nil(t, CheckRedirectLimit(0, via))
+	require.Error(t, CheckRedirectLimit(0, append(via, &http.Request{})))
+	require.Nil(t, CheckRedirectLimit(20, append(via, &http.Request{})))
+}
+
+// newDroppingServer a server which drops the connection of the first drops requests, returning the bodies it received
+func newDroppingServer(t *testing.T, drops int) (*httptest.Server, *[]string) {
+	bodies := []string{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		bodies = append(bodies, string(body))
+
+		if len(bodies) <= drops {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.Nil(t, err)
+			conn.Close()
+			return
+		}
+
+		w.Write([]byte("OK"))
+	}))
+
+	return ts, &bodies
+}
+
+func TestClientRetries(t *testing.T) {
+	defer func(sleep func(time.Duration)) { retrySleep = sleep }(retrySleep)
+
+	tests := []struct {
+		name     string
+		retries  int
+		drops    int
+		wantErr  bool
+		wantSent int
+	}{
+		{name: "retried", retries: 2, drops: 2, wantSent: 3},
+		{name: "attempts exhausted", retries: 1, drops: 2, wantErr: true, wantSent: 2},
+		{name: "not retried", retries: 0, drops: 1, wantErr: true, wantSent: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slept []time.Duration
+			retrySleep = func(d time.Duration) { slept = append(slept, d) }
+
+			ts, bodies := newDroppingServer(t, tt.drops)
+			defer ts.Close()
+
+			account := cfg.NewIDPAccount()
+			account.LoginRetries = tt.retries
+			account.RetryBackoffSeconds = 3
+
+			hc, err := NewHTTPClient(NewDefaultTransport(false), account)
+			require.Nil(t, err)
+
+			req, err := http.NewRequest("POST", ts.URL, strings.NewReader("totp=123456"))
+			require.Nil(t, err)
+
+			_, err = hc.Do(req)
+			require.Equal(t, tt.wantErr, err != nil, "%v", err)
+
+			// each attempt sends the same body
+			require.Len(t, *bodies, tt.wantSent)
+			for _, body := range *bodies {
+				require.Equal(t, "totp=123456", body)
+			}
+			require.Len(t, slept, tt.wantSent-1)
+		})
+	}
+}
@@ -50,9 +50,9 @@ type JCRedirect struct {
 // New creates a new JumpCloud client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewTransport(idpAccount)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -115,7 +115,7 @@ func (jc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	// Get the OTP and resubmit.
 	if res.StatusCode == 401 {
 		// Get the user's MFA token and re-build the body
-		a.OTP = prompter.StringRequired("MFA Token")
+		a.OTP = prompter.MFACode(loginDetails.MFATokens, func() string { return prompter.StringRequired("MFA Token") })
 		authBody, err = json.Marshal(a)
 		if err != nil {
 			return samlAssertion, errors.Wrap(err, "error building authentication req body after getting MFA Token")
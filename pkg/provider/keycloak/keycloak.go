@@ -2,11 +2,13 @@ package keycloak
 
 import (
 	"bytes"
+	"encoding/base32"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
@@ -21,76 +23,145 @@ import (
 
 var logger = logrus.WithField("provider", "keycloak")
 
+const (
+	totpPeriod      = 30
+	maxTotpAttempts = 3
+
+	// totpBoundary a rejected code within this many seconds of a window boundary is treated as expired
+	totpBoundary = 5
+)
+
+// now the clock used to decide whether a rejected TOTP code expired at a window boundary
+var now = time.Now
+
+// waitForNextTotpWindow sleeps until the next TOTP code is issued
+var waitForNextTotpWindow = func() {
+	time.Sleep(time.Duration(totpPeriod-time.Now().Unix()%totpPeriod) * time.Second)
+}
+
 // Client wrapper around KeyCloak.
 type Client struct {
-	client *provider.HTTPClient
+	client        *provider.HTTPClient
+	tenantID      string
+	totpAutoRetry bool
+	mfaCodeLength int
+	mfaTokens     creds.MFATokenSource
 }
 
 // New create a new KeyCloakClient
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewTransport(idpAccount)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
 
 	return &Client{
-		client: client,
+		client:        client,
+		tenantID:      idpAccount.TenantID,
+		totpAutoRetry: idpAccount.TOTPAutoRetry,
+		mfaCodeLength: idpAccount.MFACodeLength,
 	}, nil
 }
 
 // Authenticate logs into KeyCloak and returns a SAML response
 func (kc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
 
+	kc.mfaTokens = loginDetails.MFATokens
+
+	doc, _, err := kc.login(loginDetails)
+	if err != nil {
+		return "", err
+	}
+
+	var samlAssertion string
+
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok {
+			// submit buttons on the required action pages aren't named
+			return
+		}
+		if name == "SAMLResponse" {
+			val, ok := s.Attr("value")
+			if !ok {
+				log.Fatalf("unable to locate saml assertion value")
+			}
+			samlAssertion = val
+		}
+	})
+
+	if samlAssertion == "" {
+		if action := requiredAction(doc); action != "" {
+			return "", errors.Errorf("keycloak requires you to %s before logging in, sign in with a browser to complete it", action)
+		}
+	}
+
+	return samlAssertion, nil
+}
+
+// VerifyMFA logs into KeyCloak and completes the MFA challenge without retrieving the SAML response
+func (kc *Client) VerifyMFA(loginDetails *creds.LoginDetails) error {
+
+	doc, mfa, err := kc.login(loginDetails)
+	if err != nil {
+		return err
+	}
+
+	if !mfa {
+		return errors.New("no MFA challenge was presented by the IdP")
+	}
+
+	if containsTotpForm(doc) {
+		return errors.New("MFA code was rejected by the IdP")
+	}
+
+	return nil
+}
+
+// login submit the login form followed by the totp form if one is presented
+func (kc *Client) login(loginDetails *creds.LoginDetails) (*goquery.Document, bool, error) {
+
 	authSubmitURL, authForm, err := kc.getLoginForm(loginDetails)
 	if err != nil {
-		return "", errors.Wrap(err, "error retrieving login form from idp")
+		return nil, false, errors.Wrap(err, "error retrieving login form from idp")
 	}
 
 	data, err := kc.postLoginForm(authSubmitURL, authForm)
 	if err != nil {
-		return "", fmt.Errorf("error submitting login form")
+		return nil, false, fmt.Errorf("error submitting login form")
 	}
 	if authSubmitURL == "" {
-		return "", fmt.Errorf("error submitting login form")
+		return nil, false, fmt.Errorf("error submitting login form")
 	}
 
 	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(data))
 	if err != nil {
-		return "", errors.Wrap(err, "error parsing document")
+		return nil, false, errors.Wrap(err, "error parsing document")
 	}
 
-	if containsTotpForm(doc) {
-		totpSubmitURL, err := extractSubmitURL(doc)
+	// the otp required action asks the user to register an authenticator app before the first login
+	if containsTotpSetupForm(doc) {
+		doc, err = kc.setupTotp(doc)
 		if err != nil {
-			return "", errors.Wrap(err, "unable to locate IDP totp form submit URL")
+			return nil, true, err
 		}
 
-		doc, err = kc.postTotpForm(totpSubmitURL, loginDetails.MFAToken, doc)
-		if err != nil {
-			return "", errors.Wrap(err, "error posting totp form")
-		}
+		return doc, true, nil
 	}
 
-	var samlAssertion string
+	if !containsTotpForm(doc) {
+		return doc, false, nil
+	}
 
-	doc.Find("input").Each(func(i int, s *goquery.Selection) {
-		name, ok := s.Attr("name")
-		if !ok {
-			log.Fatalf("unable to locate IDP authentication form submit URL")
-		}
-		if name == "SAMLResponse" {
-			val, ok := s.Attr("value")
-			if !ok {
-				log.Fatalf("unable to locate saml assertion value")
-			}
-			samlAssertion = val
-		}
-	})
+	doc, err = kc.submitTotp(loginDetails.MFAToken, doc)
+	if err != nil {
+		return nil, true, err
+	}
 
-	return samlAssertion, nil
+	return doc, true, nil
 }
 
 func (kc *Client) getLoginForm(loginDetails *creds.LoginDetails) (string, url.Values, error) {
@@ -105,6 +176,13 @@ func (kc *Client) getLoginForm(loginDetails *creds.LoginDetails) (string, url.Va
 		return "", nil, errors.Wrap(err, "failed to build document from response")
 	}
 
+	if containsTenantForm(doc) {
+		doc, err = kc.postTenantForm(doc)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error submitting tenant form")
+		}
+	}
+
 	authForm := url.Values{}
 
 	doc.Find("input").Each(func(i int, s *goquery.Selection) {
@@ -119,6 +197,41 @@ func (kc *Client) getLoginForm(loginDetails *creds.LoginDetails) (string, url.Va
 	return authSubmitURL, authForm, nil
 }
 
+// postTenantForm submit the configured tenant at the organization prompt shown before the login form
+func (kc *Client) postTenantForm(doc *goquery.Document) (*goquery.Document, error) {
+
+	if kc.tenantID == "" {
+		return nil, errors.New("the IdP requires an organization, set tenant_id in the idp account")
+	}
+
+	tenantSubmitURL, err := extractSubmitURL(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to locate IDP tenant form submit URL")
+	}
+
+	tenantForm := url.Values{}
+
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		updateTenantFormData(tenantForm, s, kc.tenantID)
+	})
+
+	logger.WithField("tenantSubmitURL", tenantSubmitURL).Debug("submitting tenant")
+
+	req, err := http.NewRequest("POST", tenantSubmitURL, strings.NewReader(tenantForm.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building tenant request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving login form")
+	}
+
+	return goquery.NewDocumentFromResponse(res)
+}
+
 func (kc *Client) postLoginForm(authSubmitURL string, authForm url.Values) ([]byte, error) {
 
 	req, err := http.NewRequest("POST", authSubmitURL, strings.NewReader(authForm.Encode()))
@@ -141,12 +254,60 @@ func (kc *Client) postLoginForm(authSubmitURL string, authForm url.Values) ([]by
 	return data, nil
 }
 
+// submitTotp post the totp form, prompting for a fresh code if the IdP reports the code was already used
+//
+// When totp auto retry is enabled a code rejected just either side of a window boundary is assumed to have
+// expired before it arrived, so the user is also prompted for the next code.
+func (kc *Client) submitTotp(mfaToken string, doc *goquery.Document) (*goquery.Document, error) {
+
+	for attempt := 1; ; attempt++ {
+		totpSubmitURL, err := extractSubmitURL(doc)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to locate IDP totp form submit URL")
+		}
+
+		doc, err = kc.postTotpForm(totpSubmitURL, mfaToken, doc)
+		if err != nil {
+			return nil, errors.Wrap(err, "error posting totp form")
+		}
+
+		if !containsTotpForm(doc) {
+			return doc, nil
+		}
+
+		reused := containsReusedTotpError(doc)
+		if !reused && !(kc.totpAutoRetry && nearTotpBoundary(now())) {
+			return doc, nil
+		}
+
+		if attempt >= maxTotpAttempts {
+			if reused {
+				return nil, errors.New("mfa code rejected as already used")
+			}
+			return nil, errors.New("mfa code rejected as expired")
+		}
+
+		if reused {
+			logger.WithField("attempt", attempt).Debug("totp code already used")
+			fmt.Println("MFA code has already been used, please wait for the next code")
+		} else {
+			logger.WithField("attempt", attempt).Debug("totp code rejected at window boundary")
+			fmt.Println("MFA code expired before it was accepted, please wait for the next code")
+		}
+
+		waitForNextTotpWindow()
+
+		// the supplied token has been consumed so prompt for a new one
+		mfaToken = ""
+	}
+}
+
 func (kc *Client) postTotpForm(totpSubmitURL string, mfaToken string, doc *goquery.Document) (*goquery.Document, error) {
 
 	otpForm := url.Values{}
 
 	if mfaToken == "" {
-		mfaToken = prompter.RequestSecurityCode("000000")
+		mfaToken = prompter.MFACode(kc.mfaTokens, func() string { return prompter.RequestSecurityCodeLength(kc.mfaCodeLength) })
 	}
 
 	doc.Find("input").Each(func(i int, s *goquery.Selection) {
@@ -173,6 +334,75 @@ func (kc *Client) postTotpForm(totpSubmitURL string, mfaToken string, doc *goque
 	return doc, nil
 }
 
+// setupTotp complete the configure otp required action, showing the secret to add to an authenticator app such as
+// FreeOTP or Google Authenticator and submitting the first code it generates
+func (kc *Client) setupTotp(doc *goquery.Document) (*goquery.Document, error) {
+
+	totpSubmitURL, err := extractSubmitURL(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to locate IDP totp setup form submit URL")
+	}
+
+	secret, _ := doc.Find("input[name=totpSecret]").Attr("value")
+
+	fmt.Println("Keycloak requires an authenticator app, such as FreeOTP or Google Authenticator, to be set up.")
+	fmt.Println("Add an account to the app with this key, time based with 6 digits:")
+	fmt.Println("")
+	fmt.Println("    " + encodeTotpSecret(secret))
+	fmt.Println("")
+
+	mfaToken := prompter.RequestSecurityCodeLength(kc.mfaCodeLength)
+
+	setupForm := url.Values{}
+
+	doc.Find("input").Each(func(i int, s *goquery.Selection) {
+		updateTotpSetupFormData(setupForm, s, mfaToken)
+	})
+
+	req, err := http.NewRequest("POST", totpSubmitURL, strings.NewReader(setupForm.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building totp setup request")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := kc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving content")
+	}
+
+	doc, err = goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading totp setup form response")
+	}
+
+	if containsTotpSetupForm(doc) {
+		return nil, errors.New("mfa code was rejected while setting up the authenticator app")
+	}
+
+	return doc, nil
+}
+
+// encodeTotpSecret the base32 key authenticator apps accept, in groups of four like the keycloak manual setup page
+func encodeTotpSecret(secret string) string {
+	encoded := strings.TrimRight(base32.StdEncoding.EncodeToString([]byte(secret)), "=")
+
+	var groups []string
+	for len(encoded) > 4 {
+		groups = append(groups, encoded[:4])
+		encoded = encoded[4:]
+	}
+
+	return strings.Join(append(groups, encoded), " ")
+}
+
+// nearTotpBoundary true when the time is within totpBoundary seconds of the start or end of a TOTP window
+func nearTotpBoundary(t time.Time) bool {
+	offset := t.Unix() % totpPeriod
+
+	return offset < totpBoundary || totpPeriod-offset <= totpBoundary
+}
+
 func extractSubmitURL(doc *goquery.Document) (string, error) {
 
 	var submitURL string
@@ -193,13 +423,49 @@ func extractSubmitURL(doc *goquery.Document) (string, error) {
 }
 
 func containsTotpForm(doc *goquery.Document) bool {
-	totpIndex := doc.Find("input#totp").Index()
+	if containsTotpSetupForm(doc) {
+		return false
+	}
+
+	// keycloak 12 and later name the field otp
+	return doc.Find("input#totp, input#otp").Size() > 0
+}
+
+func containsTotpSetupForm(doc *goquery.Document) bool {
+	return doc.Find("input[name=totpSecret]").Size() > 0
+}
+
+// requiredActions the keycloak required actions saml2aws can't complete, by the id of their form
+var requiredActions = map[string]string{
+	"kc-passwd-update-form":  "update your password",
+	"kc-update-profile-form": "update your profile",
+	"kc-update-email-form":   "update your email address",
+	"kc-terms-text":          "accept the terms and conditions",
+}
+
+// requiredAction describe the required action the page asks for, empty when it isn't a required action page
+func requiredAction(doc *goquery.Document) string {
+	for id, action := range requiredActions {
+		if doc.Find("#"+id).Size() > 0 {
+			return action
+		}
+	}
+
+	return ""
+}
 
-	if totpIndex != -1 {
-		return true
+func containsTenantForm(doc *goquery.Document) bool {
+	if doc.Find("input[type=password]").Size() > 0 {
+		return false
 	}
 
-	return false
+	return doc.Find("input#organization, input#tenant").Size() > 0
+}
+
+func containsReusedTotpError(doc *goquery.Document) bool {
+	feedback := strings.ToLower(doc.Find("span.kc-feedback-text").Text())
+
+	return strings.Contains(feedback, "already been used") || strings.Contains(feedback, "reused")
 }
 
 func updateKeyCloakFormData(authForm url.Values, s *goquery.Selection, user *creds.LoginDetails) {
@@ -223,6 +489,24 @@ func updateKeyCloakFormData(authForm url.Values, s *goquery.Selection, user *cre
 	}
 }
 
+func updateTenantFormData(tenantForm url.Values, s *goquery.Selection, tenantID string) {
+	name, ok := s.Attr("name")
+	if !ok {
+		return
+	}
+	lname := strings.ToLower(name)
+	if strings.Contains(lname, "organization") || strings.Contains(lname, "tenant") {
+		tenantForm.Add(name, tenantID)
+	} else {
+		// pass through any hidden fields
+		val, ok := s.Attr("value")
+		if !ok {
+			return
+		}
+		tenantForm.Add(name, val)
+	}
+}
+
 func updateOTPFormData(otpForm url.Values, s *goquery.Selection, token string) {
 	name, ok := s.Attr("name")
 	//	log.Printf("name = %s ok = %v", name, ok)
@@ -230,8 +514,36 @@ func updateOTPFormData(otpForm url.Values, s *goquery.Selection, token string) {
 		return
 	}
 	lname := strings.ToLower(name)
-	if strings.Contains(lname, "totp") {
+	if lname == "otp" || strings.Contains(lname, "totp") {
 		otpForm.Add(name, token)
 	}
 
 }
+
+func updateTotpSetupFormData(setupForm url.Values, s *goquery.Selection, token string) {
+	name, ok := s.Attr("name")
+	if !ok {
+		return
+	}
+
+	// checkboxes are submitted as the page ticks them
+	inputType, _ := s.Attr("type")
+	if _, checked := s.Attr("checked"); (inputType == "checkbox" || inputType == "radio") && !checked {
+		return
+	}
+
+	val, _ := s.Attr("value")
+
+	switch name {
+	case "totp":
+		setupForm.Add(name, token)
+	case "userLabel":
+		if val == "" {
+			val = "saml2aws"
+		}
+		setupForm.Add(name, val)
+	default:
+		// pass through the secret and any other hidden fields
+		setupForm.Add(name, val)
+	}
+}
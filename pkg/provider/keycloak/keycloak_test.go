@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 
@@ -44,6 +46,87 @@ func TestClient_getLoginForm(t *testing.T) {
 	}, authForm)
 }
 
+// keycloakPages the example pages served by newKeyCloakServer
+type keycloakPages struct {
+	get     string            // served to GET requests
+	post    string            // served to a POST nothing else matches, a bad request when empty
+	totp    map[string]string // served to a POST of the totp code
+	actions map[string]string // served to a POST to a path containing the key
+}
+
+// newKeyCloakServer serve the example pages with their https://id.example.com links pointing at the server, returning
+// the form of the last POST
+func newKeyCloakServer(t *testing.T, pages keycloakPages) (*httptest.Server, *url.Values) {
+	var ts *httptest.Server
+
+	page := func(name string) []byte {
+		data, err := ioutil.ReadFile(name)
+		require.Nil(t, err)
+		return []byte(strings.Replace(string(data), "https://id.example.com", ts.URL, -1))
+	}
+
+	submitted := &url.Values{}
+
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write(page(pages.get))
+			return
+		}
+
+		r.ParseForm()
+		*submitted = r.PostForm
+
+		for path, name := range pages.actions {
+			if strings.Contains(r.URL.Path, path) {
+				w.Write(page(name))
+				return
+			}
+		}
+
+		if name, ok := pages.totp[r.Form.Get("totp")]; ok {
+			w.Write(page(name))
+			return
+		}
+
+		if pages.post == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write(page(pages.post))
+	}))
+
+	return ts, submitted
+}
+
+func TestClient_getLoginFormWithTenant(t *testing.T) {
+
+	ts, submitted := newKeyCloakServer(t, keycloakPages{get: "example/tenantpage.html", post: "example/loginpage.html"})
+	defer ts.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}, tenantID: "acme"}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	submitURL, authForm, err := kc.getLoginForm(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, "acme", submitted.Get("organization"))
+	require.Equal(t, "kD9s2LqP0aE", submitted.Get("tab_id"))
+	require.Equal(t, strings.Replace(exampleLoginURL, "https://id.example.com", ts.URL, 1), submitURL)
+	require.Equal(t, "test", authForm.Get("username"))
+}
+
+func TestClient_getLoginFormMissingTenant(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{get: "example/tenantpage.html", post: "example/loginpage.html"})
+	defer ts.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	_, _, err := kc.getLoginForm(loginDetails)
+	require.Error(t, err)
+}
+
 func TestClient_postLoginForm(t *testing.T) {
 
 	data, err := ioutil.ReadFile("example/mfapage.html")
@@ -81,7 +164,8 @@ func TestClient_postTotpForm(t *testing.T) {
 	require.Nil(t, err)
 
 	pr := &mocks.Prompter{}
-	prompter.SetPrompter(pr)
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
 
 	pr.Mock.On("RequestSecurityCode", "000000").Return("123456")
 
@@ -93,6 +177,43 @@ func TestClient_postTotpForm(t *testing.T) {
 	pr.Mock.AssertCalled(t, "RequestSecurityCode", "000000")
 }
 
+func TestClient_postTotpFormShortCode(t *testing.T) {
+
+	data, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	mfa, err := ioutil.ReadFile("example/mfapage.html")
+	require.Nil(t, err)
+
+	var submitted []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		submitted = append(submitted, r.Form.Get("totp"))
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(mfa))
+	require.Nil(t, err)
+
+	pr := &mocks.Prompter{}
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
+
+	pr.Mock.On("RequestSecurityCode", "000000").Return("12345").Once()
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456").Once()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}, mfaCodeLength: 6}
+
+	_, err = kc.postTotpForm(ts.URL, "", doc)
+	require.Nil(t, err)
+
+	// the short code is caught before it reaches the IdP
+	pr.Mock.AssertNumberOfCalls(t, "RequestSecurityCode", 2)
+	require.Equal(t, []string{"123456"}, submitted)
+}
+
 func TestClient_postTotpFormWithProvidedMFAToken(t *testing.T) {
 
 	data, err := ioutil.ReadFile("example/assertion.html")
@@ -107,7 +228,8 @@ func TestClient_postTotpFormWithProvidedMFAToken(t *testing.T) {
 	require.Nil(t, err)
 
 	pr := &mocks.Prompter{}
-	prompter.SetPrompter(pr)
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
 
 	mfaToken := "123456"
 	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
@@ -117,6 +239,205 @@ func TestClient_postTotpFormWithProvidedMFAToken(t *testing.T) {
 	pr.Mock.AssertNumberOfCalls(t, "RequestSecurityCode", 0)
 }
 
+func TestClient_submitTotpReusedCode(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{totp: map[string]string{
+		"111111": "example/mfareused.html",
+		"654321": "example/assertion.html",
+	}})
+	defer ts.Close()
+
+	mfa, err := ioutil.ReadFile("example/mfapage.html")
+	require.Nil(t, err)
+
+	defer func(wait func()) { waitForNextTotpWindow = wait }(waitForNextTotpWindow)
+
+	waits := 0
+	waitForNextTotpWindow = func() { waits++ }
+
+	pr := &mocks.Prompter{}
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
+
+	pr.Mock.On("RequestSecurityCode", "000000").Return("654321")
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(strings.Replace(string(mfa), "https://id.example.com", ts.URL, -1))))
+	require.Nil(t, err)
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+
+	doc, err = kc.submitTotp("111111", doc)
+	require.Nil(t, err)
+	require.False(t, containsTotpForm(doc))
+	require.Equal(t, 1, waits)
+
+	pr.Mock.AssertNumberOfCalls(t, "RequestSecurityCode", 1)
+}
+
+func TestClient_submitTotpAutoRetryAtBoundary(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{totp: map[string]string{
+		"111111": "example/mfainvalid.html",
+		"654321": "example/assertion.html",
+	}})
+	defer ts.Close()
+
+	mfa, err := ioutil.ReadFile("example/mfapage.html")
+	require.Nil(t, err)
+
+	defer func(wait func()) { waitForNextTotpWindow = wait }(waitForNextTotpWindow)
+
+	waits := 0
+	waitForNextTotpWindow = func() { waits++ }
+
+	// rejected one second into a new window
+	now = func() time.Time { return time.Unix(1500000001, 0) }
+	defer func() { now = time.Now }()
+
+	pr := &mocks.Prompter{}
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
+
+	pr.Mock.On("RequestSecurityCode", "000000").Return("654321")
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(strings.Replace(string(mfa), "https://id.example.com", ts.URL, -1))))
+	require.Nil(t, err)
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}, totpAutoRetry: true}
+
+	doc, err = kc.submitTotp("111111", doc)
+	require.Nil(t, err)
+	require.False(t, containsTotpForm(doc))
+	require.Equal(t, 1, waits)
+
+	pr.Mock.AssertNumberOfCalls(t, "RequestSecurityCode", 1)
+}
+
+func TestClient_submitTotpNoAutoRetry(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{totp: map[string]string{
+		"111111": "example/mfainvalid.html",
+		"654321": "example/assertion.html",
+	}})
+	defer ts.Close()
+
+	mfa, err := ioutil.ReadFile("example/mfapage.html")
+	require.Nil(t, err)
+
+	defer func(wait func()) { waitForNextTotpWindow = wait }(waitForNextTotpWindow)
+
+	waits := 0
+	waitForNextTotpWindow = func() { waits++ }
+
+	defer func() { now = time.Now }()
+
+	pr := &mocks.Prompter{}
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
+
+	tests := []struct {
+		name      string
+		autoRetry bool
+		rejected  time.Time
+	}{
+		{name: "disabled at boundary", autoRetry: false, rejected: time.Unix(1500000001, 0)},
+		{name: "enabled mid window", autoRetry: true, rejected: time.Unix(1500000015, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = func() time.Time { return tt.rejected }
+
+			doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(strings.Replace(string(mfa), "https://id.example.com", ts.URL, -1))))
+			require.Nil(t, err)
+
+			kc := Client{client: &provider.HTTPClient{Client: http.Client{}}, totpAutoRetry: tt.autoRetry}
+
+			doc, err = kc.submitTotp("111111", doc)
+			require.Nil(t, err)
+			require.True(t, containsTotpForm(doc))
+		})
+	}
+
+	require.Equal(t, 0, waits)
+	pr.Mock.AssertNotCalled(t, "RequestSecurityCode", "000000")
+}
+
+func TestNearTotpBoundary(t *testing.T) {
+	require.True(t, nearTotpBoundary(time.Unix(1500000000, 0)))
+	require.True(t, nearTotpBoundary(time.Unix(1500000004, 0)))
+	require.True(t, nearTotpBoundary(time.Unix(1500000027, 0)))
+	require.False(t, nearTotpBoundary(time.Unix(1500000005, 0)))
+	require.False(t, nearTotpBoundary(time.Unix(1500000020, 0)))
+}
+
+func TestClient_containsReusedTotpError(t *testing.T) {
+	data, err := ioutil.ReadFile("example/mfareused.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	require.True(t, containsReusedTotpError(doc))
+
+	data, err = ioutil.ReadFile("example/mfapage.html")
+	require.Nil(t, err)
+
+	doc, err = goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	require.False(t, containsReusedTotpError(doc))
+}
+
+func TestClient_VerifyMFA(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{
+		get:  "example/loginpage.html",
+		post: "example/mfapage.html",
+		totp: map[string]string{"123456": "example/assertion.html"},
+	})
+	defer ts.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123", MFAToken: "123456"}
+
+	err := kc.VerifyMFA(loginDetails)
+	require.Nil(t, err)
+}
+
+func TestClient_VerifyMFARejected(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{
+		get:  "example/loginpage.html",
+		post: "example/mfapage.html",
+		totp: map[string]string{"123456": "example/assertion.html"},
+	})
+	defer ts.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123", MFAToken: "000000"}
+
+	err := kc.VerifyMFA(loginDetails)
+	require.Error(t, err)
+}
+
+func TestClient_containsTenantForm(t *testing.T) {
+	data, err := ioutil.ReadFile("example/tenantpage.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	require.True(t, containsTenantForm(doc))
+
+	data, err = ioutil.ReadFile("example/loginpage.html")
+	require.Nil(t, err)
+
+	doc, err = goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	require.False(t, containsTenantForm(doc))
+}
+
 func TestClient_containsTotpForm(t *testing.T) {
 	data, err := ioutil.ReadFile("example/mfapage.html")
 	require.Nil(t, err)
@@ -126,3 +447,70 @@ func TestClient_containsTotpForm(t *testing.T) {
 
 	require.True(t, containsTotpForm(doc))
 }
+
+func TestClient_AuthenticateTotpSetup(t *testing.T) {
+
+	ts, submitted := newKeyCloakServer(t, keycloakPages{
+		get:     "example/loginpage.html",
+		post:    "example/totpsetup.html",
+		actions: map[string]string{"required-action": "example/assertion.html"},
+	})
+	defer ts.Close()
+
+	pr := &mocks.Prompter{}
+	previous := prompter.SetPrompter(pr)
+	defer prompter.SetPrompter(previous)
+
+	pr.Mock.On("RequestSecurityCode", "000000").Return("123456")
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	samlAssertion, err := kc.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, "abc123", samlAssertion)
+	require.Equal(t, url.Values{
+		"totp":            []string{"123456"},
+		"totpSecret":      []string{"l8Pd0HEq3gL5DW9uKpDE"},
+		"userLabel":       []string{"saml2aws"},
+		"logout-sessions": []string{"on"},
+	}, *submitted)
+}
+
+func TestClient_AuthenticateRequiredAction(t *testing.T) {
+
+	ts, _ := newKeyCloakServer(t, keycloakPages{
+		get:     "example/loginpage.html",
+		post:    "example/updatepassword.html",
+		actions: map[string]string{"required-action": "example/assertion.html"},
+	})
+	defer ts.Close()
+
+	kc := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+	loginDetails := &creds.LoginDetails{URL: ts.URL, Username: "test", Password: "test123"}
+
+	_, err := kc.Authenticate(loginDetails)
+	require.EqualError(t, err, "keycloak requires you to update your password before logging in, sign in with a browser to complete it")
+}
+
+func TestEncodeTotpSecret(t *testing.T) {
+	require.Equal(t, "NQ4F AZBQ JBCX CM3H JQ2U IVZZ OVFX ARCF", encodeTotpSecret("l8Pd0HEq3gL5DW9uKpDE"))
+}
+
+func TestClient_containsTotpSetupForm(t *testing.T) {
+	data, err := ioutil.ReadFile("example/totpsetup.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	require.True(t, containsTotpSetupForm(doc))
+	require.False(t, containsTotpForm(doc))
+
+	// newer keycloak releases name the code field otp
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(`<form action="/otp"><input id="otp" name="otp" type="text"/></form>`))
+	require.Nil(t, err)
+
+	require.True(t, containsTotpForm(doc))
+	require.False(t, containsTotpSetupForm(doc))
+}
@@ -0,0 +1,71 @@
+package okta
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// errMissingSAMLResponse returned when the SAML response can't be located in the response body
+var errMissingSAMLResponse = errors.New("unable to locate saml response")
+
+// assertionRetryDelay the pause before fetching the assertion again
+const assertionRetryDelay = 2 * time.Second
+
+// extractSAMLAssertion locate the base64 encoded assertion in the supplied response body
+//
+// If a JSON path is configured and the body is a JSON document the assertion is read from that
+// path, otherwise this falls back to the SAMLResponse input in the HTML form.
+func extractSAMLAssertion(body []byte, jsonPath string) (string, error) {
+
+	if jsonPath != "" && json.Valid(body) {
+		samlAssertion := gjson.GetBytes(body, jsonPath).String()
+		if samlAssertion == "" {
+			return "", errMissingSAMLResponse
+		}
+
+		return samlAssertion, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build document from response")
+	}
+
+	samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
+	if !ok {
+		return "", errMissingSAMLResponse
+	}
+
+	logger.WithField("bytes", len(samlAssertion)).Debug("extracted SAML assertion")
+
+	return samlAssertion, nil
+}
+
+// extractSAMLAssertionWithRetry fetch a response body and extract the assertion from it, fetching it again up to
+// maxRetries times when the body doesn't contain an assertion
+//
+// IdPs occasionally return a successful but empty or partial page, fetch should return an error for an
+// unsuccessful response so that isn't retried.
+func extractSAMLAssertionWithRetry(fetch func() ([]byte, error), jsonPath string, maxRetries int) (string, error) {
+
+	for attempt := 0; ; attempt++ {
+		body, err := fetch()
+		if err != nil {
+			return "", err
+		}
+
+		samlAssertion, err := extractSAMLAssertion(body, jsonPath)
+		if err != errMissingSAMLResponse || attempt >= maxRetries {
+			return samlAssertion, err
+		}
+
+		logger.WithField("attempt", attempt+1).Debug("saml response missing from successful response, retrying")
+
+		sleep(assertionRetryDelay)
+	}
+}
@@ -0,0 +1,88 @@
+package okta
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractSAMLAssertionFromJSON(t *testing.T) {
+	data, err := ioutil.ReadFile("example/assertion.json")
+	require.Nil(t, err)
+
+	samlAssertion, err := extractSAMLAssertion(data, "data.saml")
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+}
+
+func TestExtractSAMLAssertionFromJSONMissingPath(t *testing.T) {
+	data, err := ioutil.ReadFile("example/assertion.json")
+	require.Nil(t, err)
+
+	_, err = extractSAMLAssertion(data, "data.missing")
+	require.Equal(t, errMissingSAMLResponse, err)
+}
+
+func TestExtractSAMLAssertionFromForm(t *testing.T) {
+	data, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	// a configured path is ignored when the body isn't JSON
+	samlAssertion, err := extractSAMLAssertion(data, "data.saml")
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+
+	samlAssertion, err = extractSAMLAssertion(data, "")
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+}
+
+func TestExtractSAMLAssertionWithRetry(t *testing.T) {
+	data, err := ioutil.ReadFile("example/assertion.html")
+	require.Nil(t, err)
+
+	slept := []time.Duration{}
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	// the first response is a successful but empty page
+	responses := [][]byte{[]byte("<html><body></body></html>"), data}
+
+	fetches := 0
+	samlAssertion, err := extractSAMLAssertionWithRetry(func() ([]byte, error) {
+		fetches++
+		return responses[fetches-1], nil
+	}, "", 2)
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, 2, fetches)
+	require.Equal(t, []time.Duration{2 * time.Second}, slept)
+}
+
+func TestExtractSAMLAssertionWithRetryPersistentlyMissing(t *testing.T) {
+	slept := 0
+	sleep = func(time.Duration) { slept++ }
+	defer func() { sleep = time.Sleep }()
+
+	fetches := 0
+	_, err := extractSAMLAssertionWithRetry(func() ([]byte, error) {
+		fetches++
+		return []byte("<html><body><form></form></body></html>"), nil
+	}, "", 2)
+	require.Equal(t, errMissingSAMLResponse, err)
+	require.Equal(t, 3, fetches)
+	require.Equal(t, 2, slept)
+
+	// failed requests aren't retried
+	fetches = 0
+	_, err = extractSAMLAssertionWithRetry(func() ([]byte, error) {
+		fetches++
+		return nil, errors.New("request for url failed status: 500")
+	}, "", 2)
+	require.Error(t, err)
+	require.Equal(t, 1, fetches)
+	require.Equal(t, 2, slept)
+}
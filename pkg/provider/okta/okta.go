@@ -18,6 +18,7 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/versent/saml2aws/pkg/cfg"
 	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/page"
 	"github.com/versent/saml2aws/pkg/provider"
 
 	"encoding/json"
@@ -33,6 +34,15 @@ const (
 
 var logger = logrus.WithField("provider", "okta")
 
+// mfaPollInterval the time between polls of a push MFA transaction
+var mfaPollInterval = time.Second
+
+// sleep used while waiting for MFA approval and between assertion fetches, replaced in tests
+var sleep = time.Sleep
+
+// maxBootstrapRedirects limits the number of org2org bootstrap forms followed during a single login
+const maxBootstrapRedirects = 5
+
 var (
 	supportedMfaOptions = map[string]string{
 		IdentifierDuoMfa:      "DUO MFA authentication",
@@ -45,8 +55,15 @@ var (
 
 // Client is a wrapper representing a Okta SAML client
 type Client struct {
-	client *provider.HTTPClient
-	mfa    string
+	client            *provider.HTTPClient
+	mfa               string
+	autoMFAPreference []string
+	mfaInitialDelay   time.Duration
+	mfaTimeout        time.Duration
+	assertionJSONPath string
+	maxRetries        int
+	mfaCodeLength     int
+	mfaTokens         creds.MFATokenSource
 }
 
 // AuthRequest represents an mfa okta request
@@ -64,9 +81,9 @@ type VerifyRequest struct {
 // New creates a new Okta client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewTransport(idpAccount)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -76,14 +93,22 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	client.CheckResponseStatus = provider.SuccessOrRedirectResponseValidator
 
 	return &Client{
-		client: client,
-		mfa:    idpAccount.MFA,
+		client:            client,
+		mfa:               idpAccount.MFA,
+		autoMFAPreference: idpAccount.AutoMFAPreferenceList(),
+		mfaInitialDelay:   time.Duration(idpAccount.MFAInitialDelay) * time.Millisecond,
+		mfaTimeout:        time.Duration(idpAccount.MFATimeout) * time.Second,
+		assertionJSONPath: idpAccount.AssertionJSONPath,
+		maxRetries:        idpAccount.MaxRetries,
+		mfaCodeLength:     idpAccount.MFACodeLength,
 	}, nil
 }
 
 // Authenticate logs into Okta and returns a SAML response
 func (oc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
 
+	oc.mfaTokens = loginDetails.MFATokens
+
 	var samlAssertion string
 
 	oktaURL, err := url.Parse(loginDetails.URL)
@@ -152,14 +177,32 @@ func (oc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 		return samlAssertion, errors.Wrap(err, "error retrieving verify response")
 	}
 
-	//try to extract SAMLResponse
-	doc, err := goquery.NewDocumentFromResponse(res)
+	body, err = oc.followBootstrapRedirects(res)
 	if err != nil {
-		return samlAssertion, errors.Wrap(err, "error parsing document")
+		return samlAssertion, errors.Wrap(err, "error following org2org bootstrap redirect")
 	}
 
-	samlAssertion, ok := doc.Find("input[name=\"SAMLResponse\"]").Attr("value")
-	if !ok {
+	//try to extract SAMLResponse, the session cookie is set by now so a retry only needs the app URL
+	retrying := false
+	samlAssertion, err = extractSAMLAssertionWithRetry(func() ([]byte, error) {
+		if !retrying {
+			retrying = true
+			return body, nil
+		}
+
+		req, err := http.NewRequest("GET", loginDetails.URL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building saml response request")
+		}
+
+		res, err := oc.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "error retrieving saml response")
+		}
+
+		return oc.followBootstrapRedirects(res)
+	}, oc.assertionJSONPath, oc.maxRetries)
+	if err != nil {
 		return samlAssertion, errors.Wrap(err, "unable to locate saml response")
 	}
 
@@ -168,18 +211,111 @@ func (oc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 	return samlAssertion, nil
 }
 
+// followBootstrapRedirects submit any org2org bootstrap forms which carry the login from a spoke org to the hub
+// org, returning the body of the first response which isn't a bootstrap form
+func (oc *Client) followBootstrapRedirects(res *http.Response) ([]byte, error) {
+	for i := 0; ; i++ {
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "error retrieving body from response")
+		}
+
+		form, err := bootstrapForm(body)
+		if err != nil {
+			return nil, err
+		}
+		if form == nil {
+			return body, nil
+		}
+
+		if i == maxBootstrapRedirects {
+			return nil, errors.Errorf("exceeded %d org2org bootstrap redirects", maxBootstrapRedirects)
+		}
+
+		action, err := res.Request.URL.Parse(form.URL)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing bootstrap form action")
+		}
+		form.URL = action.String()
+
+		logger.WithField("url", form.URL).Debug("following org2org bootstrap redirect")
+
+		res, err = form.Submit(oc.client)
+		if err != nil {
+			return nil, errors.Wrap(err, "error submitting bootstrap form")
+		}
+	}
+}
+
+// bootstrapForm locate a form relaying a SAML message between Okta orgs, this is either a SAMLRequest sent to
+// the spoke org or a SAMLResponse posted to the inbound IdP endpoint of the hub org, nil if there is none
+func bootstrapForm(body []byte) (*page.Form, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing document")
+	}
+
+	var form *page.Form
+
+	doc.Find("form[action]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		action, _ := s.Attr("action")
+
+		if s.Find("input[name=SAMLRequest]").Size() == 0 &&
+			!(s.Find("input[name=SAMLResponse]").Size() > 0 && strings.Contains(action, "/sso/saml2/")) {
+			return true
+		}
+
+		form, err = page.NewFormFromDocument(doc, fmt.Sprintf("form[action=%q]", action))
+
+		return false
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing bootstrap form")
+	}
+
+	return form, nil
+}
+
 func parseMfaIdentifer(json string, arrayPosition int) string {
 	mfaProvider := gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.provider", arrayPosition)).String()
 	factorType := strings.ToUpper(gjson.Get(json, fmt.Sprintf("_embedded.factors.%d.factorType", arrayPosition)).String())
 	return fmt.Sprintf("%s %s", mfaProvider, factorType)
 }
 
-func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
+// preferredMfaOption when mfa is Auto select the first supported factor in the configured preference order, each
+// preference matches either the factor type such as push or the full identifier such as OKTA PUSH
+func (oc *Client) preferredMfaOption(resp string) (int, bool) {
+	if !strings.EqualFold(oc.mfa, "Auto") {
+		return 0, false
+	}
 
-	stateToken := gjson.Get(resp, "stateToken").String()
+	factors := gjson.Get(resp, "_embedded.factors").Array()
+
+	for _, preference := range oc.autoMFAPreference {
+		for i := range factors {
+			identifier := parseMfaIdentifer(resp, i)
+			if _, ok := supportedMfaOptions[identifier]; !ok {
+				continue
+			}
+
+			factorType := gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.factorType", i)).String()
+			if strings.EqualFold(preference, factorType) || strings.EqualFold(preference, identifier) {
+				return i, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// selectMfaOption choose the factor to verify, the preferred factor when mfa is Auto, the factor named by mfa, or the
+// factor the user picks when several are enrolled
+func (oc *Client) selectMfaOption(resp string) int {
+	if preferred, ok := oc.preferredMfaOption(resp); ok {
+		return preferred
+	}
 
-	// choose an mfa option if there are multiple enabled
-	mfaOption := 0
 	var mfaOptions []string
 	for i := range gjson.Get(resp, "_embedded.factors").Array() {
 		identifier := parseMfaIdentifer(resp, i)
@@ -190,16 +326,30 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 		}
 	}
 
-	if oc.mfa != "AUTO" {
-		for _, val := range mfaOptions {
-			if strings.HasPrefix(val, oc.mfa) {
-				mfaOptions = []string{val}
-				break
+	if !strings.EqualFold(oc.mfa, "Auto") {
+		for i, val := range mfaOptions {
+			if strings.HasPrefix(strings.ToUpper(val), strings.ToUpper(oc.mfa)) {
+				return i
 			}
 		}
+
+		fmt.Printf("MFA %s isn't enrolled for the user\n", oc.mfa)
 	}
+
 	if len(mfaOptions) > 1 {
-		mfaOption = prompter.Choose("Select which MFA option to use", mfaOptions)
+		return prompter.Choose("Select which MFA option to use", mfaOptions)
+	}
+
+	return 0
+}
+
+func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
+
+	stateToken := gjson.Get(resp, "stateToken").String()
+
+	mfaOption := oc.selectMfaOption(resp)
+	if mfaOption < 0 {
+		return "", errors.Wrap(prompter.ErrPromptRequired, "no MFA option chosen")
 	}
 
 	factorID := gjson.Get(resp, fmt.Sprintf("_embedded.factors.%d.id", mfaOption)).String()
@@ -241,7 +391,12 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 
 	switch mfa := mfaIdentifer; mfa {
 	case IdentifierSmsMfa, IdentifierTotpMfa, IdentifierOktaTotpMfa:
-		verifyCode := prompter.StringRequired("Enter verification code")
+		var verifyCode string
+		if mfa == IdentifierSmsMfa {
+			verifyCode = prompter.MFACode(oc.mfaTokens, func() string { return prompter.StringRequired("Enter verification code") })
+		} else {
+			verifyCode = prompter.MFACode(oc.mfaTokens, func() string { return prompter.RequestMFACode("Enter verification code", oc.mfaCodeLength) })
+		}
 		tokenReq := VerifyRequest{StateToken: stateToken, PassCode: verifyCode}
 		tokenBody := new(bytes.Buffer)
 		json.NewEncoder(tokenBody).Encode(tokenReq)
@@ -269,51 +424,7 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 		return gjson.Get(resp, "sessionToken").String(), nil
 
 	case IdentifierPushMfa:
-
-		fmt.Printf("\nWaiting for approval, please check your Okta Verify app ...")
-
-		// loop until success, error, or timeout
-		for {
-
-			res, err = oc.client.Do(req)
-			if err != nil {
-				return "", errors.Wrap(err, "error retrieving verify response")
-			}
-
-			body, err = ioutil.ReadAll(res.Body)
-			if err != nil {
-				return "", errors.Wrap(err, "error retrieving body from response")
-			}
-
-			// on 'success' status
-			if gjson.Get(string(body), "status").String() == "SUCCESS" {
-				fmt.Printf(" Approved\n\n")
-				return gjson.Get(string(body), "sessionToken").String(), nil
-			}
-
-			// otherwise probably still waiting
-			switch gjson.Get(string(body), "factorResult").String() {
-
-			case "WAITING":
-				time.Sleep(1000)
-				fmt.Printf(".")
-				logger.Debug("Waiting for user to authorize login")
-
-			case "TIMEOUT":
-				fmt.Printf(" Timeout\n")
-				return "", errors.New("User did not accept MFA in time")
-
-			case "REJECTED":
-				fmt.Printf(" Rejected\n")
-				return "", errors.New("MFA rejected by user")
-
-			default:
-				fmt.Printf(" Error\n")
-				return "", errors.New("Unsupported response from Okta, please raise ticket with saml2aws")
-
-			}
-
-		}
+		return oc.pollPush(oktaVerify, stateToken, resp)
 
 	case IdentifierDuoMfa:
 		duoHost := gjson.Get(resp, "_embedded.factor._embedded.verification.host").String()
@@ -372,10 +483,13 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 		}
 
 		duoMfaOption := prompter.Choose("Select a DUO MFA Option", duoMfaOptions)
+		if duoMfaOption < 0 {
+			return "", errors.Wrap(prompter.ErrPromptRequired, "no DUO MFA option chosen")
+		}
 
 		if duoMfaOptions[duoMfaOption] == "Passcode" {
 			//get users DUO MFA Token
-			token = prompter.StringRequired("Enter passcode")
+			token = prompter.MFACode(oc.mfaTokens, func() string { return prompter.StringRequired("Enter passcode") })
 		}
 
 		// send mfa auth request
@@ -447,9 +561,15 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 		fmt.Println(gjson.Get(resp, "response.status").String())
 
 		if duoTxResult != "SUCCESS" {
+			started := time.Now()
+
 			//poll as this is likely a push request
 			for {
-				time.Sleep(3 * time.Second)
+				if oc.mfaTimeout > 0 && time.Since(started) > oc.mfaTimeout {
+					return "", errors.New("User did not accept MFA in time")
+				}
+
+				sleep(3 * time.Second)
 
 				req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
 				if err != nil {
@@ -558,3 +678,89 @@ func verifyMfa(oc *Client, oktaOrgHost string, resp string) (string, error) {
 	// catch all
 	return "", errors.New("no mfa options provided")
 }
+
+// pollPush wait for the Okta Verify push to be approved, polling the transaction until it succeeds, is rejected, or
+// times out
+func (oc *Client) pollPush(oktaVerify, stateToken, resp string) (string, error) {
+	fmt.Printf("\nWaiting for approval, please check your Okta Verify app ...")
+
+	// with number matching on the user taps the number shown here
+	if correctAnswer := gjson.Get(resp, "_embedded.factor._embedded.challenge.correctAnswer").String(); correctAnswer != "" {
+		fmt.Printf("\nSelect %s in Okta Verify to approve the login ...", correctAnswer)
+	}
+
+	started := time.Now()
+
+	// give the push notification time to arrive before the first poll
+	if oc.mfaInitialDelay > 0 {
+		sleep(oc.mfaInitialDelay)
+	}
+
+	// loop until success, error, or timeout
+	for {
+		if oc.mfaTimeout > 0 && time.Since(started) > oc.mfaTimeout {
+			fmt.Printf(" Timeout\n")
+			return "", errors.New("User did not accept MFA in time")
+		}
+
+		// okta links the transaction's poll url, older orgs are polled by verifying the factor again
+		pollURL := gjson.Get(resp, "_links.next.href").String()
+		if pollURL == "" {
+			pollURL = oktaVerify
+		}
+
+		pollBody := new(bytes.Buffer)
+		err := json.NewEncoder(pollBody).Encode(VerifyRequest{StateToken: stateToken})
+		if err != nil {
+			return "", errors.Wrap(err, "error encoding poll request")
+		}
+
+		req, err := http.NewRequest("POST", pollURL, pollBody)
+		if err != nil {
+			return "", errors.Wrap(err, "error building poll request")
+		}
+
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Accept", "application/json")
+
+		res, err := oc.client.Do(req)
+		if err != nil {
+			return "", errors.Wrap(err, "error retrieving verify response")
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return "", errors.Wrap(err, "error retrieving body from response")
+		}
+		resp = string(body)
+
+		// on 'success' status
+		if gjson.Get(resp, "status").String() == "SUCCESS" {
+			fmt.Printf(" Approved\n\n")
+			return gjson.Get(resp, "sessionToken").String(), nil
+		}
+
+		// otherwise probably still waiting
+		switch gjson.Get(resp, "factorResult").String() {
+
+		case "WAITING":
+			sleep(mfaPollInterval)
+			fmt.Printf(".")
+			logger.Debug("Waiting for user to authorize login")
+
+		case "TIMEOUT":
+			fmt.Printf(" Timeout\n")
+			return "", errors.New("User did not accept MFA in time")
+
+		case "REJECTED":
+			fmt.Printf(" Rejected\n")
+			return "", errors.New("MFA rejected by user")
+
+		default:
+			fmt.Printf(" Error\n")
+			return "", errors.New("Unsupported response from Okta, please raise ticket with saml2aws")
+
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package okta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+const exampleAssertion = "PHNhbWxwOlJlc3BvbnNlPjwvc2FtbHA6UmVzcG9uc2U+"
+
+func newOrg2OrgServer(t *testing.T) (*httptest.Server, *[]string) {
+	bootstrap, err := ioutil.ReadFile("example/org2org-bootstrap.html")
+	require.Nil(t, err)
+
+	assertion, err := ioutil.ReadFile("example/org2org-assertion.html")
+	require.Nil(t, err)
+
+	var visited []string
+
+	var ts *httptest.Server
+	ts = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		visited = append(visited, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/api/v1/authn":
+			w.Write([]byte(`{"status":"SUCCESS","sessionToken":"20111ZsWBd6Q"}`))
+		case "/login/sessionCookieRedirect":
+			// the spoke org hands the login to the hub org, the fixture points at the hub host
+			w.Write([]byte(strings.Replace(string(bootstrap), "https://hub.okta.example", ts.URL, -1)))
+		case "/sso/saml2/0oa1hubidp2Xa9jBc0h7":
+			require.Nil(t, r.ParseForm())
+			require.Equal(t, "PHNhbWxwOlJlc3BvbnNlIElEPSJzcG9rZSI+PC9zYW1scDpSZXNwb25zZT4=", r.PostForm.Get("SAMLResponse"))
+			require.Equal(t, "/app/amazon_aws/exk1awsapp0Q2cz9W0h7/sso/saml", r.PostForm.Get("RelayState"))
+			w.Write(assertion)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return ts, &visited
+}
+
+func TestAuthenticateOrg2OrgBootstrap(t *testing.T) {
+	ts, visited := newOrg2OrgServer(t)
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.SkipVerify = true
+
+	oc, err := New(idpAccount)
+	require.Nil(t, err)
+
+	loginDetails := &creds.LoginDetails{URL: ts.URL + "/home/amazon_aws/0oa1spokeapp/272", Username: "test", Password: "test123"}
+
+	samlAssertion, err := oc.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, []string{"/api/v1/authn", "/login/sessionCookieRedirect", "/sso/saml2/0oa1hubidp2Xa9jBc0h7"}, *visited)
+}
+
+func TestBootstrapForm(t *testing.T) {
+	data, err := ioutil.ReadFile("example/org2org-bootstrap.html")
+	require.Nil(t, err)
+
+	form, err := bootstrapForm(data)
+	require.Nil(t, err)
+	require.NotNil(t, form)
+	require.Equal(t, "https://hub.okta.example/sso/saml2/0oa1hubidp2Xa9jBc0h7", form.URL)
+	require.Equal(t, "POST", form.Method)
+
+	data, err = ioutil.ReadFile("example/org2org-assertion.html")
+	require.Nil(t, err)
+
+	// the final assertion posted to AWS isn't a bootstrap form
+	form, err = bootstrapForm(data)
+	require.Nil(t, err)
+	require.Nil(t, form)
+}
+
+func TestFollowBootstrapRedirectsLimit(t *testing.T) {
+	bootstrap, err := ioutil.ReadFile("example/org2org-bootstrap.html")
+	require.Nil(t, err)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Replace(string(bootstrap), "https://hub.okta.example", ts.URL, -1)))
+	}))
+	defer ts.Close()
+
+	oc, err := New(cfg.NewIDPAccount())
+	require.Nil(t, err)
+
+	res, err := oc.client.Get(ts.URL)
+	require.Nil(t, err)
+
+	_, err = oc.followBootstrapRedirects(res)
+	require.Error(t, err)
+}
+
+func TestPreferredMfaOption(t *testing.T) {
+	data, err := ioutil.ReadFile("example/mfa-required.json")
+	require.Nil(t, err)
+
+	resp := string(data)
+
+	oc := &Client{mfa: "Auto", autoMFAPreference: []string{"push", "token:software:totp"}}
+
+	option, ok := oc.preferredMfaOption(resp)
+	require.True(t, ok)
+	require.Equal(t, 3, option)
+
+	// the unsupported u2f factor falls through to the next preference
+	oc.autoMFAPreference = []string{"u2f", "GOOGLE TOKEN:SOFTWARE:TOTP", "push"}
+
+	option, ok = oc.preferredMfaOption(resp)
+	require.True(t, ok)
+	require.Equal(t, 1, option)
+
+	oc.autoMFAPreference = []string{"call"}
+
+	_, ok = oc.preferredMfaOption(resp)
+	require.False(t, ok)
+}
+
+func TestPreferredMfaOptionNotAuto(t *testing.T) {
+	data, err := ioutil.ReadFile("example/mfa-required.json")
+	require.Nil(t, err)
+
+	oc := &Client{mfa: "OKTA", autoMFAPreference: []string{"push"}}
+
+	_, ok := oc.preferredMfaOption(string(data))
+	require.False(t, ok)
+
+	oc = &Client{mfa: "Auto"}
+
+	_, ok = oc.preferredMfaOption(string(data))
+	require.False(t, ok)
+}
+
+func TestSelectMfaOption(t *testing.T) {
+	data, err := ioutil.ReadFile("example/mfa-required.json")
+	require.Nil(t, err)
+
+	require.Equal(t, 3, (&Client{mfa: "PUSH"}).selectMfaOption(string(data)))
+	require.Equal(t, 1, (&Client{mfa: "totp"}).selectMfaOption(string(data)))
+	require.Equal(t, 0, (&Client{mfa: "SMS"}).selectMfaOption(string(data)))
+}
+
+func TestAuthenticatePush(t *testing.T) {
+	defer func(interval time.Duration) { mfaPollInterval = interval }(mfaPollInterval)
+	mfaPollInterval = time.Millisecond
+
+	assertion, err := ioutil.ReadFile("example/org2org-assertion.html")
+	require.Nil(t, err)
+
+	polls := 0
+
+	var ts *httptest.Server
+	ts = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/authn":
+			w.Write([]byte(`{"stateToken":"state","status":"MFA_REQUIRED","_embedded":{"factors":[
+				{"id":"sms1","factorType":"sms","provider":"OKTA","_links":{"verify":{"href":"` + ts.URL + `/api/v1/authn/factors/sms1/verify"}}},
+				{"id":"opf1","factorType":"push","provider":"OKTA","_links":{"verify":{"href":"` + ts.URL + `/api/v1/authn/factors/opf1/verify"}}}]}}`))
+		case "/api/v1/authn/factors/opf1/verify":
+			w.Write([]byte(`{"status":"MFA_CHALLENGE","factorResult":"WAITING","_links":{"next":{"name":"poll","href":"` + ts.URL + `/api/v1/authn/factors/opf1/verify/poll"}}}`))
+		case "/api/v1/authn/factors/opf1/verify/poll":
+			body, err := ioutil.ReadAll(r.Body)
+			require.Nil(t, err)
+			require.JSONEq(t, `{"stateToken":"state"}`, string(body))
+
+			polls++
+			if polls < 3 {
+				w.Write([]byte(`{"status":"MFA_CHALLENGE","factorResult":"WAITING","_links":{"next":{"name":"poll","href":"` + ts.URL + `/api/v1/authn/factors/opf1/verify/poll"}}}`))
+				return
+			}
+			w.Write([]byte(`{"status":"SUCCESS","sessionToken":"session"}`))
+		case "/login/sessionCookieRedirect":
+			require.Equal(t, "session", r.URL.Query().Get("token"))
+			w.Write(assertion)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	idpAccount := cfg.NewIDPAccount()
+	idpAccount.SkipVerify = true
+	idpAccount.MFA = "PUSH"
+
+	oc, err := New(idpAccount)
+	require.Nil(t, err)
+
+	loginDetails := &creds.LoginDetails{URL: ts.URL + "/home/amazon_aws/0oa1app/272", Username: "test", Password: "test123"}
+
+	samlAssertion, err := oc.Authenticate(loginDetails)
+	require.Nil(t, err)
+	require.Equal(t, exampleAssertion, samlAssertion)
+	require.Equal(t, 3, polls)
+}
+
+func TestPollPushInitialDelay(t *testing.T) {
+	tests := []struct {
+		name         string
+		initialDelay time.Duration
+		want         []string
+	}{
+		{name: "delayed", initialDelay: 1500 * time.Millisecond, want: []string{"sleep 1.5s", "poll", "sleep 1s", "poll"}},
+		{name: "not delayed", want: []string{"poll", "sleep 1s", "poll"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := []string{}
+			polls := 0
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				events = append(events, "poll")
+				polls++
+				if polls < 2 {
+					w.Write([]byte(`{"status":"MFA_CHALLENGE","factorResult":"WAITING"}`))
+					return
+				}
+				w.Write([]byte(`{"status":"SUCCESS","sessionToken":"session"}`))
+			}))
+			defer ts.Close()
+
+			sleep = func(d time.Duration) {
+				events = append(events, fmt.Sprintf("sleep %s", d))
+			}
+			defer func() { sleep = time.Sleep }()
+
+			oc, err := New(cfg.NewIDPAccount())
+			require.Nil(t, err)
+			oc.mfaInitialDelay = tt.initialDelay
+
+			sessionToken, err := oc.pollPush(ts.URL, "state", "{}")
+			require.Nil(t, err)
+			require.Equal(t, "session", sessionToken)
+			require.Equal(t, tt.want, events)
+		})
+	}
+}
+
+func TestPollPushTimeout(t *testing.T) {
+	defer func(interval time.Duration) { mfaPollInterval = interval }(mfaPollInterval)
+	mfaPollInterval = 10 * time.Millisecond
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"MFA_CHALLENGE","factorResult":"WAITING"}`))
+	}))
+	defer ts.Close()
+
+	oc, err := New(cfg.NewIDPAccount())
+	require.Nil(t, err)
+	oc.mfaTimeout = 50 * time.Millisecond
+
+	_, err = oc.pollPush(ts.URL, "state", "{}")
+	require.EqualError(t, err, "User did not accept MFA in time")
+}
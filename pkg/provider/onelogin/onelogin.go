@@ -36,6 +36,9 @@ const ProviderName = "OneLogin"
 
 var logger = logrus.WithField("provider", ProviderName)
 
+// sleep used while polling for push approval, replaced in tests
+var sleep = time.Sleep
+
 var (
 	supportedMfaOptions = map[string]string{
 		IdentifierOneLoginProtectMfa: "OLP",
@@ -54,6 +57,14 @@ type Client struct {
 	MFA string
 	// Subdomain is the organisation subdomain in OneLogin.
 	Subdomain string
+	// MFAInitialDelay is the time to wait for a push notification to arrive before the first poll.
+	MFAInitialDelay time.Duration
+	// MFACodeLength is the number of digits expected in a TOTP code.
+	MFACodeLength int
+	// MFATimeout is the time to wait for a push notification to be approved, a minute when it isn't set.
+	MFATimeout time.Duration
+
+	mfaTokens creds.MFATokenSource
 }
 
 // AuthRequest represents an mfa OneLogin request.
@@ -76,16 +87,26 @@ type VerifyRequest struct {
 
 // New creates a new OneLogin client.
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
-	client, err := provider.NewHTTPClient(tr)
+	tr := provider.NewTransport(idpAccount)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
-	return &Client{AppID: idpAccount.AppID, Client: client, MFA: idpAccount.MFA, Subdomain: idpAccount.Subdomain}, nil
+	return &Client{
+		AppID:           idpAccount.AppID,
+		Client:          client,
+		MFA:             idpAccount.MFA,
+		Subdomain:       idpAccount.Subdomain,
+		MFAInitialDelay: time.Duration(idpAccount.MFAInitialDelay) * time.Millisecond,
+		MFACodeLength:   idpAccount.MFACodeLength,
+		MFATimeout:      time.Duration(idpAccount.MFATimeout) * time.Second,
+	}, nil
 }
 
 // Authenticate logs into OneLogin and returns a SAML response.
 func (c *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	c.mfaTokens = loginDetails.MFATokens
+
 	providerURL, err := url.Parse(loginDetails.URL)
 	if err != nil {
 		return "", errors.Wrap(err, "error building providerURL")
@@ -228,6 +249,9 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 	if !preselected && len(mfaOptions) > 1 {
 		option = prompter.Choose("Select which MFA option to use", mfaOptions)
 	}
+	if option < 0 {
+		return "", errors.Wrap(prompter.ErrPromptRequired, "no MFA option chosen")
+	}
 
 	factorID := gjson.Get(resp, fmt.Sprintf("data.0.devices.%d.device_id", option)).String()
 	callbackURL := gjson.Get(resp, "data.0.callback_url").String()
@@ -273,7 +297,12 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 
 	switch mfaIdentifer {
 	case IdentifierSmsMfa, IdentifierTotpMfa:
-		verifyCode := prompter.StringRequired("Enter verification code")
+		var verifyCode string
+		if mfaIdentifer == IdentifierTotpMfa {
+			verifyCode = prompter.MFACode(oc.mfaTokens, func() string { return prompter.RequestMFACode("Enter verification code", oc.MFACodeLength) })
+		} else {
+			verifyCode = prompter.MFACode(oc.mfaTokens, func() string { return prompter.StringRequired("Enter verification code") })
+		}
 		var verifyBody bytes.Buffer
 		json.NewEncoder(&verifyBody).Encode(VerifyRequest{AppID: appID, DeviceID: mfaDeviceID, StateToken: stateToken, OTPToken: verifyCode})
 		req, err := http.NewRequest("POST", callbackURL, &verifyBody)
@@ -320,9 +349,19 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 
 		fmt.Printf("\nWaiting for approval, please check your OneLogin Protect app ...")
 		started := time.Now()
+
+		timeout := oc.MFATimeout
+		if timeout <= 0 {
+			timeout = time.Minute
+		}
+
+		// give the push notification time to arrive before the first poll
+		if oc.MFAInitialDelay > 0 {
+			sleep(oc.MFAInitialDelay)
+		}
 		// loop until success, error, or timeout
 		for {
-			if time.Since(started) > time.Minute {
+			if time.Since(started) > timeout {
 				fmt.Println(" Timeout")
 				return "", errors.New("User did not accept MFA in time")
 			}
@@ -347,7 +386,7 @@ func verifyMFA(oc *Client, oauthToken, appID, resp string) (string, error) {
 
 			switch gjson.Get(string(body), "status.type").String() {
 			case TypePending:
-				time.Sleep(time.Second)
+				sleep(time.Second)
 				fmt.Print(".")
 
 			case TypeSuccess:
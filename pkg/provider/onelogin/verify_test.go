@@ -0,0 +1,89 @@
+package onelogin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+func TestVerifyMFAInitialDelay(t *testing.T) {
+
+	events := []string{}
+	polls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyReq := VerifyRequest{}
+		json.NewDecoder(r.Body).Decode(&verifyReq)
+
+		if !verifyReq.DoNotNotify {
+			events = append(events, "notify")
+			w.Write([]byte(`{"status":{"error":false,"type":"pending"}}`))
+			return
+		}
+
+		events = append(events, "poll")
+		polls++
+		if polls < 2 {
+			w.Write([]byte(`{"status":{"error":false,"type":"pending"}}`))
+			return
+		}
+		w.Write([]byte(`{"status":{"error":false,"type":"success"},"data":"PHNhbWxwOlJlc3BvbnNlPg=="}`))
+	}))
+	defer ts.Close()
+
+	sleep = func(d time.Duration) {
+		events = append(events, fmt.Sprintf("sleep %s", d))
+	}
+	defer func() { sleep = time.Sleep }()
+
+	oc := &Client{
+		Client:          &provider.HTTPClient{Client: http.Client{}},
+		MFAInitialDelay: 1500 * time.Millisecond,
+	}
+
+	resp := fmt.Sprintf(`{"data":[{"state_token":"abc","callback_url":"%s","devices":[{"device_type":"OneLogin Protect","device_id":123}]}]}`, ts.URL)
+
+	samlAssertion, err := verifyMFA(oc, "token", "456", resp)
+	require.Nil(t, err)
+	require.Equal(t, "PHNhbWxwOlJlc3BvbnNlPg==", samlAssertion)
+	require.Equal(t, []string{"notify", "sleep 1.5s", "poll", "sleep 1s", "poll"}, events)
+}
+
+func TestVerifyMFANoInitialDelay(t *testing.T) {
+
+	events := []string{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyReq := VerifyRequest{}
+		json.NewDecoder(r.Body).Decode(&verifyReq)
+
+		if !verifyReq.DoNotNotify {
+			events = append(events, "notify")
+			w.Write([]byte(`{"status":{"error":false,"type":"pending"}}`))
+			return
+		}
+
+		events = append(events, "poll")
+		w.Write([]byte(`{"status":{"error":false,"type":"success"},"data":"PHNhbWxwOlJlc3BvbnNlPg=="}`))
+	}))
+	defer ts.Close()
+
+	sleep = func(d time.Duration) {
+		events = append(events, fmt.Sprintf("sleep %s", d))
+	}
+	defer func() { sleep = time.Sleep }()
+
+	oc := &Client{Client: &provider.HTTPClient{Client: http.Client{}}}
+
+	resp := fmt.Sprintf(`{"data":[{"state_token":"abc","callback_url":"%s","devices":[{"device_type":"OneLogin Protect","device_id":123}]}]}`, ts.URL)
+
+	_, err := verifyMFA(oc, "token", "456", resp)
+	require.Nil(t, err)
+	require.Equal(t, []string{"notify", "poll"}, events)
+}
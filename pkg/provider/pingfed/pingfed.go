@@ -25,14 +25,15 @@ var logger = logrus.WithField("provider", "pingfed")
 type Client struct {
 	client     *provider.HTTPClient
 	idpAccount *cfg.IDPAccount
+	mfaTimeout time.Duration
 }
 
 // New create a new PingFed client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewTransport(idpAccount)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -44,11 +45,18 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 	return &Client{
 		client:     client,
 		idpAccount: idpAccount,
+		mfaTimeout: time.Duration(idpAccount.MFATimeout) * time.Second,
 	}, nil
 }
 
 type ctxKey string
 
+// swipePollInterval how often the PingID status is polled while waiting for the swipe
+var swipePollInterval = 3 * time.Second
+
+// errSwipeTimeout returned when nobody approved the PingID swipe in time
+var errSwipeTimeout = errors.New("PingID swipe wasn't approved in time")
+
 // Authenticate Authenticate to PingFed and return the data from the body of the SAML assertion.
 func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
 	url := fmt.Sprintf("%s/idp/startSSO.ping?PartnerSpId=%s", loginDetails.URL, ac.idpAccount.AmazonWebservicesURN)
@@ -111,6 +119,12 @@ func (ac *Client) handleLogin(ctx context.Context, doc *goquery.Document) (conte
 		return ctx, nil, errors.Wrap(err, "error extracting login form")
 	}
 
+	// the login page shown again means the username or password was rejected
+	if ctx.Value(ctxKey("loginSubmitted")) != nil {
+		return ctx, nil, errors.New("login failed, check the username and password")
+	}
+	ctx = context.WithValue(ctx, ctxKey("loginSubmitted"), true)
+
 	form.Values.Set("pf.username", loginDetails.Username)
 	form.Values.Set("pf.pass", loginDetails.Password)
 	form.URL = makeAbsoluteURL(form.URL, loginDetails.URL)
@@ -125,7 +139,21 @@ func (ac *Client) handleOTP(ctx context.Context, doc *goquery.Document) (context
 		return ctx, nil, errors.Wrap(err, "error extracting OTP form")
 	}
 
-	token := prompter.StringRequired("Enter passcode")
+	// the supplied mfa token is only tried once, a rejected one shows the OTP form again
+	var token string
+	if loginDetails, ok := ctx.Value(ctxKey("login")).(*creds.LoginDetails); ok && ctx.Value(ctxKey("mfaTokenUsed")) == nil {
+		token = loginDetails.MFAToken
+		ctx = context.WithValue(ctx, ctxKey("mfaTokenUsed"), true)
+	}
+
+	if token == "" {
+		var tokens creds.MFATokenSource
+		if loginDetails, ok := ctx.Value(ctxKey("login")).(*creds.LoginDetails); ok {
+			tokens = loginDetails.MFATokens
+		}
+		token = prompter.MFACode(tokens, func() string { return prompter.StringRequired("Enter passcode") })
+	}
+
 	form.Values.Set("otp", token)
 	req, err := form.BuildRequest()
 	return ctx, req, err
@@ -137,47 +165,116 @@ func (ac *Client) handleSwipe(ctx context.Context, doc *goquery.Document) (conte
 		return ctx, nil, errors.Wrap(err, "error extracting swipe status form")
 	}
 
+	// with an mfa token there is no need to wait for the swipe, use the offline passcode straight away
+	if loginDetails, ok := ctx.Value(ctxKey("login")).(*creds.LoginDetails); ok && loginDetails.MFAToken != "" {
+		if req, ok, err := useCodeRequest(doc, form); ok || err != nil {
+			logger.Debug("using the supplied mfa token instead of the swipe")
+			return ctx, req, err
+		}
+	}
+
+	fmt.Println("Waiting for the PingID swipe to be approved...")
+
 	// poll status. request must specifically be a GET
 	form.Method = "GET"
-	req, err := form.BuildRequest()
+
+	err = ac.waitForSwipe(form)
+	if err == errSwipeTimeout {
+		req, ok, useCodeErr := useCodeRequest(doc, form)
+		if !ok {
+			return ctx, nil, err
+		}
+
+		fmt.Println("The PingID swipe wasn't approved in time, falling back to the passcode")
+		return ctx, req, useCodeErr
+	}
 	if err != nil {
 		return ctx, nil, err
 	}
 
+	// now build a request for getting response of MFA
+	form, err = page.NewFormFromDocument(doc, "#reponseView")
+	if err != nil {
+		return ctx, nil, errors.Wrap(err, "error extracting swipe response form")
+	}
+	req, err := form.BuildRequest()
+	return ctx, req, err
+}
+
+// waitForSwipe poll the PingID status until the swipe is approved, errSwipeTimeout is returned if it isn't approved
+// within mfa_timeout or PingID gives up waiting
+func (ac *Client) waitForSwipe(form *page.Form) error {
+	started := time.Now()
+
 	for {
-		time.Sleep(3 * time.Second)
+		if ac.mfaTimeout > 0 && time.Since(started) > ac.mfaTimeout {
+			return errSwipeTimeout
+		}
+
+		time.Sleep(swipePollInterval)
+
+		req, err := form.BuildRequest()
+		if err != nil {
+			return err
+		}
 
 		res, err := ac.client.Do(req)
 		if err != nil {
-			return ctx, nil, errors.Wrap(err, "error polling swipe status")
+			return errors.Wrap(err, "error polling swipe status")
 		}
 
 		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
 		if err != nil {
-			return ctx, nil, errors.Wrap(err, "error parsing body from swipe status response")
+			return errors.Wrap(err, "error parsing body from swipe status response")
 		}
 
-		resp := string(body)
+		pingfedMFAStatusResponse := gjson.GetBytes(body, "status").String()
 
-		pingfedMFAStatusResponse := gjson.Get(resp, "status").String()
+		logger.WithField("status", pingfedMFAStatusResponse).Debug("polled swipe status")
 
 		//ASYNC_AUTH_WAIT indicates we keep going
 		//OK indicates someone swiped
-		//DEVICE_CLAIM_TIMEOUT indicates nobody swiped
-		//otherwise loop forever?
-
-		if pingfedMFAStatusResponse == "OK" || pingfedMFAStatusResponse == "DEVICE_CLAIM_TIMEOUT" || pingfedMFAStatusResponse == "TIMEOUT" {
-			break
+		//DEVICE_CLAIM_TIMEOUT and TIMEOUT indicate nobody swiped
+		//anything else means the swipe was rejected
+		switch pingfedMFAStatusResponse {
+		case "ASYNC_AUTH_WAIT", "":
+			continue
+		case "OK":
+			return nil
+		case "DEVICE_CLAIM_TIMEOUT", "TIMEOUT":
+			return errSwipeTimeout
+		default:
+			return errors.Errorf("PingID swipe failed with status %s", pingfedMFAStatusResponse)
 		}
 	}
+}
 
-	// now build a request for getting response of MFA
-	form, err = page.NewFormFromDocument(doc, "#reponseView")
+// useCodeRequest build the request which switches the swipe page to the offline passcode, false is returned when
+// PingID doesn't allow a passcode for the device
+func useCodeRequest(doc *goquery.Document, statusForm *page.Form) (*http.Request, bool, error) {
+	useCodeURL, ok := doc.Find("input#useCodeUrl").Attr("value")
+	if !ok || useCodeURL == "" {
+		return nil, false, nil
+	}
+
+	statusURL, err := url.Parse(statusForm.URL)
 	if err != nil {
-		return ctx, nil, errors.Wrap(err, "error extracting swipe response form")
+		return nil, true, errors.Wrap(err, "error parsing swipe status url")
 	}
-	req, err = form.BuildRequest()
-	return ctx, req, err
+
+	statusURL.Path = ""
+	statusURL.RawQuery = ""
+
+	form := &page.Form{
+		URL:    makeAbsoluteURL(useCodeURL, statusURL.String()),
+		Method: "POST",
+		Values: &url.Values{},
+	}
+	form.Values.Set("csrfToken", statusForm.Values.Get("csrfToken"))
+
+	req, err := form.BuildRequest()
+	return req, true, err
 }
 
 func (ac *Client) handleFormRedirect(ctx context.Context, doc *goquery.Document) (context.Context, *http.Request, error) {
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/stretchr/testify/require"
 	"github.com/versent/saml2aws/mocks"
 	"github.com/versent/saml2aws/pkg/creds"
 	"github.com/versent/saml2aws/pkg/prompter"
+	"github.com/versent/saml2aws/pkg/provider"
 )
 
 func TestMakeAbsoluteURL(t *testing.T) {
@@ -104,6 +109,179 @@ func TestHandleOTP(t *testing.T) {
 	require.Contains(t, s, "otp=5309")
 }
 
+func TestHandleOTPMFAToken(t *testing.T) {
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+	pr.Mock.On("StringRequired", "Enter passcode").Return("5309")
+
+	data, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	ac := Client{}
+	ctx := context.WithValue(context.Background(), ctxKey("login"), &creds.LoginDetails{MFAToken: "123456"})
+
+	ctx, req, err := ac.handleOTP(ctx, doc)
+	require.Nil(t, err)
+
+	b, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "otp=123456")
+
+	// a rejected token isn't tried again
+	_, req, err = ac.handleOTP(ctx, doc)
+	require.Nil(t, err)
+
+	b, err = ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "otp=5309")
+}
+
+// queuedTokens an MFA token source handing out the codes in order
+type queuedTokens []string
+
+func (q *queuedTokens) Next() (string, error) {
+	code := (*q)[0]
+	*q = (*q)[1:]
+	return code, nil
+}
+
+func TestHandleOTPMFATokens(t *testing.T) {
+	pr := &mocks.Prompter{}
+	prompter.SetPrompter(pr)
+
+	data, err := ioutil.ReadFile("example/otp.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	// the code comes from the token source of the login, not a prompt
+	ac := Client{}
+	ctx := context.WithValue(context.Background(), ctxKey("login"), &creds.LoginDetails{MFATokens: &queuedTokens{"246810"}})
+
+	_, req, err := ac.handleOTP(ctx, doc)
+	require.Nil(t, err)
+
+	b, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "otp=246810")
+
+	pr.Mock.AssertNotCalled(t, "StringRequired", "Enter passcode")
+}
+
+// swipeDoc the swipe page pointing at the PingID server at url
+func swipeDoc(t *testing.T, url string) *goquery.Document {
+	data, err := ioutil.ReadFile("example/swipe.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(strings.Replace(string(data), "https://authenticator.pingone.com", url, -1)))
+	require.Nil(t, err)
+
+	return doc
+}
+
+// newPingIDServer a PingID server which answers the status polls with the statuses in turn
+func newPingIDServer(statuses ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		w.Write([]byte(`{"status":"` + status + `"}`))
+	}))
+}
+
+func TestHandleSwipe(t *testing.T) {
+	defer func(d time.Duration) { swipePollInterval = d }(swipePollInterval)
+	swipePollInterval = time.Millisecond
+
+	srv := newPingIDServer("ASYNC_AUTH_WAIT", "ASYNC_AUTH_WAIT", "OK")
+	defer srv.Close()
+
+	ac := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+
+	_, req, err := ac.handleSwipe(context.Background(), swipeDoc(t, srv.URL))
+	require.Nil(t, err)
+	require.Equal(t, srv.URL+"/pingid/ppm/auth/response", req.URL.String())
+}
+
+func TestHandleSwipeTimeoutFallsBackToPasscode(t *testing.T) {
+	defer func(d time.Duration) { swipePollInterval = d }(swipePollInterval)
+	swipePollInterval = time.Millisecond
+
+	srv := newPingIDServer("ASYNC_AUTH_WAIT", "TIMEOUT")
+	defer srv.Close()
+
+	ac := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+
+	_, req, err := ac.handleSwipe(context.Background(), swipeDoc(t, srv.URL))
+	require.Nil(t, err)
+	require.Equal(t, "POST", req.Method)
+	require.Equal(t, srv.URL+"/pingid/ppm/auth/usecode", req.URL.String())
+
+	b, err := ioutil.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "csrfToken=abdb4264-6aab-4e1a-a830-63c9188e2395")
+}
+
+func TestHandleSwipeMFATimeout(t *testing.T) {
+	defer func(d time.Duration) { swipePollInterval = d }(swipePollInterval)
+	swipePollInterval = time.Millisecond
+
+	srv := newPingIDServer("ASYNC_AUTH_WAIT")
+	defer srv.Close()
+
+	ac := Client{client: &provider.HTTPClient{Client: http.Client{}}, mfaTimeout: 20 * time.Millisecond}
+
+	// nobody swipes within mfa_timeout so the passcode is used
+	_, req, err := ac.handleSwipe(context.Background(), swipeDoc(t, srv.URL))
+	require.Nil(t, err)
+	require.Equal(t, srv.URL+"/pingid/ppm/auth/usecode", req.URL.String())
+}
+
+func TestHandleSwipeMFAToken(t *testing.T) {
+	ac := Client{}
+	ctx := context.WithValue(context.Background(), ctxKey("login"), &creds.LoginDetails{MFAToken: "123456"})
+
+	// the status is never polled
+	_, req, err := ac.handleSwipe(ctx, swipeDoc(t, "https://pingid.example.com"))
+	require.Nil(t, err)
+	require.Equal(t, "https://pingid.example.com/pingid/ppm/auth/usecode", req.URL.String())
+}
+
+func TestHandleSwipeRejected(t *testing.T) {
+	defer func(d time.Duration) { swipePollInterval = d }(swipePollInterval)
+	swipePollInterval = time.Millisecond
+
+	srv := newPingIDServer("DENIED")
+	defer srv.Close()
+
+	ac := Client{client: &provider.HTTPClient{Client: http.Client{}}}
+
+	_, _, err := ac.handleSwipe(context.Background(), swipeDoc(t, srv.URL))
+	require.EqualError(t, err, "PingID swipe failed with status DENIED")
+}
+
+func TestHandleLoginRejected(t *testing.T) {
+	ac := Client{}
+	ctx := context.WithValue(context.Background(), ctxKey("login"), &creds.LoginDetails{URL: "https://example.com/foo"})
+
+	data, err := ioutil.ReadFile("example/login.html")
+	require.Nil(t, err)
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	require.Nil(t, err)
+
+	ctx, _, err = ac.handleLogin(ctx, doc)
+	require.Nil(t, err)
+
+	_, _, err = ac.handleLogin(ctx, doc)
+	require.EqualError(t, err, "login failed, check the username and password")
+}
+
 func TestHandleFormRedirect(t *testing.T) {
 	data, err := ioutil.ReadFile("example/form-redirect.html")
 	require.Nil(t, err)
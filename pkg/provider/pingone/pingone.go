@@ -27,9 +27,9 @@ type Client struct {
 // New create a new PingOne client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := provider.NewDefaultTransport(idpAccount.SkipVerify)
+	tr := provider.NewTransport(idpAccount)
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -47,7 +47,7 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 func (ac *Client) EnableFollowRedirect() {
 	ac.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		ac.lastAccessUrl = req.URL
-		return nil
+		return provider.CheckRedirectLimit(ac.idpAccount.MaxRedirects, via)
 	}
 }
 
@@ -161,7 +161,7 @@ func (ac *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error)
 
 	//user has disabled swipe
 	if strings.Contains(actionURL, "/pingid/ppm/auth/otp") {
-		token := prompter.StringRequired("Enter passcode")
+		token := prompter.MFACode(loginDetails.MFATokens, func() string { return prompter.StringRequired("Enter passcode") })
 
 		//build request
 		otpReq := url.Values{}
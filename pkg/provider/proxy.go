@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// ConfigureProxy route connections made by the transport through the proxy URL
+//
+// http and https proxies use the transport's Proxy, socks5 and socks5h proxies replace its dialer. With socks5
+// host names are resolved locally, with socks5h they are resolved by the proxy. A proxy URL which can't be used
+// fails every request rather than silently connecting directly.
+func ConfigureProxy(tr *http.Transport, proxyURL string) {
+	if proxyURL == "" {
+		return
+	}
+
+	err := configureProxy(tr, proxyURL)
+	if err != nil {
+		tr.Proxy = func(*http.Request) (*url.URL, error) {
+			return nil, err
+		}
+	}
+}
+
+func configureProxy(tr *http.Transport, proxyURL string) error {
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return errors.Wrap(err, "proxy URL parse failed")
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		tr.Proxy = http.ProxyURL(u)
+	case "socks5", "socks5h":
+		// connections to the proxy are made with the transport's dialer so a source address still applies
+		var forward proxy.Dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		if tr.DialContext != nil {
+			forward = contextDialer(tr.DialContext)
+		}
+
+		// the proxy package only knows socks5 and always passes the host name through to the proxy
+		socksURL := *u
+		socksURL.Scheme = "socks5"
+
+		dialer, err := proxy.FromURL(&socksURL, forward)
+		if err != nil {
+			return errors.Wrap(err, "error configuring socks5 proxy")
+		}
+
+		resolveLocally := u.Scheme == "socks5"
+
+		tr.Proxy = nil
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if resolveLocally {
+				resolved, err := resolveAddr(ctx, addr)
+				if err != nil {
+					return nil, err
+				}
+				addr = resolved
+			}
+
+			return dialer.Dial(network, addr)
+		}
+	default:
+		return errors.Errorf("unsupported proxy URL scheme: %s", u.Scheme)
+	}
+
+	return nil
+}
+
+// contextDialer adapt a DialContext func to the proxy package's Dialer
+type contextDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+// resolveAddr replace the host name in the address with its first IP address
+func resolveAddr(ctx context.Context, addr string) (string, error) {
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ips) == 0 {
+		return "", errors.Errorf("no addresses found for %s", host)
+	}
+
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
@@ -0,0 +1,149 @@
+package provider
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// socks5Stub a minimal no auth SOCKS5 proxy which records the address of each CONNECT
+type socks5Stub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	targets  []string
+}
+
+func newSocks5Stub(t *testing.T) *socks5Stub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	s := &socks5Stub{listener: l}
+	go s.serve()
+
+	return s
+}
+
+func (s *socks5Stub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *socks5Stub) handle(conn net.Conn) {
+	defer conn.Close()
+
+	// greeting: version, method count, methods
+	buf := make([]byte, 262)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// request: version, command, reserved, address type
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(conn, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		n := int(buf[0])
+		io.ReadFull(conn, buf[:n])
+		host = string(buf[:n])
+	default:
+		return
+	}
+
+	io.ReadFull(conn, buf[:2])
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+
+	s.mu.Lock()
+	s.targets = append(s.targets, target)
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func (s *socks5Stub) connects() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.targets...)
+}
+
+func TestNewTransportSocks5Proxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.Nil(t, err)
+
+	tests := []struct {
+		scheme string
+		target string
+	}{
+		// socks5 resolves locally so the proxy is sent an IP, socks5h leaves the name for the proxy
+		{scheme: "socks5", target: "127.0.0.1:" + port},
+		{scheme: "socks5h", target: "localhost:" + port},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme, func(t *testing.T) {
+			stub := newSocks5Stub(t)
+			defer stub.listener.Close()
+
+			tr := NewTransport(&cfg.IDPAccount{ProxyURL: tt.scheme + "://" + stub.listener.Addr().String()})
+
+			res, err := (&http.Client{Transport: tr}).Get("http://localhost:" + port)
+			require.Nil(t, err)
+			res.Body.Close()
+
+			require.Equal(t, 200, res.StatusCode)
+			require.Equal(t, []string{tt.target}, stub.connects())
+		})
+	}
+}
+
+func TestNewTransportUnusableProxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	// never fall back to connecting directly
+	tr := NewTransport(&cfg.IDPAccount{ProxyURL: "socks4://127.0.0.1:1080"})
+
+	_, err := (&http.Client{Transport: tr}).Get(ts.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported proxy URL scheme: socks4")
+}
@@ -27,17 +27,16 @@ var logger = logrus.WithField("provider", "shibboleth")
 type Client struct {
 	client     *provider.HTTPClient
 	idpAccount *cfg.IDPAccount
+	mfaTokens  creds.MFATokenSource
 }
 
 // New create a new Shibboleth client
 func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 
-	tr := &http.Transport{
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: idpAccount.SkipVerify, Renegotiation: tls.RenegotiateFreelyAsClient},
-	}
+	tr := provider.NewTransport(idpAccount)
+	tr.TLSClientConfig.Renegotiation = tls.RenegotiateFreelyAsClient
 
-	client, err := provider.NewHTTPClient(tr)
+	client, err := provider.NewHTTPClient(tr, idpAccount)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building http client")
 	}
@@ -51,6 +50,8 @@ func New(idpAccount *cfg.IDPAccount) (*Client, error) {
 // Authenticate authenticate to Shibboleth and return the data from the body of the SAML assertion.
 func (sc *Client) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
 
+	sc.mfaTokens = loginDetails.MFATokens
+
 	var authSubmitURL string
 	var samlAssertion string
 
@@ -225,10 +226,13 @@ func verifyDuoMfa(oc *Client, duoHost string, parent string, tx string) (string,
 	}
 
 	duoMfaOption := prompter.Choose("Select a DUO MFA Option", duoMfaOptions)
+	if duoMfaOption < 0 {
+		return "", errors.Wrap(prompter.ErrPromptRequired, "no DUO MFA option chosen")
+	}
 
 	if duoMfaOptions[duoMfaOption] == "Passcode" {
 		//get users DUO MFA Token
-		token = prompter.StringRequired("Enter passcode")
+		token = prompter.MFACode(oc.mfaTokens, func() string { return prompter.StringRequired("Enter passcode") })
 	}
 
 	// send mfa auth request
@@ -300,8 +304,15 @@ func verifyDuoMfa(oc *Client, duoHost string, parent string, tx string) (string,
 	fmt.Println(gjson.Get(resp, "response.status").String())
 
 	if duoTxResult != "SUCCESS" {
+		started := time.Now()
+		timeout := time.Duration(oc.idpAccount.MFATimeout) * time.Second
+
 		//poll as this is likely a push request
 		for {
+			if timeout > 0 && time.Since(started) > timeout {
+				return "", errors.New("User did not accept MFA in time")
+			}
+
 			time.Sleep(3 * time.Second)
 
 			req, err = http.NewRequest("POST", duoSubmitURL, strings.NewReader(duoForm.Encode()))
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigureSourceAddress bind the connections made by the transport to the local IP address, so traffic to the IdP
+// leaves a multi-homed host from a known interface
+//
+// An address which isn't an IP fails every connection rather than letting the OS pick the interface.
+func ConfigureSourceAddress(tr *http.Transport, sourceAddress string) {
+	if sourceAddress == "" {
+		return
+	}
+
+	dialer, err := newSourceDialer(sourceAddress)
+	if err != nil {
+		tr.DialContext = func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		}
+		return
+	}
+
+	tr.DialContext = dialer.DialContext
+}
+
+// newSourceDialer the default dialer with its local address set to the source address
+func newSourceDialer(sourceAddress string) (*net.Dialer, error) {
+	ip := net.ParseIP(sourceAddress)
+	if ip == nil {
+		return nil, errors.Errorf("invalid source address: %s", sourceAddress)
+	}
+
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+		LocalAddr: &net.TCPAddr{IP: ip},
+	}, nil
+}
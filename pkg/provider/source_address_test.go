@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+func TestNewSourceDialer(t *testing.T) {
+	dialer, err := newSourceDialer("10.1.2.3")
+	require.Nil(t, err)
+	require.Equal(t, &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}, dialer.LocalAddr)
+
+	_, err = newSourceDialer("eth0")
+	require.EqualError(t, err, "invalid source address: eth0")
+}
+
+func TestNewTransportSourceAddress(t *testing.T) {
+	var remoteAddr string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	tr := NewTransport(&cfg.IDPAccount{SourceAddress: "127.0.0.1"})
+
+	res, err := (&http.Client{Transport: tr}).Get(ts.URL)
+	require.Nil(t, err)
+	res.Body.Close()
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	require.Nil(t, err)
+	require.Equal(t, "127.0.0.1", host)
+
+	// an unusable address fails rather than letting the OS pick one
+	tr = NewTransport(&cfg.IDPAccount{SourceAddress: "not-an-ip"})
+
+	_, err = (&http.Client{Transport: tr}).Get(ts.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid source address: not-an-ip")
+}
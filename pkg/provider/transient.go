@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// IsTransientNetworkError check if the error is a network failure which may not happen again, such as a timeout, a
+// refused or reset connection or a connection closed part way through a response
+//
+// Any response from the IdP, including an authentication failure, isn't transient.
+func IsTransientNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	cause := errors.Cause(err)
+
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = urlErr.Err
+	}
+
+	// a failed lookup is reported by the dial
+	if opErr, ok := cause.(*net.OpError); ok {
+		if dnsErr, ok := opErr.Err.(*net.DNSError); ok {
+			cause = dnsErr
+		}
+	}
+
+	if cause == io.EOF || cause == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	switch netErr := cause.(type) {
+	case *net.OpError:
+		return true
+	case *net.DNSError:
+		return netErr.Timeout() || netErr.Temporary()
+	case net.Error:
+		return netErr.Timeout()
+	}
+
+	return false
+}
@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransientNetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	refusedURL := ts.URL
+	ts.Close()
+
+	_, refused := http.Get(refusedURL)
+	require.True(t, IsTransientNetworkError(errors.Wrap(refused, "error retrieving login form")))
+
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer slow.Close()
+	defer close(done)
+
+	_, timeout := (&http.Client{Timeout: 50 * time.Millisecond}).Get(slow.URL)
+	require.True(t, IsTransientNetworkError(timeout))
+
+	require.True(t, IsTransientNetworkError(errors.Wrap(io.ErrUnexpectedEOF, "error reading response")))
+	require.True(t, IsTransientNetworkError(&net.DNSError{Err: "server misbehaving", IsTemporary: true}))
+
+	require.False(t, IsTransientNetworkError(nil))
+	require.False(t, IsTransientNetworkError(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "id.example.invalid"}}))
+	require.False(t, IsTransientNetworkError(errors.New("authentication failed for user")))
+}
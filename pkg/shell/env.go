@@ -8,14 +8,36 @@ import (
 )
 
 // BuildEnvVars build an array of env vars in the format required for exec
+//
+// The standard AWS variable names are always set so the AWS CLI and SDKs find the credentials. When the account has an
+// EnvPrefix configured a prefixed copy of each variable follows it. The region variables are only set when the account
+// has a region, so one already in the environment is kept otherwise.
 func BuildEnvVars(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) []string {
-	return []string{
-		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", awsCreds.AWSAccessKey),
-		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", awsCreds.AWSSecretKey),
-		fmt.Sprintf("AWS_SESSION_TOKEN=%s", awsCreds.AWSSessionToken),
-		fmt.Sprintf("AWS_SECURITY_TOKEN=%s", awsCreds.AWSSecurityToken),
-		fmt.Sprintf("EC2_SECURITY_TOKEN=%s", awsCreds.AWSSecurityToken),
-		fmt.Sprintf("AWS_PROFILE=%s", account.Profile),
-		fmt.Sprintf("AWS_DEFAULT_PROFILE=%s", account.Profile),
+	vars := [][2]string{
+		{"AWS_ACCESS_KEY_ID", awsCreds.AWSAccessKey},
+		{"AWS_SECRET_ACCESS_KEY", awsCreds.AWSSecretKey},
+		{"AWS_SESSION_TOKEN", awsCreds.AWSSessionToken},
+		{"AWS_SECURITY_TOKEN", awsCreds.AWSSecurityToken},
+		{"EC2_SECURITY_TOKEN", awsCreds.AWSSecurityToken},
+		{"AWS_PROFILE", account.Profile},
+		{"AWS_DEFAULT_PROFILE", account.Profile},
 	}
+
+	if account.Region != "" {
+		vars = append(vars,
+			[2]string{"AWS_REGION", account.Region},
+			[2]string{"AWS_DEFAULT_REGION", account.Region},
+		)
+	}
+
+	var envVars []string
+
+	for _, v := range vars {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", v[0], v[1]))
+		if account.EnvPrefix != "" {
+			envVars = append(envVars, fmt.Sprintf("%s%s=%s", account.EnvPrefix, v[0], v[1]))
+		}
+	}
+
+	return envVars
 }
@@ -33,3 +33,50 @@ func TestBuildEnvVars(t *testing.T) {
 
 	assert.Equal(t, expectedArray, BuildEnvVars(awsCreds, account))
 }
+
+func TestBuildEnvVarsWithPrefix(t *testing.T) {
+
+	expectedArray := []string{
+		"AWS_ACCESS_KEY_ID=123",
+		"PROD_AWS_ACCESS_KEY_ID=123",
+		"AWS_SECRET_ACCESS_KEY=345",
+		"PROD_AWS_SECRET_ACCESS_KEY=345",
+		"AWS_SESSION_TOKEN=567",
+		"PROD_AWS_SESSION_TOKEN=567",
+		"AWS_SECURITY_TOKEN=567",
+		"PROD_AWS_SECURITY_TOKEN=567",
+		"EC2_SECURITY_TOKEN=567",
+		"PROD_EC2_SECURITY_TOKEN=567",
+		"AWS_PROFILE=saml",
+		"PROD_AWS_PROFILE=saml",
+		"AWS_DEFAULT_PROFILE=saml",
+		"PROD_AWS_DEFAULT_PROFILE=saml",
+	}
+
+	account := &cfg.IDPAccount{
+		Profile:   "saml",
+		EnvPrefix: "PROD_",
+	}
+
+	awsCreds := &awsconfig.AWSCredentials{
+		AWSAccessKey:     "123",
+		AWSSecretKey:     "345",
+		AWSSecurityToken: "567",
+		AWSSessionToken:  "567",
+	}
+
+	assert.Equal(t, expectedArray, BuildEnvVars(awsCreds, account))
+}
+
+func TestBuildEnvVarsWithRegion(t *testing.T) {
+
+	account := &cfg.IDPAccount{
+		Profile: "saml",
+		Region:  "ap-southeast-2",
+	}
+
+	envVars := BuildEnvVars(&awsconfig.AWSCredentials{AWSAccessKey: "123"}, account)
+
+	assert.Contains(t, envVars, "AWS_REGION=ap-southeast-2")
+	assert.Contains(t, envVars, "AWS_DEFAULT_REGION=ap-southeast-2")
+}
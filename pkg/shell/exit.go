@@ -0,0 +1,28 @@
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ExitCode the exit code of the command when the error is its non-zero exit, so saml2aws can exit with the same code
+func ExitCode(err error) (int, bool) {
+	exitErr, ok := errors.Cause(err).(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1, true
+	}
+
+	// a command killed by a signal exits like it does from a shell
+	if status.Signaled() {
+		return 128 + int(status.Signal()), true
+	}
+
+	return status.ExitStatus(), true
+}
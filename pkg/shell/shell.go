@@ -3,6 +3,7 @@
 package shell
 
 import (
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -10,6 +11,11 @@ import (
 
 // ExecShellCmd exec shell command using the default shell
 func ExecShellCmd(cmdline []string, envVars []string) error {
+	return ExecShellCmdWithStderr(cmdline, envVars, os.Stderr)
+}
+
+// ExecShellCmdWithStderr exec shell command using the default shell sending its stderr to the supplied writer
+func ExecShellCmdWithStderr(cmdline []string, envVars []string, stderr io.Writer) error {
 
 	c := strings.Join(cmdline, " ")
 
@@ -17,7 +23,7 @@ func ExecShellCmd(cmdline []string, envVars []string) error {
 	cmd := exec.Command(cs[0], cs[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = stderr
 	cmd.Env = append(os.Environ(), envVars...)
 
 	return cmd.Run()
@@ -12,3 +12,15 @@ func TestExecShellCmd(t *testing.T) {
 	assert.Nil(t, err)
 
 }
+
+func TestExecShellCmdExitCode(t *testing.T) {
+
+	err := ExecShellCmd([]string{"exit", "3"}, nil)
+
+	code, ok := ExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, code)
+
+	_, ok = ExitCode(nil)
+	assert.False(t, ok)
+}
@@ -1,19 +1,25 @@
 package shell
 
 import (
+	"io"
 	"os"
 	"os/exec"
 )
 
 // ExecShellCmd exec shell command using the cmd shell
 func ExecShellCmd(cmdline []string, envVars []string) error {
+	return ExecShellCmdWithStderr(cmdline, envVars, os.Stderr)
+}
+
+// ExecShellCmdWithStderr exec shell command using the cmd shell sending its stderr to the supplied writer
+func ExecShellCmdWithStderr(cmdline []string, envVars []string, stderr io.Writer) error {
 
 	cs := []string{"cmd", "/C"}
 	cs = append(cs, cmdline...)
 	cmd := exec.Command(cs[0], cs[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = stderr
 	cmd.Env = append(os.Environ(), envVars...)
 
 	return cmd.Run()
@@ -0,0 +1,89 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+// BuildSystemdEnvFile build the content of a systemd EnvironmentFile holding the credentials
+//
+// systemd strips quotes and treats backslashes specially, so each value is written raw as KEY=value
+// one per line. Values containing a newline can't be represented and are rejected. The standard names
+// are always written, with a copy named with the account's EnvPrefix after each when there is one.
+func BuildSystemdEnvFile(awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) ([]byte, error) {
+
+	vars := [][2]string{
+		{"AWS_ACCESS_KEY_ID", awsCreds.AWSAccessKey},
+		{"AWS_SECRET_ACCESS_KEY", awsCreds.AWSSecretKey},
+		{"AWS_SESSION_TOKEN", awsCreds.AWSSessionToken},
+		{"AWS_SECURITY_TOKEN", awsCreds.AWSSecurityToken},
+		{"AWS_CREDENTIAL_EXPIRATION", awsCreds.Expires.UTC().Format(time.RFC3339)},
+	}
+
+	buf := new(bytes.Buffer)
+
+	for _, v := range vars {
+		if strings.ContainsAny(v[1], "\r\n") {
+			return nil, errors.Errorf("%s contains a newline", v[0])
+		}
+
+		fmt.Fprintf(buf, "%s=%s\n", v[0], v[1])
+		if account.EnvPrefix != "" {
+			fmt.Fprintf(buf, "%s%s=%s\n", account.EnvPrefix, v[0], v[1])
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteSystemdEnvFile write the credentials to the systemd EnvironmentFile at the supplied path
+//
+// The file is written to a temporary file in the same directory then renamed into place, so it is
+// always 0600 and a service starting mid write never reads a partial file.
+func WriteSystemdEnvFile(envFile string, awsCreds *awsconfig.AWSCredentials, account *cfg.IDPAccount) error {
+
+	path, err := homedir.Expand(envFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to expand systemd environment file path")
+	}
+
+	data, err := BuildSystemdEnvFile(awsCreds, account)
+	if err != nil {
+		return errors.Wrap(err, "error building systemd environment file")
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return errors.Wrap(err, "unable to create systemd environment file")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "error writing systemd environment file")
+	}
+
+	err = f.Chmod(0600)
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to set systemd environment file permissions")
+	}
+
+	err = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "error writing systemd environment file")
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), path), "unable to replace systemd environment file")
+}
@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+)
+
+var systemdCreds = &awsconfig.AWSCredentials{
+	AWSAccessKey:     "ASIAEXAMPLE",
+	AWSSecretKey:     "wJalr/K7MDENG+bPxRfiCY",
+	AWSSessionToken:  "FQoGZXIvYXdzE\"Jk+/=",
+	AWSSecurityToken: "FQoGZXIvYXdzE\"Jk+/=",
+	Expires:          time.Date(2018, 6, 1, 10, 30, 0, 0, time.UTC),
+}
+
+func TestBuildSystemdEnvFile(t *testing.T) {
+	data, err := BuildSystemdEnvFile(systemdCreds, &cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	expected := `AWS_ACCESS_KEY_ID=ASIAEXAMPLE
+AWS_SECRET_ACCESS_KEY=wJalr/K7MDENG+bPxRfiCY
+AWS_SESSION_TOKEN=FQoGZXIvYXdzE"Jk+/=
+AWS_SECURITY_TOKEN=FQoGZXIvYXdzE"Jk+/=
+AWS_CREDENTIAL_EXPIRATION=2018-06-01T10:30:00Z
+`
+	require.Equal(t, expected, string(data))
+
+	data, err = BuildSystemdEnvFile(systemdCreds, &cfg.IDPAccount{EnvPrefix: "PROD_"})
+	require.Nil(t, err)
+	require.Contains(t, string(data), "\nAWS_SESSION_TOKEN=FQoGZXIvYXdzE\"Jk+/=\nPROD_AWS_SESSION_TOKEN=FQoGZXIvYXdzE\"Jk+/=\n")
+
+	_, err = BuildSystemdEnvFile(&awsconfig.AWSCredentials{AWSSessionToken: "abc\ndef"}, &cfg.IDPAccount{})
+	require.Error(t, err)
+}
+
+func TestWriteSystemdEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saml2aws")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "aws.env")
+
+	// an existing file with broader permissions is replaced
+	require.Nil(t, ioutil.WriteFile(path, []byte("stale"), 0644))
+
+	err = WriteSystemdEnvFile(path, systemdCreds, &cfg.IDPAccount{})
+	require.Nil(t, err)
+
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+
+	expected, err := BuildSystemdEnvFile(systemdCreds, &cfg.IDPAccount{})
+	require.Nil(t, err)
+	require.Equal(t, string(expected), string(data))
+
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+}
@@ -0,0 +1,101 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+
+	_, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.True(t, os.IsNotExist(err))
+
+	// the parent directory must exist
+	err = fsys.WriteFile("/home/test/.saml2aws", []byte("[default]"), 0600)
+	require.True(t, os.IsNotExist(err))
+
+	require.Nil(t, fsys.MkdirAll("/home/test", 0700))
+
+	fi, err := fsys.Stat("/home")
+	require.Nil(t, err)
+	require.True(t, fi.IsDir())
+
+	require.Nil(t, fsys.WriteFile("/home/test/.saml2aws", []byte("[default]"), 0600))
+
+	data, err := fsys.ReadFile("/home/test/../test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, "[default]", string(data))
+
+	fi, err = fsys.Stat("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.False(t, fi.IsDir())
+	require.Equal(t, int64(9), fi.Size())
+	require.Equal(t, os.FileMode(0600), fi.Mode())
+
+	require.Error(t, fsys.MkdirAll("/home/test/.saml2aws/nested", 0700))
+}
+
+func TestMemFSRename(t *testing.T) {
+	fsys := NewMemFS()
+	require.Nil(t, fsys.MkdirAll("/home/test", 0700))
+
+	require.True(t, os.IsNotExist(fsys.Rename("/home/test/.saml2aws.tmp", "/home/test/.saml2aws")))
+
+	require.Nil(t, fsys.WriteFile("/home/test/.saml2aws", []byte("[old]"), 0600))
+	require.Nil(t, fsys.WriteFile("/home/test/.saml2aws.tmp", []byte("[new]"), 0600))
+
+	// the existing file is replaced
+	require.Nil(t, fsys.Rename("/home/test/.saml2aws.tmp", "/home/test/.saml2aws"))
+
+	data, err := fsys.ReadFile("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, "[new]", string(data))
+
+	_, err = fsys.Stat("/home/test/.saml2aws.tmp")
+	require.True(t, os.IsNotExist(err))
+
+	require.True(t, os.IsNotExist(fsys.Rename("/home/test/.saml2aws", "/missing/.saml2aws")))
+}
+
+func TestMemFSChmod(t *testing.T) {
+	fsys := NewMemFS()
+	require.Nil(t, fsys.MkdirAll("/home/test", 0700))
+	require.Nil(t, fsys.WriteFile("/home/test/.saml2aws", []byte("[default]"), 0666))
+
+	require.Nil(t, fsys.Chmod("/home/test/.saml2aws", 0600))
+
+	fi, err := fsys.Stat("/home/test/.saml2aws")
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode())
+
+	require.True(t, os.IsNotExist(fsys.Chmod("/home/test/missing", 0600)))
+}
+
+func TestMemFSRemove(t *testing.T) {
+	fsys := NewMemFS()
+	require.Nil(t, fsys.MkdirAll("/home/test", 0700))
+	require.Nil(t, fsys.WriteFile("/home/test/.saml2aws", []byte("[default]"), 0600))
+
+	require.Nil(t, fsys.Remove("/home/test/.saml2aws"))
+
+	_, err := fsys.Stat("/home/test/.saml2aws")
+	require.True(t, os.IsNotExist(err))
+
+	require.True(t, os.IsNotExist(fsys.Remove("/home/test/.saml2aws")))
+}
+
+func TestMemFSEvalSymlinks(t *testing.T) {
+	fsys := NewMemFS()
+	require.Nil(t, fsys.MkdirAll("/home/test/.aws", 0700))
+	require.Nil(t, fsys.WriteFile("/home/test/.aws/credentials", []byte("[saml]"), 0600))
+
+	path, err := fsys.EvalSymlinks("/home/test/../test/.aws/credentials")
+	require.Nil(t, err)
+	require.Equal(t, "/home/test/.aws/credentials", path)
+
+	_, err = fsys.EvalSymlinks("/home/test/.aws/config")
+	require.True(t, os.IsNotExist(err))
+}
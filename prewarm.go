@@ -0,0 +1,192 @@
+package saml2aws
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+	"github.com/versent/saml2aws/pkg/provider"
+)
+
+// DefaultPrewarmConcurrency the number of IdPs logged in to at once by Prewarm
+const DefaultPrewarmConcurrency = 4
+
+// CredentialsCache where Prewarm finds the cached credentials of an account and saves refreshed ones, Save may be
+// called concurrently
+type CredentialsCache interface {
+	// Load return the cached credentials of the account, nil if there aren't any
+	Load(account *cfg.IDPAccount) (*awsconfig.AWSCredentials, error)
+	// Save replace the cached credentials of the account
+	Save(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) error
+}
+
+// PrewarmOptions configure Prewarm
+type PrewarmOptions struct {
+	// Concurrency the number of IdPs logged in to at once, defaults to DefaultPrewarmConcurrency
+	Concurrency int
+	// Cache holds the credentials of each account
+	Cache CredentialsCache
+	// LoginDetails return the login details of the named account, defaults to the username of the account and an
+	// empty URL is resolved from the account
+	LoginDetails func(name string, account *cfg.IDPAccount) (creds.LoginDetails, error)
+	// RefreshBefore refresh cached credentials which expire within this long, by default only expired ones are
+	RefreshBefore time.Duration
+}
+
+// PrewarmResult the outcome of refreshing one account
+type PrewarmResult struct {
+	Name        string
+	Credentials *awsconfig.AWSCredentials
+	// Skipped the cached credentials were still valid so the account wasn't refreshed
+	Skipped bool
+	Err     error
+}
+
+// prewarmLogin the accounts which share an IdP session, the assertion from one login is exchanged for each of them
+type prewarmLogin struct {
+	account      *cfg.IDPAccount
+	loginDetails creds.LoginDetails
+	accounts     []*cfg.IDPAccount
+	results      []*PrewarmResult
+}
+
+// Prewarm refresh the credentials of the named accounts which have expired, logging in to different IdPs concurrently
+//
+// Accounts which share an IdP URL, provider, username and aws_urn share one login, the SAML assertion is exchanged
+// for the role of each of them. The results are in the same order as the names.
+func Prewarm(ctx context.Context, cfgm *cfg.ConfigManager, names []string, opts PrewarmOptions) []PrewarmResult {
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultPrewarmConcurrency
+	}
+
+	if opts.LoginDetails == nil {
+		opts.LoginDetails = defaultLoginDetails
+	}
+
+	results := make([]PrewarmResult, len(names))
+
+	logins := map[string]*prewarmLogin{}
+	var order []string
+
+	for i, name := range names {
+		result := &results[i]
+		result.Name = name
+
+		account, loginDetails, err := prewarmAccount(cfgm, name, opts)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+
+		cached, err := opts.Cache.Load(account)
+		if err != nil {
+			result.Err = errors.Wrap(err, "error loading credentials")
+			continue
+		}
+
+		if cached != nil && time.Now().Add(opts.RefreshBefore).Before(cached.Expires) {
+			result.Credentials = cached
+			result.Skipped = true
+			continue
+		}
+
+		key := strings.Join([]string{account.Provider, loginDetails.URL, loginDetails.Username, account.AmazonWebservicesURN}, "\x00")
+
+		login, ok := logins[key]
+		if !ok {
+			login = &prewarmLogin{account: account, loginDetails: loginDetails}
+			logins[key] = login
+			order = append(order, key)
+		}
+
+		login.accounts = append(login.accounts, account)
+		login.results = append(login.results, result)
+	}
+
+	sem := make(chan struct{}, opts.Concurrency)
+
+	var wg sync.WaitGroup
+
+	for _, key := range order {
+		wg.Add(1)
+
+		go func(login *prewarmLogin) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			login.run(ctx, opts.Cache)
+		}(logins[key])
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// run log in to the IdP once and refresh every account sharing the session
+func (l *prewarmLogin) run(ctx context.Context, cache CredentialsCache) {
+
+	samlAssertion, err := authenticate(l.account, l.loginDetails)
+	if err != nil {
+		for _, result := range l.results {
+			result.Err = err
+		}
+		return
+	}
+
+	for i, account := range l.accounts {
+		result := l.results[i]
+
+		awsCreds, err := credentialsFromAssertion(ctx, account, samlAssertion)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+
+		err = cache.Save(account, awsCreds)
+		if err != nil {
+			result.Err = errors.Wrap(err, "error saving credentials")
+			continue
+		}
+
+		result.Credentials = awsCreds
+	}
+}
+
+func prewarmAccount(cfgm *cfg.ConfigManager, name string, opts PrewarmOptions) (*cfg.IDPAccount, creds.LoginDetails, error) {
+
+	account, err := cfgm.LoadVerifyIDPAccount(name)
+	if err != nil {
+		return nil, creds.LoginDetails{}, errors.Wrap(err, "failed to load idp account")
+	}
+
+	account.NormalizeURLs()
+
+	err = account.Validate()
+	if err != nil {
+		return nil, creds.LoginDetails{}, errors.Wrap(err, "failed to validate account")
+	}
+
+	loginDetails, err := opts.LoginDetails(name, account)
+	if err != nil {
+		return nil, creds.LoginDetails{}, errors.Wrap(err, "error resolving login details")
+	}
+
+	if loginDetails.URL == "" {
+		loginDetails.URL = provider.ResolveIdPURL(account)
+	}
+
+	return account, loginDetails, nil
+}
+
+func defaultLoginDetails(name string, account *cfg.IDPAccount) (creds.LoginDetails, error) {
+	return creds.LoginDetails{Username: account.Username}, nil
+}
@@ -0,0 +1,272 @@
+package saml2aws
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/awsconfig"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/creds"
+)
+
+const prewarmConfig = `
+[build]
+url         = https://id.example.com
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = build
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild
+
+[nonprod]
+url         = https://id.example.com
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = nonprod
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd
+
+[cached]
+url         = https://id.example.com
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = cached
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild
+
+[unnormalized]
+url         = id.example.com/
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = unnormalized
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild
+
+[other1]
+url         = https://other1.example.com
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = other1
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild
+
+[other2]
+url         = https://other2.example.com
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = other2
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild
+
+[other3]
+url         = https://other3.example.com
+username    = wolfeidau
+provider    = KeyCloak
+mfa         = Auto
+aws_profile = other3
+role_arn    = arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild
+`
+
+// prewarmSAMLClient counts the logins to each IdP and the most running at once
+type prewarmSAMLClient struct {
+	samlAssertion string
+
+	mu      sync.Mutex
+	logins  map[string]int
+	running int
+	peak    int
+}
+
+func (m *prewarmSAMLClient) Authenticate(loginDetails *creds.LoginDetails) (string, error) {
+	m.mu.Lock()
+	m.logins[loginDetails.URL]++
+	m.running++
+	if m.running > m.peak {
+		m.peak = m.running
+	}
+	m.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+
+	return m.samlAssertion, nil
+}
+
+type prewarmSTS struct {
+	stsiface.STSAPI
+
+	mu    sync.Mutex
+	roles []string
+}
+
+func (m *prewarmSTS) AssumeRoleWithSAMLWithContext(ctx aws.Context, input *sts.AssumeRoleWithSAMLInput, opts ...request.Option) (*sts.AssumeRoleWithSAMLOutput, error) {
+	m.mu.Lock()
+	m.roles = append(m.roles, aws.StringValue(input.RoleArn))
+	m.mu.Unlock()
+
+	return &sts.AssumeRoleWithSAMLOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{Arn: aws.String("arn:aws:sts::123123123123:assumed-role/" + aws.StringValue(input.RoleArn))},
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+type memCredentialsCache struct {
+	mu    sync.Mutex
+	creds map[string]*awsconfig.AWSCredentials
+}
+
+func (c *memCredentialsCache) Load(account *cfg.IDPAccount) (*awsconfig.AWSCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.creds[account.Profile], nil
+}
+
+func (c *memCredentialsCache) Save(account *cfg.IDPAccount, awsCreds *awsconfig.AWSCredentials) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creds[account.Profile] = awsCreds
+	return nil
+}
+
+func prewarmLoginDetails(name string, account *cfg.IDPAccount) (creds.LoginDetails, error) {
+	return creds.LoginDetails{Username: account.Username, Password: "test123"}, nil
+}
+
+func withPrewarm(t *testing.T) (*cfg.ConfigManager, *prewarmSAMLClient, *prewarmSTS, func()) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "saml2aws")
+	assert.Nil(t, err)
+
+	configFile := filepath.Join(dir, "saml2aws")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(prewarmConfig), 0600))
+
+	cfgm, err := cfg.NewConfigManager(configFile)
+	assert.Nil(t, err)
+
+	client := &prewarmSAMLClient{samlAssertion: base64.StdEncoding.EncodeToString(data), logins: map[string]int{}}
+	svc := &prewarmSTS{}
+
+	origSAMLClient, origSTS := newSAMLClient, newSTS
+
+	newSAMLClient = func(*cfg.IDPAccount) (SAMLClient, error) { return client, nil }
+	newSTS = func(*cfg.IDPAccount) (stsiface.STSAPI, error) { return svc, nil }
+
+	return cfgm, client, svc, func() {
+		newSAMLClient, newSTS = origSAMLClient, origSTS
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	cfgm, client, svc, restore := withPrewarm(t)
+	defer restore()
+
+	valid := &awsconfig.AWSCredentials{AWSAccessKey: "ASIACACHED", Expires: time.Now().Add(time.Hour)}
+	expired := &awsconfig.AWSCredentials{AWSAccessKey: "ASIAEXPIRED", Expires: time.Now().Add(-time.Minute)}
+
+	cache := &memCredentialsCache{creds: map[string]*awsconfig.AWSCredentials{"cached": valid, "build": expired}}
+
+	results := Prewarm(context.Background(), cfgm, []string{"build", "cached", "nonprod", "missing"}, PrewarmOptions{Cache: cache, LoginDetails: prewarmLoginDetails})
+
+	assert.Len(t, results, 4)
+
+	assert.Equal(t, "build", results[0].Name)
+	assert.Nil(t, results[0].Err)
+	assert.False(t, results[0].Skipped)
+	assert.Equal(t, "ASIAEXAMPLE", results[0].Credentials.AWSAccessKey)
+
+	// valid cached credentials are left alone
+	assert.Equal(t, "cached", results[1].Name)
+	assert.True(t, results[1].Skipped)
+	assert.Equal(t, valid, results[1].Credentials)
+	assert.Equal(t, valid, cache.creds["cached"])
+
+	assert.Nil(t, results[2].Err)
+	assert.Equal(t, "arn:aws:sts::123123123123:assumed-role/arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd", results[2].Credentials.PrincipalARN)
+
+	assert.Equal(t, "missing", results[3].Name)
+	assert.Error(t, results[3].Err)
+
+	// build and nonprod share the IdP so only one login happens
+	assert.Equal(t, map[string]int{"https://id.example.com": 1}, client.logins)
+	assert.ElementsMatch(t, []string{
+		"arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSBuild",
+		"arn:aws:iam::123123123123:role/AWS-Admin-CloudOPSNonProd",
+	}, svc.roles)
+
+	assert.Equal(t, results[0].Credentials, cache.creds["build"])
+	assert.Equal(t, results[2].Credentials, cache.creds["nonprod"])
+}
+
+func TestPrewarmConcurrency(t *testing.T) {
+	cfgm, client, _, restore := withPrewarm(t)
+	defer restore()
+
+	cache := &memCredentialsCache{creds: map[string]*awsconfig.AWSCredentials{}}
+
+	results := Prewarm(context.Background(), cfgm, []string{"build", "other1", "other2", "other3"}, PrewarmOptions{Cache: cache, LoginDetails: prewarmLoginDetails, Concurrency: 2})
+
+	for _, result := range results {
+		assert.Nil(t, result.Err, result.Name)
+	}
+
+	assert.Len(t, client.logins, 4)
+	assert.True(t, client.peak <= 2, "peak logins %d", client.peak)
+}
+
+func TestPrewarmRefreshBefore(t *testing.T) {
+	cfgm, client, _, restore := withPrewarm(t)
+	defer restore()
+
+	expiring := &awsconfig.AWSCredentials{AWSAccessKey: "ASIAEXPIRING", Expires: time.Now().Add(3 * time.Minute)}
+	valid := &awsconfig.AWSCredentials{AWSAccessKey: "ASIACACHED", Expires: time.Now().Add(time.Hour)}
+
+	cache := &memCredentialsCache{creds: map[string]*awsconfig.AWSCredentials{"build": expiring, "cached": valid}}
+
+	results := Prewarm(context.Background(), cfgm, []string{"build", "cached"}, PrewarmOptions{Cache: cache, LoginDetails: prewarmLoginDetails, RefreshBefore: 5 * time.Minute})
+
+	// credentials expiring within the window are refreshed before they expire
+	assert.Nil(t, results[0].Err)
+	assert.False(t, results[0].Skipped)
+	assert.Equal(t, "ASIAEXAMPLE", cache.creds["build"].AWSAccessKey)
+
+	assert.True(t, results[1].Skipped)
+	assert.Equal(t, map[string]int{"https://id.example.com": 1}, client.logins)
+}
+
+func TestPrewarmNormalizesURLs(t *testing.T) {
+	cfgm, client, _, restore := withPrewarm(t)
+	defer restore()
+
+	cache := &memCredentialsCache{creds: map[string]*awsconfig.AWSCredentials{}}
+
+	results := Prewarm(context.Background(), cfgm, []string{"build", "unnormalized"}, PrewarmOptions{Cache: cache, LoginDetails: prewarmLoginDetails})
+
+	for _, result := range results {
+		assert.Nil(t, result.Err, result.Name)
+	}
+
+	// the URL without a scheme or with a trailing slash is the same IdP so shares the login
+	assert.Equal(t, map[string]int{"https://id.example.com": 1}, client.logins)
+}
@@ -0,0 +1,180 @@
+package saml2aws
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/versent/saml2aws/pkg/cfg"
+	"github.com/versent/saml2aws/pkg/vfs"
+)
+
+// DefaultRoleCachePath the file the AWS accounts found on the signin page are cached in
+const DefaultRoleCachePath = "~/.saml2aws-roles.json"
+
+// cachedRole a role as it is listed on the signin page, the principal comes from the assertion of each login
+type cachedRole struct {
+	RoleARN string `json:"role_arn"`
+	Name    string `json:"name"`
+}
+
+// cachedAccount an AWS account and its roles as they are listed on the signin page
+type cachedAccount struct {
+	Name  string       `json:"name"`
+	Roles []cachedRole `json:"roles"`
+}
+
+// cachedAccounts the AWS accounts found for an IDP account
+type cachedAccounts struct {
+	Accounts   []cachedAccount `json:"accounts"`
+	Discovered time.Time       `json:"discovered"`
+}
+
+// RoleCache caches the AWS accounts found on the signin page so repeated logins can skip fetching it
+type RoleCache struct {
+	path string
+	home string
+	fs   vfs.FS
+}
+
+// NewRoleCache build a cache stored in the supplied file, an empty path uses the default
+func NewRoleCache(path string) *RoleCache {
+	return NewRoleCacheWithFS(path, "", vfs.OS)
+}
+
+// NewRoleCacheWithFS build a cache stored in the supplied file which is read and written through the supplied
+// filesystem, ~ is expanded against home or the process HOME when it is empty
+func NewRoleCacheWithFS(path, home string, fsys vfs.FS) *RoleCache {
+	if path == "" {
+		path = DefaultRoleCachePath
+	}
+
+	return &RoleCache{path: path, home: home, fs: fsys}
+}
+
+// RoleCacheKey the key the AWS accounts of the IDP account are cached under, logins to the same IdP as the same user
+// share it
+func RoleCacheKey(account *cfg.IDPAccount) string {
+	return strings.Join([]string{account.URL, account.Username, SigninEndpoint(account)}, " ")
+}
+
+// Get return the cached AWS accounts for the key, they are only used while they list exactly the roles in the
+// assertion so a role granted or revoked since they were cached causes the signin page to be fetched again
+func (rc *RoleCache) Get(key string, awsRoles []*AWSRole) ([]*AWSAccount, bool) {
+	entries, err := rc.load()
+	if err != nil {
+		logrus.WithField("cache", "roles").WithError(err).Debug("unable to load role cache")
+		return nil, false
+	}
+
+	entry, ok := entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	var cachedARNs, roleARNs []string
+
+	awsAccounts := make([]*AWSAccount, 0, len(entry.Accounts))
+	for _, account := range entry.Accounts {
+		awsAccount := &AWSAccount{Name: account.Name}
+		for _, role := range account.Roles {
+			awsAccount.Roles = append(awsAccount.Roles, &AWSRole{RoleARN: role.RoleARN, Name: role.Name})
+			cachedARNs = append(cachedARNs, role.RoleARN)
+		}
+		awsAccounts = append(awsAccounts, awsAccount)
+	}
+
+	for _, awsRole := range awsRoles {
+		roleARNs = append(roleARNs, awsRole.RoleARN)
+	}
+
+	if !sameRoleARNs(cachedARNs, roleARNs) {
+		return nil, false
+	}
+
+	return awsAccounts, true
+}
+
+// Put store the AWS accounts for the key
+func (rc *RoleCache) Put(key string, awsAccounts []*AWSAccount) error {
+	entries, err := rc.load()
+	if err != nil {
+		entries = map[string]*cachedAccounts{}
+	}
+
+	entry := &cachedAccounts{Discovered: time.Now()}
+	for _, awsAccount := range awsAccounts {
+		account := cachedAccount{Name: awsAccount.Name}
+		for _, awsRole := range awsAccount.Roles {
+			account.Roles = append(account.Roles, cachedRole{RoleARN: awsRole.RoleARN, Name: awsRole.Name})
+		}
+		entry.Accounts = append(entry.Accounts, account)
+	}
+
+	entries[key] = entry
+
+	return rc.save(entries)
+}
+
+func (rc *RoleCache) load() (map[string]*cachedAccounts, error) {
+	path, err := cfg.ExpandHome(rc.path, rc.home)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := rc.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]*cachedAccounts{}
+
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid role cache")
+	}
+
+	return entries, nil
+}
+
+func (rc *RoleCache) save(entries map[string]*cachedAccounts) error {
+	path, err := cfg.ExpandHome(rc.path, rc.home)
+	if err != nil {
+		return errors.Wrap(err, "unable to expand role cache path")
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return errors.Wrap(err, "error encoding role cache")
+	}
+
+	err = rc.fs.WriteFile(path, data, os.FileMode(0600))
+	if err != nil {
+		return errors.Wrap(err, "error writing role cache")
+	}
+
+	return nil
+}
+
+func sameRoleARNs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
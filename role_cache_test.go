@@ -0,0 +1,68 @@
+package saml2aws
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/versent/saml2aws/pkg/vfs"
+)
+
+// newMemRoleCache a role cache for the default path in an in memory home directory
+func newMemRoleCache(t *testing.T) (*RoleCache, *vfs.MemFS) {
+	fsys := vfs.NewMemFS()
+	assert.Nil(t, fsys.MkdirAll("/home/test", 0700))
+
+	return NewRoleCacheWithFS("", "/home/test", fsys), fsys
+}
+
+func TestRoleCache(t *testing.T) {
+	rc, fsys := newMemRoleCache(t)
+
+	awsRoles := []*AWSRole{
+		{RoleARN: "arn:aws:iam::123456789012:role/admin", PrincipalARN: "arn:aws:iam::123456789012:saml-provider/idp"},
+		{RoleARN: "arn:aws:iam::000000000001:role/read", PrincipalARN: "arn:aws:iam::000000000001:saml-provider/idp"},
+	}
+
+	_, ok := rc.Get("key", awsRoles)
+	assert.False(t, ok)
+
+	err := rc.Put("key", []*AWSAccount{
+		{Name: "Account: prod (123456789012)", Roles: []*AWSRole{{RoleARN: "arn:aws:iam::123456789012:role/admin", Name: "admin"}}},
+		{Name: "Account: dev (000000000001)", Roles: []*AWSRole{{RoleARN: "arn:aws:iam::000000000001:role/read", Name: "read"}}},
+	})
+	assert.Nil(t, err)
+
+	awsAccounts, ok := rc.Get("key", awsRoles)
+	assert.True(t, ok)
+	assert.Len(t, awsAccounts, 2)
+	assert.Equal(t, "Account: prod (123456789012)", awsAccounts[0].Name)
+	assert.Equal(t, "admin", awsAccounts[0].Roles[0].Name)
+	assert.Equal(t, "", awsAccounts[0].Roles[0].PrincipalARN)
+
+	_, ok = rc.Get("other", awsRoles)
+	assert.False(t, ok)
+
+	fi, err := fsys.Stat("/home/test/.saml2aws-roles.json")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode())
+
+	// a role granted since the accounts were cached means the signin page is needed again
+	awsRoles = append(awsRoles, &AWSRole{RoleARN: "arn:aws:iam::000000000002:role/admin"})
+	_, ok = rc.Get("key", awsRoles)
+	assert.False(t, ok)
+}
+
+func TestRoleCacheInvalid(t *testing.T) {
+	rc, fsys := newMemRoleCache(t)
+	assert.Nil(t, fsys.WriteFile("/home/test/.saml2aws-roles.json", []byte("not json"), 0600))
+
+	_, ok := rc.Get("key", nil)
+	assert.False(t, ok)
+
+	// an unreadable cache is replaced
+	assert.Nil(t, rc.Put("key", []*AWSAccount{}))
+
+	_, ok = rc.Get("key", nil)
+	assert.True(t, ok)
+}
@@ -2,7 +2,9 @@ package saml2aws
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/beevik/etree"
 )
@@ -12,6 +14,8 @@ const (
 	attributeStatementTag = "AttributeStatement"
 	attributeTag          = "Attribute"
 	attributeValueTag     = "AttributeValue"
+	responseTag           = "Response"
+	destinationAttr       = "Destination"
 )
 
 //ErrMissingElement is the error type that indicates an element and/or attribute is
@@ -27,6 +31,15 @@ var (
 	ErrMissingAssertion = ErrMissingElement{Tag: assertionTag}
 )
 
+// ErrInvalidSessionDuration indicates the SessionDuration attribute isn't a whole number of seconds
+type ErrInvalidSessionDuration struct {
+	Value string
+}
+
+func (e ErrInvalidSessionDuration) Error() string {
+	return fmt.Sprintf("invalid SessionDuration attribute value %q", e.Value)
+}
+
 func (e ErrMissingElement) Error() string {
 	if e.Attribute != "" {
 		return fmt.Sprintf("missing %s attribute on %s element", e.Attribute, e.Tag)
@@ -64,13 +77,66 @@ func ExtractSessionDuration(data []byte) (int64, error) {
 		}
 		atributeValues := attribute.FindElements(childPath(assertionElement.Space, attributeValueTag))
 		for _, attrValue := range atributeValues {
-			return strconv.ParseInt(attrValue.Text(), 10, 64)
+			return parseSessionDuration(attrValue.Text())
 		}
 	}
 
 	return 0, nil
 }
 
+// parseSessionDuration parse the SessionDuration attribute value, surrounding whitespace and whole numbers written
+// as decimals such as 3600.0 are accepted
+func parseSessionDuration(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+
+	if duration, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return duration, nil
+	}
+
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(duration, 0) || duration != math.Trunc(duration) {
+		return 0, ErrInvalidSessionDuration{Value: value}
+	}
+
+	return int64(duration), nil
+}
+
+// ExtractDestination extract the Destination of the SAML Response, this is where the IdP intended it to be posted
+func ExtractDestination(data []byte) (string, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return "", err
+	}
+
+	responseElement := doc.Root()
+	if responseElement == nil || responseElement.Tag != responseTag {
+		return "", ErrMissingElement{Tag: responseTag}
+	}
+
+	destination := responseElement.SelectAttrValue(destinationAttr, "")
+	if destination == "" {
+		return "", ErrMissingElement{Tag: responseTag, Attribute: destinationAttr}
+	}
+
+	return destination, nil
+}
+
+// ValidateDestination verify the SAML Response was issued for the signin endpoint it is about to be posted to
+func ValidateDestination(data []byte, signinEndpoint string) error {
+
+	destination, err := ExtractDestination(data)
+	if err != nil {
+		return err
+	}
+
+	if destination != signinEndpoint {
+		return fmt.Errorf("SAML response destination %s does not match the signin endpoint %s", destination, signinEndpoint)
+	}
+
+	return nil
+}
+
 // ExtractAwsRoles given an assertion document extract the aws roles
 func ExtractAwsRoles(data []byte) ([]string, error) {
 
@@ -112,6 +178,48 @@ func ExtractAwsRoles(data []byte) ([]string, error) {
 	return awsroles, nil
 }
 
+// ExtractSAMLProviders the SAML provider ARN of each AWS account named in the attribute values of the assertion,
+// keyed by account id
+//
+// This looks through every attribute value in any namespace, so it still finds the providers of an assertion whose
+// roles ExtractAwsRoles couldn't parse.
+func ExtractSAMLProviders(data []byte) (map[string]string, error) {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+
+	providers := map[string]string{}
+
+	for _, attrValue := range doc.FindElements("//" + attributeValueTag) {
+		for _, token := range strings.Split(attrValue.Text(), ",") {
+			token = strings.TrimSpace(token)
+			if !strings.Contains(token, ":saml-provider/") {
+				continue
+			}
+
+			if accountID := arnAccountID(token); accountID != "" {
+				if _, ok := providers[accountID]; !ok {
+					providers[accountID] = token
+				}
+			}
+		}
+	}
+
+	return providers, nil
+}
+
+// arnAccountID the account id field of an ARN, empty when it isn't one
+func arnAccountID(arn string) string {
+	fields := strings.SplitN(arn, ":", 6)
+	if len(fields) < 6 || fields[0] != "arn" {
+		return ""
+	}
+
+	return fields[4]
+}
+
 func childPath(space, tag string) string {
 	if space == "" {
 		return "./" + tag
@@ -1,6 +1,7 @@
 package saml2aws
 
 import (
+	"bytes"
 	"io/ioutil"
 	"testing"
 
@@ -16,6 +17,18 @@ func TestExtractAwsRoles(t *testing.T) {
 	assert.Len(t, roles, 2)
 }
 
+func TestExtractSAMLProviders(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_unparsed_roles.xml")
+	assert.Nil(t, err)
+
+	providers, err := ExtractSAMLProviders(data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"111111111111": "arn:aws:iam::111111111111:saml-provider/Shibboleth",
+		"222222222222": "arn:aws:iam::222222222222:saml-provider/Shibboleth",
+	}, providers)
+}
+
 func TestExtractSessionDuration(t *testing.T) {
 	data, err := ioutil.ReadFile("testdata/assertion.xml")
 	assert.Nil(t, err)
@@ -24,3 +37,44 @@ func TestExtractSessionDuration(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, int64(28800), duration)
 }
+
+func TestExtractSessionDurationTolerant(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	for _, value := range []string{"3600", " 3600 ", "\n\t3600\n", "3600.0"} {
+		duration, err := ExtractSessionDuration(bytes.Replace(data, []byte(">28800<"), []byte(">"+value+"<"), 1))
+		assert.Nil(t, err, value)
+		assert.Equal(t, int64(3600), duration, value)
+	}
+
+	for _, value := range []string{"abc", "3600.5", "Inf"} {
+		_, err := ExtractSessionDuration(bytes.Replace(data, []byte(">28800<"), []byte(">"+value+"<"), 1))
+		assert.Equal(t, ErrInvalidSessionDuration{Value: value}, err, value)
+	}
+}
+
+func TestExtractDestination(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	destination, err := ExtractDestination(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://signin.aws.amazon.com/saml", destination)
+
+	_, err = ExtractDestination([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"></samlp:Response>`))
+	assert.Equal(t, ErrMissingElement{Tag: "Response", Attribute: "Destination"}, err)
+}
+
+func TestValidateDestination(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	assert.Nil(t, ValidateDestination(data, "https://signin.aws.amazon.com/saml"))
+
+	data, err = ioutil.ReadFile("testdata/assertion_misdirected.xml")
+	assert.Nil(t, err)
+
+	err = ValidateDestination(data, "https://signin.aws.amazon.com/saml")
+	assert.EqualError(t, err, "SAML response destination https://apps.example.com/saml/acs does not match the signin endpoint https://signin.aws.amazon.com/saml")
+}
@@ -0,0 +1,123 @@
+package saml2aws
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+)
+
+const (
+	principalTagAttributePrefix = "https://aws.amazon.com/SAML/Attributes/PrincipalTag:"
+	transitiveTagKeysAttribute  = "https://aws.amazon.com/SAML/Attributes/TransitiveTagKeys"
+)
+
+// ExtractPrincipalTags given an assertion document extract the session tags passed to AWS as principal tags
+// see https://docs.aws.amazon.com/IAM/latest/UserGuide/id_session-tags.html#id_session-tags_adding-assume-role-saml
+func ExtractPrincipalTags(data []byte) (map[string]string, error) {
+
+	tags := map[string]string{}
+
+	err := eachAttribute(data, func(name string, values []string) {
+		if !strings.HasPrefix(name, principalTagAttributePrefix) || len(values) == 0 {
+			return
+		}
+		tags[strings.TrimPrefix(name, principalTagAttributePrefix)] = values[0]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ExtractTransitiveTagKeys given an assertion document extract the session tag keys the IdP marked as transitive
+func ExtractTransitiveTagKeys(data []byte) ([]string, error) {
+
+	keys := []string{}
+
+	err := eachAttribute(data, func(name string, values []string) {
+		if name == transitiveTagKeysAttribute {
+			keys = append(keys, values...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ValidateTransitiveTagKeys verify each of the required keys is a principal tag in the assertion which the IdP has
+// also marked as transitive, otherwise the tag won't survive assuming roles from the resulting session
+func ValidateTransitiveTagKeys(data []byte, requiredKeys []string) error {
+	if len(requiredKeys) == 0 {
+		return nil
+	}
+
+	tags, err := ExtractPrincipalTags(data)
+	if err != nil {
+		return errors.Wrap(err, "error extracting principal tags")
+	}
+
+	transitiveKeys, err := ExtractTransitiveTagKeys(data)
+	if err != nil {
+		return errors.Wrap(err, "error extracting transitive tag keys")
+	}
+
+	tagKeys := make([]string, 0, len(tags))
+	for key := range tags {
+		tagKeys = append(tagKeys, key)
+	}
+
+	for _, key := range requiredKeys {
+		if !containsTagKey(tagKeys, key) {
+			return errors.Errorf("transitive tag key %s is not a principal tag in the SAML assertion", key)
+		}
+
+		if !containsTagKey(transitiveKeys, key) {
+			return errors.Errorf("principal tag %s is not marked as transitive in the SAML assertion", key)
+		}
+	}
+
+	return nil
+}
+
+// containsTagKey session tag keys are case insensitive in AWS
+func containsTagKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func eachAttribute(data []byte, fn func(name string, values []string)) error {
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return err
+	}
+
+	assertionElement := doc.FindElement(".//Assertion")
+	if assertionElement == nil {
+		return ErrMissingAssertion
+	}
+
+	attributeStatement := assertionElement.FindElement(childPath(assertionElement.Space, attributeStatementTag))
+	if attributeStatement == nil {
+		return ErrMissingElement{Tag: attributeStatementTag}
+	}
+
+	for _, attribute := range attributeStatement.FindElements(childPath(assertionElement.Space, attributeTag)) {
+		var values []string
+		for _, attrValue := range attribute.FindElements(childPath(assertionElement.Space, attributeValueTag)) {
+			values = append(values, attrValue.Text())
+		}
+		fn(attribute.SelectAttrValue("Name", ""), values)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package saml2aws
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractPrincipalTags(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_tags.xml")
+	assert.Nil(t, err)
+
+	tags, err := ExtractPrincipalTags(data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"Project": "Automation", "CostCenter": "987654", "Department": "Engineering"}, tags)
+
+	keys, err := ExtractTransitiveTagKeys(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Project", "CostCenter"}, keys)
+}
+
+func TestExtractPrincipalTagsMissing(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion.xml")
+	assert.Nil(t, err)
+
+	tags, err := ExtractPrincipalTags(data)
+	assert.Nil(t, err)
+	assert.Empty(t, tags)
+
+	keys, err := ExtractTransitiveTagKeys(data)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestValidateTransitiveTagKeys(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/assertion_tags.xml")
+	assert.Nil(t, err)
+
+	assert.Nil(t, ValidateTransitiveTagKeys(data, nil))
+	assert.Nil(t, ValidateTransitiveTagKeys(data, []string{"Project", "costcenter"}))
+
+	// a principal tag which the IdP didn't mark as transitive
+	err = ValidateTransitiveTagKeys(data, []string{"Project", "Department"})
+	assert.EqualError(t, err, "principal tag Department is not marked as transitive in the SAML assertion")
+
+	err = ValidateTransitiveTagKeys(data, []string{"Team"})
+	assert.EqualError(t, err, "transitive tag key Team is not a principal tag in the SAML assertion")
+}